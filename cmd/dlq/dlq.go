@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"tp1/internal/dlq"
+	"tp1/pkg/logs"
+)
+
+const usage = `Usage:
+  dlq inspect <queue>         Lists the messages in a dead-letter queue, leaving them in place.
+  dlq replay [-n N] <queue>   Sends up to N messages (all by default) back to their original queue.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	replayFlags := flag.NewFlagSet("replay", flag.ExitOnError)
+	limit := replayFlags.Int("n", 0, "maximum amount of messages to replay, 0 means all")
+
+	var queue string
+	switch cmd := os.Args[1]; cmd {
+	case "inspect":
+		if len(os.Args) != 3 {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		queue = os.Args[2]
+	case "replay":
+		_ = replayFlags.Parse(os.Args[2:])
+		if replayFlags.NArg() != 1 {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		queue = replayFlags.Arg(0)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n%s", cmd, usage)
+		os.Exit(2)
+	}
+
+	inspector, err := dlq.New()
+	if err != nil {
+		logs.Logger.Errorf("Failed to connect to broker: %s", err.Error())
+		os.Exit(1)
+	}
+	defer inspector.Close()
+
+	if os.Args[1] == "inspect" {
+		count, err := inspector.Inspect(queue, os.Stdout)
+		if err != nil {
+			logs.Logger.Errorf("Failed to inspect %s: %s", queue, err.Error())
+			return
+		}
+		logs.Logger.Infof("%d messages in %s", count, queue)
+		return
+	}
+
+	count, err := inspector.Replay(queue, *limit)
+	if err != nil {
+		logs.Logger.Errorf("Failed to replay %s: %s", queue, err.Error())
+	}
+	logs.Logger.Infof("Replayed %d messages from %s", count, queue)
+}
@@ -20,7 +20,7 @@ func main() {
 		logs.Logger.Errorf("Failed to create new gateway: %s", err.Error())
 		return
 	}
-	err = logs.InitLogger(g.Config.String("gateway.log_level", "INFO"))
+	err = logs.Init(g.Config.String("gateway.log_level", "INFO"), g.Config.String("gateway.log_format", logs.TextFormat))
 	if err != nil {
 		logs.Logger.Errorf("Failed to create new gateway: %s", err.Error())
 		return
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"tp1/pkg/logs"
+	"tp1/pkg/recovery"
+)
+
+const usage = `Usage:
+  recovery dump [-body] <file>   Prints the records of a recovery log, including their message bodies if -body is set.
+`
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "dump" {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	dumpFlags := flag.NewFlagSet("dump", flag.ExitOnError)
+	body := dumpFlags.Bool("body", false, "print message bodies")
+	_ = dumpFlags.Parse(os.Args[2:])
+	if dumpFlags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	path := dumpFlags.Arg(0)
+	count, err := recovery.Dump(path, os.Stdout, *body)
+	if err != nil {
+		logs.Logger.Errorf("Failed to dump %s: %s", path, err.Error())
+		os.Exit(1)
+	}
+	logs.Logger.Infof("%d records in %s", count, path)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"tp1/internal/topology"
+	"tp1/pkg/logs"
+)
+
+const usage = `Usage:
+  topology generate [-out DIR] <file>   Generates the worker configs, the gateway config and the compose file of a
+                                        topology under DIR (the current directory by default).
+  topology validate [-dir DIR]          Checks the queue wiring of the worker configs, the gateway config and the
+                                        compose file under DIR (the current directory by default).
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch cmd := os.Args[1]; cmd {
+	case "generate":
+		generate(os.Args[2:])
+	case "validate":
+		validate(os.Args[2:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n%s", cmd, usage)
+		os.Exit(2)
+	}
+}
+
+func generate(args []string) {
+	generateFlags := flag.NewFlagSet("generate", flag.ExitOnError)
+	out := generateFlags.String("out", ".", "directory the files are generated under")
+	_ = generateFlags.Parse(args)
+	if generateFlags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	path := generateFlags.Arg(0)
+	t, err := topology.Load(path)
+	if err != nil {
+		logs.Logger.Errorf("Invalid topology %s:\n%s", path, err.Error())
+		os.Exit(1)
+	}
+
+	files, err := t.Generate(*out)
+	if err != nil {
+		logs.Logger.Errorf("Failed to generate files: %s", err.Error())
+		os.Exit(1)
+	}
+	for _, file := range files {
+		logs.Logger.Infof("Generated %s", file)
+	}
+}
+
+func validate(args []string) {
+	validateFlags := flag.NewFlagSet("validate", flag.ExitOnError)
+	dir := validateFlags.String("dir", ".", "directory holding the configs directory and the compose file")
+	_ = validateFlags.Parse(args)
+	if validateFlags.NArg() != 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	w, err := topology.LoadWiring(*dir)
+	if err != nil {
+		logs.Logger.Errorf("Failed to load configs: %s", err.Error())
+		os.Exit(1)
+	}
+
+	if err = w.Validate(); err != nil {
+		logs.Logger.Errorf("Invalid wiring:\n%s", err.Error())
+		os.Exit(1)
+	}
+	logs.Logger.Infof("Wiring is valid")
+}
@@ -4,13 +4,13 @@ go 1.23.0
 
 require (
 	github.com/op/go-logging v0.0.0-20160315200505-970db520ece7
+	github.com/pemistahl/lingua-go v1.4.0
 	github.com/pierrec/xxHash v0.1.5
 	github.com/spf13/viper v1.19.0
 	github.com/stretchr/testify v1.9.0
 )
 
 require (
-	github.com/pemistahl/lingua-go v1.4.0 // indirect
 	github.com/shopspring/decimal v1.3.1 // indirect
 	google.golang.org/protobuf v1.33.0 // indirect
 )
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"tp1/pkg/protocol"
+)
+
+const (
+	checkpointKey = "client.checkpoint_path"
+	checkpointDef = "checkpoint.json"
+)
+
+// checkpoint is the progress of a client, saved after every ack so that a restarted client resumes its session
+// instead of starting over. It is removed once the client gets every result.
+type checkpoint struct {
+	path     string
+	ClientId string                                 `json:"client-id"`
+	Owner    string                                 `json:"owner"`
+	Streams  [protocol.DataStreams]streamCheckpoint `json:"streams"`
+	Results  []string                               `json:"results"` // Results are the prefixes of the results stored.
+}
+
+// streamCheckpoint is where a stream resumes from: the next batch to send, and the offset in the file it starts at.
+type streamCheckpoint struct {
+	Next   uint32 `json:"next"`
+	Offset int64  `json:"offset"`
+	Done   bool   `json:"done"`
+}
+
+// loadCheckpoint reads the checkpoint saved at path. It is empty if there is none.
+func loadCheckpoint(path string) (*checkpoint, error) {
+	cp := &checkpoint{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cp, json.Unmarshal(data, cp)
+}
+
+// save writes the checkpoint.
+func (cp *checkpoint) save() error {
+	data, err := json.Marshal(cp)
+	if err != nil {
+		return err
+	}
+	return writeAtomically(cp.path, data)
+}
+
+// writeAtomically writes data to a temporary file, which then replaces the one at path, so that a crash leaves
+// either of them whole.
+func writeAtomically(path string, data []byte) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(data); err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (cp *checkpoint) remove() error {
+	if err := os.Remove(cp.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
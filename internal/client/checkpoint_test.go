@@ -0,0 +1,30 @@
+package client
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckpointIsSavedAndRemoved(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	cp, err := loadCheckpoint(path)
+	require.NoError(t, err)
+	assert.Empty(t, cp.ClientId)
+
+	cp.ClientId, cp.Owner = "1-3", "gateway-2"
+	cp.Streams[1] = streamCheckpoint{Next: 4, Offset: 1024}
+	cp.Results = []string{"Q1"}
+	require.NoError(t, cp.save())
+
+	loaded, err := loadCheckpoint(path)
+	require.NoError(t, err)
+	assert.Equal(t, cp, loaded)
+
+	require.NoError(t, cp.remove())
+	loaded, err = loadCheckpoint(path)
+	require.NoError(t, err)
+	assert.Empty(t, loaded.ClientId)
+}
@@ -11,6 +11,7 @@ import (
 	"tp1/pkg/config/provider"
 	"tp1/pkg/logs"
 	"tp1/pkg/message"
+	"tp1/pkg/protocol"
 )
 
 const (
@@ -26,18 +27,27 @@ const (
 	gamesCsvPathDef   = "data/games.csv"
 	reviewsCsvPathKey = "client.reviews_path"
 	reviewsCsvPathDef = "data/reviews.csv"
+	logLevelKey       = "client.log_level"
+	logLevelDef       = "INFO"
+	logFormatKey      = "client.log_format"
 	csvsToSend        = 2
 	ackBytes          = 32
 )
 
 type Client struct {
-	cfg          config.Config
-	sigChan      chan os.Signal
-	stopped      bool
-	stoppedMutex sync.Mutex
-	resultsFile  *os.File
-	clientId     string
-	gatewayAddr  string
+	cfg           config.Config
+	sigChan       chan os.Signal
+	stopped       bool
+	stoppedMutex  sync.Mutex
+	resultsFile   *os.File
+	clientId      string
+	gateways      *gateways
+	log           *logs.Entry            // log attaches the client ID to records, once it gets assigned.
+	compressions  []protocol.Compression // compressions are the ones the client accepts for batches, by preference.
+	invalidPolicy string                 // invalidPolicy is how invalid rows are handled.
+	rejects       *rejects
+	resultsDir    string
+	results       map[string]message.Result // results are the ones received through sessions, by query.
 }
 
 func New() (*Client, error) {
@@ -45,119 +55,145 @@ func New() (*Client, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err = logs.Init(config.String(logLevelKey, logLevelDef), config.String(logFormatKey, logs.TextFormat)); err != nil {
+		return nil, err
+	}
+
+	invalidPolicy, err := parsePolicy(config.String(invalidRowsKey, invalidRowsDef))
+	if err != nil {
+		return nil, err
+	}
 
 	sigChan := make(chan os.Signal, signals)
 	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT)
 
 	return &Client{
-		cfg:          config,
-		sigChan:      sigChan,
-		stopped:      false,
-		stoppedMutex: sync.Mutex{},
+		cfg:           config,
+		sigChan:       sigChan,
+		stopped:       false,
+		stoppedMutex:  sync.Mutex{},
+		gateways:      newGateways(config),
+		invalidPolicy: invalidPolicy,
+		rejects:       &rejects{path: config.String(rejectsPathKey, rejectsPathDef)},
+		resultsDir:    config.String(resultsDirKey, resultsDirDef),
 	}, nil
 }
 
 func (c *Client) Start() {
-	logs.Logger.Info("Client running...")
+	c.log.Infof("Client running...")
+	defer c.rejects.close()
 	go func() {
 		<-c.sigChan
 		c.handleSigterm()
 	}()
 
+	if c.cfg.Bool(legacyKey, false) {
+		c.startLegacy()
+		return
+	}
+	c.startSession()
+}
+
+// startLegacy sends the data and receives the results through a connection to each of the old ports of the gateway.
+func (c *Client) startLegacy() {
 	wg := sync.WaitGroup{}
-	gatewayAddress := c.cfg.String(gatewayAddrKey, gatewayAddrDef)
 
-	err := c.fetchClientID(gatewayAddress)
+	err := c.fetchClientID()
 	if err != nil {
-		logs.Logger.Errorf("Error fetching client Id: %v", err)
+		c.log.Errorf("Error fetching client Id: %v", err)
 		return
 	}
 
-	err = c.openResultsFile()
+	err = c.openResultsFile(false)
 	if err != nil {
-		logs.Logger.Errorf("Error opening results file: %v", err)
+		c.log.Errorf("Error opening results file: %v", err)
 		return
 	}
 
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		c.startResultsListener(gatewayAddress)
+		c.startResultsListener()
 	}()
 
-	gamesFullAddress := c.getFullAddress(gatewayAddress, gamesPortKey, gamesPortDef)
-	reviewsFullAddress := c.getFullAddress(gatewayAddress, reviewsPortKey, reviewsPortDef)
+	gamesAddresses := c.gateways.addresses(c.cfg.String(gamesPortKey, gamesPortDef))
+	reviewsAddresses := c.gateways.addresses(c.cfg.String(reviewsPortKey, reviewsPortDef))
 
-	gamesConn, err := c.setupConnection(gamesFullAddress)
+	gamesConn, err := c.connect(gamesAddresses)
 	if err != nil {
 		return
 	}
 
-	reviewsConn, err := c.setupConnection(reviewsFullAddress)
+	reviewsConn, err := c.connect(reviewsAddresses)
 	if err != nil {
 		return
 	}
 
 	wg.Add(csvsToSend)
 
-	c.sendGames(&wg, gamesConn, gamesFullAddress)
-	c.sendReviews(&wg, reviewsConn, reviewsFullAddress)
+	c.sendGames(&wg, gamesConn, gamesAddresses)
+	c.sendReviews(&wg, reviewsConn, reviewsAddresses)
 
 	wg.Wait()
-	logs.Logger.Info("Client exit...")
+	c.log.Infof("Client exit...")
 	c.Close(gamesConn, reviewsConn)
 }
 
-func (c *Client) sendData(wg *sync.WaitGroup, conn net.Conn, pathKey string, pathDef string, id uint8, dataStruct interface{}, address string) {
+func (c *Client) sendData(wg *sync.WaitGroup, conn net.Conn, pathKey string, pathDef string, id uint8, dataStruct interface{}, addresses []string) {
 	go func() {
 		defer wg.Done()
 		defer conn.Close()
-		c.readAndSendCSV(c.cfg.String(pathKey, pathDef), id, conn, dataStruct, address)
+		c.readAndSend(c.cfg.String(pathKey, pathDef), id, conn, dataStruct, addresses)
 	}()
 }
 
-func (c *Client) sendGames(wg *sync.WaitGroup, gamesConn net.Conn, address string) {
-	c.sendData(wg, gamesConn, gamesCsvPathKey, gamesCsvPathDef, uint8(message.GameId), &message.DataCSVGames{}, address)
+func (c *Client) sendGames(wg *sync.WaitGroup, gamesConn net.Conn, addresses []string) {
+	c.sendData(wg, gamesConn, gamesCsvPathKey, gamesCsvPathDef, uint8(message.GameId), &message.DataCSVGames{}, addresses)
 }
 
-func (c *Client) sendReviews(wg *sync.WaitGroup, reviewsConn net.Conn, address string) {
-	c.sendData(wg, reviewsConn, reviewsCsvPathKey, reviewsCsvPathDef, uint8(message.ReviewId), &message.DataCSVReviews{}, address)
+func (c *Client) sendReviews(wg *sync.WaitGroup, reviewsConn net.Conn, addresses []string) {
+	c.sendData(wg, reviewsConn, reviewsCsvPathKey, reviewsCsvPathDef, uint8(message.ReviewId), &message.DataCSVReviews{}, addresses)
 }
 
-func (c *Client) getFullAddress(gatewayAddress, portKey, portDef string) string {
-	port := c.cfg.String(portKey, portDef)
-	return gatewayAddress + ":" + port
+// connect connects to the first of the addresses that accepts the connection.
+func (c *Client) connect(addresses []string) (net.Conn, error) {
+	var err error
+	for _, address := range addresses {
+		var conn net.Conn
+		if conn, err = c.setupConnection(address); err == nil {
+			return conn, nil
+		}
+		c.log.Errorf("Connection to %s failed: %v", address, err)
+	}
+	return nil, err
 }
 
-func (c *Client) reconnect(address string, timeout int) net.Conn {
-
-	var newConn net.Conn
+// reconnect connects to the first of the addresses that accepts the connection, retrying until one does.
+func (c *Client) reconnect(addresses []string, timeout int) net.Conn {
 	for {
-		conn, err := c.setupConnection(address)
+		conn, err := c.connect(addresses)
 		if err == nil {
-			logs.Logger.Infof("Reconnected successfully.")
-			newConn = conn
-			break
+			c.log.Infof("Reconnected successfully.")
+			return conn
 		}
-		logs.Logger.Errorf("Reconnect failed, retrying...")
+		c.log.Errorf("Reconnect failed, retrying...")
 		time.Sleep(time.Duration(timeout) * time.Second)
 	}
-	return newConn
 }
 
 func (c *Client) setupConnection(address string) (net.Conn, error) {
-	logs.Logger.Infof("Connecting to %s", address)
+	c.log.Infof("Connecting to %s", address)
 
 	conn, err := net.Dial(transportProtocol, address)
 	if err != nil {
 		return nil, err
 	}
 
-	logs.Logger.Infof("Connection established: %s", address)
+	c.log.Infof("Connection established: %s", address)
 
 	err = c.sendClientID(conn)
 	if err != nil {
-		logs.Logger.Errorf("Error sending client Id: %s", err)
+		c.log.Errorf("Error sending client Id: %s", err)
 		conn.Close()
 		return nil, err
 	}
@@ -1,13 +1,10 @@
 package client
 
 import (
-	"encoding/csv"
+	"errors"
 	"fmt"
 	"io"
 	"net"
-	"os"
-	"reflect"
-	"strconv"
 	"tp1/pkg/logs"
 	"tp1/pkg/message"
 )
@@ -19,143 +16,130 @@ const (
 	timeoutDefault   = 5
 )
 
-func (c *Client) readAndSendCSV(filename string, id uint8, conn net.Conn, dataStruct interface{}, address string) {
-	file, reader, err := c.openAndPrepareCSVFile(filename)
+func (c *Client) readAndSend(path string, id uint8, conn net.Conn, dataStruct interface{}, addresses []string) {
+	source, err := c.openSource(path)
 	if err != nil {
 		return
 	}
-	defer file.Close()
+	defer source.Close()
 
 	timeout := c.cfg.Int(timeoutKey, timeoutDefault)
 	batchSize := c.cfg.Int(chunkSizeKey, chunkSizeDefault)
 
-	batchProcessor := &csvBatchProcessor{
+	batchProcessor := &batchProcessor{
 		client:     c,
-		file:       file,
-		reader:     reader,
+		log:        c.log.With(logs.MessageId, id),
+		source:     source,
+		invalid:    c.invalidRows(path),
 		conn:       conn,
 		id:         id,
 		dataStruct: dataStruct,
 		batchSize:  batchSize,
-		address:    address,
+		addresses:  addresses,
 		timeout:    timeout,
 	}
 
-	batchProcessor.processCSVBatches()
+	batchProcessor.processBatches()
+	batchProcessor.report()
 }
 
-type csvBatchProcessor struct {
+type batchProcessor struct {
 	client     *Client
-	file       *os.File
-	reader     *csv.Reader
+	log        *logs.Entry
+	source     Source
 	conn       net.Conn
 	id         uint8
 	dataStruct interface{}
 	batchSize  int
-	address    string
+	addresses  []string // addresses are the ones of every gateway, starting with the owner.
 	timeout    int
+	invalid    invalidRows
+	scanned    int64 // scanned is the furthest offset read, so that invalid rows read again are not handled twice.
 }
 
-func (p *csvBatchProcessor) processCSVBatches() {
-	var batchStartLine int
+func (p *batchProcessor) processBatches() {
+	batchStart := p.source.Offset()
 	currentBatch := uint32(0)
 
 	for {
-		currentLine, err := p.sendBatch(batchStartLine, currentBatch)
+		err := p.sendBatch(currentBatch)
+		if errors.Is(err, errAborted) {
+			p.log.Errorf("Stopped sending data: %s", err)
+			return
+		}
 		if err == io.EOF {
-			if err := p.handleFinalBatch(currentBatch); err != nil {
+			if err := p.handleFinalBatch(currentBatch, batchStart); err != nil {
 				continue
 			}
 			break
 		}
 		if err != nil {
-			logs.Logger.Errorf("Error sending data: %s", err)
-			p.rewindAndReconnect(batchStartLine)
+			p.log.Errorf("Error sending data: %s", err)
+			p.rewindAndReconnect(batchStart)
 			continue
 		}
 
 		if err := readAck(p.conn); err != nil {
-			logs.Logger.Errorf("ACK error: %s", err)
-			p.rewindAndReconnect(batchStartLine)
+			p.log.Errorf("ACK error: %s", err)
+			p.rewindAndReconnect(batchStart)
 			continue
 		}
 
 		currentBatch++
-		batchStartLine = currentLine
+		batchStart = p.source.Offset()
 	}
 
-	logs.Logger.Infof("Received EOF ACK for: %v", p.id)
+	p.log.Infof("Received EOF ACK")
 }
 
-func (p *csvBatchProcessor) sendBatch(startLine int, currentBatch uint32) (int, error) {
-	lineCount := startLine
-	for lineCount < startLine+p.batchSize {
-		record, err := p.reader.Read()
-		if err == io.EOF {
-			return lineCount, err
-		}
-		if err != nil {
-			return lineCount, fmt.Errorf("error reading CSV: %w", err)
-		}
-
-		if err := p.populateDataStruct(record); err != nil {
-			logs.Logger.Errorf("Error populating data struct: %s", err)
-			continue
+func (p *batchProcessor) sendBatch(currentBatch uint32) error {
+	for sent := 0; sent < p.batchSize; sent++ {
+		if err := p.next(); err != nil {
+			return err
 		}
 
 		if err := p.sendMessage(currentBatch); err != nil {
-			return lineCount, err
+			return err
 		}
-
-		lineCount++
 	}
-	return lineCount, nil
+	return nil
 }
 
-func (p *csvBatchProcessor) populateDataStruct(record []string) error {
-	v := reflect.ValueOf(p.dataStruct).Elem()
-	for i := 0; i < v.NumField(); i++ {
-		if i < len(record) {
-			field := v.Field(i)
-			if err := setFieldValue(field, record[i]); err != nil {
+// next reads the next valid record into dataStruct. Invalid ones are handled as the policy says, once even if read
+// again after a rewind.
+func (p *batchProcessor) next() error {
+	for {
+		offset := p.source.Offset()
+		err := p.source.Read(p.dataStruct)
+		if err == nil {
+			if err = validate(p.dataStruct); err != nil {
+				err = &RowError{Offset: offset, Err: err}
+			}
+		}
+
+		var rowErr *RowError
+		seen := errors.As(err, &rowErr) && rowErr.Offset < p.scanned
+		p.scanned = max(p.scanned, p.source.Offset())
+		if rowErr == nil {
+			return err
+		}
+		if !seen {
+			if err = p.invalid.add(rowErr, p.source.Raw()); err != nil {
 				return err
 			}
 		}
 	}
-	return nil
 }
 
-func setFieldValue(field reflect.Value, value string) error {
-	switch field.Kind() {
-	case reflect.String:
-		field.SetString(value)
-	case reflect.Int64:
-		intVal, err := strconv.ParseInt(value, 10, 64)
-		if err == nil {
-			field.SetInt(intVal)
-		}
-	case reflect.Int:
-		intVal, err := strconv.Atoi(value)
-		if err == nil {
-			field.SetInt(int64(intVal))
-		}
-	case reflect.Float64:
-		floatVal, err := strconv.ParseFloat(value, 64)
-		if err == nil {
-			field.SetFloat(floatVal)
-		}
-	case reflect.Bool:
-		boolVal, err := strconv.ParseBool(value)
-		if err == nil {
-			field.SetBool(boolVal)
-		}
-	default:
-		logs.Logger.Infof("Unsupported type: %s", field.Kind())
+// report logs the invalid rows of the source, if any.
+func (p *batchProcessor) report() {
+	if report := p.invalid.report(); report != "" {
+		p.log.Warningf("%s", report)
 	}
-	return nil
 }
 
-func (p *csvBatchProcessor) sendMessage(currentBatch uint32) error {
+// encode returns the record last read, as sent to the gateway.
+func (p *batchProcessor) encode() ([]byte, error) {
 	var dataBuf []byte
 	var err error
 
@@ -166,7 +150,15 @@ func (p *csvBatchProcessor) sendMessage(currentBatch uint32) error {
 	}
 
 	if err != nil {
-		return fmt.Errorf("error id data: %w", err)
+		return nil, fmt.Errorf("error id data: %w", err)
+	}
+	return dataBuf, nil
+}
+
+func (p *batchProcessor) sendMessage(currentBatch uint32) error {
+	dataBuf, err := p.encode()
+	if err != nil {
+		return err
 	}
 
 	msg := message.ClientMessage{
@@ -178,7 +170,7 @@ func (p *csvBatchProcessor) sendMessage(currentBatch uint32) error {
 	return message.SendMessage(p.conn, msg)
 }
 
-func (p *csvBatchProcessor) handleFinalBatch(currentBatch uint32) error {
+func (p *batchProcessor) handleFinalBatch(currentBatch uint32, batchStart int64) error {
 	eofMsg := message.ClientMessage{
 		BatchNum: currentBatch,
 		DataLen:  0,
@@ -186,54 +178,43 @@ func (p *csvBatchProcessor) handleFinalBatch(currentBatch uint32) error {
 	}
 
 	if err := message.SendMessage(p.conn, eofMsg); err != nil {
-		logs.Logger.Errorf("Error sending EOF message: %s", err)
-		p.rewindAndReconnect(0)
+		p.log.Errorf("Error sending EOF message: %s", err)
+		p.rewindAndReconnect(batchStart)
 		return err
 	}
 
 	if err := readAck(p.conn); err != nil {
-		logs.Logger.Errorf("Error reading final ACK: %s", err)
-		p.rewindAndReconnect(0)
+		p.log.Errorf("Error reading final ACK: %s", err)
+		p.rewindAndReconnect(batchStart)
 		return err
 	}
 
 	return nil
 }
 
-func (p *csvBatchProcessor) rewindAndReconnect(batchStartLine int) {
-	rewindReader(p.file, &p.reader, batchStartLine)
-	p.conn = p.client.reconnect(p.address, p.timeout)
-}
-
-func (c *Client) openAndPrepareCSVFile(filename string) (*os.File, *csv.Reader, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		logs.Logger.Errorf("Error opening CSV file: %s", err)
-		return nil, nil, err
+// rewindAndReconnect moves the source back to the start of the batch not acknowledged, to send it again once
+// reconnected.
+func (p *batchProcessor) rewindAndReconnect(batchStart int64) {
+	if err := p.source.SeekTo(batchStart); err != nil {
+		p.log.Errorf("Error rewinding source: %s", err)
 	}
+	p.conn = p.client.reconnect(p.addresses, p.timeout)
+}
 
-	reader := csv.NewReader(file)
-
-	if _, err = reader.Read(); err != nil {
-		file.Close()
-		if err == io.EOF {
-			logs.Logger.Error("CSV file is empty.")
-			return nil, nil, err
-		}
-		logs.Logger.Errorf("Error reading CSV file: %s", err)
-		return nil, nil, err
+// invalidRows returns the handling of the invalid rows of the source at path, as configured.
+func (c *Client) invalidRows(path string) invalidRows {
+	r := invalidRows{policy: c.invalidPolicy, path: path}
+	if r.policy == rejectRows {
+		r.rejects = c.rejects
 	}
-
-	return file, reader, nil
+	return r
 }
 
-func rewindReader(file *os.File, reader **csv.Reader, batchStartLine int) {
-	file.Seek(0, io.SeekStart)
-	*reader = csv.NewReader(file)
-
-	_, _ = (*reader).Read()
-
-	for i := 0; i < batchStartLine; i++ {
-		_, _ = (*reader).Read()
+func (c *Client) openSource(path string) (Source, error) {
+	source, err := NewSource(path)
+	if err != nil {
+		c.log.Errorf("Error opening %s: %s", path, err)
+		return nil, err
 	}
+	return source, nil
 }
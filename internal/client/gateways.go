@@ -0,0 +1,60 @@
+package client
+
+import (
+	"math/rand/v2"
+	"tp1/pkg/config"
+)
+
+const gatewayAddrsKey = "gateway.addresses"
+
+// gateways are the hosts of the gateways a client can connect to. The client gets its ID from one of them, tried
+// from a random one so that clients get balanced across gateways, which owns the client from then on. Results are
+// received only from the owner, since they are routed to its reports queue and recovered from its log. Data can be
+// sent through any gateway, since chunks are identified by the client, so data connections fail over to the other
+// gateways while the owner is down.
+type gateways struct {
+	hosts []string
+	owner int
+}
+
+// newGateways reads the hosts from `gateway.addresses`, or from `gateway.address` if there is a single gateway.
+func newGateways(cfg config.Config) *gateways {
+	hosts := cfg.StringSlice(gatewayAddrsKey, nil)
+	if len(hosts) == 0 {
+		hosts = []string{cfg.String(gatewayAddrKey, gatewayAddrDef)}
+	}
+	return &gateways{hosts: hosts, owner: rand.IntN(len(hosts))}
+}
+
+// addresses returns the address of every gateway at the given port, starting with the owner.
+func (g *gateways) addresses(port string) []string {
+	addresses := make([]string, 0, len(g.hosts))
+	for i := range g.hosts {
+		addresses = append(addresses, g.hosts[(g.owner+i)%len(g.hosts)]+":"+port)
+	}
+	return addresses
+}
+
+// ownerAddress returns the address of the owner at the given port.
+func (g *gateways) ownerAddress(port string) string {
+	return g.hosts[g.owner] + ":" + port
+}
+
+// own makes the i-th of the addresses returned last the owner.
+func (g *gateways) own(i int) {
+	g.owner = (g.owner + i) % len(g.hosts)
+}
+
+// ownerHost returns the host of the owner.
+func (g *gateways) ownerHost() string {
+	return g.hosts[g.owner]
+}
+
+// restore makes the given host the owner, if it is one of the gateways.
+func (g *gateways) restore(host string) {
+	for i, h := range g.hosts {
+		if h == host {
+			g.owner = i
+		}
+	}
+}
@@ -0,0 +1,16 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddressesStartWithTheOwner(t *testing.T) {
+	g := &gateways{hosts: []string{"gateway-1", "gateway-2", "gateway-3"}, owner: 1}
+	assert.Equal(t, []string{"gateway-2:5051", "gateway-3:5051", "gateway-1:5051"}, g.addresses("5051"))
+
+	g.own(2)
+	assert.Equal(t, "gateway-1:5052", g.ownerAddress("5052"))
+	assert.Equal(t, []string{"gateway-1:5050", "gateway-2:5050", "gateway-3:5050"}, g.addresses("5050"))
+}
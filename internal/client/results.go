@@ -0,0 +1,74 @@
+package client
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"tp1/pkg/message"
+)
+
+const (
+	resultsDirKey = "client.results_dir"
+	resultsDirDef = "/app/data"
+)
+
+// resultsPath returns the path of a file of results of the client, named after its ID and the given suffix.
+func (c *Client) resultsPath(suffix string) string {
+	return filepath.Join(c.resultsDir, fmt.Sprintf("results_%s%s", c.clientId, suffix))
+}
+
+// loadResults reads the results stored in JSON by a previous run, so that the ones received from now on are added to
+// them. There are none if the file does not exist.
+func (c *Client) loadResults() error {
+	c.results = make(map[string]message.Result)
+	data, err := os.ReadFile(c.resultsPath(".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &c.results)
+}
+
+// storeQueryResult writes a result received through a session to the results file, as text, and to the JSON and CSV
+// files, unless one of the same query was received already. Returns whether it was written.
+func (c *Client) storeQueryResult(r message.Result, received map[string]bool) bool {
+	if received[r.Name()] {
+		c.log.Infof("Duplicate result of %s received, skipping.", r.Name())
+		return false
+	}
+
+	c.writeDataToFile(r.String())
+	if err := c.writeStructured(r); err != nil {
+		c.log.Errorf("Error writing structured result of %s: %v", r.Name(), err)
+	}
+	received[r.Name()] = true
+	return true
+}
+
+// writeStructured writes the results received so far to a JSON file, keyed by query, and the given one to a CSV file
+// of its own, since each query has different columns.
+func (c *Client) writeStructured(r message.Result) error {
+	if c.results == nil {
+		c.results = make(map[string]message.Result)
+	}
+	c.results[r.Name()] = r
+	data, err := json.MarshalIndent(c.results, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = writeAtomically(c.resultsPath(".json"), data); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err = csv.NewWriter(&buf).WriteAll(r.Records()); err != nil {
+		return err
+	}
+	return writeAtomically(c.resultsPath("_"+r.Name()+".csv"), buf.Bytes())
+}
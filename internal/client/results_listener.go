@@ -3,7 +3,6 @@ package client
 import (
 	"encoding/binary"
 	"net"
-	"tp1/pkg/logs"
 	"tp1/pkg/utils/io"
 )
 
@@ -17,19 +16,20 @@ const (
 	ResultPrefixSize   = 2
 )
 
-func (c *Client) startResultsListener(address string) {
-	resultsPort := c.cfg.String(resultsPortKey, resultsPortDefault)
-	resultsFullAddress := address + ":" + resultsPort
+// startResultsListener receives the results from the gateway that owns the client, which is the only one they are
+// sent through.
+func (c *Client) startResultsListener() {
+	resultsFullAddress := c.gateways.ownerAddress(c.cfg.String(resultsPortKey, resultsPortDefault))
 
 	resultsConn, err := net.Dial(transportProtocol, resultsFullAddress)
 	if err != nil {
-		logs.Logger.Errorf("Initial connection to %s failed: %v", resultsFullAddress, err)
+		c.log.Errorf("Initial connection to %s failed: %v", resultsFullAddress, err)
 		return
 	}
 
 	err = c.sendClientID(resultsConn)
 	if err != nil {
-		logs.Logger.Errorf("Error sending client ID: %s", err)
+		c.log.Errorf("Error sending client ID: %s", err)
 		resultsConn.Close()
 
 	}
@@ -40,7 +40,7 @@ func (c *Client) startResultsListener(address string) {
 		}
 	}()
 
-	logs.Logger.Infof("Connected to results on: %s", resultsFullAddress)
+	c.log.Infof("Connected to results on: %s", resultsFullAddress)
 
 	messageCount := 0
 	maxMessages := c.cfg.Int(maxMsgKey, maxMsgDefault)
@@ -55,7 +55,7 @@ func (c *Client) readResults(resultsConn net.Conn, messageCount int, maxMessages
 		c.stoppedMutex.Lock()
 		if c.stopped {
 			c.stoppedMutex.Unlock()
-			logs.Logger.Info("Shutting down results listener due to stopped signal.")
+			c.log.Infof("Shutting down results listener due to stopped signal.")
 			return
 		}
 		c.stoppedMutex.Unlock()
@@ -64,8 +64,8 @@ func (c *Client) readResults(resultsConn net.Conn, messageCount int, maxMessages
 		lenBuffer := make([]byte, LenFieldSize)
 		err := io.ReadFull(resultsConn, lenBuffer, LenFieldSize)
 		if err != nil {
-			logs.Logger.Errorf("Error reading length of message: %v", err)
-			resultsConn = c.reconnect(resultsFullAddress, timeout)
+			c.log.Errorf("Error reading length of message: %v", err)
+			resultsConn = c.reconnect([]string{resultsFullAddress}, timeout)
 			continue
 		}
 
@@ -74,38 +74,47 @@ func (c *Client) readResults(resultsConn net.Conn, messageCount int, maxMessages
 		payload := make([]byte, dataLen)
 		err = io.ReadFull(resultsConn, payload, int(dataLen))
 		if err != nil {
-			logs.Logger.Errorf("Error reading payload: %v", err)
-			resultsConn = c.reconnect(resultsFullAddress, timeout)
+			c.log.Errorf("Error reading payload: %v", err)
+			resultsConn = c.reconnect([]string{resultsFullAddress}, timeout)
 			continue
 		}
 
 		receivedData := string(payload)
-		prefix := receivedData[:ResultPrefixSize]
 
 		_, err = resultsConn.Write([]byte{0x01})
 		if err != nil {
-			logs.Logger.Errorf("Error sending result ack: %v", err)
-			resultsConn = c.reconnect(resultsFullAddress, timeout)
+			c.log.Errorf("Error sending result ack: %v", err)
+			resultsConn = c.reconnect([]string{resultsFullAddress}, timeout)
 			continue
 		}
 
-		if received, exists := receivedMap[prefix]; !exists || !received {
-			c.writeDataToFile(receivedData)
-			receivedMap[prefix] = true
+		if c.storeResult(receivedData, receivedMap) {
 			messageCount++
-		} else {
-			logs.Logger.Infof("Duplicate prefix %s received, skipping.", prefix)
 		}
 
 		if messageCount >= maxMessages {
-			logs.Logger.Infof("All queries (%d) processed. Exiting listener.", maxMessages)
+			c.log.Infof("All queries (%d) processed. Exiting listener.", maxMessages)
 			return
 		}
 	}
 }
 
+// storeResult writes a result to the results file, unless one of the same query was received already. Returns
+// whether it was written.
+func (c *Client) storeResult(receivedData string, receivedMap map[string]bool) bool {
+	prefix := receivedData[:ResultPrefixSize]
+	if received, exists := receivedMap[prefix]; exists && received {
+		c.log.Infof("Duplicate prefix %s received, skipping.", prefix)
+		return false
+	}
+
+	c.writeDataToFile(receivedData)
+	receivedMap[prefix] = true
+	return true
+}
+
 func (c *Client) writeDataToFile(receivedData string) {
 	if _, err := c.resultsFile.WriteString(receivedData + "\n\n"); err != nil {
-		logs.Logger.Errorf("Error writing to results.txt: %v", err)
+		c.log.Errorf("Error writing to results.txt: %v", err)
 	}
 }
@@ -0,0 +1,42 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tp1/pkg/message"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryResultsAreWrittenAsTextJSONAndCSV(t *testing.T) {
+	dir := t.TempDir()
+	c := &Client{clientId: "0-1", resultsDir: dir}
+	require.NoError(t, c.openResultsFile(false))
+	received := make(map[string]bool)
+
+	platforms := message.Result{Query: message.Query1, Platforms: &message.Platform{Windows: 10, Linux: 3, Mac: 5}}
+	assert.True(t, c.storeQueryResult(platforms, received))
+	assert.False(t, c.storeQueryResult(platforms, received), "a duplicate result is not written again")
+	c.resultsFile.Close()
+
+	text, err := os.ReadFile(filepath.Join(dir, "results_0-1.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "Q1:\nWindows: [10], Linux: [3], Mac: [5]\n\n", string(text))
+
+	csv, err := os.ReadFile(filepath.Join(dir, "results_0-1_Q1.csv"))
+	require.NoError(t, err)
+	assert.Equal(t, "windows,linux,mac\n10,3,5\n", string(csv))
+
+	// A resumed client keeps the results stored before.
+	resumed := &Client{clientId: "0-1", resultsDir: dir}
+	require.NoError(t, resumed.openResultsFile(true))
+	defer resumed.resultsFile.Close()
+	games := message.Result{Query: message.Query4, Games: message.GameNames{{GameId: 20, GameName: "Dota 2"}}}
+	assert.True(t, resumed.storeQueryResult(games, map[string]bool{"Q1": true}))
+
+	require.NoError(t, resumed.loadResults())
+	assert.Equal(t, map[string]message.Result{"Q1": platforms, "Q4": games}, resumed.results)
+}
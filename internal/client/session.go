@@ -0,0 +1,424 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+	"tp1/pkg/logs"
+	"tp1/pkg/message"
+	"tp1/pkg/protocol"
+)
+
+const (
+	legacyKey      = "gateway.legacy"
+	sessionPortKey = "gateway.port"
+	sessionPortDef = "5054"
+	compressionKey = "client.compression"
+	compressionDef = "gzip"
+)
+
+// stream is a source sent as batches through sessions. A batch is kept until it gets acknowledged, so that it is
+// sent again if the session breaks.
+type stream struct {
+	batches *batchProcessor
+	frame   protocol.Type
+	num     uint32          // num is the number of the batch being sent.
+	offset  int64           // offset is where the batch being sent starts in the file.
+	end     int64           // end is where the pending batch ends in the file.
+	pending *protocol.Batch // pending is the batch being sent, once read.
+	sent    bool            // sent tells whether the pending batch was sent through the current session.
+	eof     bool            // eof tells whether the pending batch is the last one.
+	done    bool            // done is set once the last batch is acknowledged.
+}
+
+// startSession sends the data and receives the results through a single connection to the gateway, speaking the
+// multiplexed protocol. If the connection breaks, the client opens a new session with its ID and resumes from the
+// batches the gateway tells it: to any gateway while it sends data, and to the one that owns it afterward, since
+// results are only sent through the owner. Its progress is saved to a checkpoint, so that it resumes too if the
+// client restarts.
+func (c *Client) startSession() {
+	port := c.cfg.String(sessionPortKey, sessionPortDef)
+	timeout := time.Duration(c.cfg.Int(timeoutKey, timeoutDefault)) * time.Second
+
+	compression, err := protocol.ParseCompression(c.cfg.String(compressionKey, compressionDef))
+	if err != nil {
+		c.log.Errorf("Error reading compression: %s", err)
+		return
+	}
+	c.compressions = []protocol.Compression{compression}
+	if compression != protocol.NoCompression {
+		c.compressions = append(c.compressions, protocol.NoCompression)
+	}
+
+	cp, err := loadCheckpoint(c.cfg.String(checkpointKey, checkpointDef))
+	if err != nil {
+		c.log.Errorf("Error loading checkpoint: %s", err)
+		return
+	}
+	if cp.ClientId != "" {
+		c.clientId = cp.ClientId
+		c.log = logs.With(logs.ClientId, c.clientId)
+		c.gateways.restore(cp.Owner)
+		if err = c.openResultsFile(true); err != nil {
+			return
+		}
+		c.log.Infof("Resuming from checkpoint")
+	}
+
+	var conn net.Conn
+	var owner bool // owner tells whether the session is with the gateway that owns the client.
+	var streams []*stream
+	received := make(map[string]bool)
+	for _, prefix := range cp.Results {
+		received[prefix] = true
+	}
+	maxMessages := c.cfg.Int(maxMsgKey, maxMsgDefault)
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+		for _, s := range streams {
+			s.batches.source.Close()
+			s.batches.report()
+		}
+		if c.resultsFile != nil {
+			c.resultsFile.Close()
+		}
+	}()
+
+	for !c.isStopped() {
+		dataDone := streams != nil && streams[0].done && streams[1].done
+		if dataDone && len(received) >= maxMessages {
+			c.log.Infof("All queries (%d) processed. Exiting.", maxMessages)
+			if err = cp.remove(); err != nil {
+				c.log.Errorf("Error removing checkpoint: %s", err)
+			}
+			return
+		}
+		if conn != nil && dataDone && !owner {
+			conn.Close()
+			conn = nil
+		}
+
+		if conn == nil {
+			addresses := c.gateways.addresses(port)
+			if dataDone {
+				addresses = addresses[:1]
+			}
+
+			var resume protocol.Resume
+			if conn, owner, resume, err = c.openSession(addresses); errors.Is(err, protocol.ErrRefused) {
+				c.log.Errorf("Error opening session: %s. Giving up", err)
+				if err = cp.remove(); err != nil {
+					c.log.Errorf("Error removing checkpoint: %s", err)
+				}
+				return
+			} else if err != nil {
+				c.log.Errorf("Error opening session: %s. Retrying...", err)
+				time.Sleep(timeout)
+				continue
+			}
+			if streams == nil {
+				if streams, err = c.openStreams(cp); err != nil {
+					return
+				}
+			}
+			if err = c.resume(streams, resume); errors.Is(err, errAborted) {
+				c.log.Errorf("Stopped sending data: %s", err)
+				return
+			} else if err != nil {
+				c.log.Errorf("Error resuming streams: %s", err)
+				return
+			}
+			compression = resume.Compression
+			c.saveCheckpoint(cp, streams)
+		}
+
+		if err = c.sendBatches(conn, streams, compression); errors.Is(err, errAborted) {
+			c.log.Errorf("Stopped sending data: %s", err)
+			return
+		} else if err != nil {
+			c.log.Errorf("Error sending batch: %s", err)
+			conn.Close()
+			conn = nil
+			continue
+		}
+
+		if err = c.handleFrame(conn, streams, received, cp); err != nil {
+			c.log.Errorf("Error in session: %s", err)
+			conn.Close()
+			conn = nil
+		}
+	}
+}
+
+// openSession connects to the first of the addresses that completes the handshake, and returns whether it is the
+// owner, along with where to resume from. The first session gets the ID of the client assigned, and makes its
+// gateway the owner. If a gateway refuses the session, the others are not tried.
+func (c *Client) openSession(addresses []string) (net.Conn, bool, protocol.Resume, error) {
+	var resume protocol.Resume
+	var err error
+	for i, address := range addresses {
+		var conn net.Conn
+		if conn, err = net.Dial(transportProtocol, address); err != nil {
+			continue
+		}
+
+		if resume, err = c.handshake(conn); err != nil {
+			conn.Close()
+			if errors.Is(err, protocol.ErrRefused) {
+				break
+			}
+			continue
+		}
+
+		owner := i == 0 // Once the client has an ID, the owner is the first of the addresses.
+		if c.clientId == "" {
+			c.clientId = resume.ClientId
+			c.log = logs.With(logs.ClientId, c.clientId)
+			c.gateways.own(i)
+			if err = c.openResultsFile(false); err != nil {
+				conn.Close()
+				return nil, false, resume, err
+			}
+			owner = true
+		}
+		c.log.Infof("Session established: %s", address)
+		return conn, owner, resume, nil
+	}
+	return nil, false, resume, err
+}
+
+func (c *Client) handshake(conn net.Conn) (protocol.Resume, error) {
+	hello, err := protocol.NewHello(c.clientId, c.compressions)
+	if err != nil {
+		return protocol.Resume{}, err
+	}
+	if err = protocol.WriteFrame(conn, hello); err != nil {
+		return protocol.Resume{}, err
+	}
+
+	welcome, err := protocol.ReadFrame(conn)
+	if err != nil {
+		return protocol.Resume{}, err
+	}
+	return protocol.ParseWelcome(welcome)
+}
+
+// openStreams opens the CSV files, from where the checkpoint left them.
+func (c *Client) openStreams(cp *checkpoint) ([]*stream, error) {
+	batchSize := c.cfg.Int(chunkSizeKey, chunkSizeDefault)
+	files := []struct {
+		pathKey    string
+		pathDef    string
+		id         message.Id
+		frame      protocol.Type
+		dataStruct any
+	}{
+		{gamesCsvPathKey, gamesCsvPathDef, message.GameId, protocol.Games, &message.DataCSVGames{}},
+		{reviewsCsvPathKey, reviewsCsvPathDef, message.ReviewId, protocol.Reviews, &message.DataCSVReviews{}},
+	}
+
+	streams := make([]*stream, 0, len(files))
+	closeFiles := func() {
+		for _, s := range streams {
+			s.batches.source.Close()
+		}
+	}
+	for i, f := range files {
+		path := c.cfg.String(f.pathKey, f.pathDef)
+		source, err := c.openSource(path)
+		if err != nil {
+			closeFiles()
+			return nil, err
+		}
+
+		batches := &batchProcessor{
+			client:     c,
+			log:        c.log.With(logs.MessageId, f.id),
+			source:     source,
+			invalid:    c.invalidRows(path),
+			id:         uint8(f.id),
+			dataStruct: f.dataStruct,
+			batchSize:  batchSize,
+		}
+		s := &stream{batches: batches, frame: f.frame, num: cp.Streams[i].Next, done: cp.Streams[i].Done}
+		streams = append(streams, s)
+
+		if offset := cp.Streams[i].Offset; offset > 0 {
+			if err = s.seek(offset); err != nil {
+				closeFiles()
+				return nil, err
+			}
+		}
+	}
+	return streams, nil
+}
+
+// resume skips the batches of each stream before the ones the gateway expects, which it already published.
+func (c *Client) resume(streams []*stream, r protocol.Resume) error {
+	for i, s := range streams {
+		if s.done || s.num >= r.Next[i] {
+			continue
+		}
+
+		c.log.Infof("Skipping %s batches %d to %d, already published", s.frame, s.num, r.Next[i]-1)
+		for !s.done && s.num < r.Next[i] {
+			if s.pending == nil {
+				if err := s.read(); err != nil {
+					return err
+				}
+			}
+			s.acked()
+		}
+	}
+	return nil
+}
+
+// sendBatches sends the batch of every stream not sent through the session yet, reading the next one if the last
+// was acknowledged. Batches are compressed as agreed for the session.
+func (c *Client) sendBatches(conn net.Conn, streams []*stream, compression protocol.Compression) error {
+	for _, s := range streams {
+		if s.done || s.sent {
+			continue
+		}
+
+		if s.pending == nil {
+			if err := s.read(); err != nil {
+				return err
+			}
+		}
+
+		f, err := protocol.NewBatch(s.frame, *s.pending, compression)
+		if err != nil {
+			return err
+		}
+		if err = protocol.WriteFrame(conn, f); err != nil {
+			return err
+		}
+		s.sent = true
+	}
+	return nil
+}
+
+// handleFrame handles the next frame of the session: an ack of a batch, or a result, which gets acknowledged once
+// stored. Both are saved to the checkpoint.
+func (c *Client) handleFrame(conn net.Conn, streams []*stream, received map[string]bool, cp *checkpoint) error {
+	f, err := protocol.ReadFrame(conn)
+	if err != nil {
+		return err
+	}
+
+	switch f.Type {
+	case protocol.Ack:
+		stream, num, err := protocol.ParseAck(f)
+		if err != nil {
+			return err
+		}
+		if int(stream) >= len(streams) {
+			return fmt.Errorf("ack of stream %d", stream)
+		}
+		s := streams[stream]
+		if s.sent && num == s.num {
+			s.acked()
+			c.saveCheckpoint(cp, streams)
+		}
+		return nil
+	case protocol.Result:
+		result, err := message.ResultFromJSON(f.Payload)
+		if err != nil {
+			return err
+		}
+		if c.storeQueryResult(result, received) {
+			cp.Results = append(cp.Results, result.Name())
+			c.saveCheckpoint(cp, streams)
+		}
+		ack, err := protocol.NewAck(protocol.ResultsStream, 0)
+		if err != nil {
+			return err
+		}
+		return protocol.WriteFrame(conn, ack)
+	case protocol.Error:
+		return fmt.Errorf("gateway closed the session: %s", f.Payload)
+	default:
+		return protocol.UnexpectedFrame(f)
+	}
+}
+
+func (c *Client) saveCheckpoint(cp *checkpoint, streams []*stream) {
+	cp.ClientId = c.clientId
+	cp.Owner = c.gateways.ownerHost()
+	for i, s := range streams {
+		cp.Streams[i] = streamCheckpoint{Next: s.num, Offset: s.offset, Done: s.done}
+	}
+	if err := cp.save(); err != nil {
+		c.log.Errorf("Error saving checkpoint: %s", err)
+	}
+}
+
+// seek moves the stream to the given offset of the file, where a batch starts.
+func (s *stream) seek(offset int64) error {
+	if err := s.batches.source.SeekTo(offset); err != nil {
+		return fmt.Errorf("error seeking source: %w", err)
+	}
+	s.offset = offset
+	return nil
+}
+
+// read reads the next batch of the stream, which is pending until acknowledged.
+func (s *stream) read() error {
+	b, err := s.batches.readBatch(s.num)
+	if err != nil {
+		return err
+	}
+	s.pending, s.eof, s.end = &b, b.Eof, s.batches.source.Offset()
+	return nil
+}
+
+// acked moves the stream past its pending batch.
+func (s *stream) acked() {
+	s.pending, s.sent, s.done = nil, false, s.eof
+	s.offset = s.end
+	s.num++
+}
+
+// readBatch reads the next batch of records of the source, encoded in columns. The batch is the last one if the
+// source ends. Records that cannot be parsed are counted and left out.
+func (p *batchProcessor) readBatch(num uint32) (protocol.Batch, error) {
+	b := protocol.Batch{Num: num}
+	var games []message.DataCSVGames
+	var reviews []message.DataCSVReviews
+	for read := 0; read < p.batchSize; {
+		err := p.next()
+		if err == io.EOF {
+			b.Eof = true
+			break
+		}
+		if err != nil {
+			return b, fmt.Errorf("error reading source: %w", err)
+		}
+
+		if p.id == uint8(message.ReviewId) {
+			reviews = append(reviews, *p.dataStruct.(*message.DataCSVReviews))
+		} else {
+			games = append(games, *p.dataStruct.(*message.DataCSVGames))
+		}
+		read++
+	}
+
+	var err error
+	if p.id == uint8(message.ReviewId) {
+		b.Records, err = message.ClientReviewsToColumns(reviews)
+	} else {
+		b.Records, err = message.ClientGamesToColumns(games)
+	}
+	return b, err
+}
+
+func (c *Client) isStopped() bool {
+	c.stoppedMutex.Lock()
+	defer c.stoppedMutex.Unlock()
+	return c.stopped
+}
@@ -0,0 +1,55 @@
+package client
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tp1/pkg/message"
+	"tp1/pkg/protocol"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// gamesStream opens a games stream of batches of 2 records over a CSV file with 5 games.
+func gamesStream(t *testing.T, c *Client, path string) *stream {
+	source, err := NewSource(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { source.Close() })
+
+	batches := &batchProcessor{client: c, source: source, id: uint8(message.GameId), dataStruct: &message.DataCSVGames{}, batchSize: 2}
+	return &stream{batches: batches, frame: protocol.Games}
+}
+
+func TestStreamsResumeFromTheBatchesPublished(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "games.csv")
+	csv := "AppID,Name\n10,Portal\n20,Half-Life\n30,Dota 2\n40,Left 4 Dead\n50,Team Fortress\n"
+	require.NoError(t, os.WriteFile(path, []byte(csv), 0666))
+	c := &Client{}
+
+	s := gamesStream(t, c, path)
+	require.NoError(t, c.resume([]*stream{s}, protocol.Resume{Next: [protocol.DataStreams]uint32{2}}))
+	assert.Equal(t, uint32(2), s.num)
+	assert.False(t, s.done)
+	require.NoError(t, s.read())
+	assert.Equal(t, uint32(2), s.pending.Num)
+	assert.True(t, s.pending.Eof)
+	games, err := message.ClientGamesFromColumns(s.pending.Records)
+	require.NoError(t, err)
+	require.Len(t, games, 1)
+	assert.Equal(t, "Team Fortress", games[0].Name)
+
+	// A restarted client seeks to the offset it saved, and reads the same batch.
+	restarted := gamesStream(t, c, path)
+	require.NoError(t, restarted.seek(s.offset))
+	restarted.num = s.num
+	require.NoError(t, restarted.read())
+	assert.Equal(t, s.pending, restarted.pending)
+	assert.Equal(t, s.end, restarted.end)
+
+	// The gateway published the last batch, so there is nothing left to send.
+	require.NoError(t, c.resume([]*stream{restarted}, protocol.Resume{Next: [protocol.DataStreams]uint32{3}}))
+	assert.True(t, restarted.done)
+	assert.Equal(t, int64(len(csv)), restarted.offset)
+}
@@ -0,0 +1,400 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const gzipExt = ".gz"
+
+const (
+	// mergedColumn is a column of the Steam games header that names two columns of its rows, the discount and the
+	// count of DLCs. The second one is read into blankColumn, as the positional fields of the games do.
+	mergedColumn = "discountdlccount"
+	blankColumn  = "blank"
+)
+
+// Source reads the records a client sends. Records are read into structs, whose fields get the columns or keys of
+// the same name, ignoring case, spaces and underscores. Columns or keys with no field are ignored, and fields with no
+// column or key are left empty.
+type Source interface {
+	// Read reads the next record into dst, a pointer to a struct. It returns io.EOF once there are no more records,
+	// and a RowError if the record could not be parsed, after which the next record can still be read.
+	Read(dst any) error
+	// Raw returns the last record read as it is in the file, without its line ending, even if it could not be parsed.
+	Raw() string
+	// Offset returns where the next record starts, in bytes of the decompressed file.
+	Offset() int64
+	// SeekTo moves to an offset returned by Offset.
+	SeekTo(offset int64) error
+	Close() error
+}
+
+// RowError is the error of a record that could not be parsed.
+type RowError struct {
+	Offset int64 // Offset is where the record starts.
+	Err    error
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("invalid row at offset %d: %s", e.Offset, e.Err)
+}
+
+func (e *RowError) Unwrap() error {
+	return e.Err
+}
+
+// NewSource opens the source of a file, by its extension: CSV with a header (.csv) or JSON Lines (.jsonl), compressed
+// with gzip if followed by .gz.
+func NewSource(path string) (Source, error) {
+	name := strings.TrimSuffix(path, gzipExt)
+	f, err := openInput(path, name != path)
+	if err != nil {
+		return nil, err
+	}
+
+	var s Source
+	switch ext := strings.ToLower(name[strings.LastIndex(name, ".")+1:]); ext {
+	case "csv":
+		s, err = newCSVSource(f)
+	case "jsonl":
+		s = &jsonlSource{input: f, r: bufio.NewReader(f)}
+	default:
+		err = fmt.Errorf("unknown format %q of %s", ext, path)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// input is a file, decompressed if gzipped.
+type input struct {
+	file *os.File
+	gz   *gzip.Reader // gz is nil unless the file is gzipped.
+}
+
+func openInput(path string, gzipped bool) (*input, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	in := &input{file: file}
+	if gzipped {
+		if in.gz, err = gzip.NewReader(file); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+	return in, nil
+}
+
+func (in *input) Read(p []byte) (int, error) {
+	if in.gz != nil {
+		return in.gz.Read(p)
+	}
+	return in.file.Read(p)
+}
+
+// seek moves to an offset of the decompressed file. Gzipped files cannot seek, so they are read again from the start
+// up to the offset.
+func (in *input) seek(offset int64) error {
+	if in.gz == nil {
+		_, err := in.file.Seek(offset, io.SeekStart)
+		return err
+	}
+
+	if _, err := in.file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := in.gz.Reset(in.file); err != nil {
+		return err
+	}
+	_, err := io.CopyN(io.Discard, in, offset)
+	return err
+}
+
+func (in *input) Close() error {
+	if in.gz != nil {
+		in.gz.Close()
+	}
+	return in.file.Close()
+}
+
+// csvSource reads a CSV file, whose first record is the header that names its columns.
+type csvSource struct {
+	input  *input
+	r      *csv.Reader
+	rec    *recorder // rec keeps what the reader reads, to cut the records from it.
+	raw    string
+	base   int64    // base is the offset the reader started reading at.
+	header []string // header are the names of the columns, normalized.
+	wide   []string // wide is the header of rows with a column more than it, if it has the merged column.
+	fields fields
+}
+
+func newCSVSource(in *input) (*csvSource, error) {
+	s := &csvSource{input: in, rec: &recorder{r: in}}
+	s.r = newCSVReader(s.rec)
+	header, err := s.r.Read()
+	if err == io.EOF {
+		return nil, errors.New("CSV file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV header: %w", err)
+	}
+
+	for _, column := range header {
+		s.header = append(s.header, normalize(column))
+	}
+	for i, column := range s.header {
+		if column == mergedColumn {
+			s.wide = append(append(append([]string{}, s.header[:i+1]...), blankColumn), s.header[i+1:]...)
+			break
+		}
+	}
+	return s, nil
+}
+
+// newCSVReader returns a reader that lets records have any number of fields, since those of the Steam games have one
+// more than the header.
+func newCSVReader(r io.Reader) *csv.Reader {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	return cr
+}
+
+// headerOf returns the header of a record, by its number of fields.
+func (s *csvSource) headerOf(record []string) ([]string, error) {
+	switch len(record) {
+	case len(s.header):
+		return s.header, nil
+	case len(s.wide):
+		return s.wide, nil
+	}
+	return nil, fmt.Errorf("%w: got %d, want %d", csv.ErrFieldCount, len(record), len(s.header))
+}
+
+func (s *csvSource) Read(dst any) error {
+	offset := s.Offset()
+	start := s.r.InputOffset()
+	record, err := s.r.Read()
+	s.raw = trimLineEnding(s.rec.cut(start, s.r.InputOffset()))
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return &RowError{Offset: offset, Err: err}
+	}
+	if err != nil {
+		return err
+	}
+
+	header, err := s.headerOf(record)
+	if err != nil {
+		return &RowError{Offset: offset, Err: err}
+	}
+
+	v, index := s.fields.of(dst)
+	for i, value := range record {
+		if field, ok := index[header[i]]; ok {
+			if err = setField(v.Field(field), value); err != nil {
+				return &RowError{Offset: offset, Err: &FieldError{Field: v.Type().Field(field).Name, Err: err}}
+			}
+		}
+	}
+	return nil
+}
+
+func (s *csvSource) Raw() string {
+	return s.raw
+}
+
+func (s *csvSource) Offset() int64 {
+	return s.base + s.r.InputOffset()
+}
+
+func (s *csvSource) SeekTo(offset int64) error {
+	if err := s.input.seek(offset); err != nil {
+		return err
+	}
+	s.rec = &recorder{r: s.input}
+	s.r = newCSVReader(s.rec)
+	s.base = offset
+	return nil
+}
+
+func (s *csvSource) Close() error {
+	return s.input.Close()
+}
+
+// recorder keeps what is read through it, from where the last record cut ends.
+type recorder struct {
+	r     io.Reader
+	buf   []byte
+	start int64 // start is the offset of the first byte in buf, from where the recorder started reading.
+}
+
+func (r *recorder) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.buf = append(r.buf, p[:n]...)
+	return n, err
+}
+
+// cut returns what was read between two offsets from where the recorder started reading, and drops what was read
+// before the end.
+func (r *recorder) cut(from, to int64) string {
+	raw := string(r.buf[from-r.start : to-r.start])
+	r.buf = r.buf[to-r.start:]
+	r.start = to
+	return raw
+}
+
+func trimLineEnding(line string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+}
+
+// jsonlSource reads a JSON Lines file, with an object per line.
+type jsonlSource struct {
+	input  *input
+	r      *bufio.Reader
+	offset int64
+	raw    string
+	fields fields
+}
+
+func (s *jsonlSource) Read(dst any) error {
+	var offset int64
+	var line []byte
+	for len(bytes.TrimSpace(line)) == 0 { // Blank lines are skipped.
+		var err error
+		offset = s.offset
+		line, err = s.r.ReadBytes('\n')
+		s.offset += int64(len(line))
+		s.raw = trimLineEnding(string(line))
+		if err == io.EOF && len(line) > 0 {
+			err = nil // The last line may not end with a newline.
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	var object map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(line))
+	decoder.UseNumber()
+	if err := decoder.Decode(&object); err != nil {
+		return &RowError{Offset: offset, Err: err}
+	}
+
+	v, index := s.fields.of(dst)
+	for key, value := range object {
+		field, ok := index[normalize(key)]
+		if !ok || value == nil {
+			continue
+		}
+		if err := setField(v.Field(field), fmt.Sprint(value)); err != nil {
+			return &RowError{Offset: offset, Err: &FieldError{Field: v.Type().Field(field).Name, Err: err}}
+		}
+	}
+	return nil
+}
+
+func (s *jsonlSource) Raw() string {
+	return s.raw
+}
+
+func (s *jsonlSource) Offset() int64 {
+	return s.offset
+}
+
+func (s *jsonlSource) SeekTo(offset int64) error {
+	if err := s.input.seek(offset); err != nil {
+		return err
+	}
+	s.r.Reset(s.input)
+	s.offset = offset
+	return nil
+}
+
+func (s *jsonlSource) Close() error {
+	return s.input.Close()
+}
+
+// fields maps the normalized names of the fields of the struct records are read into to their indexes.
+type fields struct {
+	t     reflect.Type
+	index map[string]int
+}
+
+// of returns the struct dst points to, zeroed so that values of the previous record do not remain, along with the
+// indexes of its fields.
+func (f *fields) of(dst any) (reflect.Value, map[string]int) {
+	v := reflect.ValueOf(dst).Elem()
+	v.SetZero()
+	if f.t != v.Type() {
+		f.t, f.index = v.Type(), make(map[string]int, v.NumField())
+		for i := 0; i < v.NumField(); i++ {
+			f.index[normalize(f.t.Field(i).Name)] = i
+		}
+	}
+	return v, f.index
+}
+
+// normalize lowercases a name, dropping what is not a letter or a digit.
+func normalize(name string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, name)
+}
+
+// setField parses a value into a field. Empty values leave the field empty, except for booleans, which must be either
+// true or false.
+func setField(field reflect.Value, value string) error {
+	if value == "" && field.Kind() == reflect.Bool {
+		return errRequired
+	}
+	if value == "" && field.Kind() != reflect.String {
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int64, reflect.Int:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Kind())
+	}
+	return nil
+}
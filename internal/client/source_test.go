@@ -0,0 +1,125 @@
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tp1/pkg/message"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	gamesCSV   = "Name,AppID,Windows\nPortal,10,True\nHalf-Life,not a number,True\nDota 2,30,False\n"
+	gamesJSONL = "{\"name\": \"Portal\", \"app_id\": 10, \"windows\": true}\n{\"name\": \"Half-Life\", \"app_id\": \"x\"}\n\n{\"name\": \"Dota 2\", \"app_id\": 30}"
+)
+
+// writeSource writes a file, gzipped if its name ends in .gz.
+func writeSource(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	data := []byte(content)
+	if filepath.Ext(name) == gzipExt {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		_, err := w.Write(data)
+		require.NoError(t, err)
+		require.NoError(t, w.Close())
+		data = buf.Bytes()
+	}
+	require.NoError(t, os.WriteFile(path, data, 0666))
+	return path
+}
+
+func TestSourcesReadRecordsByName(t *testing.T) {
+	for name, content := range map[string]string{
+		"games.csv":      gamesCSV,
+		"games.csv.gz":   gamesCSV,
+		"games.jsonl":    gamesJSONL,
+		"games.jsonl.gz": gamesJSONL,
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, err := NewSource(writeSource(t, name, content))
+			require.NoError(t, err)
+			defer s.Close()
+
+			var game message.DataCSVGames
+			require.NoError(t, s.Read(&game))
+			assert.Equal(t, message.DataCSVGames{AppID: 10, Name: "Portal", Windows: true}, game)
+
+			second := s.Offset()
+			var rowErr *RowError
+			require.ErrorAs(t, s.Read(&game), &rowErr, "the second game has an invalid ID")
+			assert.Equal(t, second, rowErr.Offset)
+
+			third := s.Offset()
+			require.NoError(t, s.Read(&game))
+			assert.Equal(t, message.DataCSVGames{AppID: 30, Name: "Dota 2"}, game)
+			assert.ErrorIs(t, s.Read(&game), io.EOF)
+
+			// Seeking back reads the same records again.
+			require.NoError(t, s.SeekTo(third))
+			require.NoError(t, s.Read(&game))
+			assert.Equal(t, "Dota 2", game.Name)
+			assert.ErrorIs(t, s.Read(&game), io.EOF)
+		})
+	}
+}
+
+func TestSteamGamesRowsHaveAColumnMoreThanTheHeader(t *testing.T) {
+	header := "AppID,Name,Release date,Estimated owners,Peak CCU,Required age,Price,DiscountDLC count,About the game," +
+		"Supported languages,Full audio languages,Reviews,Header image,Website,Support url,Support email,Windows,Mac," +
+		"Linux,Metacritic score,Metacritic url,User score,Positive,Negative,Score rank,Achievements,Recommendations," +
+		"Notes,Average playtime forever,Average playtime two weeks,Median playtime forever,Median playtime two weeks," +
+		"Developers,Publishers,Categories,Genres,Tags,Screenshots,Movies\n"
+	row := "20200,Galactic Bowling,\"Oct 21, 2008\",0 - 20000,0,0,19.99,0,2,About,\"['English']\",[],,image,,," +
+		"mail,True,False,False,0,,0,6,11,,30,0,,0,0,0,0,Perpetual FX Creative,Perpetual FX Creative," +
+		"\"Single-player,Multi-player\",\"Casual,Indie,Sports\",\"Indie,Casual\",shots,movies\n"
+	s, err := NewSource(writeSource(t, "games.csv", header+row+"10,Portal\n"))
+	require.NoError(t, err)
+	defer s.Close()
+
+	var game message.DataCSVGames
+	require.NoError(t, s.Read(&game))
+	assert.Equal(t, int64(20200), game.AppID)
+	assert.Equal(t, 19.99, game.Price)
+	assert.Equal(t, int64(0), game.DiscountDLCCount)
+	assert.Equal(t, int64(2), game.Blank)
+	assert.Equal(t, "About", game.AboutTheGame)
+	assert.True(t, game.Windows)
+	assert.Equal(t, int64(6), game.Positive)
+	assert.Equal(t, "Indie,Casual", game.Tags)
+	assert.Equal(t, "movies", game.Movies)
+
+	var rowErr *RowError
+	require.ErrorAs(t, s.Read(&game), &rowErr, "rows with other numbers of fields are invalid")
+	assert.ErrorIs(t, rowErr, csv.ErrFieldCount)
+}
+
+func TestInvalidRowsAreCountedOnce(t *testing.T) {
+	s, err := NewSource(writeSource(t, "games.csv", gamesCSV))
+	require.NoError(t, err)
+	defer s.Close()
+	p := &batchProcessor{source: s, dataStruct: &message.DataCSVGames{}}
+
+	start := s.Offset()
+	for i := 0; i < 2; i++ { // The second time, as if the batch was sent again.
+		require.NoError(t, p.next())
+		require.NoError(t, p.next())
+		assert.True(t, errors.Is(p.next(), io.EOF))
+		require.NoError(t, s.SeekTo(start))
+	}
+	assert.Equal(t, 1, p.invalid.count)
+	assert.ErrorContains(t, p.invalid.first, "AppID")
+}
+
+func TestUnknownFormatsAreRejected(t *testing.T) {
+	_, err := NewSource(writeSource(t, "games.txt", gamesCSV))
+	assert.ErrorContains(t, err, "unknown format")
+}
@@ -9,11 +9,20 @@ import (
 	"tp1/pkg/utils/io"
 )
 
-func (c *Client) openResultsFile() error {
-	fileName := fmt.Sprintf("/app/data/results_%s.txt", c.clientId)
-	file, err := os.OpenFile(fileName, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+// openResultsFile opens the results file of the client, keeping the results stored if it resumes.
+func (c *Client) openResultsFile(resume bool) error {
+	fileName := c.resultsPath(".txt")
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resume {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		if err := c.loadResults(); err != nil {
+			c.log.Errorf("Error loading results: %v", err)
+			return err
+		}
+	}
+	file, err := os.OpenFile(fileName, flags, 0666)
 	if err != nil {
-		logs.Logger.Errorf("Error opening results file: %v", err)
+		c.log.Errorf("Error opening results file: %v", err)
 		return err
 	}
 
@@ -21,28 +30,35 @@ func (c *Client) openResultsFile() error {
 	return nil
 }
 
-func (c *Client) fetchClientID(address string) error {
-	idsPort := c.cfg.String("gateway.ids_port", "5053")
-	idsFullAddress := address + ":" + idsPort
-	idConn, err := net.Dial("tcp", idsFullAddress)
+// fetchClientID gets an ID from the first gateway that assigns one, which becomes the owner of the client.
+func (c *Client) fetchClientID() error {
+	var idConn net.Conn
+	var err error
+	for i, address := range c.gateways.addresses(c.cfg.String("gateway.ids_port", "5053")) {
+		if idConn, err = net.Dial("tcp", address); err == nil {
+			c.gateways.own(i)
+			break
+		}
+		c.log.Errorf("ID connection error: %v", err)
+	}
 	if err != nil {
-		logs.Logger.Errorf("ID connection error: %v", err)
 		return err
 	}
 	defer idConn.Close()
 
 	clientIdBuffer := make([]byte, id.ClientIdLen)
 	if err := io.ReadFull(idConn, clientIdBuffer, id.ClientIdLen); err != nil {
-		logs.Logger.Errorf("Error reading client ID: %v", err)
+		c.log.Errorf("Error reading client ID: %v", err)
 		return err
 	}
 	c.clientId = id.DecodeClientId(clientIdBuffer)
-	logs.Logger.Infof("Assigned client ID: %s", c.clientId)
+	c.log = logs.With(logs.ClientId, c.clientId)
+	c.log.Infof("Assigned client ID")
 	return nil
 }
 
 func (c *Client) handleSigterm() {
-	logs.Logger.Info("Sigterm Signal Received... Shutting down")
+	c.log.Infof("Sigterm Signal Received... Shutting down")
 	c.stoppedMutex.Lock()
 	c.stopped = true
 	c.stoppedMutex.Unlock()
@@ -58,7 +74,7 @@ func (c *Client) Close(gamesConn net.Conn, reviewsConn net.Conn) {
 func (c *Client) sendClientID(conn net.Conn) error {
 	clientIdBuf := id.EncodeClientId(c.clientId)
 	if err := io.SendAll(conn, clientIdBuf); err != nil {
-		logs.Logger.Errorf("Error sending client ID: %s", err)
+		c.log.Errorf("Error sending client ID: %s", err)
 		return err
 	}
 	return nil
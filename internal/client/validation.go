@@ -0,0 +1,176 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"tp1/pkg/message"
+	"tp1/pkg/utils/io"
+)
+
+const (
+	invalidRowsKey = "client.invalid_rows"
+	invalidRowsDef = skipRows
+	rejectsPathKey = "client.rejects_path"
+	rejectsPathDef = "rejects.csv"
+	// releaseDateLayout is the one release dates are parsed with to filter games by year.
+	releaseDateLayout = "Jan 2, 2006"
+	minReviewScore    = -1
+	maxReviewScore    = 1
+)
+
+// Policies for invalid rows: they are either left out, or left out and written to the rejects file, or the client
+// stops sending data at the first one.
+const (
+	skipRows   = "skip"
+	rejectRows = "reject"
+	abortRows  = "abort"
+)
+
+var (
+	errRequired = errors.New("required")
+	// errAborted is returned when reading an invalid row with the abort policy.
+	errAborted = errors.New("aborted at an invalid row")
+)
+
+// FieldError is the error of a field of a record that is invalid.
+type FieldError struct {
+	Field string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+func parsePolicy(policy string) (string, error) {
+	switch policy {
+	case skipRows, rejectRows, abortRows:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown policy for invalid rows %q", policy)
+}
+
+// validate checks the rules of the records of games and reviews that parsing them does not: the fields required, the
+// format of release dates and the range of review scores.
+func validate(record any) error {
+	switch r := record.(type) {
+	case *message.DataCSVGames:
+		if r.AppID <= 0 {
+			return &FieldError{Field: "AppID", Err: errRequired}
+		}
+		if r.Name == "" {
+			return &FieldError{Field: "Name", Err: errRequired}
+		}
+		if r.ReleaseDate != "" {
+			if _, err := time.Parse(releaseDateLayout, r.ReleaseDate); err != nil {
+				return &FieldError{Field: "ReleaseDate", Err: fmt.Errorf("%q is not a date like %q", r.ReleaseDate, releaseDateLayout)}
+			}
+		}
+	case *message.DataCSVReviews:
+		if r.AppID <= 0 {
+			return &FieldError{Field: "AppID", Err: errRequired}
+		}
+		if r.ReviewScore < minReviewScore || r.ReviewScore > maxReviewScore {
+			return &FieldError{Field: "ReviewScore", Err: fmt.Errorf("%d is not between %d and %d", r.ReviewScore, minReviewScore, maxReviewScore)}
+		}
+		if r.ReviewVotes < 0 {
+			return &FieldError{Field: "ReviewVotes", Err: fmt.Errorf("%d is negative", r.ReviewVotes)}
+		}
+	}
+	return nil
+}
+
+// invalidRows handles the invalid rows of a source as its policy says, and counts them by field for the report.
+type invalidRows struct {
+	policy  string
+	path    string   // path is the one of the source, written along with the rows rejected.
+	rejects *rejects // rejects is nil unless the policy is to reject rows.
+	count   int
+	byField map[string]int
+	first   error
+}
+
+// add handles an invalid row, read as raw, returning errAborted if the policy is to abort.
+func (r *invalidRows) add(rowErr *RowError, raw string) error {
+	field := "row" // Rows that cannot be split into fields, such as a malformed line, have no field.
+	var fieldErr *FieldError
+	if errors.As(rowErr, &fieldErr) {
+		field = fieldErr.Field
+	}
+	if r.byField == nil {
+		r.byField = make(map[string]int)
+	}
+	if r.count == 0 {
+		r.first = rowErr
+	}
+	r.count++
+	r.byField[field]++
+
+	switch r.policy {
+	case abortRows:
+		return fmt.Errorf("%w: %w", errAborted, rowErr)
+	case rejectRows:
+		if err := r.rejects.write(r.path, rowErr, raw); err != nil {
+			return fmt.Errorf("error writing rejected row: %w", err)
+		}
+	}
+	return nil
+}
+
+// report returns how many rows were invalid, by field, along with the first of them. It is empty if none was.
+func (r *invalidRows) report() string {
+	if r.count == 0 {
+		return ""
+	}
+
+	fields := make([]string, 0, len(r.byField))
+	for field, count := range r.byField {
+		fields = append(fields, fmt.Sprintf("%s %d", field, count))
+	}
+	sort.Strings(fields)
+	return fmt.Sprintf("%d invalid rows in %s (%s). The first: %s", r.count, r.path, strings.Join(fields, ", "), r.first)
+}
+
+// rejects is the file the rows rejected from every source are written to, as the path of the source, the offset of
+// the row, why it is invalid and the row as it is in the source. It is created with the first row rejected.
+type rejects struct {
+	mu   sync.Mutex
+	path string
+	file *io.File
+}
+
+func (r *rejects) write(source string, rowErr *RowError, raw string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		file, err := io.NewFile(r.path)
+		if err != nil {
+			return err
+		}
+		r.file = file
+	}
+	if err := r.file.Write([]string{source, strconv.FormatInt(rowErr.Offset, 10), rowErr.Err.Error(), raw}); err != nil {
+		return err
+	}
+	return r.file.Sync()
+}
+
+func (r *rejects) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file != nil {
+		r.file.Close()
+		r.file = nil
+	}
+}
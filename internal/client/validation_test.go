@@ -0,0 +1,115 @@
+package client
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"tp1/pkg/message"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const invalidGamesCSV = "AppID,Name,Release date,Windows\n" +
+	"10,Portal,\"Oct 9, 2007\",True\n" +
+	"20,,\"Nov 19, 1998\",True\n" +
+	"30,Dota 2,2013-07-09,True\n" +
+	"40,Left 4 Dead,\"Nov 17, 2008\",\n" +
+	"50,Team Fortress,,False\n"
+
+func TestValidateChecksTheRulesOfRecords(t *testing.T) {
+	tests := map[string]struct {
+		record any
+		field  string
+	}{
+		"valid game":       {&message.DataCSVGames{AppID: 10, Name: "Portal", ReleaseDate: "Oct 9, 2007"}, ""},
+		"game without ID":  {&message.DataCSVGames{Name: "Portal"}, "AppID"},
+		"game with a date": {&message.DataCSVGames{AppID: 10, Name: "Portal", ReleaseDate: "Oct 2007"}, "ReleaseDate"},
+		"valid review":     {&message.DataCSVReviews{AppID: 10, ReviewScore: -1, ReviewVotes: 3}, ""},
+		"review scored 5":  {&message.DataCSVReviews{AppID: 10, ReviewScore: 5}, "ReviewScore"},
+		"negative votes":   {&message.DataCSVReviews{AppID: 10, ReviewScore: 1, ReviewVotes: -1}, "ReviewVotes"},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := validate(test.record)
+			if test.field == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var fieldErr *FieldError
+			require.ErrorAs(t, err, &fieldErr)
+			assert.Equal(t, test.field, fieldErr.Field)
+		})
+	}
+}
+
+// gamesProcessor returns a processor of the games at path, handling invalid rows with the given policy.
+func gamesProcessor(t *testing.T, path string, policy string) *batchProcessor {
+	s, err := NewSource(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { s.Close() })
+
+	c := &Client{invalidPolicy: policy, rejects: &rejects{path: filepath.Join(t.TempDir(), "rejects.csv")}}
+	t.Cleanup(c.rejects.close)
+	return &batchProcessor{source: s, invalid: c.invalidRows(path), dataStruct: &message.DataCSVGames{}, batchSize: 5}
+}
+
+func TestRejectedRowsAreWrittenAndReported(t *testing.T) {
+	path := writeSource(t, "games.csv", invalidGamesCSV)
+	p := gamesProcessor(t, path, rejectRows)
+
+	b, err := p.readBatch(0)
+	require.NoError(t, err)
+	games, err := message.ClientGamesFromColumns(b.Records)
+	require.NoError(t, err)
+	require.Len(t, games, 2)
+	assert.Equal(t, "Portal", games[0].Name)
+	assert.Equal(t, "Team Fortress", games[1].Name)
+
+	assert.Equal(t, 3, p.invalid.count)
+	assert.Contains(t, p.invalid.report(), "(Name 1, ReleaseDate 1, Windows 1)")
+
+	file, err := os.Open(p.invalid.rejects.path)
+	require.NoError(t, err)
+	defer file.Close()
+	rejected, err := csv.NewReader(file).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rejected, 3)
+	assert.Equal(t, []string{path, "61", "Name: required", "20,,\"Nov 19, 1998\",True"}, rejected[0])
+	assert.Equal(t, []string{path, "111", "Windows: required", "40,Left 4 Dead,\"Nov 17, 2008\","}, rejected[2])
+}
+
+func TestRawRecordsAreKeptAsInTheSource(t *testing.T) {
+	tests := map[string]struct {
+		content string
+		raws    []string
+	}{
+		"games.csv":      {"AppID,Name\r\n10,\"Half\nLife\"\r\n20,\"Dota\r\n", []string{"10,\"Half\nLife\"", "20,\"Dota"}},
+		"games.jsonl.gz": {"{\"app_id\": 10}\r\n{\"app_id\": 20,\n", []string{"{\"app_id\": 10}", "{\"app_id\": 20,"}},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			s, err := NewSource(writeSource(t, name, test.content))
+			require.NoError(t, err)
+			defer s.Close()
+
+			var game message.DataCSVGames
+			require.NoError(t, s.Read(&game))
+			assert.Equal(t, test.raws[0], s.Raw())
+
+			var rowErr *RowError
+			require.ErrorAs(t, s.Read(&game), &rowErr, "the second record is malformed")
+			assert.Equal(t, test.raws[1], s.Raw())
+		})
+	}
+}
+
+func TestAbortStopsAtTheFirstInvalidRow(t *testing.T) {
+	p := gamesProcessor(t, writeSource(t, "games.csv", invalidGamesCSV), abortRows)
+
+	_, err := p.readBatch(0)
+	assert.ErrorIs(t, err, errAborted)
+	assert.ErrorContains(t, err, "Name: required")
+}
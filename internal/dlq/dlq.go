@@ -0,0 +1,128 @@
+package dlq
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"tp1/pkg/amqp"
+	"tp1/pkg/amqp/broker"
+	"tp1/pkg/config/provider"
+	"tp1/pkg/dlq"
+	"tp1/pkg/logs"
+	"tp1/pkg/sequence"
+)
+
+const (
+	configPath   = "config.toml"
+	logLevelKey  = "dlq.log-level"
+	logFormatKey = "dlq.log-format"
+	idleKey      = "dlq.idle-ms"
+
+	defaultLogLevel = "INFO"
+	defaultIdle     = 1000
+)
+
+// Inspector reads dead-letter queues and replays their messages.
+type Inspector struct {
+	broker amqp.MessageBroker
+	idle   time.Duration // idle is how long to wait for a new message before considering the queue drained.
+}
+
+// New creates a new Inspector using the `rabbitmq` and `dlq` sections of the configuration file.
+func New() (*Inspector, error) {
+	cfg, err := provider.LoadConfig(configPath)
+	if err != nil {
+		return nil, err
+	}
+	_ = logs.Init(cfg.String(logLevelKey, defaultLogLevel), cfg.String(logFormatKey, logs.TextFormat))
+
+	b, err := broker.NewBroker(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return newInspector(b, time.Duration(cfg.Int64(idleKey, defaultIdle))*time.Millisecond), nil
+}
+
+func newInspector(b amqp.MessageBroker, idle time.Duration) *Inspector {
+	return &Inspector{broker: b, idle: idle}
+}
+
+// Inspect writes a summary of every message in the queue. Messages are left in the queue.
+func (i *Inspector) Inspect(queue string, w io.Writer) (int, error) {
+	deliveries, err := i.broker.Consume(queue, "", false, false, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	// Deliveries are not acknowledged, so they get requeued once the inspector is closed.
+	count := 0
+	for delivery, ok := i.next(deliveries); ok; delivery, ok = i.next(deliveries) {
+		entry, err := dlq.EntryFromDelivery(delivery)
+		if err != nil {
+			deliveryLog(delivery).Warningf("Skipping message %d: %s", delivery.DeliveryTag, err.Error())
+			continue
+		}
+
+		count++
+		if _, err = fmt.Fprintf(w, "%d. %s\n", count, entry.String()); err != nil {
+			return count, err
+		}
+	}
+
+	return count, nil
+}
+
+// Replay sends messages in the queue back to where they were originally published, and removes them from the
+// queue. At most limit messages are replayed, unless limit is 0. Every run replays from a sequence source of its own.
+func (i *Inspector) Replay(queue string, limit int) (int, error) {
+	deliveries, err := i.broker.Consume(queue, "", false, false, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	src, count := dlq.ReplaySource(), 0
+	for delivery, ok := i.next(deliveries); ok && (limit == 0 || count < limit); delivery, ok = i.next(deliveries) {
+		entry, err := dlq.EntryFromDelivery(delivery)
+		if err != nil {
+			deliveryLog(delivery).Warningf("Skipping message %d: %s", delivery.DeliveryTag, err.Error())
+			continue
+		}
+
+		replay := entry.Replay(sequence.SrcNew(src, uint64(count)))
+		if err = i.broker.PublishBatch(replay); err != nil {
+			return count, err
+		}
+		if err = delivery.Ack(false); err != nil {
+			return count, err
+		}
+
+		count++
+		deliveryLog(delivery).Debugf("Replayed message to exchange %q with key %q", entry.Exchange, entry.Key)
+	}
+
+	return count, nil
+}
+
+// Close closes the connection with the broker. Messages that were not replayed are put back in their queue.
+func (i *Inspector) Close() {
+	i.broker.Close()
+}
+
+// deliveryLog returns an entry with the node that dead-lettered the delivery and its client attached.
+func deliveryLog(delivery amqp.Delivery) *logs.Entry {
+	node, _ := delivery.Headers[dlq.NodeHeader].(string)
+	client, _ := delivery.Headers[amqp.ClientIdHeader].(string)
+	return logs.With(logs.Node, node, logs.ClientId, client)
+}
+
+// next waits for the next delivery. It returns false once no delivery arrives for the idle duration.
+func (i *Inspector) next(deliveries <-chan amqp.Delivery) (amqp.Delivery, bool) {
+	select {
+	case delivery, ok := <-deliveries:
+		return delivery, ok
+	case <-time.After(i.idle):
+		return amqp.Delivery{}, false
+	}
+}
@@ -0,0 +1,90 @@
+package dlq
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"tp1/pkg/amqp"
+	"tp1/pkg/amqp/memory"
+	"tp1/pkg/dlq"
+	"tp1/pkg/sequence"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const idle = 50 * time.Millisecond
+
+func setup(t *testing.T, n int) *memory.Server {
+	s := memory.NewServer()
+	b := s.NewBroker()
+	defer b.Close()
+
+	assert.NoError(t, b.ExchangeDeclare(amqp.Exchange{Name: "action", Kind: "direct"}, amqp.Exchange{Name: "action_dlx", Kind: dlq.Kind}))
+	_, err := b.QueueDeclare("games_action_0", "action_dlq")
+	assert.NoError(t, err)
+	assert.NoError(t, b.QueueBind(
+		amqp.QueueBind{Exchange: "action", Name: "games_action_0", Key: "input-0"},
+		amqp.QueueBind{Exchange: "action_dlx", Name: "action_dlq"},
+	))
+
+	for i := 0; i < n; i++ {
+		delivery := amqp.Delivery{Exchange: "action", RoutingKey: "input-0", Headers: amqp.Header{ClientId: "0-0", SequenceId: fmt.Sprintf("gateway-%d", i)}.ToMap(), Body: []byte{byte(i)}}
+		assert.NoError(t, b.PublishBatch(dlq.Wrap(delivery, amqp.Destination{Exchange: "action_dlx"}, "action-1", errors.New("failed to parse message"))))
+	}
+
+	return s
+}
+
+func TestInspectLeavesMessagesInQueue(t *testing.T) {
+	s := setup(t, 2)
+	i := newInspector(s.NewBroker(), idle)
+
+	var out bytes.Buffer
+	count, err := i.Inspect("action_dlq", &out)
+	i.Close()
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, 2, strings.Count(out.String(), "failed to parse message"))
+	assert.Equal(t, 2, s.Messages("action_dlq"))
+	assert.Equal(t, 0, s.Messages("games_action_0"))
+}
+
+func TestReplaySendsMessagesToOriginalQueue(t *testing.T) {
+	s := setup(t, 3)
+	i := newInspector(s.NewBroker(), idle)
+
+	count, err := i.Replay("action_dlq", 2)
+	i.Close()
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, 1, s.Messages("action_dlq"))
+	assert.Equal(t, 2, s.Messages("games_action_0"))
+}
+
+func TestReplayRunSendsMessagesFromASingleSource(t *testing.T) {
+	s := setup(t, 2)
+	i := newInspector(s.NewBroker(), idle)
+
+	_, err := i.Replay("action_dlq", 0)
+	i.Close()
+	assert.NoError(t, err)
+
+	b := s.NewBroker()
+	defer b.Close()
+	deliveries, err := b.Consume("games_action_0", "", true, false, 0)
+	assert.NoError(t, err)
+
+	first, err := sequence.SrcFromString(amqp.HeadersFromDelivery(<-deliveries).SequenceId)
+	assert.NoError(t, err)
+	second, err := sequence.SrcFromString(amqp.HeadersFromDelivery(<-deliveries).SequenceId)
+	assert.NoError(t, err)
+	assert.Equal(t, first.WorkerUuid(), second.WorkerUuid())
+	assert.Equal(t, uint64(0), first.Id())
+	assert.Equal(t, uint64(1), second.Id())
+}
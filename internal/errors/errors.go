@@ -2,8 +2,11 @@ package errors
 
 import "errors"
 
-var InvalidMessageId = errors.New("unexpected message with ID %d received")
+var InvalidMessageId = errors.New("unexpected message ID received")
 var FailedToPublish = errors.New("failed to publish message")
 var FailedToParse = errors.New("failed to parse message")
 var FailedToLog = errors.New("failed to log info to disk")
 var UnmappedLanguage = errors.New("unmapped language")
+var FailedToSnapshot = errors.New("failed to save snapshot")
+var FailedToRestore = errors.New("failed to restore snapshot")
+var FailedToServeMetrics = errors.New("failed to serve metrics")
@@ -1,104 +1,345 @@
 package chunk
 
 import (
+	"fmt"
+	"math"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
+	"tp1/internal/gateway/offsets"
 	"tp1/internal/gateway/utils"
 	"tp1/pkg/amqp"
 	"tp1/pkg/logs"
 	"tp1/pkg/message"
+	"tp1/pkg/tracing"
 	"tp1/pkg/utils/shard"
 )
 
+const batchSpan = "batch"
+
+// abortBatchNum is the batch number of client aborts. It is greater than any batch number a client can send, so
+// that messages of the client arriving after the abort are discarded as duplicates.
+const abortBatchNum = uint64(math.MaxUint32) + 1
+
+// offsetBits are the low bits of a sequence ID, which hold the offset within its batch of the last message in the
+// chunk. Batches sent in parts get a sequence ID per part, greater than the ones of the parts before.
+const offsetBits = 8
+
+// retryDelay is how long a sender waits to publish again the chunks it failed to publish.
+const retryDelay = time.Second
+
 type Sender struct {
-	id           int //0 for games, 1 for reviews
-	channel      <-chan Item
-	broker       amqp.MessageBroker
-	dst          []amqp.Destination
-	maxChunkSize uint8
-	chunks       map[string][]any
+	id      int //0 for games, 1 for reviews
+	channel <-chan Item
+	broker  amqp.MessageBroker
+	dst     []amqp.Destination
+	limits  Limits
+	chunks  map[string]*pending
+	offsets *offsets.Store  // offsets records the batches published, unless nil.
+	tracer  *tracing.Tracer // tracer is nil unless the `tracing` section is set.
+}
+
+// Limits bound the chunks of a client. A chunk is sent once it holds a whole batch of Items messages, which is
+// when the client gets its ack, so Items must be positive. Before that, it is sent in parts if it grows to Bytes, or
+// if its oldest message waits for Flush. Bytes and Flush set to 0 are disabled.
+//
+// A batch sent again must be cut in the same parts, so that they get the same sequence IDs. Cuts by Items and Bytes
+// depend only on the messages of the batch. Cuts by Flush are recorded in the offsets before their part is
+// published, and the batch is cut there again when sent again.
+type Limits struct {
+	Items uint8
+	Bytes int
+	Flush time.Duration
 }
 
 type Item struct {
 	Msg      any //DataCSVGames or DataCSVReviews
 	ClientId string
 	BatchNum uint32
+	Size     int  // Size is the length of the message as the client sent it.
+	Abort    bool // Abort is set if the client disconnected before finishing, in which case Msg is nil.
+	Resume   bool // Resume is set if the client opened a new session, in which case Msg is nil.
+}
+
+// pending is the batch a client is sending.
+type pending struct {
+	batchNum uint32
+	items    []any
+	bytes    int
+	received int       // received counts the messages of the batch, including those already sent.
+	since    time.Time // since is when the oldest message in items was received.
+	cuts     []int     // cuts are the offsets the batch was cut by time at when it was sent before, yet to reach.
+	parts    []part    // parts are the ones cut from the batch and not published yet, in order.
+	complete bool      // complete is set once the whole batch was received.
+	eof      bool      // eof is set if the batch is the last one of the client, which its EOF follows.
+	retryAt  time.Time // retryAt is when the parts get published again, if publishing them failed.
 }
 
-func New(id int, channel <-chan Item, broker amqp.MessageBroker, dst []amqp.Destination, chunkMaxSize uint8) *Sender {
+// part holds messages of a batch that are published together. Its offset is the one of its last message.
+type part struct {
+	items  []any
+	offset int
+}
+
+func New(id int, channel <-chan Item, broker amqp.MessageBroker, dst []amqp.Destination, limits Limits, offsets *offsets.Store, tracer *tracing.Tracer) *Sender {
 	return &Sender{
-		id:           id,
-		channel:      channel,
-		broker:       broker,
-		dst:          dst,
-		chunks:       make(map[string][]any),
-		maxChunkSize: chunkMaxSize,
+		id:      id,
+		channel: channel,
+		broker:  broker,
+		dst:     dst,
+		chunks:  make(map[string]*pending),
+		limits:  limits,
+		offsets: offsets,
+		tracer:  tracer,
 	}
 }
 
-func Start(id int, clientAckChannels *sync.Map, channel <-chan Item, broker amqp.MessageBroker, dst []amqp.Destination, chunkMaxSize uint8) {
-	s := New(id, channel, broker, dst, chunkMaxSize)
+func Start(id int, clientAckChannels *sync.Map, channel <-chan Item, broker amqp.MessageBroker, dst []amqp.Destination, limits Limits, offsets *offsets.Store, tracer *tracing.Tracer) {
+	s := New(id, channel, broker, dst, limits, offsets, tracer)
+	var expired <-chan time.Time
+	var deadline time.Time
 	for {
-		item := <-channel
-		s.updateChunk(clientAckChannels, item, item.Msg == nil)
+		select {
+		case item, ok := <-channel:
+			if !ok {
+				s.flush()
+				return
+			}
+			if item.Abort {
+				s.abort(item.ClientId)
+			} else if item.Resume {
+				s.resume(item.ClientId)
+			} else {
+				s.updateChunk(clientAckChannels, item, item.Msg == nil)
+			}
+		case now := <-expired:
+			s.expire(clientAckChannels, now)
+			deadline = time.Time{}
+		}
+
+		if next := s.nextDeadline(); next.IsZero() {
+			expired, deadline = nil, next
+		} else if !next.Equal(deadline) {
+			expired, deadline = time.After(time.Until(next)), next
+		}
 	}
 }
 
 func (s *Sender) updateChunk(clientAckChannels *sync.Map, item Item, eof bool) {
 	clientId := item.ClientId
+	chunk, ok := s.chunks[clientId]
+	if !ok {
+		chunk = &pending{
+			batchNum: item.BatchNum,
+			items:    make([]any, 0, s.limits.Items),
+			cuts:     s.offsets.Cuts(s.id, clientId, item.BatchNum),
+		}
+		s.chunks[clientId] = chunk
+	}
 
 	if !eof {
-		if _, ok := s.chunks[clientId]; !ok {
-			s.chunks[clientId] = make([]any, 0, s.maxChunkSize)
+		if len(chunk.items) == 0 {
+			chunk.since = time.Now()
 		}
-		s.chunks[clientId] = append(s.chunks[clientId], item)
+		chunk.items = append(chunk.items, item)
+		chunk.bytes += item.Size
+		chunk.received++
+	}
+	recut := len(chunk.cuts) > 0 && chunk.received >= chunk.cuts[0] // The batch was cut by time here when sent before.
+	if recut {
+		chunk.cuts = chunk.cuts[1:]
+	}
+	if chunk.received >= int(s.limits.Items) || eof {
+		chunk.complete, chunk.eof = true, eof
 	}
 
-	s.sendChunk(clientAckChannels, eof, clientId, item.BatchNum)
+	if chunk.complete || recut || (s.limits.Bytes > 0 && chunk.bytes >= s.limits.Bytes) {
+		s.cut(chunk)
+		s.sendChunk(clientAckChannels, clientId, chunk)
+	}
 }
 
-// sendChunk sends a chunks of data to the broker if the chunks is full or the eof flag is true
-// In case eof is true, it sends an EOF message to the broker
-// if a chunks was sent restarts count
-func (s *Sender) sendChunk(clientAckChannels *sync.Map, eof bool, clientId string, batchNum uint32) {
-	messageId := utils.MatchMessageId(s.id)
-	chunk := s.chunks[clientId]
+// cut makes a part of the messages of a chunk received since it was last cut, if any.
+func (s *Sender) cut(chunk *pending) {
+	if len(chunk.items) == 0 {
+		return
+	}
+	chunk.parts = append(chunk.parts, part{items: chunk.items, offset: chunk.received})
+	chunk.items = make([]any, 0, s.limits.Items)
+	chunk.bytes = 0
+}
+
+// sendChunk publishes the parts cut from the chunk of a client, in order, and the EOF of the client if the batch is
+// its last. Once the whole batch is published, it gets recorded and the client acknowledged. If publishing fails,
+// the parts left are kept, to publish them again with the same sequence IDs after retryDelay.
+func (s *Sender) sendChunk(clientAckChannels *sync.Map, clientId string, chunk *pending) {
+	if err := s.publishParts(clientId, chunk); err != nil {
+		logs.With(logs.ClientId, clientId).Errorf("Error publishing batch %d, retrying: %s", chunk.batchNum, err)
+		chunk.retryAt = time.Now().Add(retryDelay)
+		return
+	}
+	chunk.retryAt = time.Time{}
+	if !chunk.complete {
+		return
+	}
+
+	s.offsets.Published(s.id, clientId, chunk.batchNum)
+	sendAckThroughChannel(clientAckChannels, clientId)
+	delete(s.chunks, clientId)
+}
 
-	if len(chunk) >= int(s.maxChunkSize) || eof {
-		bytes, err := toBytes(messageId, chunk)
+func (s *Sender) publishParts(clientId string, chunk *pending) error {
+	messageId := utils.MatchMessageId(s.id)
+	for len(chunk.parts) > 0 {
+		p := chunk.parts[0]
+		bytes, err := toBytes(messageId, p.items)
 		if err != nil {
-			logs.Logger.Errorf("Error converting chunks to bytes: %s", err.Error())
+			return fmt.Errorf("error converting chunk to bytes: %w", err)
 		}
-
-		sequenceId := strings.Replace(clientId, "-", "", -1) + "-" + strconv.FormatUint(uint64(batchNum), 10)
-		headers := amqp.Header{MessageId: messageId, ClientId: clientId, SequenceId: sequenceId}
+		headers := amqp.Header{MessageId: messageId, ClientId: clientId, SequenceId: sequenceId(clientId, uint64(chunk.batchNum), p.offset)}
 		if err = s.publish(bytes, headers); err != nil {
-			logs.Logger.Errorf("Error publishing chunks: %s", err.Error())
+			return err
 		}
+		chunk.parts = chunk.parts[1:]
+	}
+
+	if chunk.complete && chunk.eof {
+		return s.sendEof(clientId, chunk.batchNum)
+	}
+	return nil
+}
 
-		s.chunks[clientId] = make([]any, 0, s.maxChunkSize)
-		sendAckThroughChannel(clientAckChannels, clientId)
+// sendEof sends the EOF of a client, which follows its last batch.
+func (s *Sender) sendEof(clientId string, batchNum uint32) error {
+	headers := amqp.Header{MessageId: message.EofId, ClientId: clientId, SequenceId: sequenceId(clientId, uint64(batchNum)+1, 0)}
+	if err := s.publish(amqp.EmptyEof, headers); err != nil {
+		return fmt.Errorf("error publishing EOF: %w", err)
 	}
+	return nil
+}
 
-	if eof {
-		sequenceId := strings.Replace(clientId, "-", "", -1) + "-" + strconv.FormatUint(uint64(batchNum+1), 10)
-		headers := amqp.Header{MessageId: message.EofId, ClientId: clientId, SequenceId: sequenceId}
+// expire cuts the chunks whose oldest message has waited for Flush, and publishes again the ones whose retry is due.
+func (s *Sender) expire(clientAckChannels *sync.Map, now time.Time) {
+	for clientId, chunk := range s.chunks {
+		if flush := s.flushAt(chunk); !flush.IsZero() && !now.Before(flush) {
+			if err := s.offsets.Cut(s.id, clientId, chunk.batchNum, chunk.received); err != nil {
+				logs.With(logs.ClientId, clientId).Errorf("Error recording cut of batch %d: %s", chunk.batchNum, err)
+				chunk.since = now // The cut is tried again once Flush passes again.
+				continue
+			}
+			s.cut(chunk)
+			s.sendChunk(clientAckChannels, clientId, chunk)
+		} else if !chunk.retryAt.IsZero() && !now.Before(chunk.retryAt) {
+			s.sendChunk(clientAckChannels, clientId, chunk)
+		}
+	}
+}
+
+// flushAt returns when a chunk gets cut by time, or the zero time if it does not.
+func (s *Sender) flushAt(chunk *pending) time.Time {
+	if s.limits.Flush <= 0 || len(chunk.items) == 0 || chunk.complete {
+		return time.Time{}
+	}
+	return chunk.since.Add(s.limits.Flush)
+}
 
-		if err := s.publish(amqp.EmptyEof, headers); err != nil {
-			logs.Logger.Errorf("Error publishing EOF: %s", err.Error())
+// nextDeadline returns when the next chunk gets cut by time or published again, or the zero time if none does.
+func (s *Sender) nextDeadline() time.Time {
+	var next time.Time
+	for _, chunk := range s.chunks {
+		for _, at := range []time.Time{s.flushAt(chunk), chunk.retryAt} {
+			if !at.IsZero() && (next.IsZero() || at.Before(next)) {
+				next = at
+			}
 		}
+	}
+	return next
+}
+
+// sequenceId returns the sequence ID of a chunk of a client, given its batch number and the offset of its last
+// message within the batch.
+func sequenceId(clientId string, batchNum uint64, offset int) string {
+	return strings.Replace(clientId, "-", "", -1) + "-" + strconv.FormatUint(batchNum<<offsetBits|uint64(offset), 10)
+}
+
+// abort discards the pending chunk of a client and sends a client abort to the broker, in place of an EOF.
+func (s *Sender) abort(clientId string) {
+	delete(s.chunks, clientId)
+
+	headers := amqp.Header{MessageId: message.ClientAbortId, ClientId: clientId, SequenceId: sequenceId(clientId, abortBatchNum, 0)}
+	if err := s.publish(amqp.EmptyEof, headers); err != nil {
+		logs.With(logs.Header(clientId, headers.SequenceId, headers.MessageId)...).Errorf("Error publishing client abort: %s", err.Error())
+	}
+}
+
+// resume drops the pending chunk of a client that opened a new session, since the client sends its batch again from
+// the start. The parts of the batch already sent are sent again with the same sequence IDs, and discarded as
+// duplicates.
+func (s *Sender) resume(clientId string) {
+	if chunk, ok := s.chunks[clientId]; ok {
+		logs.With(logs.ClientId, clientId).Infof("Discarding %d messages of batch %d, sent again", chunk.unsent(), chunk.batchNum)
 		delete(s.chunks, clientId)
 	}
 }
 
+// flush publishes the chunks left once the channel is closed, so that the messages received are not held until the
+// clients send them again. Partial chunks are cut like by time, recording their cut first, so that the batches get
+// cut in the same parts when sent again and the parts published now get discarded as duplicates. Clients are not
+// acknowledged, since their connections are closed by then, so they send their batches again once they reconnect.
+func (s *Sender) flush() {
+	for clientId, chunk := range s.chunks {
+		log := logs.With(logs.ClientId, clientId)
+		if len(chunk.items) > 0 && !chunk.complete {
+			if err := s.offsets.Cut(s.id, clientId, chunk.batchNum, chunk.received); err != nil {
+				log.Errorf("Error recording cut of batch %d, discarding %d messages: %s", chunk.batchNum, chunk.unsent(), err)
+				continue
+			}
+			s.cut(chunk)
+		}
+
+		n := chunk.unsent()
+		if err := s.publishParts(clientId, chunk); err != nil {
+			log.Errorf("Error publishing batch %d, discarding %d messages: %s", chunk.batchNum, chunk.unsent(), err)
+			continue
+		}
+		if chunk.complete {
+			s.offsets.Published(s.id, clientId, chunk.batchNum)
+		}
+		log.Infof("Flushed %d messages of batch %d", n, chunk.batchNum)
+	}
+	clear(s.chunks)
+}
+
+// unsent counts the messages of a chunk not published yet.
+func (p *pending) unsent() int {
+	n := len(p.items)
+	for _, part := range p.parts {
+		n += len(part.items)
+	}
+	return n
+}
+
+// publish sends a message to every destination. Each message starts a new trace, if sampled, whose root span
+// records the routing keys it was published with.
 func (s *Sender) publish(msg []byte, headers amqp.Header) error {
+	headers.TraceId = s.tracer.NewTrace()
+	span := s.tracer.Start(batchSpan, headers)
+	headers = span.Header(headers)
+
+	msgs := make([]amqp.Message, 0, len(s.dst))
+	keys := make([]string, 0, len(s.dst))
 	for _, dst := range s.dst {
 		key := shard.String(headers.SequenceId, dst.Key, dst.Consumers)
-		if err := s.broker.Publish(dst.Exchange, key, msg, headers); err != nil {
-			return err
-		}
+		msgs = append(msgs, amqp.Message{Exchange: dst.Exchange, Key: key, Body: msg, Header: headers})
+		keys = append(keys, key)
+	}
+
+	if err := s.broker.PublishBatch(msgs...); err != nil {
+		span.Fail(err)
+		return err
 	}
+	span.Finish(keys...)
 	return nil
 }
 
@@ -122,6 +363,6 @@ func sendAckThroughChannel(clientAckChannels *sync.Map, clientID string) {
 		clientChan := clientChanI.(chan []byte)
 		clientChan <- []byte{0x01}
 	} else {
-		logs.Logger.Errorf("No client channel found for clientID %v", clientID)
+		logs.With(logs.ClientId, clientID).Errorf("No client channel found")
 	}
 }
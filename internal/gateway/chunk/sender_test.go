@@ -0,0 +1,196 @@
+package chunk
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"tp1/internal/gateway/offsets"
+	"tp1/internal/gateway/utils"
+	"tp1/pkg/amqp"
+	"tp1/pkg/amqp/memory"
+	"tp1/pkg/message"
+	ioutils "tp1/pkg/utils/io"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func review(clientId string, batchNum uint32) Item {
+	return Item{Msg: message.DataCSVReviews{AppID: 10, AppName: "Portal", ReviewText: "great", ReviewScore: 1}, ClientId: clientId, BatchNum: batchNum, Size: 10}
+}
+
+// startSender starts a reviews sender that publishes to a queue it returns the deliveries of.
+func startSender(t *testing.T, clientAckChannels *sync.Map, limits Limits) (chan<- Item, <-chan amqp.Delivery, <-chan struct{}) {
+	b := memory.NewServer().NewBroker()
+	deliveries := declareReviews(t, b)
+	require.NoError(t, b.QueueBind(amqp.QueueBind{Exchange: "reviews", Name: "reviews_0", Key: "reviews-0"}))
+	channel, stopped := startSenderWith(t, b, clientAckChannels, limits, nil)
+	return channel, deliveries, stopped
+}
+
+// declareReviews declares the reviews exchange and its queue, not bound yet, and returns the deliveries of the queue.
+func declareReviews(t *testing.T, b amqp.MessageBroker) <-chan amqp.Delivery {
+	t.Cleanup(b.Close)
+	require.NoError(t, b.ExchangeDeclare(amqp.Exchange{Name: "reviews", Kind: "direct"}))
+	_, err := b.QueueDeclare("reviews_0")
+	require.NoError(t, err)
+	deliveries, err := b.Consume("reviews_0", "", true, false, 16)
+	require.NoError(t, err)
+	return deliveries
+}
+
+func startSenderWith(t *testing.T, b amqp.MessageBroker, clientAckChannels *sync.Map, limits Limits, store *offsets.Store) (chan<- Item, <-chan struct{}) {
+	channel := make(chan Item)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		dst := []amqp.Destination{{Exchange: "reviews", Key: "reviews-%d", Consumers: 1}}
+		Start(utils.ReviewsListener, clientAckChannels, channel, b, dst, limits, store, nil)
+	}()
+	return channel, stopped
+}
+
+func receiveSequenceId(t *testing.T, deliveries <-chan amqp.Delivery) string {
+	t.Helper()
+	select {
+	case d := <-deliveries:
+		return amqp.HeadersFromDelivery(d).SequenceId
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a chunk")
+		return ""
+	}
+}
+
+func assertNoChunk(t *testing.T, deliveries <-chan amqp.Delivery) {
+	t.Helper()
+	select {
+	case d := <-deliveries:
+		t.Fatalf("unexpected chunk %s", amqp.HeadersFromDelivery(d).SequenceId)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestStartFlushesPartialChunksOnceChannelIsClosed(t *testing.T) {
+	acks := make(chan []byte, 1)
+	clientAckChannels := &sync.Map{}
+	clientAckChannels.Store("0-1", acks)
+	clientAckChannels.Store("0-2", make(chan []byte))
+	store, err := offsets.Open(filepath.Join(t.TempDir(), "offsets.csv"), ioutils.SyncPolicy{Mode: ioutils.SyncAlways})
+	require.NoError(t, err)
+	t.Cleanup(store.Close)
+	b := memory.NewServer().NewBroker()
+	deliveries := declareReviews(t, b)
+	require.NoError(t, b.QueueBind(amqp.QueueBind{Exchange: "reviews", Name: "reviews_0", Key: "reviews-0"}))
+	channel, stopped := startSenderWith(t, b, clientAckChannels, Limits{Items: 3}, store)
+
+	for i := 0; i < 3; i++ {
+		channel <- review("0-1", 0)
+	}
+	channel <- review("0-2", 4)
+	channel <- review("0-2", 4)
+	close(channel)
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("sender did not stop once its channel was closed")
+	}
+	assert.Equal(t, "01-3", receiveSequenceId(t, deliveries))
+	assert.Equal(t, "02-1026", receiveSequenceId(t, deliveries))
+	assertNoChunk(t, deliveries)
+	assert.Len(t, acks, 1, "clients are acknowledged only for whole batches")
+	assert.Equal(t, []int{2}, store.Cuts(int(utils.ReviewsListener), "0-2", 4), "the partial chunk is cut like by time")
+}
+
+func TestBatchesLargerThanByteLimitAreSentInParts(t *testing.T) {
+	acks := make(chan []byte, 1)
+	clientAckChannels := &sync.Map{}
+	clientAckChannels.Store("0-1", acks)
+	channel, deliveries, _ := startSender(t, clientAckChannels, Limits{Items: 3, Bytes: 20})
+
+	channel <- review("0-1", 1)
+	channel <- review("0-1", 1)
+	assert.Equal(t, "01-258", receiveSequenceId(t, deliveries))
+	assert.Empty(t, acks, "the client must not be acknowledged before its batch is complete")
+
+	channel <- review("0-1", 1)
+	assert.Equal(t, "01-259", receiveSequenceId(t, deliveries))
+	assert.Len(t, acks, 1)
+
+	channel <- Item{ClientId: "0-1", BatchNum: 2}
+	<-acks
+	assert.Equal(t, "01-768", receiveSequenceId(t, deliveries))
+}
+
+func TestBatchesSentAgainAreCutInTheSameParts(t *testing.T) {
+	clientAckChannels := &sync.Map{}
+	clientAckChannels.Store("0-1", make(chan []byte, 1))
+	channel, deliveries, _ := startSender(t, clientAckChannels, Limits{Items: 5, Bytes: 20})
+
+	channel <- review("0-1", 0)
+	channel <- review("0-1", 0)
+	channel <- review("0-1", 0)
+	assert.Equal(t, "01-2", receiveSequenceId(t, deliveries))
+
+	channel <- Item{ClientId: "0-1", Resume: true}
+	channel <- review("0-1", 0)
+	channel <- review("0-1", 0)
+	assert.Equal(t, "01-2", receiveSequenceId(t, deliveries), "the part already sent must be discarded as a duplicate")
+	assertNoChunk(t, deliveries)
+}
+
+func TestBatchesThatFailToBePublishedAreRetriedBeforeTheAck(t *testing.T) {
+	acks := make(chan []byte, 1)
+	clientAckChannels := &sync.Map{}
+	clientAckChannels.Store("0-1", acks)
+	b := memory.NewServer().NewConfirmingBroker()
+	deliveries := declareReviews(t, b) // Unbound, so publishing fails as unroutable.
+	channel, _ := startSenderWith(t, b, clientAckChannels, Limits{Items: 2}, nil)
+
+	channel <- review("0-1", 0)
+	channel <- review("0-1", 0)
+	assertNoChunk(t, deliveries)
+	assert.Empty(t, acks, "the client must not be acknowledged before its batch is published")
+
+	require.NoError(t, b.QueueBind(amqp.QueueBind{Exchange: "reviews", Name: "reviews_0", Key: "reviews-0"}))
+	select {
+	case d := <-deliveries:
+		assert.Equal(t, "01-2", amqp.HeadersFromDelivery(d).SequenceId)
+	case <-time.After(2 * retryDelay):
+		t.Fatal("the batch was not published again")
+	}
+	select {
+	case <-acks:
+	case <-time.After(time.Second):
+		t.Fatal("the client was not acknowledged once its batch was published")
+	}
+}
+
+func TestBatchesCutByTimeAreCutThereAgainWhenSentAgain(t *testing.T) {
+	acks := make(chan []byte, 1)
+	clientAckChannels := &sync.Map{}
+	clientAckChannels.Store("0-1", acks)
+	store, err := offsets.Open(filepath.Join(t.TempDir(), "offsets.csv"), ioutils.SyncPolicy{Mode: ioutils.SyncAlways})
+	require.NoError(t, err)
+	t.Cleanup(store.Close)
+	b := memory.NewServer().NewBroker()
+	deliveries := declareReviews(t, b)
+	require.NoError(t, b.QueueBind(amqp.QueueBind{Exchange: "reviews", Name: "reviews_0", Key: "reviews-0"}))
+	channel, _ := startSenderWith(t, b, clientAckChannels, Limits{Items: 5, Flush: 50 * time.Millisecond}, store)
+
+	channel <- review("0-1", 0)
+	channel <- review("0-1", 0)
+	assert.Equal(t, "01-2", receiveSequenceId(t, deliveries))
+	assert.Empty(t, acks, "the client must not be acknowledged before its batch is complete")
+
+	channel <- Item{ClientId: "0-1", Resume: true}
+	for i := 0; i < 5; i++ {
+		channel <- review("0-1", 0)
+	}
+	assert.Equal(t, "01-2", receiveSequenceId(t, deliveries), "the batch sent again must be cut where it was cut by time")
+	assert.Equal(t, "01-5", receiveSequenceId(t, deliveries))
+	<-acks
+	assert.Empty(t, store.Cuts(int(utils.ReviewsListener), "0-1", 0), "the cuts are dropped once the batch is published")
+}
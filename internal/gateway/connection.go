@@ -2,8 +2,8 @@ package gateway
 
 import (
 	"net"
+	"time"
 	"tp1/internal/gateway/utils"
-	"tp1/pkg/logs"
 )
 
 const (
@@ -13,6 +13,7 @@ const (
 	reviewsAddrKey    = "gateway.reviews-address"
 	resultsAddrKey    = "gateway.results-address"
 	clientIdAddrKey   = "gateway.client-id-address"
+	sessionAddrKey    = "gateway.address"
 )
 
 func (g *Gateway) createGatewaySockets() error {
@@ -35,20 +36,27 @@ func (g *Gateway) createGatewaySockets() error {
 		return err
 	}
 
+	sessionListener, err := g.newListener(sessionAddrKey)
+	if err != nil {
+		return err
+	}
+
 	g.Listeners[utils.GamesListener] = gamesListener
 	g.Listeners[utils.ReviewsListener] = reviewsListener
 	g.Listeners[utils.ResultsListener] = resultsListener
 	g.Listeners[utils.ClientIdListener] = clientIdListener
+	g.Listeners[utils.SessionListener] = sessionListener
 
 	g.logListeners("games", gamesListener)
 	g.logListeners("reviews", reviewsListener)
 	g.logListeners("client id", clientIdListener)
 	g.logListeners("results", resultsListener)
+	g.logListeners("sessions", sessionListener)
 	return nil
 }
 
 func (g *Gateway) logListeners(listenerName string, listener net.Listener) {
-	logs.Logger.Infof("Gateway listening %s on %s", listenerName, listener.Addr().String())
+	g.log.Infof("Gateway listening %s on %s", listenerName, listener.Addr().String())
 }
 
 func (g *Gateway) newListener(configKey string) (net.Listener, error) {
@@ -56,21 +64,30 @@ func (g *Gateway) newListener(configKey string) (net.Listener, error) {
 	return net.Listen(TransportProtocol, addr)
 }
 
+// listenForConnections accepts connections until the gateway shuts down, handling each of them in its own goroutine.
+// Connections accepted while shutting down get their reads interrupted right away.
 func (g *Gateway) listenForConnections(listener int, handleConnection func(net.Conn)) error {
-	logs.Logger.Infof("Waiting for new client connections, listener %d...", listener)
-	for {
-		g.finishedMu.Lock()
-		if g.finished {
-			g.finishedMu.Unlock()
-			break
-		}
-		g.finishedMu.Unlock()
+	g.log.Infof("Waiting for new client connections, listener %d...", listener)
+	for !g.isFinished() {
 		c, err := g.Listeners[listener].Accept()
-		logs.Logger.Infof("Successfully established new connection! Listener %d...", listener)
 		if err != nil {
+			if g.isFinished() {
+				break
+			}
 			return err
 		}
-		go handleConnection(c)
+		g.log.Infof("Successfully established new connection! Listener %d...", listener)
+
+		g.conns.Store(c, struct{}{})
+		if g.isFinished() {
+			_ = c.SetReadDeadline(time.Now())
+		}
+		g.handlers.Add(1)
+		go func() {
+			defer g.handlers.Done()
+			defer g.conns.Delete(c)
+			handleConnection(c)
+		}()
 	}
 	return nil
 }
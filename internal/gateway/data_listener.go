@@ -27,6 +27,17 @@ func (g *Gateway) listenForData(listener int) error {
 
 func (g *Gateway) handleDataConnection(c net.Conn, msgId message.Id) {
 	clientId := g.readClientId(c)
+	log := g.log.With(logs.ClientId, clientId, logs.MessageId, msgId)
+
+	// A client reconnecting after its connection broke sends again the batch that was not acked.
+	waiting, aborted := g.cancelAbort(clientId)
+	if aborted {
+		log.Errorf("Client was aborted, refusing its data")
+		return
+	}
+	if waiting {
+		g.ChunkChans[utils.MatchListenerId(msgId)] <- chunk.Item{ClientId: clientId, Resume: true}
+	}
 	sends := 0
 	auxBuf := make([]byte, g.Config.Int(bufferSizeKey, defaultBufferSize))
 	buf := make([]byte, 0, g.Config.Int(bufferSizeKey, defaultBufferSize))
@@ -36,10 +47,10 @@ func (g *Gateway) handleDataConnection(c net.Conn, msgId message.Id) {
 
 	if msgId == message.ReviewId {
 		g.clientReviewsAckChannels.Store(clientId, clientChan)
-		go sendAcksToClient(&g.clientReviewsAckChannels, clientId, c)
+		go sendAcksToClient(&g.clientReviewsAckChannels, clientId, c, source(msgId))
 	} else {
 		g.clientGamesAckChannels.Store(clientId, clientChan)
-		go sendAcksToClient(&g.clientGamesAckChannels, clientId, c)
+		go sendAcksToClient(&g.clientGamesAckChannels, clientId, c, source(msgId))
 	}
 
 	for !finished {
@@ -51,8 +62,13 @@ func (g *Gateway) handleDataConnection(c net.Conn, msgId message.Id) {
 		g.finishedMu.Unlock()
 
 		n, err := c.Read(auxBuf)
+		if err != nil && g.isFinished() {
+			log.Infof("Stopped reading, shutting down")
+			break
+		}
 		if err != nil {
-			logs.Logger.Errorf("Error reading from listener: %s", err)
+			log.Errorf("Error reading from listener: %s", err)
+			g.abortLater(clientId)
 			return
 		}
 		buf = append(buf, auxBuf[:n]...)
@@ -86,27 +102,28 @@ func (g *Gateway) handleDataConnection(c net.Conn, msgId message.Id) {
 			}
 
 			sends++
-			finished = g.processPayload(msgId, buf[:payloadSize], payloadSize, clientId, batchNum)
+			batches.Inc(clientId, source(msgId))
+			finished = g.processPayload(log, msgId, buf[:payloadSize], payloadSize, clientId, batchNum)
 
 			buf = buf[payloadSize:]
 		}
 	}
-	logs.Logger.Infof("%d - Received %d messages", msgId, sends)
+	log.Infof("Received %d messages", sends)
 }
 
 func (g *Gateway) readClientId(c net.Conn) string {
 	clientId := make([]byte, id.ClientIdLen)
 	if err := io.ReadFull(c, clientId, id.ClientIdLen); err != nil {
-		logs.Logger.Errorf("Error reading client id from client: %s", err)
+		g.log.Errorf("Error reading client id from client: %s", err)
 	}
 	return id.DecodeClientId(clientId)
 }
 
 // processPayload parses the data received from the client and appends it to the corresponding chunks
 // Returns true if the end of the file was reached
-func (g *Gateway) processPayload(msgId message.Id, payload []byte, payloadSize uint32, clientId string, batchNum uint32) bool {
+func (g *Gateway) processPayload(log *logs.Entry, msgId message.Id, payload []byte, payloadSize uint32, clientId string, batchNum uint32) bool {
 	if isEndOfFile(payloadSize) {
-		logs.Logger.Infof("End of file received for message Id: %d", msgId)
+		log.Infof("End of file received")
 		g.sendMsgToChunkSender(msgId, nil, clientId, batchNum)
 		return true
 	}
@@ -127,23 +144,47 @@ func (g *Gateway) sendMsgToChunkSender(msgId message.Id, payload []byte, clientI
 		data = nil
 	}
 
-	g.ChunkChans[utils.MatchListenerId(msgId)] <- chunk.Item{Msg: data, ClientId: clientId, BatchNum: batchNum}
+	g.sendToChunkSender(msgId, data, len(payload), clientId, batchNum)
+}
+
+// sendToChunkSender sends a record of a client to the chunk sender of its data. A nil record is an EOF.
+func (g *Gateway) sendToChunkSender(msgId message.Id, data any, size int, clientId string, batchNum uint32) {
+	g.ChunkChans[utils.MatchListenerId(msgId)] <- chunk.Item{Msg: data, ClientId: clientId, BatchNum: batchNum, Size: size}
+}
+
+// abortClient tells every pipeline that a client disconnected before sending all its data, so that its state gets
+// purged. Each client is aborted only once, even if both of its data connections break.
+func (g *Gateway) abortClient(clientId string) {
+	if g.isFinished() { // Connections break when shutting down too.
+		return
+	}
+
+	if _, aborted := g.abortedClients.LoadOrStore(clientId, struct{}{}); aborted {
+		return
+	}
+	g.offsets.Abort(clientId)
+
+	g.log.With(logs.ClientId, clientId).Infof("Client disconnected before finishing. Aborting it")
+	for _, ch := range g.ChunkChans {
+		ch <- chunk.Item{ClientId: clientId, Abort: true}
+	}
 }
 
 func isEndOfFile(payloadSize uint32) bool {
 	return payloadSize == eofPayloadSize
 }
 
-func sendAcksToClient(clientAckChannels *sync.Map, clientId string, conn net.Conn) {
+func sendAcksToClient(clientAckChannels *sync.Map, clientId string, conn net.Conn, source string) {
 	if ch, ok := clientAckChannels.Load(clientId); ok {
 		ackChannel := ch.(chan []byte)
 		for ack := range ackChannel {
 			// Send the ack byte to the client
 			_, err := conn.Write(ack)
 			if err != nil {
-				logs.Logger.Errorf("Error sending ack to client %s: %v\n", clientId, err)
+				logs.With(logs.ClientId, clientId).Errorf("Error sending ack to client: %v", err)
 				break
 			}
+			acks.Inc(clientId, source)
 		}
 	}
 }
@@ -0,0 +1,59 @@
+package gateway
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// drain shuts the gateway down in order, so that nothing it received is lost or left half done:
+//   - It stops accepting connections and interrupts the reads of the open ones. Clients resend the batches the gateway
+//     did not acknowledge once they reconnect.
+//   - Once every connection is handled, it closes the chunk channels so that senders flush their partial chunks.
+//   - It stops consuming results and waits for the ones taken to be logged, synced to disk and acknowledged.
+//
+// Draining gives up after `gateway.shutdown_timeout_ms`, leaving the results not acknowledged by then to be
+// redelivered once the broker is closed.
+func (g *Gateway) drain(listeners, senders *sync.WaitGroup, results, logged <-chan struct{}) {
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		g.finishedMu.Lock()
+		g.finished = true
+		g.finishedMu.Unlock()
+
+		for _, l := range g.Listeners {
+			_ = l.Close()
+		}
+		g.conns.Range(func(c, _ any) bool {
+			_ = c.(net.Conn).SetReadDeadline(time.Now())
+			return true
+		})
+		listeners.Wait()
+		g.handlers.Wait()
+
+		for _, ch := range g.ChunkChans {
+			close(ch)
+		}
+		senders.Wait()
+		g.offsets.Close()
+
+		if err := g.broker.Cancel(g.resultsTag); err != nil {
+			g.log.Errorf("Failed to cancel consumer %s: %s", g.resultsTag, err.Error())
+		}
+		<-results
+		close(g.logChannel)
+		<-logged
+		if err := g.recovery.Sync(); err != nil {
+			g.log.Errorf("Failed to sync recovery log: %s", err)
+		}
+		g.recovery.Close()
+	}()
+
+	select {
+	case <-drained:
+		g.log.Infof("Drained clients and results in process")
+	case <-time.After(g.shutdown):
+		g.log.Warningf("Timed out draining after %s. Results not acknowledged yet will be redelivered", g.shutdown)
+	}
+}
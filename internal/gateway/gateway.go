@@ -1,15 +1,19 @@
 package gateway
 
 import (
+	"context"
+	"fmt"
 	"net"
 	"os"
 	"os/signal"
 	"strconv"
 	"sync"
 	"syscall"
+	"time"
 	"tp1/pkg/sequence"
 
 	"tp1/internal/gateway/chunk"
+	"tp1/internal/gateway/offsets"
 	"tp1/internal/gateway/persistence"
 	"tp1/internal/gateway/rabbit"
 	"tp1/internal/gateway/utils"
@@ -19,39 +23,75 @@ import (
 	"tp1/pkg/config/provider"
 	"tp1/pkg/dup"
 	"tp1/pkg/logs"
+	"tp1/pkg/message"
 	"tp1/pkg/recovery"
+	"tp1/pkg/tracing"
 	"tp1/pkg/utils/id"
+	ioutils "tp1/pkg/utils/io"
 )
 
 const (
 	configFilePath   = "config.toml"
-	connections      = 4
+	connections      = 5
 	chunkChans       = 2
 	exchangeNameKey  = "rabbitmq.exchange_name"
 	workerIdKey      = "worker-id"
 	chunkSizeKey     = "gateway.chunk_size"
 	chunkSizeDefault = 100
-	signals          = 2
+	chunkBytesKey    = "gateway.chunk_max_bytes"
+	chunkFlushKey    = "gateway.chunk_flush_ms"
+	maxBytesDefault  = 1 << 20
+	fsyncKey         = "fsync"
+	workerUuidKey    = "worker-uuid"
+	tracingKey       = "tracing"
+	service          = "gateway"
+	shutdownKey      = "gateway.shutdown_timeout_ms"
+	defaultShutdown  = 5000
+	offsetsKey       = "gateway.offsets_path"
+	offsetsFile      = "offsets.csv"
+	resumeKey        = "gateway.resume_timeout_ms"
+	defaultResume    = 30000
+	resultsConsumer  = "-results"
 )
 
 type Gateway struct {
 	Config                   config.Config
+	id                       uint8 // id is the worker ID, which prefixes the IDs of the clients the gateway owns.
 	broker                   amqp.MessageBroker
 	queues                   []amqp.Queue //order: reviews, games_platform, games_action, games_indie
 	destinations             []amqp.Destination
+	limits                   chunk.Limits // limits bound the chunks of each client.
 	exchange                 string
 	Listeners                [connections]net.Listener
 	ChunkChans               [chunkChans]chan chunk.Item
 	finished                 bool
 	finishedMu               sync.Mutex
 	IdGenerator              *id.Generator
-	IdGeneratorMu            sync.Mutex
 	clientChannels           sync.Map
 	clientGamesAckChannels   sync.Map
 	clientReviewsAckChannels sync.Map
+	abortedClients           sync.Map
 	recovery                 *recovery.Handler
-	logChannel               chan recovery.Record
+	logChannel               chan logRequest
 	dup                      *dup.Handler
+	tracer                   *tracing.Tracer // tracer is nil unless the `tracing` section is set.
+	log                      *logs.Entry     // log attaches the UUID of the gateway to its records.
+	ctx                      context.Context // ctx is done once the gateway is signaled to shut down.
+	conns                    sync.Map        // conns are the client connections being handled.
+	handlers                 sync.WaitGroup
+	resultsTag               string // resultsTag is the consumer tag of the results queue.
+	shutdown                 time.Duration
+	offsets                  *offsets.Store // offsets are the batches published of each client.
+	resume                   time.Duration  // resume is how long a client has to resume a broken session.
+	resuming                 map[string]*time.Timer
+	resumingMu               sync.Mutex
+	sessions                 sync.Map // sessions are the open sessions, by client ID.
+}
+
+// logRequest is a record to be logged, along with the callback to call once it is durable.
+type logRequest struct {
+	record recovery.Record
+	done   func(error)
 }
 
 func New() (*Gateway, error) {
@@ -65,7 +105,16 @@ func New() (*Gateway, error) {
 		return nil, err
 	}
 
-	b, err := broker.NewBroker()
+	limits := chunk.Limits{
+		Items: cfg.Uint8(chunkSizeKey, chunkSizeDefault),
+		Bytes: cfg.Int(chunkBytesKey, maxBytesDefault),
+		Flush: time.Duration(cfg.Int(chunkFlushKey, 0)) * time.Millisecond,
+	}
+	if limits.Items == 0 {
+		return nil, fmt.Errorf("%s must be positive", chunkSizeKey)
+	}
+
+	b, err := broker.NewBroker(cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -75,69 +124,107 @@ func New() (*Gateway, error) {
 		return nil, err
 	}
 
-	recoveryHandler, err := recovery.NewHandler()
+	syncPolicy, err := ioutils.SyncPolicyFromConfig(cfg, fsyncKey)
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryHandler, err := recovery.NewHandler(syncPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	offsetsStore, err := offsets.Open(cfg.String(offsetsKey, offsetsFile), syncPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	uuid := os.Getenv(workerUuidKey)
+	tracer, err := tracing.NewTracer(cfg, tracingKey, service, uuid)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Gateway{
 		Config:                   cfg,
+		id:                       uint8(gId),
 		broker:                   b,
 		queues:                   queues,
 		exchange:                 cfg.String(exchangeNameKey, ""),
 		destinations:             destinations,
+		limits:                   limits,
 		ChunkChans:               [chunkChans]chan chunk.Item{make(chan chunk.Item), make(chan chunk.Item)},
 		finished:                 false,
 		finishedMu:               sync.Mutex{},
 		Listeners:                [connections]net.Listener{},
-		IdGenerator:              id.NewGenerator(uint8(gId), ""),
-		IdGeneratorMu:            sync.Mutex{},
+		IdGenerator:              id.NewGenerator(uint8(gId), "", syncPolicy),
 		clientChannels:           sync.Map{},
 		clientGamesAckChannels:   sync.Map{},
 		clientReviewsAckChannels: sync.Map{},
 		recovery:                 recoveryHandler,
-		logChannel:               make(chan recovery.Record),
+		logChannel:               make(chan logRequest),
 		dup:                      dup.NewHandler(),
+		tracer:                   tracer,
+		log:                      logs.With(logs.Node, uuid),
+		ctx:                      context.Background(),
+		resultsTag:               uuid + resultsConsumer,
+		shutdown:                 time.Duration(cfg.Int(shutdownKey, defaultShutdown)) * time.Millisecond,
+		offsets:                  offsetsStore,
+		resume:                   time.Duration(cfg.Int(resumeKey, defaultResume)) * time.Millisecond,
+		resuming:                 make(map[string]*time.Timer),
 	}, nil
 }
 
 func (g *Gateway) Start() {
+	defer g.tracer.Close()
 	defer g.broker.Close()
 	defer g.IdGenerator.Close()
 
-	sigs := make(chan os.Signal, signals)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	g.ctx = ctx
 
-	go func() {
-		<-sigs
-		g.HandleSIGTERM()
-	}()
+	g.serveMetrics()
 
 	err := g.createGatewaySockets()
 	if err != nil {
-		logs.Logger.Errorf("Failed to create gateway socket: %s", err.Error())
+		g.log.Errorf("Failed to create gateway socket: %s", err.Error())
 		return
 	}
 
-	go chunk.Start(utils.GamesListener, &g.clientGamesAckChannels,
-		g.ChunkChans[utils.GamesListener], g.broker, g.destinations[1:],
-		g.Config.Uint8(chunkSizeKey, chunkSizeDefault),
-	)
-
-	go chunk.Start(utils.ReviewsListener, &g.clientReviewsAckChannels,
-		g.ChunkChans[utils.ReviewsListener], g.broker, g.destinations[0:1],
-		g.Config.Uint8(chunkSizeKey, chunkSizeDefault),
-	)
+	senders := &sync.WaitGroup{}
+	senders.Add(chunkChans)
+	go func() {
+		defer senders.Done()
+		chunk.Start(utils.GamesListener, &g.clientGamesAckChannels,
+			g.ChunkChans[utils.GamesListener], g.broker, g.destinations[1:], g.limits, g.offsets, g.tracer,
+		)
+	}()
+	go func() {
+		defer senders.Done()
+		chunk.Start(utils.ReviewsListener, &g.clientReviewsAckChannels,
+			g.ChunkChans[utils.ReviewsListener], g.broker, g.destinations[0:1], g.limits, g.offsets, g.tracer,
+		)
+	}()
 
-	go g.ListenResults()
-	go g.logResults()
+	results := make(chan struct{})
+	go func() {
+		defer close(results)
+		g.ListenResults()
+	}()
+	logged := make(chan struct{})
+	go func() {
+		defer close(logged)
+		g.logResults()
+	}()
 
-	wg := &sync.WaitGroup{}
-	wg.Add(connections)
-	g.startListeners(wg)
-	wg.Wait()
+	listeners := &sync.WaitGroup{}
+	listeners.Add(connections)
+	g.startListeners(listeners)
 
-	g.free(sigs)
+	<-ctx.Done()
+	g.log.Infof("Received SIGTERM, shutting down")
+	g.drain(listeners, senders, results, logged)
 }
 
 func (g *Gateway) startListeners(wg *sync.WaitGroup) {
@@ -145,13 +232,14 @@ func (g *Gateway) startListeners(wg *sync.WaitGroup) {
 	go g.startDataListener(wg, utils.ReviewsListener, "reviews")
 	go g.startDataListener(wg, utils.GamesListener, "games")
 	go g.startResultsListener(wg)
+	go g.startSessionListener(wg)
 }
 
 func (g *Gateway) startNewClientListener(wg *sync.WaitGroup) {
 	defer wg.Done()
 	err := g.listenForNewClient()
 	if err != nil {
-		logs.Logger.Errorf("Error listening new client: %s", err)
+		g.log.Errorf("Error listening new client: %s", err)
 	}
 }
 
@@ -159,7 +247,7 @@ func (g *Gateway) startDataListener(wg *sync.WaitGroup, listener int, listenerTy
 	defer wg.Done()
 	err := g.listenForData(listener)
 	if err != nil {
-		logs.Logger.Errorf("Error listening %s: %s", listenerType, err)
+		g.log.Errorf("Error listening %s: %s", listenerType, err)
 	}
 }
 
@@ -167,14 +255,22 @@ func (g *Gateway) startResultsListener(wg *sync.WaitGroup) {
 	defer wg.Done()
 	err := g.listenResultsRequests()
 	if err != nil {
-		logs.Logger.Errorf("Error listening results: %s", err)
+		g.log.Errorf("Error listening results: %s", err)
+	}
+}
+
+func (g *Gateway) startSessionListener(wg *sync.WaitGroup) {
+	defer wg.Done()
+	err := g.listenForSessions()
+	if err != nil {
+		g.log.Errorf("Error listening sessions: %s", err)
 	}
 }
 
 func (g *Gateway) recoverResults(
 	ch chan recovery.Record,
-	clientAccumulatedResults map[string]map[uint8]string,
-	recoveredMessages map[string]map[uint8]string,
+	clientAccumulatedResults map[string]map[uint8]message.Result,
+	recoveredMessages map[string]map[uint8]message.Result,
 ) {
 	go g.recovery.Recover(ch)
 
@@ -185,13 +281,20 @@ func (g *Gateway) recoverResults(
 		if string(recoveredMsg.Message()) != utils.Ack {
 			seqSource, err := sequence.SrcFromString(sequenceId)
 			if err != nil {
-				logs.Logger.Errorf("Failed to parse sequence source: %v", err)
+				g.logMessage(recoveredMsg.Header()).Errorf("Failed to parse sequence source: %v", err)
 				continue
 			}
 
 			g.dup.RecoverSequenceId(*seqSource)
 		}
 
+		if recoveredMsg.Header().MessageId == message.ClientAbortId {
+			g.recordAbort(recoveredMsg.Header().ClientId)
+			delete(clientAccumulatedResults, recoveredMsg.Header().ClientId)
+			delete(recoveredMessages, recoveredMsg.Header().ClientId)
+			continue
+		}
+
 		switch originId {
 		case amqp.Query1OriginId, amqp.Query2OriginId, amqp.Query3OriginId:
 			persistence.HandleSimpleQueryRecovery(recoveredMsg, recoveredMessages)
@@ -202,33 +305,29 @@ func (g *Gateway) recoverResults(
 				recoveredMessages,
 			)
 		default:
-			logs.Logger.Infof("Header x-origin-id does not match any known origin IDs, got: %v", originId)
+			g.logMessage(recoveredMsg.Header()).Infof("Header x-origin-id does not match any known origin IDs, got: %v", originId)
 		}
 	}
 }
 
 func (g *Gateway) logResults() {
-	for record := range g.logChannel {
-		if err := g.recovery.Log(record); err != nil {
-			logs.Logger.Errorf("Failed to log record: %s", err)
+	for req := range g.logChannel {
+		if err := g.recovery.Log(req.record, req.done); err != nil {
+			g.logMessage(req.record.Header()).Errorf("Failed to log record: %s", err)
+			if req.done != nil {
+				req.done(err)
+			}
 		}
 	}
 }
 
-func (g *Gateway) free(sigs chan os.Signal) {
-	g.broker.Close()
-	_ = g.Listeners[utils.ReviewsListener].Close()
-	_ = g.Listeners[utils.GamesListener].Close()
-	_ = g.Listeners[utils.ResultsListener].Close()
-	_ = g.Listeners[utils.ClientIdListener].Close()
-	close(g.ChunkChans[utils.ReviewsListener])
-	close(g.ChunkChans[utils.GamesListener])
-	close(sigs)
+// logMessage returns the gateway's log entry with the client, sequence ID and message ID of the header attached.
+func (g *Gateway) logMessage(header amqp.Header) *logs.Entry {
+	return g.log.With(logs.Header(header.ClientId, header.SequenceId, header.MessageId)...)
 }
 
-func (g *Gateway) HandleSIGTERM() {
-	logs.Logger.Info("Received SIGTERM, shutting down")
+func (g *Gateway) isFinished() bool {
 	g.finishedMu.Lock()
-	g.finished = true
-	g.finishedMu.Unlock()
+	defer g.finishedMu.Unlock()
+	return g.finished
 }
@@ -0,0 +1,35 @@
+package gateway
+
+import (
+	"tp1/pkg/message"
+	"tp1/pkg/metrics"
+)
+
+const (
+	metricsAddressKey     = "gateway.metrics-address"
+	defaultMetricsAddress = ":9100"
+	reviewsSource         = "reviews"
+	gamesSource           = "games"
+)
+
+var (
+	batches = metrics.NewCounter("gateway_batches_total",
+		"Batches received from each client, by source: games or reviews.", "client_id", "source")
+	acks = metrics.NewCounter("gateway_acks_total",
+		"Acks sent to each client, by source: games or reviews.", "client_id", "source")
+)
+
+// serveMetrics exposes the gateway metrics over HTTP at `gateway.metrics-address`, unless it is empty.
+func (g *Gateway) serveMetrics() {
+	if err := metrics.Serve(g.Config.String(metricsAddressKey, defaultMetricsAddress)); err != nil {
+		g.log.Errorf("Failed to serve metrics: %s", err.Error())
+	}
+}
+
+// source returns the source label of the data with the given message ID.
+func source(msgId message.Id) string {
+	if msgId == message.ReviewId {
+		return reviewsSource
+	}
+	return gamesSource
+}
@@ -14,12 +14,14 @@ func (g *Gateway) listenForNewClient() error {
 }
 
 func (g *Gateway) assignClientId(c net.Conn) {
-	g.IdGeneratorMu.Lock()
-	clientId := g.IdGenerator.GetId()
-	g.IdGeneratorMu.Unlock()
+	clientId, err := g.IdGenerator.GetId()
+	if err != nil {
+		g.log.Errorf("Error assigning client id: %s", err)
+		return
+	}
 
-	err := io.SendAll(c, id.EncodeClientId(clientId))
+	err = io.SendAll(c, id.EncodeClientId(clientId))
 	if err != nil {
-		logs.Logger.Errorf("Error sending client id to client: %s", err)
+		g.log.With(logs.ClientId, clientId).Errorf("Error sending client id to client: %s", err)
 	}
 }
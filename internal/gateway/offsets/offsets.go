@@ -0,0 +1,314 @@
+package offsets
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+
+	"tp1/pkg/logs"
+	"tp1/pkg/protocol"
+	ioutils "tp1/pkg/utils/io"
+)
+
+const (
+	nextKind  = "next"
+	abortKind = "abort"
+	cutKind   = "cut"
+	tmpExt    = ".tmp"
+	fileMode  = 0666
+)
+
+// Store keeps the number of the next batch the gateway expects from each client in each data stream, which follows
+// the last batch it published, and the clients it aborted. Clients resume their sessions from there. It also keeps
+// where the batches not published yet were cut by time, so that a batch sent again gets cut in the same parts. Every
+// update is appended to a file, which is compacted when loaded.
+type Store struct {
+	mu      sync.Mutex
+	file    *ioutils.File
+	syncer  *ioutils.Syncer
+	next    map[string]*[protocol.DataStreams]uint32
+	aborted map[string]bool
+	cuts    map[batch][]int // cuts are the offsets within a batch of the last message of each part cut by time.
+}
+
+// batch identifies a batch of a client in a stream.
+type batch struct {
+	clientId string
+	stream   int
+	num      uint32
+}
+
+// Open loads the store persisted in path, creating it if missing, and syncs its updates according to policy.
+func Open(path string, policy ioutils.SyncPolicy) (*Store, error) {
+	s := &Store{
+		next:    make(map[string]*[protocol.DataStreams]uint32),
+		aborted: make(map[string]bool),
+		cuts:    make(map[batch][]int),
+	}
+	if err := s.load(path); err != nil {
+		return nil, err
+	}
+	if err := compact(path, s.records()); err != nil {
+		return nil, err
+	}
+
+	file, err := ioutils.NewFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s.file = file
+	s.syncer = ioutils.NewSyncer(policy, file.Sync)
+	return s, nil
+}
+
+func (s *Store) load(path string) error {
+	file, err := ioutils.NewFile(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	for {
+		record, err := file.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err = s.apply(record); err != nil {
+			recordLog(record).Errorf("Skipping offsets record %v: %s", record, err)
+		}
+	}
+}
+
+// compact writes the records to a temporary file, which then replaces the one at path, so that a crash while
+// compacting leaves either of them whole.
+func compact(path string, records [][]string) error {
+	tmp := path + tmpExt
+	file, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, fileMode)
+	if err != nil {
+		return err
+	}
+	if err = csv.NewWriter(file).WriteAll(records); err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *Store) apply(record []string) error {
+	switch {
+	case len(record) == 2 && record[0] == abortKind:
+		s.forget(record[1])
+	case len(record) == 5 && record[0] == cutKind:
+		b, err := parseBatch(record[1:4])
+		if err != nil {
+			return err
+		}
+		offset, err := strconv.Atoi(record[4])
+		if err != nil {
+			return err
+		}
+		if !s.aborted[b.clientId] && b.num >= s.Next(b.clientId)[b.stream] {
+			s.cuts[b] = append(s.cuts[b], offset)
+		}
+	case len(record) == 4 && record[0] == nextKind:
+		b, err := parseBatch(record[1:])
+		if err != nil {
+			return err
+		}
+		s.advance(b.clientId, b.stream, b.num)
+	default:
+		return fmt.Errorf("unknown record")
+	}
+	return nil
+}
+
+// records returns the records that rebuild the store.
+func (s *Store) records() [][]string {
+	records := make([][]string, 0, len(s.aborted)+len(s.next)*protocol.DataStreams)
+	for clientId := range s.aborted {
+		records = append(records, []string{abortKind, clientId})
+	}
+	for clientId, next := range s.next {
+		for stream, num := range next {
+			if num > 0 {
+				records = append(records, nextRecord(clientId, stream, num))
+			}
+		}
+	}
+	for b, offsets := range s.cuts {
+		for _, offset := range offsets {
+			records = append(records, cutRecord(b, offset))
+		}
+	}
+	return records
+}
+
+// advance sets the next batch of a stream of a client, unless it expects a later one. Returns whether it changed.
+func (s *Store) advance(clientId string, stream int, num uint32) bool {
+	next, ok := s.next[clientId]
+	if !ok {
+		next = &[protocol.DataStreams]uint32{}
+		s.next[clientId] = next
+	}
+	if num <= next[stream] {
+		return false
+	}
+	for b := range s.cuts {
+		if b.clientId == clientId && b.stream == stream && b.num < num {
+			delete(s.cuts, b)
+		}
+	}
+	next[stream] = num
+	return true
+}
+
+// forget marks a client as aborted, dropping the rest of what the store keeps of it.
+func (s *Store) forget(clientId string) {
+	s.aborted[clientId] = true
+	delete(s.next, clientId)
+	for b := range s.cuts {
+		if b.clientId == clientId {
+			delete(s.cuts, b)
+		}
+	}
+}
+
+// Next returns the number of the next batch expected from a client in each data stream.
+func (s *Store) Next(clientId string) [protocol.DataStreams]uint32 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if next, ok := s.next[clientId]; ok {
+		return *next
+	}
+	return [protocol.DataStreams]uint32{}
+}
+
+// Published records that the given batch of a client was published, so the next one is expected.
+func (s *Store) Published(stream int, clientId string, batchNum uint32) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.aborted[clientId] || !s.advance(clientId, stream, batchNum+1) {
+		return
+	}
+	s.write(nextRecord(clientId, stream, batchNum+1))
+}
+
+// Abort records that a client was aborted, so that it can no longer resume its session.
+func (s *Store) Abort(clientId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.aborted[clientId] {
+		return
+	}
+	s.forget(clientId)
+	s.write([]string{abortKind, clientId})
+}
+
+// Cut records that a batch of a client not published yet was cut by time after the message at the given offset. It
+// returns once the cut is synced, so that the part cut is published only if the batch gets cut there again when sent
+// again.
+func (s *Store) Cut(stream int, clientId string, batchNum uint32, offset int) error {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	if s.aborted[clientId] {
+		s.mu.Unlock()
+		return nil
+	}
+	b := batch{clientId: clientId, stream: stream, num: batchNum}
+	s.cuts[b] = append(s.cuts[b], offset)
+	err := s.file.Write(cutRecord(b, offset))
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("error writing cut: %w", err)
+	}
+
+	synced := make(chan error, 1)
+	s.syncer.Written(func(err error) { synced <- err })
+	if err = <-synced; err != nil {
+		return fmt.Errorf("error syncing cut: %w", err)
+	}
+	return nil
+}
+
+// Cuts returns the offsets a batch of a client was cut by time at, in order.
+func (s *Store) Cuts(stream int, clientId string, batchNum uint32) []int {
+	if s == nil {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.cuts[batch{clientId: clientId, stream: stream, num: batchNum}])
+}
+
+// Aborted tells whether a client was aborted.
+func (s *Store) Aborted(clientId string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.aborted[clientId]
+}
+
+func (s *Store) write(record []string) {
+	if err := s.file.Write(record); err != nil {
+		recordLog(record).Errorf("Error writing offsets: %v", err)
+		return
+	}
+	s.syncer.Written(func(err error) {
+		if err != nil {
+			recordLog(record).Errorf("Error syncing offsets: %v", err)
+		}
+	})
+}
+
+func (s *Store) Close() {
+	s.syncer.Flush()
+	s.file.Close()
+}
+
+// recordLog returns an entry with the client of a record attached. Records too short to name one log without it.
+func recordLog(record []string) *logs.Entry {
+	if len(record) < 2 {
+		return nil
+	}
+	return logs.With(logs.ClientId, record[1])
+}
+
+func nextRecord(clientId string, stream int, num uint32) []string {
+	return []string{nextKind, clientId, strconv.Itoa(stream), strconv.FormatUint(uint64(num), 10)}
+}
+
+func cutRecord(b batch, offset int) []string {
+	return []string{cutKind, b.clientId, strconv.Itoa(b.stream), strconv.FormatUint(uint64(b.num), 10), strconv.Itoa(offset)}
+}
+
+// parseBatch parses the client, stream and number of a batch, as written in a record.
+func parseBatch(fields []string) (batch, error) {
+	stream, err := strconv.Atoi(fields[1])
+	if err != nil || stream < 0 || stream >= protocol.DataStreams {
+		return batch{}, fmt.Errorf("invalid stream %s", fields[1])
+	}
+	num, err := strconv.ParseUint(fields[2], 10, 32)
+	if err != nil {
+		return batch{}, err
+	}
+	return batch{clientId: fields[0], stream: stream, num: uint32(num)}, nil
+}
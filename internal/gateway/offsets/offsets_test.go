@@ -0,0 +1,79 @@
+package offsets
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"tp1/pkg/protocol"
+	ioutils "tp1/pkg/utils/io"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublishedBatchesSurviveRestarts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "offsets.csv")
+	s, err := Open(path, ioutils.SyncPolicy{Mode: ioutils.SyncAlways})
+	require.NoError(t, err)
+
+	s.Published(int(protocol.GamesStream), "0-1", 0)
+	s.Published(int(protocol.GamesStream), "0-1", 1)
+	s.Published(int(protocol.ReviewsStream), "0-1", 4)
+	s.Published(int(protocol.GamesStream), "0-1", 0) // A batch published again does not go back.
+	s.Published(int(protocol.GamesStream), "0-2", 7)
+	s.Abort("0-2")
+	s.Close()
+
+	s, err = Open(path, ioutils.SyncPolicy{Mode: ioutils.SyncAlways})
+	require.NoError(t, err)
+	defer s.Close()
+	assert.Equal(t, [protocol.DataStreams]uint32{2, 5}, s.Next("0-1"))
+	assert.Equal(t, [protocol.DataStreams]uint32{}, s.Next("0-2"))
+	assert.True(t, s.Aborted("0-2"))
+	assert.False(t, s.Aborted("0-1"))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Len(t, strings.Split(strings.TrimSpace(string(data)), "\n"), 3, "the file is compacted when loaded")
+}
+
+func TestInterruptedCompactionKeepsTheStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "offsets.csv")
+	s, err := Open(path, ioutils.SyncPolicy{Mode: ioutils.SyncAlways})
+	require.NoError(t, err)
+	s.Published(int(protocol.GamesStream), "0-1", 3)
+	s.Close()
+
+	// A crash while compacting leaves the temporary file half written.
+	require.NoError(t, os.WriteFile(path+tmpExt, []byte("next,0-1"), 0666))
+
+	s, err = Open(path, ioutils.SyncPolicy{Mode: ioutils.SyncAlways})
+	require.NoError(t, err)
+	defer s.Close()
+	assert.Equal(t, [protocol.DataStreams]uint32{4, 0}, s.Next("0-1"))
+	assert.NoFileExists(t, path+tmpExt)
+}
+
+func TestCutsAreKeptUntilTheirBatchIsPublished(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "offsets.csv")
+	s, err := Open(path, ioutils.SyncPolicy{Mode: ioutils.SyncAlways})
+	require.NoError(t, err)
+	games := int(protocol.GamesStream)
+	require.NoError(t, s.Cut(games, "0-1", 0, 3))
+	require.NoError(t, s.Cut(games, "0-1", 0, 7))
+	require.NoError(t, s.Cut(games, "0-2", 4, 1))
+	s.Abort("0-2")
+	s.Close()
+
+	s, err = Open(path, ioutils.SyncPolicy{Mode: ioutils.SyncAlways})
+	require.NoError(t, err)
+	defer s.Close()
+	assert.Equal(t, []int{3, 7}, s.Cuts(games, "0-1", 0))
+	assert.Empty(t, s.Cuts(int(protocol.ReviewsStream), "0-1", 0))
+	assert.Empty(t, s.Cuts(games, "0-2", 4), "the cuts of aborted clients are dropped")
+
+	s.Published(games, "0-1", 0)
+	assert.Empty(t, s.Cuts(games, "0-1", 0))
+}
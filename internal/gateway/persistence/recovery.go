@@ -11,7 +11,7 @@ import (
 // HandleSimpleQueryRecovery Handle recovery for Q1, Q2, and Q3
 func HandleSimpleQueryRecovery(
 	recoveredMsg recovery.Record,
-	recoveredMessages map[string]map[uint8]string,
+	recoveredMessages map[string]map[uint8]message.Result,
 ) {
 	clientId := recoveredMsg.Header().ClientId
 	body := recoveredMsg.Message()
@@ -20,21 +20,24 @@ func HandleSimpleQueryRecovery(
 	if string(body) == utils.Ack {
 		removeProcessedMessage(recoveredMessages, clientId, originId)
 	} else {
-		parsedBody, _ := utils.ParseMessageBody(originId, body)
-		bodyStr, _ := utils.ResultBodyToString(originId, parsedBody)
+		parsedBody, err := utils.ParseMessageBody(originId, body)
+		if err != nil {
+			return
+		}
+		result, _ := utils.ResultOf(originId, parsedBody)
 
 		if _, exists := recoveredMessages[clientId]; !exists {
-			recoveredMessages[clientId] = make(map[uint8]string)
+			recoveredMessages[clientId] = make(map[uint8]message.Result)
 		}
-		recoveredMessages[clientId][originId] = bodyStr
+		recoveredMessages[clientId][originId] = result
 	}
 }
 
 // HandleAccumulatingQueryRecovery Handle recovery for Q4 and Q5
 func HandleAccumulatingQueryRecovery(
 	recoveredMsg recovery.Record,
-	clientAccumulatedResults map[string]map[uint8]string,
-	recoveredMessages map[string]map[uint8]string,
+	clientAccumulatedResults map[string]map[uint8]message.Result,
+	recoveredMessages map[string]map[uint8]message.Result,
 ) {
 	clientId := recoveredMsg.Header().ClientId
 	body := recoveredMsg.Message()
@@ -55,7 +58,7 @@ func HandleAccumulatingQueryRecovery(
 }
 
 func removeProcessedMessage(
-	messageMap map[string]map[uint8]string,
+	messageMap map[string]map[uint8]message.Result,
 	clientId string,
 	originId uint8,
 ) {
@@ -70,38 +73,38 @@ func removeProcessedMessage(
 func handleEofCase(
 	clientId string,
 	originId uint8,
-	clientAccumulatedResults map[string]map[uint8]string,
-	recoveredMessages map[string]map[uint8]string,
+	clientAccumulatedResults map[string]map[uint8]message.Result,
+	recoveredMessages map[string]map[uint8]message.Result,
 ) {
 
 	if _, ok := clientAccumulatedResults[clientId]; !ok {
-		clientAccumulatedResults[clientId] = make(map[uint8]string)
+		clientAccumulatedResults[clientId] = make(map[uint8]message.Result)
 	}
 
 	if _, ok := recoveredMessages[clientId]; !ok {
-		recoveredMessages[clientId] = make(map[uint8]string)
+		recoveredMessages[clientId] = make(map[uint8]message.Result)
 	}
 
 	result := clientAccumulatedResults[clientId][originId]
-
-	if originId == amqp.Query4OriginId {
-		resultStr := message.ToQ4ResultString(result)
-		recoveredMessages[clientId][originId] = resultStr
-	} else if originId == amqp.Query5OriginId {
-		resultStr := message.ToQ5ResultString(result)
-		recoveredMessages[clientId][originId] = resultStr
-	}
+	result.Query = utils.QueryOf(originId)
+	recoveredMessages[clientId][originId] = result
 }
 
 func accumulateResults(
 	clientId string,
 	originId uint8,
 	body []byte,
-	clientAccumulatedResults map[string]map[uint8]string,
+	clientAccumulatedResults map[string]map[uint8]message.Result,
 ) {
 	if _, ok := clientAccumulatedResults[clientId]; !ok {
-		clientAccumulatedResults[clientId] = make(map[uint8]string)
+		clientAccumulatedResults[clientId] = make(map[uint8]message.Result)
 	}
-	bodyStr, _ := message.GameNamesFromBytes(body)
-	clientAccumulatedResults[clientId][originId] += bodyStr.ToStringAux()
+	parsedBody, err := utils.ParseMessageBody(originId, body)
+	if err != nil {
+		return
+	}
+	partial, _ := utils.ResultOf(originId, parsedBody)
+	result := clientAccumulatedResults[clientId][originId]
+	result.Append(partial)
+	clientAccumulatedResults[clientId][originId] = result
 }
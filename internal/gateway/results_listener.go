@@ -15,8 +15,8 @@ import (
 )
 
 const (
-	idPos    = 1
-	zeroChar = '0'
+	prefetchKey     = "rabbitmq.prefetch"
+	defaultPrefetch = 256
 )
 
 // ListenResultsRequests waits until a client connects to the results listener and sends the results to the client
@@ -24,23 +24,16 @@ func (g *Gateway) listenResultsRequests() error {
 	return g.listenForConnections(utils.ResultsListener, g.SendResults)
 }
 
-// SendResults gets reports from the result chan and sends them to the client
+// SendResults gets reports from the result chan and sends them to the client, as text.
 func (g *Gateway) SendResults(cliConn net.Conn) {
 	clientId := g.readClientId(cliConn)
-	clientChanI, _ := g.clientChannels.LoadOrStore(clientId, make(chan []byte))
-	clientChan := clientChanI.(chan []byte)
+	defer cliConn.Close()
 
-	defer func() {
-		g.clientChannels.Delete(clientId)
-		close(clientChan)
-		cliConn.Close()
-	}()
-
-	for {
-		rabbitMsg := <-clientChan
+	g.sendResults(clientId, nil, func(r message.Result) error {
+		result := []byte(r.String())
 		clientMsg := message.ClientMessage{
-			DataLen: uint32(len(rabbitMsg)),
-			Data:    rabbitMsg,
+			DataLen: uint32(len(result)),
+			Data:    result,
 		}
 
 		data := make([]byte, LenFieldSize+len(clientMsg.Data))
@@ -48,51 +41,88 @@ func (g *Gateway) SendResults(cliConn net.Conn) {
 		copy(data[LenFieldSize:], clientMsg.Data)
 
 		if err := io.SendAll(cliConn, data); err != nil {
-			logs.Logger.Errorf("Error sending message to client: %s", err)
+			return fmt.Errorf("error sending message to client: %w", err)
+		}
+		return readAck(cliConn)
+	})
+}
+
+// sendResults sends the results of a client as they arrive through send, which returns once the client acknowledged
+// the result, and logs their acks. It returns once send fails, done is closed or the gateway shuts down.
+func (g *Gateway) sendResults(clientId string, done <-chan struct{}, send func(message.Result) error) {
+	clientChanI, _ := g.clientChannels.LoadOrStore(clientId, make(chan message.Result))
+	clientChan := clientChanI.(chan message.Result)
+
+	defer func() {
+		g.clientChannels.Delete(clientId)
+		close(clientChan)
+	}()
+
+	for {
+		var result message.Result
+		select {
+		case result = <-clientChan:
+		case <-done:
+			return
+		case <-g.ctx.Done():
 			return
 		}
 
-		readAck(cliConn)
-		originId := uint8(rabbitMsg[idPos]-zeroChar) + 1
-		g.logChannel <- recovery.NewRecord(amqp.Header{ClientId: clientId, OriginId: originId}, nil, []byte(utils.Ack))
+		if err := send(result); err != nil {
+			// The result is sent again once the client reconnects, since its ack was not logged.
+			g.log.With(logs.ClientId, clientId).Errorf("Error sending result to client: %s", err)
+			return
+		}
+		originId := utils.OriginIdOf(result.Query)
+		g.logChannel <- logRequest{record: recovery.NewRecord(amqp.Header{ClientId: clientId, OriginId: originId}, nil, []byte(utils.Ack))}
 	}
 }
 
 // ListenResults listens for results from the "reports" queue and sends them to the results channel
 func (g *Gateway) ListenResults() {
-	messages, err := g.broker.Consume(g.queues[len(g.queues)-1].Name, "", false, false)
+	messages, err := g.broker.Consume(g.queues[len(g.queues)-1].Name, g.resultsTag, false, false, g.Config.Int(prefetchKey, defaultPrefetch))
 	if err != nil {
-		logs.Logger.Errorf("Failed to start consuming messages from reports_queue: %s", err.Error())
+		g.log.Errorf("Failed to start consuming messages from reports_queue: %s", err.Error())
 		return
 	}
 
 	ch := make(chan recovery.Record)
-	clientAccumulatedResults := make(map[string]map[uint8]string)
-	recoveredMessages := make(map[string]map[uint8]string)
+	clientAccumulatedResults := make(map[string]map[uint8]message.Result)
+	recoveredMessages := make(map[string]map[uint8]message.Result)
 	g.recoverResults(ch, clientAccumulatedResults, recoveredMessages)
 
 	for clientID, innerMap := range recoveredMessages {
-		for _, resultStr := range innerMap {
-			sendResultThroughChannel(g, clientID, resultStr)
+		for _, result := range innerMap {
+			sendResultThroughChannel(g, clientID, result)
 		}
 	}
 
 	for m := range messages {
-		g.handleMessage(m, clientAccumulatedResults)
-		err = m.Ack(false)
-		if err != nil {
-			logs.Logger.Errorf("Failed to acknowledge message: %s", err.Error())
+		// Logged messages get acknowledged once their record is durable.
+		if logged := g.handleMessage(m, clientAccumulatedResults); !logged {
+			recovery.Ack(m)(nil)
 		}
 	}
 
 }
 
-func (g *Gateway) handleMessage(m amqp.Delivery, clientAccumulatedResults map[string]map[uint8]string) {
+// handleMessage processes a result and returns whether it was logged.
+func (g *Gateway) handleMessage(m amqp.Delivery, clientAccumulatedResults map[string]map[uint8]message.Result) bool {
 	clientID := m.Headers[amqp.ClientIdHeader].(string)
+	headers := amqp.HeadersFromDelivery(m)
+	log := g.logMessage(headers)
+	if headers.MessageId == message.ClientAbortId {
+		// Aborts are logged so that the results of the client are dropped on recovery too.
+		g.logChannel <- logRequest{record: recovery.NewRecord(headers, nil, m.Body), done: recovery.Ack(m)}
+		g.recordAbort(clientID)
+		delete(clientAccumulatedResults, clientID)
+		return true
+	}
+
 	originID, ok := m.Headers[amqp.OriginIdHeader] //not all workers send this header
 	if !ok {
-		logs.Logger.Errorf("message missing origin ID")
-		return
+		log.Errorf("message missing origin ID")
+		return false
 	}
 
 	originIDUint8 := originID.(uint8)
@@ -101,17 +131,17 @@ func (g *Gateway) handleMessage(m amqp.Delivery, clientAccumulatedResults map[st
 
 	seqSource, err := sequence.SrcFromString(sequenceId)
 	if err != nil {
-		logs.Logger.Errorf("Failed to parse sequence source: %v", err)
-		return
+		log.Errorf("Failed to parse sequence source: %v", err)
+		return false
 	}
 
 	if g.dup.IsDuplicate(*seqSource) {
-		return
+		return false
 	} else {
 		g.dup.RecoverSequenceId(*seqSource)
 	}
 
-	g.logChannel <- recovery.NewRecord(amqp.HeadersFromDelivery(m), nil, m.Body)
+	g.logChannel <- logRequest{record: recovery.NewRecord(headers, nil, m.Body), done: recovery.Ack(m)}
 
 	// Handle EOF or message content
 	if originIDUint8 == amqp.Query4OriginId || originIDUint8 == amqp.Query5OriginId {
@@ -124,69 +154,62 @@ func (g *Gateway) handleMessage(m amqp.Delivery, clientAccumulatedResults map[st
 	} else if !ok || message.Id(messageId.(uint8)) != message.EofId {
 		result, err := utils.ParseMessageBody(originIDUint8, m.Body)
 		if err != nil {
-			logs.Logger.Errorf("Failed to parse message body: %v", err)
-			return
+			log.Errorf("Failed to parse message body: %v", err)
+			return true
 		}
 		g.handleResultMsg(clientID, originIDUint8, result)
 	}
+
+	return true
 }
 
-func initializeAccumulatedResultsForClient(clientAccumulatedResults map[string]map[uint8]string, clientID string) {
+func initializeAccumulatedResultsForClient(clientAccumulatedResults map[string]map[uint8]message.Result, clientID string) {
 	if _, exists := clientAccumulatedResults[clientID]; !exists {
-		clientAccumulatedResults[clientID] = map[uint8]string{
-			amqp.Query4OriginId: "",
-			amqp.Query5OriginId: "",
+		clientAccumulatedResults[clientID] = map[uint8]message.Result{
+			amqp.Query4OriginId: {Query: message.Query4},
+			amqp.Query5OriginId: {Query: message.Query5},
 		}
 	}
 }
 
-func (g *Gateway) handleResultMsg(clientID string, originIDUint8 uint8, result interface{}) {
-	resultStr, shouldReturn := utils.ResultBodyToString(originIDUint8, result)
+func (g *Gateway) handleResultMsg(clientID string, originIDUint8 uint8, body interface{}) {
+	result, shouldReturn := utils.ResultOf(originIDUint8, body)
 	if shouldReturn {
+		g.log.With(logs.ClientId, clientID).Infof("Header x-origin-id does not match any known origin IDs, got: %v", originIDUint8)
 		return
 	}
 
-	sendResultThroughChannel(g, clientID, resultStr)
+	sendResultThroughChannel(g, clientID, result)
 }
 
-func handleAppendMsg(originIDUint8 uint8, m amqp.Delivery, accumulatedResults map[uint8]string) {
-	var body string
-
-	switch originIDUint8 {
-	case amqp.Query4OriginId:
-		parsedBody, err := message.GameNamesFromBytes(m.Body)
-		if err != nil {
-			logs.Logger.Errorf("Failed to parse scored reviews: %v", err)
-		}
-		body = parsedBody.ToStringAux()
-	case amqp.Query5OriginId:
-		parsedBody, err := message.ScoredReviewsFromBytes(m.Body)
-		if err != nil {
-			logs.Logger.Errorf("Failed to parse games names: %v", err)
-		}
-		body = parsedBody.ToStringAux()
+func handleAppendMsg(originIDUint8 uint8, m amqp.Delivery, accumulatedResults map[uint8]message.Result) {
+	body, err := utils.ParseMessageBody(originIDUint8, m.Body)
+	if err != nil {
+		headers := amqp.HeadersFromDelivery(m)
+		logs.With(logs.Header(headers.ClientId, headers.SequenceId, headers.MessageId)...).Errorf("Failed to parse partial result: %v", err)
+		return
 	}
 
-	accumulatedResults[originIDUint8] = accumulatedResults[originIDUint8] + body
+	partial, _ := utils.ResultOf(originIDUint8, body)
+	result := accumulatedResults[originIDUint8]
+	result.Append(partial)
+	accumulatedResults[originIDUint8] = result
 }
 
-func (g *Gateway) handleEof(clientID string, accumulatedResults map[uint8]string, originIDUint8 uint8) {
+func (g *Gateway) handleEof(clientID string, accumulatedResults map[uint8]message.Result, originIDUint8 uint8) {
 	result := accumulatedResults[originIDUint8]
-	var resultStr string
-
-	if originIDUint8 == amqp.Query4OriginId {
-		resultStr = message.ToQ4ResultString(result)
-	} else if originIDUint8 == amqp.Query5OriginId {
-		resultStr = message.ToQ5ResultString(result)
-	}
+	result.Query = utils.QueryOf(originIDUint8)
 
-	sendResultThroughChannel(g, clientID, resultStr)
+	sendResultThroughChannel(g, clientID, result)
 }
 
-func sendResultThroughChannel(g *Gateway, clientID string, resultStr string) {
-	clientChanI, _ := g.clientChannels.LoadOrStore(clientID, make(chan []byte))
-	clientChan := clientChanI.(chan []byte)
-	clientChan <- []byte(resultStr)
+func sendResultThroughChannel(g *Gateway, clientID string, result message.Result) {
+	clientChanI, _ := g.clientChannels.LoadOrStore(clientID, make(chan message.Result))
+	clientChan := clientChanI.(chan message.Result)
+	select {
+	case clientChan <- result:
+	case <-g.ctx.Done(): // Logged results are sent again once the gateway restarts.
+	}
 }
 
 func readAck(conn net.Conn) error {
@@ -0,0 +1,368 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+	"tp1/internal/gateway/chunk"
+	"tp1/internal/gateway/utils"
+	"tp1/pkg/logs"
+	"tp1/pkg/message"
+	"tp1/pkg/protocol"
+	"tp1/pkg/utils/id"
+)
+
+var errSessionClosed = errors.New("session closed")
+
+// streams are the data streams of a session, indexed by protocol.Stream.
+var streams = [...]message.Id{protocol.GamesStream: message.GameId, protocol.ReviewsStream: message.ReviewId}
+
+// session is a connection with a client that speaks the multiplexed protocol. Acks and results are written from
+// their own goroutines, so writes are synchronized.
+type session struct {
+	conn        net.Conn
+	clientId    string
+	compression protocol.Compression // compression is the one of the batches the client sends.
+	log         *logs.Entry
+	mu          sync.Mutex
+	batches     [len(streams)]atomic.Uint32 // batches are the numbers of the last batch received of each stream.
+	started     [len(streams)]bool          // started tells which streams got batches through the session.
+	eofs        [len(streams)]bool
+	resultAcks  chan struct{}
+	done        chan struct{}
+}
+
+// listenForSessions listens for clients that speak the multiplexed protocol.
+func (g *Gateway) listenForSessions() error {
+	return g.listenForConnections(utils.SessionListener, g.handleSession)
+}
+
+// handleSession serves a client until it disconnects. Acks of batches are forwarded to the client from the chunk
+// senders. Results are sent only if the gateway owns the client, since they are routed to the gateway that assigned
+// its ID. Like with the old ports, the client gets aborted if it disconnects while sending data, unless it resumes its
+// session in time.
+func (g *Gateway) handleSession(c net.Conn) {
+	defer c.Close()
+
+	s, err := g.handshake(c)
+	if err != nil {
+		g.log.Errorf("Error in handshake: %s", err)
+		return
+	}
+	s.log.Infof("Session started")
+	g.sessions.Store(s.clientId, s)
+	defer g.sessions.CompareAndDelete(s.clientId, s)
+
+	wg := &sync.WaitGroup{}
+	for stream, msgId := range streams {
+		ackChan := make(chan []byte, 1) // A client waits for the ack of a batch before sending the next one.
+		ackChannels := g.ackChannels(msgId)
+		ackChannels.Store(s.clientId, ackChan)
+		defer ackChannels.CompareAndDelete(s.clientId, ackChan)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.forwardAcks(s, protocol.Stream(stream), ackChan)
+		}()
+	}
+	if g.owns(s.clientId) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.sendResults(s.clientId, s.done, s.sendResult)
+		}()
+	}
+
+	g.readFrames(s)
+	close(s.done)
+	wg.Wait()
+}
+
+// handshake reads the Hello of a client and answers it with its ID, a new one if the client has none, along with the
+// batches to resume from. Clients that got aborted cannot resume their sessions.
+func (g *Gateway) handshake(c net.Conn) (*session, error) {
+	f, err := protocol.ReadFrame(c)
+	if err != nil {
+		return nil, err
+	}
+	h, err := protocol.ParseHello(f)
+	if err != nil {
+		return nil, err
+	}
+
+	clientId := h.ClientId
+	if h.Version != protocol.Version {
+		err = fmt.Errorf("unsupported protocol version %d", h.Version)
+	} else if clientId == "" {
+		clientId, err = g.IdGenerator.GetId()
+	} else if len(clientId) > id.ClientIdLen {
+		err = fmt.Errorf("client id %s too long", clientId)
+	} else if _, err = id.SplitId(clientId); err == nil && !g.resumeSession(clientId) {
+		err = fmt.Errorf("client %s was aborted", clientId)
+	}
+	if err != nil {
+		_ = protocol.WriteFrame(c, protocol.NewError(err.Error()))
+		return nil, err
+	}
+
+	compression := protocol.Choose(h.Compressions)
+	welcome, err := protocol.NewWelcome(protocol.Resume{ClientId: clientId, Compression: compression, Next: g.offsets.Next(clientId)})
+	if err != nil {
+		return nil, err
+	}
+	if err = protocol.WriteFrame(c, welcome); err != nil {
+		return nil, err
+	}
+
+	return &session{
+		conn:        c,
+		clientId:    clientId,
+		compression: compression,
+		log:         g.log.With(logs.ClientId, clientId),
+		resultAcks:  make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}, nil
+}
+
+// readFrames handles the frames of a session until the client disconnects or sends an invalid frame.
+func (g *Gateway) readFrames(s *session) {
+	for {
+		f, err := protocol.ReadFrame(s.conn)
+		if err != nil {
+			if g.isFinished() {
+				s.log.Infof("Stopped reading, shutting down")
+			} else if s.sendingData() {
+				s.log.Errorf("Error reading from session: %s", err)
+				g.abortLater(s.clientId)
+			} else {
+				s.log.Infof("Session ended")
+			}
+			return
+		}
+
+		switch f.Type {
+		case protocol.Games, protocol.Reviews:
+			err = g.handleBatch(s, f)
+		case protocol.Ack:
+			err = s.handleAck(f)
+		default:
+			err = protocol.UnexpectedFrame(f)
+		}
+
+		if err != nil {
+			s.log.Errorf("Invalid %s frame: %s", f.Type, err)
+			_ = s.write(protocol.NewError(err.Error()))
+			if s.sendingData() {
+				g.abortClient(s.clientId)
+			}
+			return
+		}
+	}
+}
+
+// handleBatch sends the records of a batch to the chunk senders, as the data listeners do with their payloads.
+func (g *Gateway) handleBatch(s *session, f protocol.Frame) error {
+	b, err := protocol.ParseBatch(f, s.compression)
+	if err != nil {
+		return err
+	}
+
+	stream := protocol.GamesStream
+	if f.Type == protocol.Reviews {
+		stream = protocol.ReviewsStream
+	}
+	msgId := streams[stream]
+	log := s.log.With(logs.MessageId, msgId)
+	records, err := recordsFromColumns(msgId, b.Records)
+	if err != nil {
+		return err
+	}
+
+	s.batches[stream].Store(b.Num)
+	s.started[stream] = true
+	for _, record := range records {
+		batches.Inc(s.clientId, source(msgId))
+		// Records are sent in columns, so each is accounted for an even share of the batch.
+		g.sendToChunkSender(msgId, record, len(b.Records)/len(records), s.clientId, b.Num)
+	}
+	if b.Eof {
+		s.eofs[stream] = g.processPayload(log, msgId, nil, eofPayloadSize, s.clientId, b.Num)
+	}
+	return nil
+}
+
+// recordsFromColumns decodes the records of a batch of the given data.
+func recordsFromColumns(msgId message.Id, columns []byte) ([]any, error) {
+	if msgId == message.ReviewId {
+		reviews, err := message.ClientReviewsFromColumns(columns)
+		records := make([]any, 0, len(reviews))
+		for _, r := range reviews {
+			records = append(records, r)
+		}
+		return records, err
+	}
+
+	games, err := message.ClientGamesFromColumns(columns)
+	records := make([]any, 0, len(games))
+	for _, g := range games {
+		records = append(records, g)
+	}
+	return records, err
+}
+
+func (s *session) handleAck(f protocol.Frame) error {
+	stream, _, err := protocol.ParseAck(f)
+	if err != nil {
+		return err
+	}
+	if stream != protocol.ResultsStream {
+		return fmt.Errorf("ack of stream %d", stream)
+	}
+
+	select {
+	case s.resultAcks <- struct{}{}:
+	default: // The client acknowledged a result that was not sent.
+	}
+	return nil
+}
+
+// forwardAcks sends the acks of the batches of a stream to the client until the session ends.
+func (g *Gateway) forwardAcks(s *session, stream protocol.Stream, ackChan <-chan []byte) {
+	for {
+		select {
+		case <-ackChan:
+		case <-s.done:
+			return
+		}
+
+		f, err := protocol.NewAck(stream, s.batches[stream].Load())
+		if err == nil {
+			err = s.write(f)
+		}
+		if err != nil {
+			s.log.Errorf("Error sending ack to client: %v", err)
+			return
+		}
+		acks.Inc(s.clientId, source(streams[stream]))
+	}
+}
+
+// sendResult sends a result to the client and waits for its ack.
+func (s *session) sendResult(r message.Result) error {
+	result, err := r.ToJSON()
+	if err != nil {
+		return err
+	}
+	if err := s.write(protocol.NewResult(result)); err != nil {
+		return err
+	}
+
+	select {
+	case <-s.resultAcks:
+		return nil
+	case <-s.done:
+		return errSessionClosed
+	}
+}
+
+func (s *session) write(f protocol.Frame) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return protocol.WriteFrame(s.conn, f)
+}
+
+// sendingData tells whether the client was sending data through the session when it ended.
+func (s *session) sendingData() bool {
+	for stream := range streams {
+		if s.started[stream] && !s.eofs[stream] {
+			return true
+		}
+	}
+	return false
+}
+
+// abortLater aborts a client whose connection broke while it was sending data, unless it reconnects within
+// `gateway.resume_timeout_ms`.
+func (g *Gateway) abortLater(clientId string) {
+	if g.resume <= 0 {
+		g.abortClient(clientId)
+		return
+	}
+
+	g.resumingMu.Lock()
+	defer g.resumingMu.Unlock()
+	var timer *time.Timer
+	timer = time.AfterFunc(g.resume, func() {
+		g.resumingMu.Lock()
+		if g.resuming[clientId] != timer || g.isFinished() {
+			g.resumingMu.Unlock()
+			return
+		}
+		delete(g.resuming, clientId)
+		g.offsets.Abort(clientId) // Marked before unlocking, so that the client cannot resume it meanwhile.
+		g.resumingMu.Unlock()
+		g.abortClient(clientId)
+	})
+	g.resuming[clientId] = timer
+}
+
+// resumeSession stops the abort of a client waiting for it to resume its session, and drops the chunks it was
+// sending, since it sends them again. Returns false if the client got aborted.
+func (g *Gateway) resumeSession(clientId string) bool {
+	if _, aborted := g.cancelAbort(clientId); aborted {
+		return false
+	}
+
+	for _, ch := range g.ChunkChans {
+		ch <- chunk.Item{ClientId: clientId, Resume: true}
+	}
+	return true
+}
+
+// cancelAbort stops the abort of a client waiting for it to reconnect. Returns whether the client was waiting to be
+// aborted, and whether it already got aborted.
+func (g *Gateway) cancelAbort(clientId string) (waiting bool, aborted bool) {
+	g.resumingMu.Lock()
+	defer g.resumingMu.Unlock()
+	if timer, ok := g.resuming[clientId]; ok {
+		timer.Stop()
+		delete(g.resuming, clientId)
+		waiting = true
+	}
+	return waiting, g.offsets.Aborted(clientId)
+}
+
+// recordAbort records the abort of a client, which reaches its owner through the results whichever gateway aborted
+// it. Clients can resume their sessions with any gateway while their owner is down, so the one that aborts a client
+// may not be the owner, which otherwise would let the client resume and wait for results that never come. The open
+// session of the client, if any, gets closed, so that the client reconnects and gets refused.
+func (g *Gateway) recordAbort(clientId string) {
+	g.abortedClients.Store(clientId, struct{}{})
+	g.offsets.Abort(clientId)
+
+	if s, ok := g.sessions.Load(clientId); ok {
+		s := s.(*session)
+		s.log.Infof("Client was aborted. Closing its session")
+		_ = s.write(protocol.NewError(fmt.Sprintf("client %s was aborted", clientId)))
+		_ = s.conn.Close()
+	}
+}
+
+// ackChannels returns the channels the chunk sender of the given data sends acks through.
+func (g *Gateway) ackChannels(msgId message.Id) *sync.Map {
+	if msgId == message.ReviewId {
+		return &g.clientReviewsAckChannels
+	}
+	return &g.clientGamesAckChannels
+}
+
+// owns tells whether the gateway assigned the ID of a client.
+func (g *Gateway) owns(clientId string) bool {
+	parts, err := id.SplitId(clientId)
+	return err == nil && parts[0] == strconv.Itoa(int(g.id))
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 
 	"tp1/pkg/amqp"
-	"tp1/pkg/logs"
 	"tp1/pkg/message"
 )
 
@@ -13,23 +12,38 @@ const (
 	ResultsListener  = 2
 	GamesListener    = 0
 	ClientIdListener = 3
+	SessionListener  = 4
 	Ack              = "ACK"
 )
 
-func ResultBodyToString(originIDUint8 uint8, result interface{}) (string, bool) {
-	var resultStr string
+// ResultOf returns the result of a query for a client, out of the body parsed of a message of its origin. It returns
+// true if the origin does not match any query.
+func ResultOf(originIDUint8 uint8, body interface{}) (message.Result, bool) {
+	result := message.Result{Query: QueryOf(originIDUint8)}
 	switch originIDUint8 {
 	case amqp.Query1OriginId:
-		resultStr = result.(message.Platform).ToResultString()
+		platforms := body.(message.Platform)
+		result.Platforms = &platforms
 	case amqp.Query2OriginId:
-		resultStr = result.(message.DateFilteredReleases).ToResultString()
-	case amqp.Query3OriginId:
-		resultStr = result.(message.ScoredReviews).ToQ3ResultString()
+		result.Releases = body.(message.DateFilteredReleases)
+	case amqp.Query3OriginId, amqp.Query5OriginId:
+		result.Reviews = body.(message.ScoredReviews)
+	case amqp.Query4OriginId:
+		result.Games = body.(message.GameNames)
 	default:
-		logs.Logger.Infof("Header x-origin-id does not match any known origin IDs, got: %v", originIDUint8)
-		return "", true
+		return message.Result{}, true
 	}
-	return resultStr, false
+	return result, false
+}
+
+// QueryOf returns the query whose results come from the given origin.
+func QueryOf(originId uint8) uint8 {
+	return originId - amqp.Query1OriginId + message.Query1
+}
+
+// OriginIdOf returns the origin of the results of the given query.
+func OriginIdOf(query uint8) uint8 {
+	return query - message.Query1 + amqp.Query1OriginId
 }
 
 func ParseMessageBody(originID uint8, body []byte) (interface{}, error) {
@@ -38,10 +52,10 @@ func ParseMessageBody(originID uint8, body []byte) (interface{}, error) {
 		return message.PlatformFromBytes(body)
 	case amqp.Query2OriginId:
 		return message.DateFilteredReleasesFromBytes(body)
-	case amqp.Query3OriginId:
+	case amqp.Query3OriginId, amqp.Query5OriginId:
 		return message.ScoredReviewsFromBytes(body)
-	case amqp.Query4OriginId, amqp.Query5OriginId:
-		return nil, fmt.Errorf("ParseMessageBody should not be called for queries 4 and 5")
+	case amqp.Query4OriginId:
+		return message.GameNamesFromBytes(body)
 	default:
 		return nil, fmt.Errorf("unknown origin ID: %v", originID)
 	}
@@ -13,6 +13,7 @@ import (
 	"tp1/pkg/config"
 	"tp1/pkg/config/provider"
 	"tp1/pkg/logs"
+	"tp1/pkg/metrics"
 	"tp1/pkg/utils/io"
 )
 
@@ -33,22 +34,34 @@ const (
 	defTimeoutMs           = 1500
 	intervalKey            = "hc.interval-ms"
 	defInterval            = 1000
+	metricsAddressKey      = "hc.metrics-address"
+	defMetricsAddress      = ":9100"
 
 	configFilePath = "config.toml"
 	hcMsg          = 1
 	dockerRestart  = "docker restart "
+	checkedNode    = "checked_node" // checkedNode is the key of the field holding the node being checked.
+)
+
+var (
+	restarts = metrics.NewCounter("healthchecker_restarts_total",
+		"Restarts of each node, after it stopped answering health checks.", "node")
+	failedRestarts = metrics.NewCounter("healthchecker_failed_restarts_total",
+		"Restarts of each node that could not be done.", "node")
 )
 
 type HealthChecker struct {
-	hcAddr     string
-	serverPort string
-	nextHc     string   //address of the next health checker
-	nodes      []string //addresses of the nodes to check
-	finished   bool
-	finishedMu sync.Mutex
-	maxErrors  uint8
-	timeout    time.Duration
-	interval   time.Duration
+	hcAddr      string
+	serverPort  string
+	nextHc      string   //address of the next health checker
+	nodes       []string //addresses of the nodes to check
+	finished    bool
+	finishedMu  sync.Mutex
+	maxErrors   uint8
+	timeout     time.Duration
+	interval    time.Duration
+	metricsAddr string
+	log         *logs.Entry // log attaches the address of the health checker to its records.
 }
 
 func New() (*HealthChecker, error) {
@@ -66,13 +79,15 @@ func New() (*HealthChecker, error) {
 	}
 
 	return &HealthChecker{
-		hcAddr:     hcAddr,
-		nextHc:     nextHc,
-		nodes:      nodes,
-		serverPort: serverPort,
-		maxErrors:  cfg.Uint8(hcMaxErrKey, maxErrorsDef),
-		timeout:    time.Millisecond * time.Duration(cfg.Int64(timeoutSecsKey, defTimeoutMs)),
-		interval:   time.Millisecond * time.Duration(cfg.Int64(intervalKey, defInterval)),
+		hcAddr:      hcAddr,
+		nextHc:      nextHc,
+		nodes:       nodes,
+		serverPort:  serverPort,
+		maxErrors:   cfg.Uint8(hcMaxErrKey, maxErrorsDef),
+		timeout:     time.Millisecond * time.Duration(cfg.Int64(timeoutSecsKey, defTimeoutMs)),
+		interval:    time.Millisecond * time.Duration(cfg.Int64(intervalKey, defInterval)),
+		metricsAddr: cfg.String(metricsAddressKey, defMetricsAddress),
+		log:         logs.With(logs.Node, hcAddr),
 	}, nil
 }
 
@@ -86,6 +101,10 @@ func (hc *HealthChecker) Start() {
 		hc.handleSigterm()
 	}()
 
+	if err := metrics.Serve(hc.metricsAddr); err != nil {
+		hc.log.Errorf("Failed to serve metrics: %s", err.Error())
+	}
+
 	wg := sync.WaitGroup{}
 	wg.Add(len(hc.nodes))
 
@@ -102,6 +121,7 @@ func (hc *HealthChecker) Start() {
 // check checks if the node is alive and restarts it if it is not.
 // nodeIp is the container name of the node
 func (hc *HealthChecker) check(nodeIp string) {
+	log := hc.log.With(checkedNode, nodeIp)
 	connErr := uint8(0)
 	for {
 		hc.finishedMu.Lock()
@@ -112,29 +132,29 @@ func (hc *HealthChecker) check(nodeIp string) {
 		hc.finishedMu.Unlock()
 
 		nodeAddr := nodeIp + ":" + hc.serverPort
-		conn, err := hc.connect(nodeAddr)
+		conn, err := hc.connect(log, nodeAddr)
 		if err != nil {
-			logs.Logger.Errorf("Node conn error: %v", err)
+			log.Errorf("Node conn error: %v", err)
 			connErr++
 			if connErr == hc.maxErrors {
-				hc.restartNode(nodeIp)
+				hc.restartNode(log, nodeIp)
 				connErr = 0
 			}
 			continue
 		}
 
-		errCount := hc.sendHcMsg(conn)
+		errCount := hc.sendHcMsg(log, conn)
 		_ = conn.Close()
 
 		if errCount == hc.maxErrors {
-			hc.restartNode(nodeIp)
+			hc.restartNode(log, nodeIp)
 		}
 	}
 }
 
 // Send health check message to the node and wait for the ack.
 // If it fails to send the message or receive ack maxError times, returns.
-func (hc *HealthChecker) sendHcMsg(conn *net.UDPConn) uint8 {
+func (hc *HealthChecker) sendHcMsg(log *logs.Entry, conn *net.UDPConn) uint8 {
 	errCount := uint8(0)
 	buffer := make([]byte, msgBytes)
 
@@ -149,19 +169,19 @@ func (hc *HealthChecker) sendHcMsg(conn *net.UDPConn) uint8 {
 		_, err := conn.Write([]byte{hcMsg})
 		if err != nil {
 			errCount++
-			logs.Logger.Errorf("Error sending health check message: %v. Count: %d", err, errCount)
+			log.Errorf("Error sending health check message: %v. Count: %d", err, errCount)
 			continue
 		}
 
 		err = conn.SetReadDeadline(time.Now().Add(hc.timeout))
 		if err != nil {
-			logs.Logger.Errorf("Error setting read deadline: %v", err)
+			log.Errorf("Error setting read deadline: %v", err)
 		}
 
 		_, err = conn.Read(buffer)
 		if err != nil {
 			errCount++
-			logs.Logger.Debugf("Error recv health check ack: %v. Error count: %d", err, errCount)
+			log.Debugf("Error recv health check ack: %v. Error count: %d", err, errCount)
 		} else {
 			errCount = 0
 		}
@@ -175,21 +195,21 @@ func (hc *HealthChecker) sendHcMsg(conn *net.UDPConn) uint8 {
 // Connect to the node.
 // If it fails to connect, it tries to reconnect maxErrors times.
 // If it fails to reconnect, it restarts the node.
-func (hc *HealthChecker) connect(nodeAddr string) (*net.UDPConn, error) {
+func (hc *HealthChecker) connect(log *logs.Entry, nodeAddr string) (*net.UDPConn, error) {
 	i := uint8(0)
 	udpAddr, err := net.ResolveUDPAddr(transportProtocol, nodeAddr)
 	if err != nil {
-		logs.Logger.Errorf("Error resolving address %s: %v", nodeAddr, err)
+		log.Errorf("Error resolving address %s: %v", nodeAddr, err)
 		return nil, err
 	}
 
 	for i < hc.maxErrors {
 		conn, connErr := net.DialUDP(transportProtocol, nil, udpAddr)
 		if connErr == nil {
-			logs.Logger.Infof("Connected to node %v", udpAddr)
+			log.Infof("Connected to node %v", udpAddr)
 			return conn, nil
 		}
-		logs.Logger.Errorf("Error connecting to node %s: %v, retrying", nodeAddr, connErr)
+		log.Errorf("Error connecting to node %s: %v, retrying", nodeAddr, connErr)
 		i++
 		err = connErr
 	}
@@ -198,16 +218,18 @@ func (hc *HealthChecker) connect(nodeAddr string) (*net.UDPConn, error) {
 }
 
 // Using DinD to restart the health checker
-func (hc *HealthChecker) restartNode(containerName string) {
-	logs.Logger.Errorf("Node %s is down", containerName)
+func (hc *HealthChecker) restartNode(log *logs.Entry, containerName string) {
+	log.Errorf("Node %s is down", containerName)
 
 	output, err := io.ExecCommand(dockerRestart + containerName)
 	if err != nil {
-		logs.Logger.Errorf("Error restarting node: %s", err)
+		log.Errorf("Error restarting node: %s", err)
+		failedRestarts.Inc(containerName)
 		return
 	}
+	restarts.Inc(containerName)
 
-	logs.Logger.Infof("Node restarted: %s", output)
+	log.Infof("Node restarted: %s", output)
 	time.Sleep(hc.interval)
 }
 
@@ -229,7 +251,7 @@ func hcAddrFromId(containerName string, id int) string {
 }
 
 func (hc *HealthChecker) handleSigterm() {
-	logs.Logger.Info("Received SIGTERM, shutting down")
+	hc.log.Infof("Received SIGTERM, shutting down")
 	hc.finishedMu.Lock()
 	hc.finished = true
 	hc.finishedMu.Unlock()
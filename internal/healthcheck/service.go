@@ -16,11 +16,14 @@ const (
 	maxErrKey         = "service.max-err"
 	defaultMaxErr     = 3
 	serviceCfgPath    = "healthcheck_service.toml"
+	healthPort        = "health_port"    // healthPort is the key of the field holding the port of the service.
+	healthChecker     = "health_checker" // healthChecker is the key of the field holding the address of a checker.
 )
 
 type Service struct {
 	listener *net.UDPConn
 	maxErr   uint8
+	log      *logs.Entry // log attaches the port the service listens on to its records.
 }
 
 func NewService() (*Service, error) {
@@ -42,7 +45,7 @@ func NewService() (*Service, error) {
 		return nil, err
 	}
 
-	return &Service{listener: listener, maxErr: maxError}, nil
+	return &Service{listener: listener, maxErr: maxError, log: logs.With(healthPort, port)}, nil
 }
 
 // Listen reads the health checker messages.
@@ -53,18 +56,18 @@ func (h *Service) Listen() {
 	for i < h.maxErr {
 		_, addr, err := h.listener.ReadFromUDP(buf)
 		if err != nil {
-			logs.Logger.Warningf("Error reading health check message: %v", err)
+			h.log.Warningf("Error reading health check message: %v", err)
 			i++
 			continue
 		}
 
 		_, err = h.listener.WriteToUDP([]byte{ackMsg}, addr)
 		if err != nil {
-			logs.Logger.Errorf("Error sending health check ack: %v", err)
+			h.log.With(healthChecker, addr).Errorf("Error sending health check ack: %v", err)
 		}
 	}
 
-	logs.Logger.Infof("Closing hc conn")
+	h.log.Infof("Closing hc conn")
 	h.Close()
 }
 
@@ -0,0 +1,219 @@
+package topology
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+const (
+	gatewayNode = "gateway"
+	inputKey    = "input-%d"
+	shardSuffix = "%d"
+	fileTracing = "file"
+	otlpTracing = "otlp"
+)
+
+// Sharding is the way the messages of an edge are split among the replicas of its destination stage.
+type Sharding string
+
+const (
+	// BySequence spreads messages by sequence ID. EOFs reach a single replica, so the stage sends them around its
+	// replicas before propagating them.
+	BySequence Sharding = "by-sequence"
+	// ByGame sends the messages of a game to the same replica. EOFs reach every replica.
+	ByGame Sharding = "by-game"
+	// ByReplica sends the messages of each replica to the replica with the same ID of the destination stage.
+	ByReplica Sharding = "by-replica"
+	// ByClient sends the results of a client to the gateway it is connected to.
+	ByClient Sharding = "by-client"
+	// Shared sends every message to a single queue, consumed by a single replica which gets an EOF from each
+	// replica of the source stage.
+	Shared Sharding = "shared"
+)
+
+// nodeType holds the amount of inputs and outputs a node is written for. Outputs are used by index, so the order
+// of the edges of a stage matters.
+type nodeType struct {
+	inputs  int
+	outputs int
+}
+
+// nodes holds the node types that can be deployed, by image name.
+var nodes = map[string]nodeType{
+	gatewayNode:            {},
+	"reviews-filter":       {inputs: 1, outputs: 3},
+	"review-text-filter":   {inputs: 1, outputs: 1},
+	"action-filter":        {inputs: 1, outputs: 2},
+	"indie-filter":         {inputs: 1, outputs: 2},
+	"platform-filter":      {inputs: 1, outputs: 1},
+	"release-date-filter":  {inputs: 1, outputs: 1},
+	"counter-joiner":       {inputs: 2, outputs: 1},
+	"percentile-joiner":    {inputs: 2, outputs: 1},
+	"top-joiner":           {inputs: 2, outputs: 1},
+	"topn":                 {inputs: 1, outputs: 1},
+	"topn-playtime-filter": {inputs: 1, outputs: 1},
+	"platform-counter":     {inputs: 1, outputs: 1},
+	"counter":              {inputs: 1, outputs: 1},
+	"percentile":           {inputs: 1, outputs: 1},
+}
+
+// gatewaySections are the sections of the gateway configuration the input data is published with. The gateway
+// must have an edge for each of them.
+var gatewaySections = []string{"reviews", "action", "indie", "platform"}
+
+// Topology describes the whole system: the stages that get deployed and the edges that connect them.
+type Topology struct {
+	Stages  []Stage  `json:"stages"`
+	Edges   []Edge   `json:"edges"`
+	Tracing *Tracing `json:"tracing,omitempty"` // Tracing, if set, is enabled in the gateway and in every worker.
+}
+
+// Tracing is the tracing section of the gateway and worker configurations.
+type Tracing struct {
+	Exporter    string  `json:"exporter"`           // Exporter is either file or otlp.
+	Endpoint    string  `json:"endpoint,omitempty"` // Endpoint is the OTLP/HTTP collector spans are posted to.
+	SampleRatio float64 `json:"sample-ratio,omitempty"`
+}
+
+// Stage is a set of replicas of the same node, sharing its configuration.
+type Stage struct {
+	Name        string          `json:"name"`     // Name of the stage, used for its containers and its membership.
+	Node        string          `json:"node"`     // Node type, which is the image the stage runs.
+	Config      string          `json:"config"`   // Config is the name of the configuration file, without extension.
+	Replicas    uint8           `json:"replicas"` // Amount of workers of the stage.
+	Exchange    string          `json:"exchange"` // Exchange the stage publishes to.
+	Query       json.RawMessage `json:"query,omitempty"`
+	Prefetch    int             `json:"prefetch,omitempty"`
+	Concurrency int             `json:"concurrency,omitempty"`
+	LogLevel    string          `json:"log-level,omitempty"`
+	LogFormat   string          `json:"log-format,omitempty"` // LogFormat is either text, the default, or json.
+}
+
+// Edge is a queue, or a set of queues, from a stage to another.
+type Edge struct {
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+	Queue    string   `json:"queue"` // Queue name, without the replica suffix.
+	Key      string   `json:"key"`   // Routing key, without the replica suffix.
+	Sharding Sharding `json:"sharding"`
+	Section  string   `json:"section"` // Section of the gateway configuration. Only for edges from the gateway.
+}
+
+// Load reads a topology file and validates it.
+func Load(path string) (*Topology, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var t Topology
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&t); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	if err = t.Validate(); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// stage returns the stage with the given name.
+func (t *Topology) stage(name string) (Stage, bool) {
+	for _, s := range t.Stages {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Stage{}, false
+}
+
+// gateway returns the gateway stage.
+func (t *Topology) gateway() Stage {
+	for _, s := range t.Stages {
+		if s.Node == gatewayNode {
+			return s
+		}
+	}
+	return Stage{}
+}
+
+// inputs returns the edges to a stage, in order.
+func (t *Topology) inputs(stage string) []Edge {
+	var edges []Edge
+	for _, e := range t.Edges {
+		if e.To == stage {
+			edges = append(edges, e)
+		}
+	}
+	return edges
+}
+
+// outputs returns the edges from a stage, in order.
+func (t *Topology) outputs(stage string) []Edge {
+	var edges []Edge
+	for _, e := range t.Edges {
+		if e.From == stage {
+			edges = append(edges, e)
+		}
+	}
+	return edges
+}
+
+// rings returns whether a stage sends the EOFs around its replicas, which happens when it is fed by sequence.
+func (t *Topology) rings(stage string) bool {
+	for _, e := range t.inputs(stage) {
+		if e.Sharding == BySequence {
+			return true
+		}
+	}
+	return false
+}
+
+// upstream returns the stage a stage gets an EOF from each replica of, if any.
+func (t *Topology) upstream(stage string) string {
+	for _, e := range t.inputs(stage) {
+		if e.Sharding == Shared {
+			return e.From
+		}
+	}
+	return ""
+}
+
+// singleton returns whether a stage is only fed by shared queues, in which case it runs a single worker.
+func (t *Topology) singleton(stage string) bool {
+	inputs := t.inputs(stage)
+	for _, e := range inputs {
+		if e.Sharding != Shared {
+			return false
+		}
+	}
+	return len(inputs) > 0
+}
+
+// sharded returns whether an edge has a queue per replica of its destination.
+func (e Edge) sharded() bool {
+	return e.Sharding != Shared
+}
+
+// queueName returns the queue name format of an edge.
+func (e Edge) queueName() string {
+	if !e.sharded() {
+		return e.Queue
+	}
+	return e.Queue + "_" + shardSuffix
+}
+
+// routingKey returns the routing key format of an edge.
+func (e Edge) routingKey() string {
+	if !e.sharded() {
+		return e.Key
+	}
+	if e.Key == "" {
+		return shardSuffix
+	}
+	return e.Key + "-" + shardSuffix
+}
@@ -0,0 +1,149 @@
+package topology
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const repoRoot = "../.."
+
+func load(t *testing.T) *Topology {
+	topology, err := Load(filepath.Join(repoRoot, "configs", "topology.json"))
+	require.NoError(t, err)
+	return topology
+}
+
+func TestRepoFilesAreGeneratedFromTopology(t *testing.T) {
+	files, err := load(t).Files()
+	require.NoError(t, err)
+
+	for path, content := range files {
+		onDisk, err := os.ReadFile(filepath.Join(repoRoot, path))
+		require.NoError(t, err)
+		assert.Equal(t, string(content), string(onDisk), "%s is out of date, run `make topology`", path)
+	}
+}
+
+func TestScalingStageUpdatesUpstreamConsumers(t *testing.T) {
+	topology := load(t)
+	setReplicas(topology, "review-text-filter", 3)
+
+	files, err := topology.Files()
+	require.NoError(t, err)
+
+	var review workerConfig
+	require.NoError(t, json.Unmarshal(files[filepath.Join(configsDir, "review.json")], &review))
+	assert.Equal(t, uint8(3), review.Outputs[1].Consumers)
+	assert.True(t, review.Outputs[1].Single)
+	assert.Contains(t, string(files[composeFile]), "review-text-filter-3:")
+	assert.NotContains(t, string(files[composeFile]), "review-text-filter-4:")
+}
+
+func TestTracingIsEnabledEverywhere(t *testing.T) {
+	topology := load(t)
+	topology.Tracing = &Tracing{Exporter: fileTracing, SampleRatio: 0.5}
+
+	files, err := topology.Files()
+	require.NoError(t, err)
+
+	var review workerConfig
+	require.NoError(t, json.Unmarshal(files[filepath.Join(configsDir, "review.json")], &review))
+	assert.Equal(t, &tracingConfig{Exporter: fileTracing, Path: tracesFile, SampleRatio: 0.5}, review.Tracing)
+	assert.Contains(t, string(files[filepath.Join(configsDir, gatewayConfig)]), "[tracing]\nexporter = \"file\"\npath = \"traces.json\"\nsample-ratio = 0.5\n")
+	assert.Contains(t, string(files[composeFile]), "./volumes/gateway-1-traces.json:/traces.json")
+	assert.Contains(t, string(files[composeFile]), "./volumes/reviews-filter-1-traces.json:/traces.json")
+}
+
+func TestLogFormatIsSetByStage(t *testing.T) {
+	topology := load(t)
+	for i := range topology.Stages {
+		if topology.Stages[i].Name == "gateway" || topology.Stages[i].Name == "review-text-filter" {
+			topology.Stages[i].LogFormat = "json"
+		}
+	}
+
+	files, err := topology.Files()
+	require.NoError(t, err)
+
+	var text, action workerConfig
+	require.NoError(t, json.Unmarshal(files[filepath.Join(configsDir, "text.json")], &text))
+	require.NoError(t, json.Unmarshal(files[filepath.Join(configsDir, "action.json")], &action))
+	assert.Equal(t, "json", text.LogFormat)
+	assert.Empty(t, action.LogFormat)
+	assert.Contains(t, string(files[filepath.Join(configsDir, gatewayConfig)]), "log_level = \"INFO\"\nlog_format = \"json\"\n")
+}
+
+func TestInconsistentTopologiesAreRejected(t *testing.T) {
+	tests := map[string]func(*Topology){
+		"unknown node": func(t *Topology) { t.Stages[1].Node = "sorter" },
+		"shared queue with many replicas": func(t *Topology) {
+			setReplicas(t, "topn-aggregator", 2)
+		},
+		"by replica with different replicas": func(t *Topology) {
+			setReplicas(t, "topn-filter", 3)
+		},
+		"missing output": func(t *Topology) {
+			t.Edges = removeEdge(t.Edges, "action-filter", "percentile-joiner")
+		},
+		"ring through a shared exchange": func(t *Topology) {
+			for i := range t.Stages {
+				if t.Stages[i].Name == "platform-counter" {
+					t.Stages[i].Exchange = "reports"
+				}
+			}
+		},
+		"missing gateway section": func(t *Topology) {
+			t.Edges = removeEdge(t.Edges, "gateway", "platform-filter")
+			t.Edges = removeEdge(t.Edges, "platform-filter", "platform-counter")
+		},
+		"unknown stage":      func(t *Topology) { t.Edges[0].To = "nowhere" },
+		"unknown log format": func(t *Topology) { t.Stages[1].LogFormat = "xml" },
+		"otlp tracing without endpoint": func(t *Topology) {
+			t.Tracing = &Tracing{Exporter: otlpTracing}
+		},
+	}
+
+	for name, mutate := range tests {
+		t.Run(name, func(t *testing.T) {
+			topology := load(t)
+			mutate(topology)
+			assert.Error(t, topology.Validate())
+		})
+	}
+}
+
+func TestGenerateWritesNothingForInconsistentTopology(t *testing.T) {
+	topology := load(t)
+	setReplicas(topology, "review-counter-aggregator", 2)
+
+	dir := t.TempDir()
+	_, err := topology.Generate(dir)
+	assert.Error(t, err)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func setReplicas(t *Topology, stage string, replicas uint8) {
+	for i := range t.Stages {
+		if t.Stages[i].Name == stage {
+			t.Stages[i].Replicas = replicas
+		}
+	}
+}
+
+func removeEdge(edges []Edge, from, to string) []Edge {
+	var kept []Edge
+	for _, e := range edges {
+		if e.From != from || e.To != to {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
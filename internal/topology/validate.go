@@ -0,0 +1,220 @@
+package topology
+
+import (
+	"errors"
+	"fmt"
+
+	"tp1/pkg/logs"
+)
+
+// Validate checks that the topology can be deployed, returning every inconsistency found.
+func (t *Topology) Validate() error {
+	var errs []error
+	errs = append(errs, t.validateStages()...)
+	errs = append(errs, t.validateEdges()...)
+	errs = append(errs, t.validateTracing()...)
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	// Wiring is only checked once every edge refers to known stages.
+	for _, s := range t.Stages {
+		errs = append(errs, t.validateWiring(s)...)
+	}
+	return errors.Join(errs...)
+}
+
+func (t *Topology) validateTracing() []error {
+	if t.Tracing == nil {
+		return nil
+	}
+
+	var errs []error
+	if t.Tracing.Exporter != fileTracing && t.Tracing.Exporter != otlpTracing {
+		errs = append(errs, fmt.Errorf("tracing: unknown exporter %q", t.Tracing.Exporter))
+	}
+	if t.Tracing.Exporter == otlpTracing && t.Tracing.Endpoint == "" {
+		errs = append(errs, errors.New("tracing: otlp exporter without endpoint"))
+	}
+	if t.Tracing.SampleRatio < 0 || t.Tracing.SampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("tracing: sample ratio %v out of [0, 1]", t.Tracing.SampleRatio))
+	}
+	return errs
+}
+
+func (t *Topology) validateStages() []error {
+	var errs []error
+	names := make(map[string]bool)
+	configs := make(map[string]bool)
+	gateways := 0
+
+	for _, s := range t.Stages {
+		if s.Name == "" {
+			errs = append(errs, errors.New("stage without name"))
+			continue
+		}
+		if names[s.Name] {
+			errs = append(errs, fmt.Errorf("stage %q: duplicated name", s.Name))
+		}
+		names[s.Name] = true
+
+		if _, ok := nodes[s.Node]; !ok {
+			errs = append(errs, fmt.Errorf("stage %q: unknown node %q", s.Name, s.Node))
+		}
+		if s.Replicas == 0 {
+			errs = append(errs, fmt.Errorf("stage %q: replicas must be at least 1", s.Name))
+		}
+		if s.Exchange == "" {
+			errs = append(errs, fmt.Errorf("stage %q: missing exchange", s.Name))
+		}
+		if s.LogFormat != "" && s.LogFormat != logs.TextFormat && s.LogFormat != logs.JsonFormat {
+			errs = append(errs, fmt.Errorf("stage %q: unknown log format %q", s.Name, s.LogFormat))
+		}
+
+		if s.Node == gatewayNode {
+			gateways++
+			continue
+		}
+		if s.Config == "" {
+			errs = append(errs, fmt.Errorf("stage %q: missing config", s.Name))
+		} else if configs[s.Config] {
+			errs = append(errs, fmt.Errorf("stage %q: config %q is used by another stage", s.Name, s.Config))
+		}
+		configs[s.Config] = true
+	}
+
+	if gateways != 1 {
+		errs = append(errs, fmt.Errorf("expected a single gateway stage, got %d", gateways))
+	}
+	return errs
+}
+
+func (t *Topology) validateEdges() []error {
+	var errs []error
+	queues := make(map[string]Edge)
+
+	for _, e := range t.Edges {
+		name := fmt.Sprintf("edge %s -> %s", e.From, e.To)
+		if _, ok := t.stage(e.From); !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown stage %q", name, e.From))
+		}
+		if _, ok := t.stage(e.To); !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown stage %q", name, e.To))
+		}
+		if e.From == e.To {
+			errs = append(errs, fmt.Errorf("%s: a stage can not feed itself", name))
+		}
+		if e.Queue == "" {
+			errs = append(errs, fmt.Errorf("%s: missing queue", name))
+		}
+		if from, ok := t.stage(e.From); ok && from.Node != gatewayNode && e.Section != "" {
+			errs = append(errs, fmt.Errorf("%s: only edges from the gateway have a section", name))
+		}
+
+		switch e.Sharding {
+		case BySequence, ByGame, ByReplica, ByClient, Shared:
+		default:
+			errs = append(errs, fmt.Errorf("%s: unknown sharding %q", name, e.Sharding))
+		}
+
+		// Many stages may only publish to the same queue if they feed the same stage the same way.
+		if other, ok := queues[e.Queue]; ok && (other.To != e.To || other.Sharding != e.Sharding) {
+			errs = append(errs, fmt.Errorf("%s: queue %q is already used by edge %s -> %s", name, e.Queue, other.From, other.To))
+		}
+		queues[e.Queue] = e
+	}
+
+	return errs
+}
+
+// validateWiring checks the edges of a stage against its node type and the stages on the other end.
+func (t *Topology) validateWiring(s Stage) []error {
+	if s.Node == gatewayNode {
+		return t.validateGateway(s)
+	}
+
+	var errs []error
+	node := nodes[s.Node]
+	inputs, outputs := t.inputs(s.Name), t.outputs(s.Name)
+	if len(inputs) != node.inputs {
+		errs = append(errs, fmt.Errorf("stage %q: node %q takes %d inputs, got %d", s.Name, s.Node, node.inputs, len(inputs)))
+	}
+	if len(outputs) != node.outputs {
+		errs = append(errs, fmt.Errorf("stage %q: node %q takes %d outputs, got %d", s.Name, s.Node, node.outputs, len(outputs)))
+	}
+
+	sequenced, upstreams := 0, make(map[string]bool)
+	for _, e := range inputs {
+		from, _ := t.stage(e.From)
+		switch e.Sharding {
+		case BySequence:
+			sequenced++
+		case ByReplica:
+			if from.Replicas != s.Replicas {
+				errs = append(errs, fmt.Errorf("stage %q: has %d replicas but is fed by replica from %q, which has %d", s.Name, s.Replicas, from.Name, from.Replicas))
+			}
+		case ByClient:
+			errs = append(errs, fmt.Errorf("stage %q: only the gateway can be fed by client", s.Name))
+		case Shared:
+			upstreams[e.From] = true
+			if s.Replicas != 1 {
+				errs = append(errs, fmt.Errorf("stage %q: is fed by a shared queue from %q, so it must have a single replica", s.Name, from.Name))
+			}
+		}
+	}
+
+	if sequenced > 1 {
+		errs = append(errs, fmt.Errorf("stage %q: can only be fed by sequence from a single edge", s.Name))
+	}
+	if len(upstreams) > 1 {
+		errs = append(errs, fmt.Errorf("stage %q: can only be fed by shared queues from a single stage", s.Name))
+	}
+	if t.rings(s.Name) {
+		// The EOFs go around the replicas through the exchange of the stage, so nobody else may publish to it.
+		for _, other := range t.Stages {
+			if other.Name != s.Name && other.Exchange == s.Exchange {
+				errs = append(errs, fmt.Errorf("stage %q: sends EOFs around its replicas through exchange %q, which is shared with %q", s.Name, s.Exchange, other.Name))
+			}
+		}
+	}
+
+	return errs
+}
+
+// validateGateway checks that the gateway publishes every section of the input data and gets every result back
+// from the same queue.
+func (t *Topology) validateGateway(s Stage) []error {
+	var errs []error
+	sections := make(map[string]int)
+	for _, e := range t.outputs(s.Name) {
+		sections[e.Section]++
+		if e.Sharding != BySequence {
+			errs = append(errs, fmt.Errorf("edge %s -> %s: the gateway can only publish by sequence", e.From, e.To))
+		}
+	}
+
+	for _, section := range gatewaySections {
+		if sections[section] != 1 {
+			errs = append(errs, fmt.Errorf("stage %q: expected a single edge for section %q, got %d", s.Name, section, sections[section]))
+		}
+		delete(sections, section)
+	}
+	for section := range sections {
+		errs = append(errs, fmt.Errorf("stage %q: unknown section %q", s.Name, section))
+	}
+
+	inputs := t.inputs(s.Name)
+	if len(inputs) == 0 {
+		errs = append(errs, fmt.Errorf("stage %q: no stage sends results to the gateway", s.Name))
+	}
+	for _, e := range inputs {
+		if e.Sharding != ByClient {
+			errs = append(errs, fmt.Errorf("edge %s -> %s: results can only be sent to the gateway by client", e.From, e.To))
+		}
+		if e.Queue != inputs[0].Queue {
+			errs = append(errs, fmt.Errorf("edge %s -> %s: results must be sent to queue %q", e.From, e.To, inputs[0].Queue))
+		}
+	}
+
+	return errs
+}
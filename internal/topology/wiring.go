@@ -0,0 +1,233 @@
+package topology
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"tp1/pkg/amqp"
+	"tp1/pkg/config/provider"
+)
+
+const (
+	gatewayName     = "gateway"
+	gatewayMount    = "gateway.toml"
+	configExtension = ".json"
+	topologyFile    = "topology.json"
+)
+
+// node is a worker, or the gateway, as wired by its configuration file.
+type node struct {
+	name         string // name is the membership stage of the node, or its config if it has none.
+	config       string
+	replicas     int
+	stage        string
+	upstream     string
+	peers        uint8
+	expectedEofs uint8
+	inputs       []amqp.Destination
+	outputs      []amqp.Destination
+	exchanges    map[string]bool
+}
+
+// binding is a queue bound to an exchange with a routing key.
+type binding struct {
+	exchange string
+	key      string
+	queue    string
+}
+
+// Wiring is the queue graph of a deployment, built from the configuration files its nodes are started with.
+type Wiring struct {
+	nodes []*node // nodes holds the gateway first, followed by the workers sorted by config.
+}
+
+// LoadWiring reads the worker configurations and the gateway configuration under the configs directory of dir, and
+// the replicas of each of them from the compose file of dir.
+func LoadWiring(dir string) (*Wiring, error) {
+	replicas, err := loadReplicas(filepath.Join(dir, composeFile))
+	if err != nil {
+		return nil, err
+	}
+
+	gateway, err := loadGateway(filepath.Join(dir, configsDir, gatewayConfig))
+	if err != nil {
+		return nil, err
+	}
+	gateway.replicas = replicas[gatewayMount]
+	w := &Wiring{nodes: []*node{gateway}}
+
+	paths, err := filepath.Glob(filepath.Join(dir, configsDir, "*"+configExtension))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		if filepath.Base(path) == topologyFile {
+			continue
+		}
+		n, err := loadWorker(path)
+		if err != nil {
+			return nil, err
+		}
+		n.replicas = replicas[filepath.Base(path)]
+		w.nodes = append(w.nodes, n)
+	}
+
+	return w, nil
+}
+
+// loadReplicas counts the services of the compose file that mount each configuration file.
+func loadReplicas(path string) (map[string]int, error) {
+	cfg, err := provider.LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var services map[string]struct {
+		Volumes []string
+	}
+	if err = cfg.Unmarshal("services", &services); err != nil {
+		return nil, err
+	}
+
+	replicas := make(map[string]int)
+	for _, service := range services {
+		for _, volume := range service.Volumes {
+			host, _, _ := strings.Cut(volume, ":")
+			name := filepath.Base(host)
+			if filepath.Base(filepath.Dir(host)) == configsDir && (filepath.Ext(name) == configExtension || name == gatewayMount) {
+				replicas[name]++
+			}
+		}
+	}
+	return replicas, nil
+}
+
+func loadGateway(path string) (*node, error) {
+	cfg, err := provider.LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	exchange := cfg.String("rabbitmq.exchange_name", "")
+	n := &node{
+		name:      gatewayName,
+		config:    gatewayMount,
+		inputs:    []amqp.Destination{{Name: cfg.String("rabbitmq.reports.queue", "")}},
+		exchanges: map[string]bool{exchange: true},
+	}
+
+	// The gateway shards its EOFs by sequence ID, just like its messages, so each of them reaches a single queue.
+	for _, section := range gatewaySections {
+		key := "rabbitmq." + section
+		n.outputs = append(n.outputs, amqp.Destination{
+			Exchange:  exchange,
+			Name:      cfg.String(key+".queue", ""),
+			Key:       cfg.String(key+".key", ""),
+			Consumers: cfg.Uint8(key+".consumers", 1),
+			Single:    true,
+		})
+	}
+
+	return n, nil
+}
+
+func loadWorker(path string) (*node, error) {
+	cfg, err := provider.LoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	n := &node{
+		config:       filepath.Base(path),
+		stage:        cfg.String("membership.stage", ""),
+		upstream:     cfg.String("membership.upstream", ""),
+		peers:        cfg.Uint8("peers", 0),
+		expectedEofs: cfg.Uint8("expected-eofs", 0),
+		exchanges:    make(map[string]bool),
+	}
+	n.name = n.stage
+	if n.name == "" {
+		n.name = strings.TrimSuffix(n.config, configExtension)
+	}
+
+	if err = cfg.Unmarshal("input-queues", &n.inputs); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err = cfg.Unmarshal("output-queues", &n.outputs); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var exchanges []amqp.Exchange
+	if err = cfg.Unmarshal("exchanges", &exchanges); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	for _, e := range exchanges {
+		n.exchanges[e.Name] = true
+	}
+
+	return n, nil
+}
+
+// published returns the queues an output is bound to. Outputs without consumers are bound to a single queue.
+func published(output amqp.Destination) []binding {
+	if output.Consumers == 0 {
+		return []binding{{exchange: output.Exchange, key: output.Key, queue: output.Name}}
+	}
+
+	bindings := make([]binding, 0, output.Consumers)
+	for i := 0; i < int(output.Consumers); i++ {
+		bindings = append(bindings, binding{exchange: output.Exchange, key: shard(output.Key, i), queue: shard(output.Name, i)})
+	}
+	return bindings
+}
+
+// consumed returns the queues the replicas of a node consume from an input.
+func (n *node) consumed(input amqp.Destination) []string {
+	if !strings.Contains(input.Name, shardSuffix) {
+		return []string{input.Name}
+	}
+
+	queues := make([]string, 0, n.replicas)
+	for id := 0; id < n.replicas; id++ {
+		queues = append(queues, shard(input.Name, id))
+	}
+	return queues
+}
+
+// ringBindings returns the queues the replicas of a node bind to its exchange from an input, if any.
+func (n *node) ringBindings(input amqp.Destination) []binding {
+	if !rings(input) {
+		return nil
+	}
+	if !strings.Contains(input.Name, shardSuffix) || !strings.Contains(input.Key, shardSuffix) {
+		return []binding{{exchange: input.Exchange, key: input.Key, queue: input.Name}}
+	}
+
+	bindings := make([]binding, 0, n.replicas)
+	for id := 0; id < n.replicas; id++ {
+		bindings = append(bindings, binding{exchange: input.Exchange, key: shard(input.Key, id), queue: shard(input.Name, id)})
+	}
+	return bindings
+}
+
+// shard inserts a replica ID into a queue name or routing key, if it has a place for it.
+func shard(format string, id int) string {
+	if !strings.Contains(format, shardSuffix) {
+		return format
+	}
+	return fmt.Sprintf(format, id)
+}
+
+// rings returns whether an input is bound to the exchange of the node, so that EOFs can be sent around its replicas.
+func rings(input amqp.Destination) bool {
+	return input.Exchange != ""
+}
+
+// errorf returns a problem found in a node.
+func (n *node) errorf(format string, args ...any) error {
+	return fmt.Errorf("%s: %s", n.config, fmt.Sprintf(format, args...))
+}
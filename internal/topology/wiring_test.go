@@ -0,0 +1,111 @@
+package topology
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepoWiringIsValid(t *testing.T) {
+	w, err := LoadWiring(repoRoot)
+	require.NoError(t, err)
+	assert.NoError(t, w.Validate())
+}
+
+func TestWiringProblemsAreReported(t *testing.T) {
+	tests := map[string]struct {
+		config string
+		edit   func(cfg map[string]any)
+		want   string
+	}{
+		"dangling queue": {
+			config: "text",
+			edit:   func(cfg map[string]any) { output(cfg, 0)["name"] = "english_reviews_%d" },
+			want:   `joiner_counter.json: input queue "reviews_q4_0" is not published to by any node`,
+		},
+		"fan-out mismatch": {
+			config: "review",
+			edit:   func(cfg map[string]any) { output(cfg, 1)["consumers"] = 4 },
+			want:   `review.json: publishes to 4 queues "text_reviews_q4_%d", but review-text-filter has 5 replicas`,
+		},
+		"key with a replica ID on a non-scalable destination": {
+			config: "topn",
+			edit:   func(cfg map[string]any) { output(cfg, 0)["key"] = "%d" },
+			want:   `topn.json: output queue "top_queue" has %d in its name or key but no consumers, so it is declared as is`,
+		},
+		"input key without a replica ID": {
+			config: "text",
+			edit:   func(cfg map[string]any) { input(cfg, 0)["key"] = "input" },
+			want:   `text.json: input queue "text_reviews_q4_%d" is bound with key "input", either both or none must have %d`,
+		},
+		"EOF reaching a single replica": {
+			config: "text",
+			edit: func(cfg map[string]any) {
+				delete(input(cfg, 0), "exchange")
+				delete(input(cfg, 0), "key")
+			},
+			want: `review.json: EOFs only reach "text_reviews_q4_0", but review-text-filter does not send them around its replicas`,
+		},
+		"expected EOFs mismatch": {
+			config: "topn_agg",
+			edit: func(cfg map[string]any) {
+				delete(cfg, "membership")
+				cfg["expected-eofs"] = 1
+			},
+			want: `topn_agg.json: expects 1 EOFs by client, but 2 workers publish to it`,
+		},
+		"unknown upstream": {
+			config: "counter_agg",
+			edit:   func(cfg map[string]any) { cfg["membership"].(map[string]any)["upstream"] = "percentile-joiner" },
+			want:   `counter_agg.json: expects an EOF from each worker of "percentile-joiner", which does not publish to it`,
+		},
+		"cycle": {
+			config: "topn_agg",
+			edit: func(cfg map[string]any) {
+				cfg["output-queues"] = []any{map[string]any{"exchange": "reports", "name": "joined_top_%d", "key": "top-%d", "consumers": 2}}
+			},
+			want: "cycle: topn-filter -> topn-aggregator -> topn-filter",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			_, err := load(t).Generate(dir)
+			require.NoError(t, err)
+			editConfig(t, dir, test.config, test.edit)
+
+			w, err := LoadWiring(dir)
+			require.NoError(t, err)
+			err = w.Validate()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), test.want)
+		})
+	}
+}
+
+func editConfig(t *testing.T, dir, config string, edit func(cfg map[string]any)) {
+	path := filepath.Join(dir, configsDir, config+configExtension)
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var cfg map[string]any
+	require.NoError(t, json.Unmarshal(b, &cfg))
+	edit(cfg)
+
+	b, err = json.Marshal(cfg)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, b, 0o644))
+}
+
+func input(cfg map[string]any, i int) map[string]any {
+	return cfg["input-queues"].([]any)[i].(map[string]any)
+}
+
+func output(cfg map[string]any, i int) map[string]any {
+	return cfg["output-queues"].([]any)[i].(map[string]any)
+}
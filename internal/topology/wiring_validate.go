@@ -0,0 +1,382 @@
+package topology
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"tp1/pkg/amqp"
+)
+
+// route is an exchange and a routing key messages are published with.
+type route struct {
+	exchange string
+	key      string
+}
+
+// graph holds, by queue, the nodes that publish to it and the nodes that consume from it.
+type graph struct {
+	publishers map[string][]*node
+	consumers  map[string][]*node
+	routes     map[route][]string
+}
+
+// Validate checks the wiring of the deployment, returning every problem found: queues nobody publishes to or
+// consumes from, queue counts that do not match the replicas on the other end, EOF routes that can never complete
+// and cycles.
+func (w *Wiring) Validate() error {
+	g := w.graph()
+
+	var errs []error
+	for _, n := range w.nodes {
+		errs = append(errs, n.validateFormats()...)
+	}
+	errs = append(errs, w.validateQueues(g)...)
+	errs = append(errs, g.validateRoutes()...)
+	for _, n := range w.nodes {
+		errs = append(errs, w.validateFanOut(n)...)
+		errs = append(errs, w.validateEofs(n, g)...)
+	}
+	errs = append(errs, w.validateReachability(g)...)
+	errs = append(errs, w.validateCycles(g)...)
+
+	return errors.Join(errs...)
+}
+
+func (w *Wiring) graph() graph {
+	g := graph{
+		publishers: make(map[string][]*node),
+		consumers:  make(map[string][]*node),
+		routes:     make(map[route][]string),
+	}
+
+	for _, n := range w.nodes {
+		for _, output := range n.outputs {
+			for _, b := range published(output) {
+				g.publishers[b.queue] = appendNode(g.publishers[b.queue], n)
+				g.bind(b)
+			}
+		}
+		for _, input := range n.inputs {
+			for _, queue := range n.consumed(input) {
+				g.consumers[queue] = appendNode(g.consumers[queue], n)
+			}
+			for _, b := range n.ringBindings(input) {
+				g.bind(b)
+			}
+		}
+	}
+
+	return g
+}
+
+func (g graph) bind(b binding) {
+	r := route{exchange: b.exchange, key: b.key}
+	for _, queue := range g.routes[r] {
+		if queue == b.queue {
+			return
+		}
+	}
+	g.routes[r] = append(g.routes[r], b.queue)
+}
+
+// next returns the nodes a node publishes to, in order.
+func (g graph) next(n *node) []*node {
+	var next []*node
+	for _, output := range n.outputs {
+		for _, b := range published(output) {
+			for _, consumer := range g.consumers[b.queue] {
+				next = appendNode(next, consumer)
+			}
+		}
+	}
+	return next
+}
+
+// validateFormats checks that the queue names and routing keys of a node have a place for the replica ID only if
+// they get one.
+func (n *node) validateFormats() []error {
+	var errs []error
+	if n.replicas == 0 {
+		errs = append(errs, n.errorf("not deployed by the compose file"))
+	}
+
+	for _, output := range n.outputs {
+		if output.Name == "" {
+			errs = append(errs, n.errorf("output queue without name"))
+			continue
+		}
+		scalable := strings.Contains(output.Name, shardSuffix) || strings.Contains(output.Key, shardSuffix)
+		if output.Consumers == 0 && scalable {
+			errs = append(errs, n.errorf("output queue %q has %s in its name or key but no consumers, so it is declared as is", output.Name, shardSuffix))
+		}
+		if output.Consumers > 0 && (!strings.Contains(output.Name, shardSuffix) || !strings.Contains(output.Key, shardSuffix)) {
+			errs = append(errs, n.errorf("output queue %q has %d consumers, so both its name and its key %q must have %s", output.Name, output.Consumers, output.Key, shardSuffix))
+		}
+		if !n.exchanges[output.Exchange] {
+			errs = append(errs, n.errorf("output queue %q is published to exchange %q, which is not declared", output.Name, output.Exchange))
+		}
+	}
+
+	for _, input := range n.inputs {
+		if input.Name == "" {
+			errs = append(errs, n.errorf("input queue without name"))
+			continue
+		}
+		if !rings(input) {
+			continue
+		}
+		// Queues bound to the exchange of the node get declared with the replica ID only if both the name and the
+		// key have a place for it, but they are always consumed with it.
+		if strings.Contains(input.Name, shardSuffix) != strings.Contains(input.Key, shardSuffix) {
+			errs = append(errs, n.errorf("input queue %q is bound with key %q, either both or none must have %s", input.Name, input.Key, shardSuffix))
+		}
+		if !n.exchanges[input.Exchange] {
+			errs = append(errs, n.errorf("input queue %q is bound to exchange %q, which is not declared", input.Name, input.Exchange))
+		}
+	}
+
+	return errs
+}
+
+// validateQueues checks that every queue consumed is published to, and the other way around.
+func (w *Wiring) validateQueues(g graph) []error {
+	var errs []error
+	for _, n := range w.nodes {
+		for _, input := range n.inputs {
+			for _, queue := range n.consumed(input) {
+				if len(g.publishers[queue]) == 0 {
+					errs = append(errs, n.errorf("input queue %q is not published to by any node", queue))
+				}
+			}
+		}
+		for _, output := range n.outputs {
+			for _, b := range published(output) {
+				if len(g.consumers[b.queue]) == 0 {
+					errs = append(errs, n.errorf("output queue %q is not consumed by any node", b.queue))
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// validateRoutes checks that each routing key of an exchange reaches a single queue, since every queue bound with
+// it gets a copy of the messages.
+func (g graph) validateRoutes() []error {
+	routes := make([]route, 0, len(g.routes))
+	for r, queues := range g.routes {
+		if len(queues) > 1 {
+			routes = append(routes, r)
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].exchange < routes[j].exchange || (routes[i].exchange == routes[j].exchange && routes[i].key < routes[j].key)
+	})
+
+	errs := make([]error, 0, len(routes))
+	for _, r := range routes {
+		errs = append(errs, fmt.Errorf("exchange %q: key %q is bound to many queues %v", r.exchange, r.key, g.routes[r]))
+	}
+	return errs
+}
+
+// validateFanOut checks that the queues a node publishes to match the replicas that consume them.
+func (w *Wiring) validateFanOut(n *node) []error {
+	var errs []error
+	for _, output := range n.outputs {
+		if output.Consumers == 0 {
+			continue
+		}
+		for _, consumer := range w.consumersOf(output) {
+			if consumer.replicas != int(output.Consumers) {
+				errs = append(errs, n.errorf("publishes to %d queues %q, but %s has %d replicas", output.Consumers, output.Name, consumer.name, consumer.replicas))
+			}
+		}
+	}
+	return errs
+}
+
+// validateEofs checks that every EOF sent to a node reaches all of its replicas, and that the node knows how many
+// EOFs to wait for.
+func (w *Wiring) validateEofs(n *node, g graph) []error {
+	var errs []error
+
+	for _, output := range n.outputs {
+		if !output.Single || output.Consumers <= 1 {
+			continue
+		}
+		for _, consumer := range w.consumersOf(output) {
+			if input, _ := consumer.input(output.Name); !rings(input) {
+				errs = append(errs, n.errorf("EOFs only reach %q, but %s does not send them around its replicas", shard(output.Name, 0), consumer.name))
+			}
+		}
+	}
+
+	for _, input := range n.inputs {
+		if rings(input) && n.replicas > 1 && n.stage == "" && int(n.peers) != n.replicas {
+			errs = append(errs, n.errorf("sends EOFs around %d peers, but has %d replicas", n.peers, n.replicas))
+		}
+	}
+
+	publishers := w.publishersOf(n, g)
+	if n.stage == "" && n.expectedEofs > 0 {
+		workers := 0
+		for _, p := range publishers {
+			workers += p.replicas
+		}
+		if workers != int(n.expectedEofs) {
+			errs = append(errs, n.errorf("expects %d EOFs by client, but %d workers publish to it", n.expectedEofs, workers))
+		}
+	}
+	if n.upstream != "" {
+		found := false
+		for _, p := range publishers {
+			found = found || p.stage == n.upstream
+		}
+		if !found {
+			errs = append(errs, n.errorf("expects an EOF from each worker of %q, which does not publish to it", n.upstream))
+		}
+	}
+
+	return errs
+}
+
+// validateReachability checks that every node gets the data of the gateway and sends its results back to it, so
+// that EOFs go all the way around.
+func (w *Wiring) validateReachability(g graph) []error {
+	gateway := w.nodes[0]
+
+	reached := map[*node]bool{gateway: true}
+	pending := []*node{gateway}
+	for len(pending) > 0 {
+		n := pending[0]
+		pending = pending[1:]
+		for _, next := range g.next(n) {
+			if !reached[next] {
+				reached[next] = true
+				pending = append(pending, next)
+			}
+		}
+	}
+
+	var errs []error
+	for _, n := range w.nodes[1:] {
+		if !reached[n] {
+			errs = append(errs, n.errorf("is not reachable from the gateway"))
+		}
+		if !w.reaches(n, gateway, g, make(map[*node]bool)) {
+			errs = append(errs, n.errorf("never sends its results to the gateway, so its EOFs can never complete"))
+		}
+	}
+	return errs
+}
+
+func (w *Wiring) reaches(from, to *node, g graph, visited map[*node]bool) bool {
+	if from == to {
+		return true
+	}
+	visited[from] = true
+	for _, next := range g.next(from) {
+		if !visited[next] && w.reaches(next, to, g, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateCycles checks that no worker gets back the messages it publishes. The gateway is left out, since every
+// message starts and ends there.
+func (w *Wiring) validateCycles(g graph) []error {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+
+	var errs []error
+	state := make(map[*node]int)
+	var path []*node
+
+	var visit func(n *node)
+	visit = func(n *node) {
+		state[n] = visiting
+		path = append(path, n)
+		for _, next := range g.next(n) {
+			if next == w.nodes[0] {
+				continue
+			}
+			switch state[next] {
+			case unvisited:
+				visit(next)
+			case visiting:
+				errs = append(errs, fmt.Errorf("cycle: %s", cycle(path, next)))
+			}
+		}
+		path = path[:len(path)-1]
+		state[n] = visited
+	}
+
+	for _, n := range w.nodes[1:] {
+		if state[n] == unvisited {
+			visit(n)
+		}
+	}
+	return errs
+}
+
+// cycle returns the names of the nodes of a path from the given one on, back to it.
+func cycle(path []*node, start *node) string {
+	var names []string
+	for i := len(path) - 1; i >= 0; i-- {
+		names = append([]string{path[i].name}, names...)
+		if path[i] == start {
+			break
+		}
+	}
+	return strings.Join(append(names, start.name), " -> ")
+}
+
+// consumersOf returns the nodes that consume the queues of an output.
+func (w *Wiring) consumersOf(output amqp.Destination) []*node {
+	var consumers []*node
+	for _, n := range w.nodes {
+		if _, ok := n.input(output.Name); ok {
+			consumers = append(consumers, n)
+		}
+	}
+	return consumers
+}
+
+// publishersOf returns the nodes that publish to the queues a node consumes.
+func (w *Wiring) publishersOf(n *node, g graph) []*node {
+	var publishers []*node
+	for _, input := range n.inputs {
+		for _, queue := range n.consumed(input) {
+			for _, p := range g.publishers[queue] {
+				publishers = appendNode(publishers, p)
+			}
+		}
+	}
+	return publishers
+}
+
+// input returns the input of a node with the given queue name.
+func (n *node) input(name string) (amqp.Destination, bool) {
+	for _, input := range n.inputs {
+		if input.Name == name {
+			return input, true
+		}
+	}
+	return amqp.Destination{}, false
+}
+
+func appendNode(nodes []*node, n *node) []*node {
+	for _, other := range nodes {
+		if other == n {
+			return nodes
+		}
+	}
+	return append(nodes, n)
+}
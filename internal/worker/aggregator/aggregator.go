@@ -12,9 +12,11 @@ import (
 )
 
 type processor interface {
+	worker.Snapshotter
+	worker.Purger
 	reset(clientId string)
 	publish(headers amqp.Header) []sequence.Destination
-	save(msgBytes []byte, clientId string)
+	save(msgBytes []byte, clientId string) error
 }
 
 type aggregator struct {
@@ -60,31 +62,41 @@ func (a *aggregator) reset(clientId string) {
 	delete(a.eofsRecv, clientId)
 }
 
+// purge drops the state of a client, both the aggregator's and the instance's.
+func (a *aggregator) purge(instance processor, clientId string) {
+	a.reset(clientId)
+	instance.reset(clientId)
+}
+
 func (a *aggregator) recover(instance processor, msgId message.Id) {
 	ch := make(chan recovery.Message, worker.ChanSize)
-	go a.w.Recover(ch)
+	go a.w.Recover(instance, ch)
 
 	for recoveredMsg := range ch {
 		switch recoveredMsg.Header().MessageId {
 		case message.EofId:
 			a.processEof(instance, recoveredMsg.Header().WithOriginId(a.originId), true)
+		case message.ClientAbortId:
+			a.purge(instance, recoveredMsg.Header().ClientId)
 		case msgId:
-			instance.save(recoveredMsg.Message(), recoveredMsg.Header().ClientId)
+			if err := instance.save(recoveredMsg.Message(), recoveredMsg.Header().ClientId); err != nil {
+				a.w.Log(recoveredMsg.Header()).Errorf("%s", err)
+			}
 		default:
-			logs.Logger.Errorf(errors.InvalidMessageId.Error(), recoveredMsg.Header().MessageId)
+			a.w.Log(recoveredMsg.Header()).Errorf("%s: %d", errors.InvalidMessageId.Error(), recoveredMsg.Header().MessageId)
 		}
 	}
 }
 
 func (a *aggregator) eofsReached(headers amqp.Header) bool {
-	return a.eofsRecv[headers.ClientId] >= a.w.ExpectedEofs
+	return a.eofsRecv[headers.ClientId] >= a.w.ExpectedEofs(headers.ClientId)
 }
 
 func shardOutput(output amqp.Destination, clientId string) amqp.Destination {
 	output, err := shard.AggregatorOutput(output, clientId)
 
 	if err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
+		logs.With(logs.ClientId, clientId).Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
 	}
 	return output
 }
@@ -93,9 +105,9 @@ func (a *aggregator) sendEof(headers amqp.Header) []sequence.Destination {
 	output := shardOutput(a.w.Outputs[0], headers.ClientId)
 	sequenceIds, err := a.w.HandleEofMessage(amqp.EmptyEof, headers, amqp.DestinationEof(output))
 	if err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToPublish.Error(), err)
+		a.w.Log(headers).Errorf("%s: %s", errors.FailedToPublish.Error(), err)
 	}
 
-	logs.Logger.Debugf("Eof message sent for client %s", headers.ClientId)
+	a.w.Log(headers).Debugf("Eof message sent")
 	return sequenceIds
 }
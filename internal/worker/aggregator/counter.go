@@ -1,10 +1,11 @@
 package aggregator
 
 import (
+	"fmt"
+
 	"tp1/internal/errors"
 	"tp1/internal/worker"
 	"tp1/pkg/amqp"
-	"tp1/pkg/logs"
 	"tp1/pkg/message"
 	"tp1/pkg/sequence"
 )
@@ -14,6 +15,12 @@ type counter struct {
 	games map[string]message.GameNames // <clientId, []GameName>
 }
 
+// counterState is the state of a counter, saved in snapshots.
+type counterState struct {
+	EofsRecv map[string]uint8
+	Games    map[string]message.GameNames
+}
+
 func NewCounter() (worker.Node, error) {
 	a, err := newAggregator(amqp.Query4OriginId)
 	if err != nil {
@@ -43,15 +50,21 @@ func (c *counter) Start() {
 
 func (c *counter) Process(delivery amqp.Delivery, headers amqp.Header) ([]sequence.Destination, []byte) {
 	var sequenceIds []sequence.Destination
+	var err error
 
 	switch headers.MessageId {
 	case message.EofId:
 		sequenceIds = c.agg.processEof(c, headers.WithOriginId(c.agg.originId), false)
 	case message.GameNameId:
-		c.save(delivery.Body, headers.ClientId)
-		sequenceIds = c.publish(headers)
+		if err = c.save(delivery.Body, headers.ClientId); err == nil {
+			sequenceIds = c.publish(headers)
+		}
 	default:
-		logs.Logger.Errorf(errors.InvalidMessageId.Error(), headers.MessageId)
+		err = fmt.Errorf("%w: %d", errors.InvalidMessageId, headers.MessageId)
+	}
+
+	if err != nil {
+		c.agg.w.DeadLetter(delivery, err)
 	}
 
 	return sequenceIds, delivery.Body
@@ -60,10 +73,11 @@ func (c *counter) Process(delivery amqp.Delivery, headers amqp.Header) ([]sequen
 func (c *counter) publish(headers amqp.Header) []sequence.Destination {
 	var sequenceIds []sequence.Destination
 	if len(c.games[headers.ClientId]) > 0 && (c.batchSizeReached(headers) || c.agg.eofsReached(headers)) {
+		log := c.agg.w.Log(headers)
 		b, err := c.games[headers.ClientId].ToBytes()
-		logs.Logger.Infof("Publishing batch of %d games for client %s", len(c.games), headers.ClientId)
+		log.Infof("Publishing batch of %d games", len(c.games[headers.ClientId]))
 		if err != nil {
-			logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
+			log.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
 			return sequenceIds
 		}
 
@@ -81,21 +95,28 @@ func (c *counter) sendBatch(headers amqp.Header, b []byte) []sequence.Destinatio
 	headers = headers.WithSequenceId(sequence.SrcNew(c.agg.w.Uuid, sequenceId)).WithOriginId(c.agg.originId)
 
 	if err := c.agg.w.Broker.Publish(output.Exchange, key, b, headers); err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToPublish.Error(), err)
+		c.agg.w.Log(headers).Errorf("%s: %s", errors.FailedToPublish.Error(), err)
 	}
 
 	return []sequence.Destination{sequence.DstNew(key, sequenceId)}
 }
 
+func (c *counter) Purge(clientId string) {
+	c.agg.purge(c, clientId)
+}
+
+func (c *counter) StateSize(clientId string) int {
+	return len(c.games[clientId])
+}
+
 func (c *counter) reset(clientId string) {
 	delete(c.games, clientId)
 }
 
-func (c *counter) save(msgBytes []byte, clientId string) {
+func (c *counter) save(msgBytes []byte, clientId string) error {
 	msg, err := message.GameNameFromBytes(msgBytes)
 	if err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
-		return
+		return fmt.Errorf("%w: %w", errors.FailedToParse, err)
 	}
 
 	if _, ok := c.games[clientId]; !ok {
@@ -103,8 +124,18 @@ func (c *counter) save(msgBytes []byte, clientId string) {
 	}
 
 	c.games[clientId] = append(c.games[clientId], msg)
+
+	return nil
 }
 
 func (c *counter) batchSizeReached(headers amqp.Header) bool {
 	return len(c.games[headers.ClientId]) >= int(c.agg.batchSize)
 }
+
+func (c *counter) Snapshot() ([]byte, error) {
+	return worker.EncodeState(counterState{EofsRecv: c.agg.eofsRecv, Games: c.games})
+}
+
+func (c *counter) Restore(state []byte) error {
+	return worker.DecodeState(state, &counterState{EofsRecv: c.agg.eofsRecv, Games: c.games})
+}
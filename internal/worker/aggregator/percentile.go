@@ -1,11 +1,11 @@
 package aggregator
 
 import (
+	"fmt"
 	"math"
 	"tp1/internal/errors"
 	"tp1/internal/worker"
 	"tp1/pkg/amqp"
-	"tp1/pkg/logs"
 	"tp1/pkg/message"
 	"tp1/pkg/sequence"
 )
@@ -16,6 +16,12 @@ type percentile struct {
 	scoredReviews map[string]message.ScoredReviews // <clientid, scoredReviews>
 }
 
+// percentileState is the state of a percentile, saved in snapshots.
+type percentileState struct {
+	EofsRecv      map[string]uint8
+	ScoredReviews map[string]message.ScoredReviews
+}
+
 func NewPercentile() (worker.Node, error) {
 	a, err := newAggregator(amqp.Query5OriginId)
 	if err != nil {
@@ -48,24 +54,28 @@ func (p *percentile) Start() {
 
 func (p *percentile) Process(delivery amqp.Delivery, headers amqp.Header) ([]sequence.Destination, []byte) {
 	var sequenceIds []sequence.Destination
+	var err error
 
 	switch headers.MessageId {
 	case message.EofId:
 		sequenceIds = p.agg.processEof(p, headers.WithOriginId(p.agg.originId), false)
 	case message.ScoredReviewId:
-		p.save(delivery.Body, headers.ClientId)
+		err = p.save(delivery.Body, headers.ClientId)
 	default:
-		logs.Logger.Errorf(errors.InvalidMessageId.Error(), headers.MessageId)
+		err = fmt.Errorf("%w: %d", errors.InvalidMessageId, headers.MessageId)
+	}
+
+	if err != nil {
+		p.agg.w.DeadLetter(delivery, err)
 	}
 
 	return sequenceIds, delivery.Body
 }
 
-func (p *percentile) save(msgBytes []byte, clientId string) {
+func (p *percentile) save(msgBytes []byte, clientId string) error {
 	msg, err := message.ScoredReviewsFromBytes(msgBytes)
 	if err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
-		return
+		return fmt.Errorf("%w: %w", errors.FailedToParse, err)
 	}
 
 	if _, ok := p.scoredReviews[clientId]; !ok {
@@ -73,6 +83,8 @@ func (p *percentile) save(msgBytes []byte, clientId string) {
 	}
 
 	p.scoredReviews[clientId] = append(p.scoredReviews[clientId], msg...)
+
+	return nil
 }
 
 func (p *percentile) publish(headers amqp.Header) []sequence.Destination {
@@ -103,6 +115,14 @@ func (p *percentile) percentileIdx(clientId string) int {
 	return percentileIndex
 }
 
+func (p *percentile) Purge(clientId string) {
+	p.agg.purge(p, clientId)
+}
+
+func (p *percentile) StateSize(clientId string) int {
+	return len(p.scoredReviews[clientId])
+}
+
 func (p *percentile) reset(clientId string) {
 	delete(p.scoredReviews, clientId)
 }
@@ -116,7 +136,7 @@ func (p *percentile) sendBatches(headers amqp.Header, output amqp.Destination, m
 		batch, nextStart := p.nextBatch(msg, start, len(msg))
 		bytes, err := batch.ToBytes()
 		if err != nil {
-			logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err)
+			p.agg.w.Log(headers).Errorf("%s: %s", errors.FailedToParse.Error(), err)
 			return sequenceIds
 		}
 
@@ -133,10 +153,10 @@ func (p *percentile) sendBatches(headers amqp.Header, output amqp.Destination, m
 
 func (p *percentile) sendBatch(bytes []byte, headers amqp.Header, output amqp.Destination) {
 	if err := p.agg.w.Broker.Publish(output.Exchange, output.Key, bytes, headers); err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToPublish.Error(), err)
+		p.agg.w.Log(headers).Errorf("%s: %s", errors.FailedToPublish.Error(), err)
 	}
 
-	logs.Logger.Infof("Games in percentile %d published", p.n)
+	p.agg.w.Log(headers).Infof("Games in percentile %d published", p.n)
 }
 
 func (p *percentile) nextBatch(data message.ScoredReviews, start int, gamesLen int) (message.ScoredReviews, int) {
@@ -146,3 +166,11 @@ func (p *percentile) nextBatch(data message.ScoredReviews, start int, gamesLen i
 	}
 	return data[start:end], end
 }
+
+func (p *percentile) Snapshot() ([]byte, error) {
+	return worker.EncodeState(percentileState{EofsRecv: p.agg.eofsRecv, ScoredReviews: p.scoredReviews})
+}
+
+func (p *percentile) Restore(state []byte) error {
+	return worker.DecodeState(state, &percentileState{EofsRecv: p.agg.eofsRecv, ScoredReviews: p.scoredReviews})
+}
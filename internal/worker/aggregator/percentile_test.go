@@ -116,6 +116,36 @@ func TestSaveScoredReviewAppendsMessagesToManyClients(t *testing.T) {
 	}
 }
 
+func TestSnapshotRestoresScoredReviewsAndEofs(t *testing.T) {
+	f := fakeFilter(90)
+	f.agg = &aggregator{eofsRecv: map[string]uint8{"0-0": 1}}
+	msg := message.ScoredReviews{
+		{GameId: 1, Votes: 10, GameName: "a"},
+		{GameId: 2, Votes: 20, GameName: "b"},
+	}
+	bytes, _ := msg.ToBytes()
+	_ = f.save(bytes, "0-0")
+
+	state, err := f.Snapshot()
+	if err != nil {
+		t.Fatalf("Unexpected error taking snapshot: %s", err)
+	}
+
+	restored := fakeFilter(90)
+	restored.agg = &aggregator{eofsRecv: make(map[string]uint8)}
+	if err = restored.Restore(state); err != nil {
+		t.Fatalf("Unexpected error restoring snapshot: %s", err)
+	}
+
+	if len(restored.scoredReviews["0-0"]) != 2 || restored.scoredReviews["0-0"][1] != msg[1] {
+		t.Errorf("Expected scored reviews %v, got %v", msg, restored.scoredReviews["0-0"])
+	}
+
+	if restored.agg.eofsRecv["0-0"] != 1 {
+		t.Errorf("Expected 1 EOF received, got %d", restored.agg.eofsRecv["0-0"])
+	}
+}
+
 func fakeFilter(n uint8) *percentile {
 	return &percentile{n: n, scoredReviews: make(map[string]message.ScoredReviews)}
 }
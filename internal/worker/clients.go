@@ -0,0 +1,132 @@
+package worker
+
+import (
+	"sync"
+	"time"
+)
+
+// Purger is implemented by nodes that keep state by client, so that it can be dropped once a client gets aborted
+// or expires.
+type Purger interface {
+	// Purge drops every state the node keeps for the given client.
+	Purge(clientId string)
+}
+
+// clients tracks the lifecycle of the clients seen by a worker: when each client was last seen, and which clients
+// were aborted or expired, so that their late messages get discarded.
+type clients struct {
+	mu         sync.Mutex
+	ttl        time.Duration // ttl is how long a client may go unseen before it expires. 0 disables expiration.
+	lastSeen   map[string]time.Time
+	aborted    map[string]time.Time
+	expired    map[string]time.Time // expired holds the clients that expired, which were not aborted by the gateway.
+	nextExpiry time.Time
+}
+
+func newClients(ttl time.Duration) *clients {
+	return &clients{
+		ttl:      ttl,
+		lastSeen: make(map[string]time.Time),
+		aborted:  make(map[string]time.Time),
+		expired:  make(map[string]time.Time),
+	}
+}
+
+// touch records that a client was seen at the given time.
+func (c *clients) touch(clientId string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastSeen[clientId] = now
+}
+
+// abort marks a client as aborted at the given time.
+func (c *clients) abort(clientId string, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.lastSeen, clientId)
+	delete(c.expired, clientId)
+	c.aborted[clientId] = now
+}
+
+// isAborted returns whether a client was aborted.
+func (c *clients) isAborted(clientId string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.aborted[clientId]
+	return ok
+}
+
+// discards returns whether the messages of a client get discarded, since it was either aborted or expired.
+func (c *clients) discards(clientId string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, aborted := c.aborted[clientId]
+	_, expired := c.expired[clientId]
+	return aborted || expired
+}
+
+// active returns the amount of clients seen that were neither aborted nor expired.
+func (c *clients) active() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.lastSeen)
+}
+
+// expire forgets the clients that were not seen for longer than the TTL and returns them. Their late messages get
+// discarded like the ones of aborted clients, instead of starting them over with part of their data. Aborted and
+// expired clients are forgotten after the TTL too. Clients are checked at most once per TTL, so a client may live up
+// to twice the TTL.
+func (c *clients) expire(now time.Time) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ttl <= 0 || now.Before(c.nextExpiry) {
+		return nil
+	}
+	c.nextExpiry = now.Add(c.ttl)
+
+	var expired []string
+	for clientId, seen := range c.lastSeen {
+		if now.Sub(seen) > c.ttl {
+			expired = append(expired, clientId)
+			delete(c.lastSeen, clientId)
+			c.expired[clientId] = now
+		}
+	}
+	for clientId, abortedAt := range c.aborted {
+		if now.Sub(abortedAt) > c.ttl {
+			delete(c.aborted, clientId)
+		}
+	}
+	for clientId, expiredAt := range c.expired {
+		if now.Sub(expiredAt) > c.ttl {
+			delete(c.expired, clientId)
+		}
+	}
+
+	return expired
+}
+
+// snapshot returns a copy of the last time each client was seen and of the aborted and expired clients.
+func (c *clients) snapshot() (map[string]time.Time, map[string]time.Time, map[string]time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return copyTimes(c.lastSeen), copyTimes(c.aborted), copyTimes(c.expired)
+}
+
+// restore replaces the tracked clients with the ones of a snapshot.
+func (c *clients) restore(lastSeen, aborted, expired map[string]time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastSeen = copyTimes(lastSeen)
+	c.aborted = copyTimes(aborted)
+	c.expired = copyTimes(expired)
+}
+
+func copyTimes(m map[string]time.Time) map[string]time.Time {
+	times := make(map[string]time.Time, len(m))
+	for k, v := range m {
+		times[k] = v
+	}
+	return times
+}
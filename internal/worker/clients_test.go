@@ -0,0 +1,117 @@
+package worker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClientsExpireUnseenClients(t *testing.T) {
+	c := newClients(time.Minute)
+	now := time.Now()
+
+	c.touch("idle", now)
+	c.touch("active", now.Add(2*time.Minute))
+
+	expired := c.expire(now.Add(2 * time.Minute))
+	if len(expired) != 1 || expired[0] != "idle" {
+		t.Fatalf("expected only the idle client to expire, got %v", expired)
+	}
+}
+
+func TestClientsAreCheckedOncePerTTL(t *testing.T) {
+	c := newClients(time.Minute)
+	now := time.Now()
+
+	c.touch("client", now)
+	if expired := c.expire(now.Add(30 * time.Second)); len(expired) != 0 {
+		t.Fatalf("expected no client to expire, got %v", expired)
+	}
+	if expired := c.expire(now.Add(80 * time.Second)); len(expired) != 0 {
+		t.Fatalf("expected clients not to be checked again within the TTL, got %v", expired)
+	}
+	if expired := c.expire(now.Add(100 * time.Second)); len(expired) != 1 {
+		t.Fatalf("expected the client to expire, got %v", expired)
+	}
+}
+
+func TestClientsDoNotExpireWithoutTTL(t *testing.T) {
+	c := newClients(0)
+	now := time.Now()
+
+	c.touch("client", now)
+	if expired := c.expire(now.Add(24 * time.Hour)); len(expired) != 0 {
+		t.Fatalf("expected no client to expire, got %v", expired)
+	}
+}
+
+func TestClientsActiveLeavesOutAbortedAndExpiredClients(t *testing.T) {
+	c := newClients(time.Minute)
+	now := time.Now()
+
+	c.touch("idle", now)
+	c.touch("aborted", now)
+	c.touch("active", now.Add(2*time.Minute))
+	c.abort("aborted", now)
+	if active := c.active(); active != 2 {
+		t.Fatalf("expected 2 active clients, got %d", active)
+	}
+
+	c.expire(now.Add(2 * time.Minute))
+	if active := c.active(); active != 1 {
+		t.Fatalf("expected 1 active client, got %d", active)
+	}
+}
+
+func TestClientsForgetAbortedClientsAfterTTL(t *testing.T) {
+	c := newClients(time.Minute)
+	now := time.Now()
+
+	c.touch("client", now)
+	c.abort("client", now)
+	if !c.isAborted("client") {
+		t.Fatal("expected client to be aborted")
+	}
+
+	if expired := c.expire(now.Add(2 * time.Minute)); len(expired) != 0 {
+		t.Fatalf("expected aborted clients not to be purged again, got %v", expired)
+	}
+	if c.isAborted("client") {
+		t.Fatal("expected aborted client to be forgotten after the TTL")
+	}
+}
+
+func TestClientsRestoreSnapshot(t *testing.T) {
+	c := newClients(time.Minute)
+	now := time.Now()
+	c.touch("active", now)
+	c.abort("aborted", now)
+
+	restored := newClients(time.Minute)
+	restored.restore(c.snapshot())
+
+	if !restored.isAborted("aborted") || restored.isAborted("active") {
+		t.Fatal("expected aborted clients to be restored")
+	}
+	if expired := restored.expire(now.Add(2 * time.Minute)); len(expired) != 1 || expired[0] != "active" {
+		t.Fatalf("expected the restored client to expire, got %v", expired)
+	}
+}
+
+func TestClientsDiscardExpiredClientsWithoutTakingThemForAborted(t *testing.T) {
+	c := newClients(time.Minute)
+	now := time.Now()
+
+	c.touch("client", now)
+	c.expire(now.Add(2 * time.Minute))
+	if !c.discards("client") {
+		t.Fatal("expected the messages of an expired client to be discarded")
+	}
+	if c.isAborted("client") {
+		t.Fatal("expected an expired client not to be taken for aborted, so that its abort gets forwarded")
+	}
+
+	c.abort("client", now.Add(3*time.Minute))
+	if !c.isAborted("client") || !c.discards("client") {
+		t.Fatal("expected the client to be aborted")
+	}
+}
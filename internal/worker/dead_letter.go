@@ -0,0 +1,75 @@
+package worker
+
+import (
+	"tp1/internal/errors"
+	"tp1/pkg/amqp"
+	"tp1/pkg/dlq"
+)
+
+// initDeadLetter declares the node's dead-letter exchange and queue, if configured.
+func (f *Worker) initDeadLetter() error {
+	if !f.config.Contains(deadLetterKey) {
+		f.log.Warningf("No dead-letter queue configured. Messages that cannot be processed will be dropped")
+		return nil
+	}
+
+	var dst amqp.Destination
+	if err := f.config.Unmarshal(deadLetterKey, &dst); err != nil {
+		return err
+	}
+
+	if err := f.Broker.ExchangeDeclare(amqp.Exchange{Name: dst.Exchange, Kind: dlq.Kind}); err != nil {
+		return err
+	}
+	if _, err := f.Broker.QueueDeclare(dst.Name); err != nil {
+		return err
+	}
+	if err := f.Broker.QueueBind(amqp.QueueBind{Exchange: dst.Exchange, Name: dst.Name, Key: dst.Key}); err != nil {
+		return err
+	}
+
+	f.deadLetter = &dst
+	return nil
+}
+
+// DeadLetter sends a delivery that cannot be processed to the node's dead-letter exchange, so that it can be
+// inspected and replayed later on. If no dead-letter queue is configured, the delivery is dropped.
+// It must be called from Process, so that a failed publishing gets retried along with the other outputs.
+func (f *Worker) DeadLetter(delivery amqp.Delivery, cause error) {
+	f.deadLettered = cause
+	header := amqp.HeadersFromDelivery(delivery)
+	countDelivery(header.MessageId, failed)
+	if err := f.sendToDeadLetter(f.Broker, delivery, cause); err != nil {
+		f.Log(header).Errorf("%s: %s", errors.FailedToPublish.Error(), err)
+	}
+}
+
+// discard dead-letters a delivery that cannot even be handed to the node, and acknowledges it.
+// It publishes through the underlying broker, since it may run while the node is processing another delivery.
+func (f *Worker) discard(delivery amqp.Delivery, cause error) {
+	header := amqp.HeadersFromDelivery(delivery)
+	log := f.Log(header)
+	countDelivery(header.MessageId, failed)
+	if err := f.sendToDeadLetter(f.publisher.MessageBroker, delivery, cause); err != nil {
+		log.Errorf("%s: %s. Requeueing message", errors.FailedToPublish.Error(), err)
+		if err = delivery.Nack(false, true); err != nil {
+			log.Errorf("Failed to negatively acknowledge message: %s", err.Error())
+		}
+		return
+	}
+
+	if err := delivery.Ack(false); err != nil {
+		log.Errorf("Failed to acknowledge message: %s", err.Error())
+	}
+}
+
+func (f *Worker) sendToDeadLetter(b amqp.MessageBroker, delivery amqp.Delivery, cause error) error {
+	log := f.Log(amqp.HeadersFromDelivery(delivery))
+	if f.deadLetter == nil {
+		log.Errorf("%s. Dropping message", cause)
+		return nil
+	}
+
+	log.Errorf("%s. Sending message to dead-letter exchange %s", cause, f.deadLetter.Exchange)
+	return b.PublishBatch(dlq.Wrap(delivery, *f.deadLetter, f.Uuid, cause))
+}
@@ -0,0 +1,43 @@
+package worker
+
+import (
+	"time"
+
+	"tp1/internal/errors"
+)
+
+// drain stops consuming from the input queues and waits for the messages being processed to be completed, logged,
+// synced to disk and acknowledged, so that they are not processed again once the worker restarts. Messages the
+// broker already sent but the worker did not take yet stay unacknowledged, and get redelivered once the broker is
+// closed. Draining gives up after `shutdown-timeout-ms`, leaving the messages not acknowledged by then to be
+// redelivered too: the pipeline skips the messages it did not start, and publishings being retried are given up.
+// It still waits for the messages in process, so that the broker and the recovery log are not closed under them.
+func (f *Worker) drain(p *pipeline) {
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		for _, tag := range f.consumers {
+			if err := f.Broker.Cancel(tag); err != nil {
+				f.log.Errorf("Failed to cancel consumer %s: %s", tag, err.Error())
+			}
+		}
+		if p != nil {
+			p.close()
+		}
+		if err := f.recovery.Sync(); err != nil {
+			f.log.Errorf("%s: %s", errors.FailedToLog.Error(), err)
+		}
+	}()
+
+	select {
+	case <-drained:
+		f.log.Infof("Drained messages in process")
+	case <-time.After(f.shutdown):
+		f.log.Warningf("Timed out draining after %s. Messages not acknowledged yet will be redelivered", f.shutdown)
+		close(f.stopping)
+		if p != nil {
+			p.stop()
+		}
+		<-drained
+	}
+}
@@ -1,10 +1,11 @@
 package filter
 
 import (
+	"fmt"
+
 	"tp1/internal/errors"
 	"tp1/internal/worker"
 	"tp1/pkg/amqp"
-	"tp1/pkg/logs"
 	"tp1/pkg/message"
 	"tp1/pkg/sequence"
 	"tp1/pkg/utils/shard"
@@ -37,6 +38,23 @@ func (f *action) Start() {
 }
 
 func (f *action) Process(delivery amqp.Delivery, headers amqp.Header) ([]sequence.Destination, []byte) {
+	return f.Complete(f.Prepare(delivery, headers), delivery, headers)
+}
+
+// Prepare parses the games in the delivery. It returns the parsing error, if any.
+func (f *action) Prepare(delivery amqp.Delivery, headers amqp.Header) any {
+	if headers.MessageId != message.GameId {
+		return nil
+	}
+
+	msg, err := message.GamesFromBytes(delivery.Body)
+	if err != nil {
+		return err
+	}
+	return msg
+}
+
+func (f *action) Complete(prepared any, delivery amqp.Delivery, headers amqp.Header) ([]sequence.Destination, []byte) {
 	var sequenceIds []sequence.Destination
 	var err error
 
@@ -44,17 +62,16 @@ func (f *action) Process(delivery amqp.Delivery, headers amqp.Header) ([]sequenc
 	case message.EofId:
 		sequenceIds, err = f.w.HandleEofMessage(delivery.Body, headers.WithOriginId(amqp.GameOriginId))
 		if err != nil {
-			logs.Logger.Errorf("%s: %s", errors.FailedToPublish.Error(), err)
+			f.w.Log(headers).Errorf("%s: %s", errors.FailedToPublish.Error(), err)
 		}
 	case message.GameId:
-		msg, err := message.GamesFromBytes(delivery.Body)
-		if err != nil {
-			logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
+		if err, ok := prepared.(error); ok {
+			f.w.DeadLetter(delivery, fmt.Errorf("%w: %w", errors.FailedToParse, err))
 		} else {
-			sequenceIds = f.publish(headers, msg)
+			sequenceIds = f.publish(headers, prepared.(message.Game))
 		}
 	default:
-		logs.Logger.Errorf(errors.InvalidMessageId.Error(), headers.MessageId)
+		f.w.DeadLetter(delivery, fmt.Errorf("%w: %d", errors.InvalidMessageId, headers.MessageId))
 	}
 
 	return sequenceIds, nil
@@ -67,7 +84,7 @@ func (f *action) publish(headers amqp.Header, msg message.Game) []sequence.Desti
 	for _, game := range games {
 		b, err := game.ToBytes()
 		if err != nil {
-			logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
+			f.w.Log(headers).Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
 			continue
 		}
 
@@ -79,7 +96,7 @@ func (f *action) publish(headers amqp.Header, msg message.Game) []sequence.Desti
 			headers = headers.WithMessageId(message.GameNameId).WithSequenceId(sequence.SrcNew(f.w.Uuid, sequenceId))
 
 			if err = f.w.Broker.Publish(output.Exchange, key, b, headers); err != nil {
-				logs.Logger.Errorf("%s: %s", errors.FailedToPublish.Error(), err)
+				f.w.Log(headers).Errorf("%s: %s", errors.FailedToPublish.Error(), err)
 			}
 		}
 	}
@@ -88,5 +105,5 @@ func (f *action) publish(headers amqp.Header, msg message.Game) []sequence.Desti
 }
 
 func (f *action) recover() {
-	f.w.Recover(nil)
+	f.w.Recover(nil, nil)
 }
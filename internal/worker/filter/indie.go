@@ -1,10 +1,11 @@
 package filter
 
 import (
+	"fmt"
+
 	"tp1/internal/errors"
 	"tp1/internal/worker"
 	"tp1/pkg/amqp"
-	"tp1/pkg/logs"
 	"tp1/pkg/message"
 	"tp1/pkg/sequence"
 	"tp1/pkg/utils/shard"
@@ -50,17 +51,17 @@ func (f *indie) Process(delivery amqp.Delivery, headers amqp.Header) ([]sequence
 	case message.EofId:
 		sequenceIds, err = f.w.HandleEofMessage(delivery.Body, headers.WithOriginId(amqp.GameOriginId))
 		if err != nil {
-			logs.Logger.Errorf("%s: %s", errors.FailedToPublish.Error(), err)
+			f.w.Log(headers).Errorf("%s: %s", errors.FailedToPublish.Error(), err)
 		}
 	case message.GameId:
 		msg, err := message.GamesFromBytes(delivery.Body)
 		if err != nil {
-			logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
+			f.w.DeadLetter(delivery, fmt.Errorf("%w: %w", errors.FailedToParse, err))
 		} else {
 			sequenceIds = f.publish(headers, msg)
 		}
 	default:
-		logs.Logger.Errorf(errors.InvalidMessageId.Error(), headers.MessageId)
+		f.w.DeadLetter(delivery, fmt.Errorf("%w: %d", errors.InvalidMessageId, headers.MessageId))
 	}
 
 	return sequenceIds, nil
@@ -82,7 +83,7 @@ func (f *indie) publishGameNames(headers amqp.Header, msg message.Game, genre st
 	for _, game := range gameNames {
 		b, err := game.ToBytes()
 		if err != nil {
-			logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
+			f.w.Log(headers).Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
 			continue
 		}
 
@@ -92,7 +93,7 @@ func (f *indie) publishGameNames(headers amqp.Header, msg message.Game, genre st
 		sequenceIdsNames = append(sequenceIdsNames, sequence.DstNew(key, sequenceId))
 
 		if err = f.w.Broker.Publish(output.Exchange, key, b, headers.WithSequenceId(sequence.SrcNew(f.w.Uuid, sequenceId))); err != nil {
-			logs.Logger.Errorf("%s: %s", errors.FailedToPublish.Error(), err.Error())
+			f.w.Log(headers).Errorf("%s: %s", errors.FailedToPublish.Error(), err.Error())
 		}
 	}
 
@@ -105,7 +106,7 @@ func (f *indie) publishGameReleases(headers amqp.Header, msg message.Game, genre
 
 	b, err := gameReleases.ToBytes()
 	if err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
+		f.w.Log(headers).Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
 		return []sequence.Destination{}
 	}
 
@@ -114,7 +115,7 @@ func (f *indie) publishGameReleases(headers amqp.Header, msg message.Game, genre
 	headers = headers.WithMessageId(message.GameReleaseId).WithSequenceId(sequence.SrcNew(f.w.Uuid, sequenceId))
 
 	if err = f.w.Broker.Publish(output.Exchange, key, b, headers.WithMessageId(message.GameReleaseId)); err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToPublish.Error(), err.Error())
+		f.w.Log(headers).Errorf("%s: %s", errors.FailedToPublish.Error(), err.Error())
 	}
 
 	return []sequence.Destination{sequence.DstNew(key, sequenceId)}
@@ -125,5 +126,5 @@ func getGenre(f *indie) string {
 }
 
 func (f *indie) recover() {
-	f.w.Recover(nil)
+	f.w.Recover(nil, nil)
 }
@@ -1,10 +1,11 @@
 package filter
 
 import (
+	"fmt"
+
 	"tp1/internal/errors"
 	"tp1/internal/worker"
 	"tp1/pkg/amqp"
-	"tp1/pkg/logs"
 	"tp1/pkg/message"
 	"tp1/pkg/sequence"
 	"tp1/pkg/utils/shard"
@@ -37,6 +38,23 @@ func (f *platform) Start() {
 }
 
 func (f *platform) Process(delivery amqp.Delivery, headers amqp.Header) ([]sequence.Destination, []byte) {
+	return f.Complete(f.Prepare(delivery, headers), delivery, headers)
+}
+
+// Prepare parses the games in the delivery. It returns the parsing error, if any.
+func (f *platform) Prepare(delivery amqp.Delivery, headers amqp.Header) any {
+	if headers.MessageId != message.GameId {
+		return nil
+	}
+
+	msg, err := message.GamesFromBytes(delivery.Body)
+	if err != nil {
+		return err
+	}
+	return msg
+}
+
+func (f *platform) Complete(prepared any, delivery amqp.Delivery, headers amqp.Header) ([]sequence.Destination, []byte) {
 	var sequenceIds []sequence.Destination
 	var err error
 
@@ -44,17 +62,16 @@ func (f *platform) Process(delivery amqp.Delivery, headers amqp.Header) ([]seque
 	case message.EofId:
 		sequenceIds, err = f.w.HandleEofMessage(delivery.Body, headers)
 		if err != nil {
-			logs.Logger.Errorf("%s: %s", errors.FailedToPublish.Error(), err)
+			f.w.Log(headers).Errorf("%s: %s", errors.FailedToPublish.Error(), err)
 		}
 	case message.GameId:
-		msg, err := message.GamesFromBytes(delivery.Body)
-		if err != nil {
-			logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
+		if err, ok := prepared.(error); ok {
+			f.w.DeadLetter(delivery, fmt.Errorf("%w: %w", errors.FailedToParse, err))
 		} else {
-			sequenceIds = f.publish(headers, msg)
+			sequenceIds = f.publish(headers, prepared.(message.Game))
 		}
 	default:
-		logs.Logger.Errorf(errors.InvalidMessageId.Error(), headers.MessageId)
+		f.w.DeadLetter(delivery, fmt.Errorf("%w: %d", errors.InvalidMessageId, headers.MessageId))
 	}
 
 	return sequenceIds, nil
@@ -69,16 +86,16 @@ func (f *platform) publish(headers amqp.Header, msg message.Game) []sequence.Des
 	platforms := msg.ToPlatformMessage()
 	b, err := platforms.ToBytes()
 	if err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
+		f.w.Log(headers).Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
 	}
 
 	if err = f.w.Broker.Publish(output.Exchange, key, b, headers); err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToPublish.Error(), err)
+		f.w.Log(headers).Errorf("%s: %s", errors.FailedToPublish.Error(), err)
 	}
 
 	return []sequence.Destination{sequence.DstNew(key, sequenceId)}
 }
 
 func (f *platform) recover() {
-	f.w.Recover(nil)
+	f.w.Recover(nil, nil)
 }
@@ -1,10 +1,11 @@
 package filter
 
 import (
+	"fmt"
+
 	"tp1/internal/errors"
 	"tp1/internal/worker"
 	"tp1/pkg/amqp"
-	"tp1/pkg/logs"
 	"tp1/pkg/message"
 	"tp1/pkg/sequence"
 	"tp1/pkg/utils/shard"
@@ -42,6 +43,23 @@ func (f *releaseDate) Start() {
 }
 
 func (f *releaseDate) Process(delivery amqp.Delivery, headers amqp.Header) ([]sequence.Destination, []byte) {
+	return f.Complete(f.Prepare(delivery, headers), delivery, headers)
+}
+
+// Prepare parses the releases in the delivery. It returns the parsing error, if any.
+func (f *releaseDate) Prepare(delivery amqp.Delivery, headers amqp.Header) any {
+	if headers.MessageId != message.GameReleaseId {
+		return nil
+	}
+
+	msg, err := message.ReleasesFromBytes(delivery.Body)
+	if err != nil {
+		return err
+	}
+	return msg
+}
+
+func (f *releaseDate) Complete(prepared any, delivery amqp.Delivery, headers amqp.Header) ([]sequence.Destination, []byte) {
 	var sequenceIds []sequence.Destination
 	var err error
 
@@ -49,17 +67,16 @@ func (f *releaseDate) Process(delivery amqp.Delivery, headers amqp.Header) ([]se
 	case message.EofId:
 		sequenceIds, err = f.w.HandleEofMessage(delivery.Body, headers)
 		if err != nil {
-			logs.Logger.Errorf("%s: %s", errors.FailedToPublish.Error(), err)
+			f.w.Log(headers).Errorf("%s: %s", errors.FailedToPublish.Error(), err)
 		}
 	case message.GameReleaseId:
-		msg, err := message.ReleasesFromBytes(delivery.Body)
-		if err != nil {
-			logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
+		if err, ok := prepared.(error); ok {
+			f.w.DeadLetter(delivery, fmt.Errorf("%w: %w", errors.FailedToParse, err))
 		} else {
-			sequenceIds = f.publish(msg, headers)
+			sequenceIds = f.publish(prepared.(message.Releases), headers)
 		}
 	default:
-		logs.Logger.Errorf(errors.InvalidMessageId.Error(), headers.MessageId)
+		f.w.DeadLetter(delivery, fmt.Errorf("%w: %d", errors.InvalidMessageId, headers.MessageId))
 	}
 
 	return sequenceIds, nil
@@ -71,7 +88,7 @@ func (f *releaseDate) publish(msg message.Releases, headers amqp.Header) []seque
 
 	b, err := dateFilteredGames.ToBytes()
 	if err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
+		f.w.Log(headers).Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
 		return []sequence.Destination{}
 	}
 
@@ -81,12 +98,12 @@ func (f *releaseDate) publish(msg message.Releases, headers amqp.Header) []seque
 	headers = headers.WithMessageId(message.GameWithPlaytimeId).WithSequenceId(sequence.SrcNew(f.w.Uuid, sequenceId))
 
 	if err = f.w.Broker.Publish(output.Exchange, key, b, headers); err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToPublish.Error(), err)
+		f.w.Log(headers).Errorf("%s: %s", errors.FailedToPublish.Error(), err)
 	}
 
 	return []sequence.Destination{sequence.DstNew(key, sequenceId)}
 }
 
 func (f *releaseDate) recover() {
-	f.w.Recover(nil)
+	f.w.Recover(nil, nil)
 }
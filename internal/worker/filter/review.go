@@ -1,10 +1,11 @@
 package filter
 
 import (
+	"fmt"
+
 	"tp1/internal/errors"
 	"tp1/internal/worker"
 	"tp1/pkg/amqp"
-	"tp1/pkg/logs"
 	"tp1/pkg/message"
 	"tp1/pkg/sequence"
 	"tp1/pkg/utils/shard"
@@ -60,25 +61,24 @@ func (f *review) Process(delivery amqp.Delivery, headers amqp.Header) ([]sequenc
 	case message.EofId:
 		sequenceIds, err = f.w.HandleEofMessage(delivery.Body, headers)
 		if err != nil {
-			logs.Logger.Errorf("%s: %s", errors.FailedToPublish.Error(), err.Error())
+			f.w.Log(headers).Errorf("%s: %s", errors.FailedToPublish.Error(), err.Error())
 		}
 	case message.ReviewId:
-		sequenceIds = f.publish(delivery.Body, headers)
+		msg, err := message.ReviewFromBytes(delivery.Body)
+		if err != nil {
+			f.w.DeadLetter(delivery, fmt.Errorf("%w: %w", errors.FailedToParse, err))
+		} else {
+			sequenceIds = f.publish(msg, headers)
+		}
 
 	default:
-		logs.Logger.Infof(errors.InvalidMessageId.Error(), headers.MessageId)
+		f.w.DeadLetter(delivery, fmt.Errorf("%w: %d", errors.InvalidMessageId, headers.MessageId))
 	}
 
 	return sequenceIds, nil
 }
 
-func (f *review) publish(msgBytes []byte, headers amqp.Header) []sequence.Destination {
-	msg, err := message.ReviewFromBytes(msgBytes)
-	if err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
-		return []sequence.Destination{}
-	}
-
+func (f *review) publish(msg message.Review, headers amqp.Header) []sequence.Destination {
 	return append(f.publishReviewWithText(msg, headers), f.publishScoredReview(msg, headers)...)
 }
 
@@ -98,7 +98,7 @@ func (f *review) publishScoredReview(msg message.Review, headers amqp.Header) []
 func (f *review) publishReviewWithText(msg message.Review, headers amqp.Header) []sequence.Destination {
 	b, err := msg.ToReviewWithTextMessage(f.scores[query4]).ToBytes()
 	if err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
+		f.w.Log(headers).Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
 	}
 
 	output := f.w.Outputs[query4]
@@ -107,7 +107,7 @@ func (f *review) publishReviewWithText(msg message.Review, headers amqp.Header)
 	headers = headers.WithMessageId(message.ReviewWithTextId).WithSequenceId(sequence.SrcNew(f.w.Uuid, sequenceId))
 
 	if err = f.w.Broker.Publish(output.Exchange, key, b, headers); err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToPublish.Error(), err.Error())
+		f.w.Log(headers).Errorf("%s: %s", errors.FailedToPublish.Error(), err.Error())
 	}
 
 	return []sequence.Destination{sequence.DstNew(key, sequenceId)}
@@ -118,7 +118,7 @@ func (f *review) shardPublish(reviews message.ScoredReviews, output amqp.Destina
 	for _, rv := range reviews {
 		b, err := rv.ToBytes()
 		if err != nil {
-			logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
+			f.w.Log(headers).Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
 			continue
 		}
 
@@ -128,7 +128,7 @@ func (f *review) shardPublish(reviews message.ScoredReviews, output amqp.Destina
 		headers = headers.WithSequenceId(sequence.SrcNew(f.w.Uuid, sequenceId))
 
 		if err = f.w.Broker.Publish(output.Exchange, k, b, headers); err != nil {
-			logs.Logger.Errorf("%s: %s", errors.FailedToPublish.Error(), err.Error())
+			f.w.Log(headers).Errorf("%s: %s", errors.FailedToPublish.Error(), err.Error())
 		}
 	}
 
@@ -136,5 +136,5 @@ func (f *review) shardPublish(reviews message.ScoredReviews, output amqp.Destina
 }
 
 func (f *review) recover() {
-	f.w.Recover(nil)
+	f.w.Recover(nil, nil)
 }
@@ -1,10 +1,11 @@
 package filter
 
 import (
+	"fmt"
+
 	"tp1/internal/errors"
 	"tp1/internal/worker"
 	"tp1/pkg/amqp"
-	"tp1/pkg/logs"
 	"tp1/pkg/message"
 	"tp1/pkg/sequence"
 	"tp1/pkg/utils/shard"
@@ -67,6 +68,32 @@ func (f *text) Start() {
 }
 
 func (f *text) Process(delivery amqp.Delivery, headers amqp.Header) ([]sequence.Destination, []byte) {
+	return f.Complete(f.Prepare(delivery, headers), delivery, headers)
+}
+
+// Prepare parses the reviews in the delivery and counts, by game ID, the ones written in the target language.
+// Language detection is the expensive part of this filter, and the detector is safe for concurrent use.
+// It returns the parsing error, if any.
+func (f *text) Prepare(delivery amqp.Delivery, headers amqp.Header) any {
+	if headers.MessageId != message.ReviewWithTextId {
+		return nil
+	}
+
+	msg, err := message.TextReviewFromBytes(delivery.Body)
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[int64]int, len(msg))
+	for gameId, reviews := range msg {
+		if count := f.detectLang(reviews); count > 0 {
+			counts[gameId] = count
+		}
+	}
+	return counts
+}
+
+func (f *text) Complete(prepared any, delivery amqp.Delivery, headers amqp.Header) ([]sequence.Destination, []byte) {
 	var sequenceIds []sequence.Destination
 	var err error
 	headers = headers.WithOriginId(amqp.ReviewOriginId)
@@ -75,45 +102,38 @@ func (f *text) Process(delivery amqp.Delivery, headers amqp.Header) ([]sequence.
 	case message.EofId:
 		sequenceIds, err = f.w.HandleEofMessage(delivery.Body, headers)
 		if err != nil {
-			logs.Logger.Errorf("%s: %s", errors.FailedToPublish.Error(), err.Error())
+			f.w.Log(headers).Errorf("%s: %s", errors.FailedToPublish.Error(), err.Error())
 		}
 	case message.ReviewWithTextId:
-		msg, err := message.TextReviewFromBytes(delivery.Body)
-		if err != nil {
-			logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
+		if err, ok := prepared.(error); ok {
+			f.w.DeadLetter(delivery, fmt.Errorf("%w: %w", errors.FailedToParse, err))
 		} else {
-			sequenceIds = f.publish(msg, headers)
+			sequenceIds = f.publish(prepared.(map[int64]int), headers)
 		}
 	default:
-		logs.Logger.Infof(errors.InvalidMessageId.Error(), headers.MessageId)
+		f.w.DeadLetter(delivery, fmt.Errorf("%w: %d", errors.InvalidMessageId, headers.MessageId))
 	}
 
 	return sequenceIds, nil
 }
 
-func (f *text) publish(msg message.TextReviews, headers amqp.Header) []sequence.Destination {
-	sequenceIds := make([]sequence.Destination, 0, len(msg))
-
-	for gameId, reviews := range msg {
-		count := f.detectLang(reviews)
-
-		if count == 0 {
-			continue
-		}
+func (f *text) publish(counts map[int64]int, headers amqp.Header) []sequence.Destination {
+	sequenceIds := make([]sequence.Destination, 0, len(counts))
 
+	for gameId, count := range counts {
 		k := shard.Int64(gameId, f.w.Outputs[0].Key, f.w.Outputs[0].Consumers)
 		sequenceId := f.w.NextSequenceId(k)
 		sequenceIds = append(sequenceIds, sequence.DstNew(k, sequenceId))
 		b, err := message.ScoredReview{GameId: gameId, Votes: uint64(count)}.ToBytes()
 		if err != nil {
-			logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
+			f.w.Log(headers).Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
 			continue
 		}
 
 		headers = headers.WithMessageId(message.ScoredReviewId).WithSequenceId(sequence.SrcNew(f.w.Uuid, sequenceId))
 
 		if err = f.w.Broker.Publish(f.w.Outputs[0].Exchange, k, b, headers); err != nil {
-			logs.Logger.Errorf("%s: %s", errors.FailedToPublish.Error(), err.Error())
+			f.w.Log(headers).Errorf("%s: %s", errors.FailedToPublish.Error(), err.Error())
 		}
 	}
 
@@ -132,5 +152,5 @@ func (f *text) detectLang(reviews []string) int {
 }
 
 func (f *text) recover() {
-	f.w.Recover(nil)
+	f.w.Recover(nil, nil)
 }
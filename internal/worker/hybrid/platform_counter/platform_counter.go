@@ -1,11 +1,11 @@
 package platform_counter
 
 import (
+	"fmt"
 	"strings"
 	"tp1/internal/errors"
 	"tp1/internal/worker"
 	"tp1/pkg/amqp"
-	"tp1/pkg/logs"
 	"tp1/pkg/message"
 	"tp1/pkg/recovery"
 	"tp1/pkg/sequence"
@@ -18,6 +18,11 @@ type filter struct {
 	agg      bool
 }
 
+// state is the state of the filter, saved in snapshots.
+type state struct {
+	Counters map[string]*message.Platform
+}
+
 func New() (worker.Node, error) {
 	w, err := worker.New()
 	if err != nil {
@@ -48,30 +53,36 @@ func (f *filter) Start() {
 
 func (f *filter) Process(delivery amqp.Delivery, headers amqp.Header) ([]sequence.Destination, []byte) {
 	var sequenceIds []sequence.Destination
+	var err error
 
 	switch headers.MessageId {
 	case message.EofId:
 		sequenceIds = f.processEof(delivery.Body, headers, false)
 	case message.PlatformId:
-		f.processPlatform(delivery.Body, headers.ClientId)
+		err = f.processPlatform(delivery.Body, headers.ClientId)
 	default:
-		logs.Logger.Errorf(errors.InvalidMessageId.Error(), headers.MessageId)
+		err = fmt.Errorf("%w: %d", errors.InvalidMessageId, headers.MessageId)
+	}
+
+	if err != nil {
+		f.w.DeadLetter(delivery, err)
 	}
 
 	return sequenceIds, delivery.Body
 }
 
-func (f *filter) processPlatform(msgBytes []byte, clientId string) {
+func (f *filter) processPlatform(msgBytes []byte, clientId string) error {
 	if _, exists := f.counters[clientId]; !exists {
 		f.counters[clientId] = &message.Platform{Windows: 0, Linux: 0, Mac: 0}
 	}
 
 	msg, err := message.PlatformFromBytes(msgBytes)
 	if err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
-	} else {
-		f.counters[clientId].Increment(msg)
+		return fmt.Errorf("%w: %w", errors.FailedToParse, err)
 	}
+
+	f.counters[clientId].Increment(msg)
+	return nil
 }
 
 func (f *filter) processEof(msgBytes []byte, headers amqp.Header, recovery bool) []sequence.Destination {
@@ -82,7 +93,7 @@ func (f *filter) processEof(msgBytes []byte, headers amqp.Header, recovery bool)
 		if !f.agg {
 			eofSqIds, err := f.w.HandleEofMessage(msgBytes, headers)
 			if err != nil {
-				logs.Logger.Errorf("%s: %s", errors.FailedToPublish.Error(), err)
+				f.w.Log(headers).Errorf("%s: %s", errors.FailedToPublish.Error(), err)
 			} else {
 				sequenceIds = append(sequenceIds, eofSqIds...)
 			}
@@ -102,7 +113,7 @@ func (f *filter) publish(headers amqp.Header) []sequence.Destination {
 
 	b, err := platforms.ToBytes()
 	if err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
+		f.w.Log(headers).Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
 		return sequenceIds
 	}
 
@@ -110,7 +121,7 @@ func (f *filter) publish(headers amqp.Header) []sequence.Destination {
 	if f.agg {
 		output, err = shard.AggregatorOutput(output, headers.ClientId)
 		if err != nil {
-			logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
+			f.w.Log(headers).Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
 		}
 	}
 
@@ -119,7 +130,7 @@ func (f *filter) publish(headers amqp.Header) []sequence.Destination {
 	sequenceIds = append(sequenceIds, sequence.DstNew(output.Key, sequenceId))
 
 	if err = f.w.Broker.Publish(output.Exchange, output.Key, b, headers); err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToPublish.Error(), err)
+		f.w.Log(headers).Errorf("%s: %s", errors.FailedToPublish.Error(), err)
 	}
 
 	return sequenceIds
@@ -127,16 +138,40 @@ func (f *filter) publish(headers amqp.Header) []sequence.Destination {
 
 func (f *filter) recover() {
 	ch := make(chan recovery.Message, worker.ChanSize)
-	go f.w.Recover(ch)
+	go f.w.Recover(f, ch)
 
 	for recoveredMsg := range ch {
 		switch recoveredMsg.Header().MessageId {
 		case message.EofId:
 			f.processEof(recoveredMsg.Message(), recoveredMsg.Header(), true)
+		case message.ClientAbortId:
+			f.Purge(recoveredMsg.Header().ClientId)
 		case message.PlatformId:
-			f.processPlatform(recoveredMsg.Message(), recoveredMsg.Header().ClientId)
+			if err := f.processPlatform(recoveredMsg.Message(), recoveredMsg.Header().ClientId); err != nil {
+				f.w.Log(recoveredMsg.Header()).Errorf("%s", err)
+			}
 		default:
-			logs.Logger.Errorf(errors.InvalidMessageId.Error(), recoveredMsg.Header().MessageId)
+			f.w.Log(recoveredMsg.Header()).Errorf("%s: %d", errors.InvalidMessageId.Error(), recoveredMsg.Header().MessageId)
 		}
 	}
 }
+
+func (f *filter) Purge(clientId string) {
+	delete(f.counters, clientId)
+}
+
+// StateSize returns 1 if the filter is counting platforms for the client, and 0 otherwise.
+func (f *filter) StateSize(clientId string) int {
+	if _, ok := f.counters[clientId]; ok {
+		return 1
+	}
+	return 0
+}
+
+func (f *filter) Snapshot() ([]byte, error) {
+	return worker.EncodeState(state{Counters: f.counters})
+}
+
+func (f *filter) Restore(b []byte) error {
+	return worker.DecodeState(b, &state{Counters: f.counters})
+}
@@ -2,10 +2,10 @@ package top_n
 
 import (
 	"container/heap"
+	"fmt"
 	"tp1/internal/errors"
 	"tp1/internal/worker"
 	"tp1/pkg/amqp"
-	"tp1/pkg/logs"
 	"tp1/pkg/message"
 	"tp1/pkg/recovery"
 	"tp1/pkg/sequence"
@@ -22,6 +22,12 @@ type filter struct {
 	agg      bool
 }
 
+// state is the state of the filter, saved in snapshots.
+type state struct {
+	Top      map[string]PriorityQueue
+	EofsRecv map[string]uint8
+}
+
 func New() (worker.Node, error) {
 	w, err := worker.New()
 	if err != nil {
@@ -48,21 +54,26 @@ func (f *filter) Init() error {
 }
 
 func (f *filter) Start() {
-	f.agg = f.w.ExpectedEofs > 0
+	f.agg = f.w.Aggregates()
 
 	f.w.Start(f)
 }
 
 func (f *filter) Process(delivery amqp.Delivery, headers amqp.Header) ([]sequence.Destination, []byte) {
 	var sequenceIds []sequence.Destination
+	var err error
 
 	switch headers.MessageId {
 	case message.EofId:
 		sequenceIds = f.processEof(headers, false)
 	case message.ScoredReviewId:
-		f.updateTop(delivery.Body, headers.ClientId)
+		err = f.updateTop(delivery.Body, headers.ClientId)
 	default:
-		logs.Logger.Errorf(errors.InvalidMessageId.Error(), headers.MessageId)
+		err = fmt.Errorf("%w: %d", errors.InvalidMessageId, headers.MessageId)
+	}
+
+	if err != nil {
+		f.w.DeadLetter(delivery, err)
 	}
 
 	return sequenceIds, delivery.Body
@@ -71,18 +82,17 @@ func (f *filter) Process(delivery amqp.Delivery, headers amqp.Header) ([]sequenc
 func (f *filter) processEof(headers amqp.Header, recovery bool) []sequence.Destination {
 	var sequenceIds []sequence.Destination
 	f.eofsRecv[headers.ClientId]++
-	if f.eofsRecv[headers.ClientId] >= f.w.ExpectedEofs {
+	if f.eofsRecv[headers.ClientId] >= f.w.ExpectedEofs(headers.ClientId) {
 		sequenceIds = f.publish(headers, recovery)
 	}
 
 	return sequenceIds
 }
 
-func (f *filter) updateTop(msgBytes []byte, clientId string) {
+func (f *filter) updateTop(msgBytes []byte, clientId string) error {
 	messages, err := message.ScoredReviewsFromBytes(msgBytes)
 	if err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
-		return
+		return fmt.Errorf("%w: %w", errors.FailedToParse, err)
 	}
 
 	for _, msg := range messages {
@@ -98,6 +108,8 @@ func (f *filter) updateTop(msgBytes []byte, clientId string) {
 			f.top[clientId] = clientTop
 		}
 	}
+
+	return nil
 }
 
 // If the game is already in the top, fix the heap and return false
@@ -134,10 +146,10 @@ func (f *filter) publish(headers amqp.Header, recovery bool) []sequence.Destinat
 	headers = headers.WithOriginId(amqp.Query3OriginId)
 
 	topNScoredReviews := f.getTopNScoredReviews(headers.ClientId)
-	logs.Logger.Infof("Top %d games with most votes: %v", f.n, topNScoredReviews)
+	f.w.Log(headers).Infof("Top %d games with most votes: %v", f.n, topNScoredReviews)
 	bytes, err := topNScoredReviews.ToBytes()
 	if err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
+		f.w.Log(headers).Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
 		return sequenceIds
 	}
 
@@ -145,7 +157,7 @@ func (f *filter) publish(headers amqp.Header, recovery bool) []sequence.Destinat
 	if f.agg {
 		output, err = shard.AggregatorOutput(output, headers.ClientId)
 		if err != nil {
-			logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
+			f.w.Log(headers).Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
 		}
 	}
 
@@ -154,13 +166,13 @@ func (f *filter) publish(headers amqp.Header, recovery bool) []sequence.Destinat
 	sequenceIds = append(sequenceIds, sequence.DstNew(output.Key, sequenceId))
 
 	if err = f.w.Broker.Publish(output.Exchange, output.Key, bytes, headers); err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToPublish.Error(), err)
+		f.w.Log(headers).Errorf("%s: %s", errors.FailedToPublish.Error(), err)
 	}
 
 	if !f.agg {
 		eofSqIds, err := f.w.HandleEofMessage(amqp.EmptyEof, headers, amqp.DestinationEof(f.w.Outputs[0]))
 		if err != nil {
-			logs.Logger.Errorf("%s: %s", errors.FailedToPublish.Error(), err.Error())
+			f.w.Log(headers).Errorf("%s: %s", errors.FailedToPublish.Error(), err.Error())
 		} else {
 			sequenceIds = append(sequenceIds, eofSqIds...)
 		}
@@ -185,16 +197,37 @@ func (f *filter) getTopNScoredReviews(clientId string) message.ScoredReviews {
 
 func (f *filter) recover() {
 	ch := make(chan recovery.Message, worker.ChanSize)
-	go f.w.Recover(ch)
+	go f.w.Recover(f, ch)
 
 	for recoveredMsg := range ch {
 		switch recoveredMsg.Header().MessageId {
 		case message.EofId:
 			f.processEof(recoveredMsg.Header(), true)
+		case message.ClientAbortId:
+			f.Purge(recoveredMsg.Header().ClientId)
 		case message.ScoredReviewId:
-			f.updateTop(recoveredMsg.Message(), recoveredMsg.Header().ClientId)
+			if err := f.updateTop(recoveredMsg.Message(), recoveredMsg.Header().ClientId); err != nil {
+				f.w.Log(recoveredMsg.Header()).Errorf("%s", err)
+			}
 		default:
-			logs.Logger.Errorf(errors.InvalidMessageId.Error(), recoveredMsg.Header().MessageId)
+			f.w.Log(recoveredMsg.Header()).Errorf("%s: %d", errors.InvalidMessageId.Error(), recoveredMsg.Header().MessageId)
 		}
 	}
 }
+
+func (f *filter) Purge(clientId string) {
+	delete(f.top, clientId)
+	delete(f.eofsRecv, clientId)
+}
+
+func (f *filter) StateSize(clientId string) int {
+	return len(f.top[clientId])
+}
+
+func (f *filter) Snapshot() ([]byte, error) {
+	return worker.EncodeState(state{Top: f.top, EofsRecv: f.eofsRecv})
+}
+
+func (f *filter) Restore(b []byte) error {
+	return worker.DecodeState(b, &state{Top: f.top, EofsRecv: f.eofsRecv})
+}
@@ -140,6 +140,54 @@ func TestManyClientTops(t *testing.T) {
 	}
 }
 
+func TestSnapshotRestoresTop(t *testing.T) {
+	f := fakeFilter(2)
+	f.eofsRecv = map[string]uint8{"0-0": 1}
+	for i := 1; i <= 3; i++ {
+		msg, _ := message.ScoredReviews{message.ScoredReview{GameId: int64(i), Votes: uint64(i * 10)}}.ToBytes()
+		_ = f.updateTop(msg, "0-0")
+	}
+
+	state, err := f.Snapshot()
+	if err != nil {
+		t.Fatalf("Unexpected error taking snapshot: %s", err)
+	}
+
+	restored := fakeFilter(2)
+	restored.eofsRecv = make(map[string]uint8)
+	if err = restored.Restore(state); err != nil {
+		t.Fatalf("Unexpected error restoring snapshot: %s", err)
+	}
+
+	top := restored.getTopNScoredReviews("0-0")
+	if len(top) != 2 || top[0].GameId != 3 || top[1].GameId != 2 {
+		t.Errorf("Expected games 3 and 2 in the top, got %v", top)
+	}
+	if restored.eofsRecv["0-0"] != 1 {
+		t.Errorf("Expected 1 EOF received, got %d", restored.eofsRecv["0-0"])
+	}
+}
+
+func TestPurgeDropsOnlyTheClientTop(t *testing.T) {
+	f := fakeFilter(2)
+	f.eofsRecv = map[string]uint8{"0-0": 1}
+	msg, _ := message.ScoredReviews{message.ScoredReview{GameId: 1, Votes: 10}}.ToBytes()
+	_ = f.updateTop(msg, "0-0")
+	_ = f.updateTop(msg, "0-1")
+
+	f.Purge("0-0")
+
+	if _, ok := f.top["0-0"]; ok {
+		t.Errorf("Expected the top of the purged client to be dropped")
+	}
+	if _, ok := f.eofsRecv["0-0"]; ok {
+		t.Errorf("Expected the EOFs of the purged client to be dropped")
+	}
+	if len(f.getTopNScoredReviews("0-1")) != 1 {
+		t.Errorf("Expected the top of other clients to be kept")
+	}
+}
+
 func fakeFilter(n int) *filter {
 	return &filter{top: make(map[string]PriorityQueue), n: n}
 }
@@ -1,11 +1,11 @@
 package top_n_playtime
 
 import (
+	"fmt"
 	"strings"
 	"tp1/internal/errors"
 	"tp1/internal/worker"
 	"tp1/pkg/amqp"
-	"tp1/pkg/logs"
 	"tp1/pkg/message"
 	"tp1/pkg/recovery"
 	"tp1/pkg/sequence"
@@ -19,6 +19,11 @@ type filter struct {
 	agg         bool
 }
 
+// state is the state of the filter, saved in snapshots.
+type state struct {
+	ClientHeaps map[string]*MinHeapPlaytime
+}
+
 func New() (worker.Node, error) {
 	w, err := worker.New()
 	if err != nil {
@@ -49,20 +54,25 @@ func (f *filter) Start() {
 
 func (f *filter) Process(delivery amqp.Delivery, headers amqp.Header) ([]sequence.Destination, []byte) {
 	var sequenceIds []sequence.Destination
+	var err error
 
 	switch headers.MessageId {
 	case message.EofId:
 		sequenceIds = f.processEof(delivery.Body, headers, false)
 	case message.GameWithPlaytimeId:
-		f.processGame(delivery.Body, headers.ClientId)
+		err = f.processGame(delivery.Body, headers.ClientId)
 	default:
-		logs.Logger.Errorf(errors.InvalidMessageId.Error(), headers.MessageId)
+		err = fmt.Errorf("%w: %d", errors.InvalidMessageId, headers.MessageId)
+	}
+
+	if err != nil {
+		f.w.DeadLetter(delivery, err)
 	}
 
 	return sequenceIds, delivery.Body
 }
 
-func (f *filter) processGame(msgBytes []byte, clientId string) {
+func (f *filter) processGame(msgBytes []byte, clientId string) error {
 	if _, exists := f.clientHeaps[clientId]; !exists {
 		f.clientHeaps[clientId] = &MinHeapPlaytime{}
 	}
@@ -70,11 +80,12 @@ func (f *filter) processGame(msgBytes []byte, clientId string) {
 
 	msg, err := message.DateFilteredReleasesFromBytes(msgBytes)
 	if err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
-		return
+		return fmt.Errorf("%w: %w", errors.FailedToParse, err)
 	}
 
 	clientHeap.UpdateReleases(msg, int(f.n))
+
+	return nil
 }
 
 func (f *filter) processEof(msgBytes []byte, headers amqp.Header, recovery bool) []sequence.Destination {
@@ -83,7 +94,7 @@ func (f *filter) processEof(msgBytes []byte, headers amqp.Header, recovery bool)
 
 	workersVisited, err := message.EofFromBytes(msgBytes)
 	if err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
+		f.w.Log(headers).Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
 		return sequenceIds
 	}
 
@@ -97,7 +108,7 @@ func (f *filter) processEof(msgBytes []byte, headers amqp.Header, recovery bool)
 	if !f.agg && !recovery {
 		eofSqIds, err := f.w.HandleEofMessage(msgBytes, headers)
 		if err != nil {
-			logs.Logger.Errorf("%s: %s", errors.FailedToPublish.Error(), err)
+			f.w.Log(headers).Errorf("%s: %s", errors.FailedToPublish.Error(), err)
 		} else {
 			sequenceIds = append(sequenceIds, eofSqIds...)
 		}
@@ -117,7 +128,7 @@ func (f *filter) publish(headers amqp.Header) []sequence.Destination {
 	topNPlaytime := ToTopNPlaytimeMessage(f.n, clientHeap)
 	b, err := topNPlaytime.ToBytes()
 	if err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
+		f.w.Log(headers).Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
 		return sequenceIds
 	}
 
@@ -125,7 +136,7 @@ func (f *filter) publish(headers amqp.Header) []sequence.Destination {
 	if f.agg {
 		output, err = shard.AggregatorOutput(output, headers.ClientId)
 		if err != nil {
-			logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
+			f.w.Log(headers).Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
 		}
 	}
 
@@ -134,7 +145,7 @@ func (f *filter) publish(headers amqp.Header) []sequence.Destination {
 	sequenceIds = append(sequenceIds, sequence.DstNew(output.Key, sequenceId))
 
 	if err = f.w.Broker.Publish(output.Exchange, output.Key, b, headers); err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToPublish.Error(), err)
+		f.w.Log(headers).Errorf("%s: %s", errors.FailedToPublish.Error(), err)
 	}
 
 	return sequenceIds
@@ -142,16 +153,39 @@ func (f *filter) publish(headers amqp.Header) []sequence.Destination {
 
 func (f *filter) recover() {
 	ch := make(chan recovery.Message, worker.ChanSize)
-	go f.w.Recover(ch)
+	go f.w.Recover(f, ch)
 
 	for recoveredMsg := range ch {
 		switch recoveredMsg.Header().MessageId {
 		case message.EofId:
 			f.processEof(recoveredMsg.Message(), recoveredMsg.Header(), true)
+		case message.ClientAbortId:
+			f.Purge(recoveredMsg.Header().ClientId)
 		case message.GameWithPlaytimeId:
-			f.processGame(recoveredMsg.Message(), recoveredMsg.Header().ClientId)
+			if err := f.processGame(recoveredMsg.Message(), recoveredMsg.Header().ClientId); err != nil {
+				f.w.Log(recoveredMsg.Header()).Errorf("%s", err)
+			}
 		default:
-			logs.Logger.Errorf(errors.InvalidMessageId.Error(), recoveredMsg.Header().MessageId)
+			f.w.Log(recoveredMsg.Header()).Errorf("%s: %d", errors.InvalidMessageId.Error(), recoveredMsg.Header().MessageId)
 		}
 	}
 }
+
+func (f *filter) Purge(clientId string) {
+	delete(f.clientHeaps, clientId)
+}
+
+func (f *filter) StateSize(clientId string) int {
+	if h, ok := f.clientHeaps[clientId]; ok {
+		return h.Len()
+	}
+	return 0
+}
+
+func (f *filter) Snapshot() ([]byte, error) {
+	return worker.EncodeState(state{ClientHeaps: f.clientHeaps})
+}
+
+func (f *filter) Restore(b []byte) error {
+	return worker.DecodeState(b, &state{ClientHeaps: f.clientHeaps})
+}
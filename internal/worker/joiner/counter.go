@@ -1,10 +1,11 @@
 package joiner
 
 import (
+	"fmt"
+
 	"tp1/internal/errors"
 	"tp1/internal/worker"
 	"tp1/pkg/amqp"
-	"tp1/pkg/logs"
 	"tp1/pkg/message"
 	"tp1/pkg/sequence"
 )
@@ -42,16 +43,21 @@ func (c *counter) Start() {
 
 func (c *counter) Process(delivery amqp.Delivery, headers amqp.Header) ([]sequence.Destination, []byte) {
 	var sequenceIds []sequence.Destination
+	var err error
 
 	switch headers.MessageId {
 	case message.EofId:
 		sequenceIds = c.joiner.processEof(headers, c.processEof)
 	case message.ScoredReviewId:
-		sequenceIds = c.processReview(headers, delivery.Body, false)
+		sequenceIds, err = c.processReview(headers, delivery.Body, false)
 	case message.GameNameId:
-		sequenceIds = c.processGame(headers, delivery.Body, false)
+		sequenceIds, err = c.processGame(headers, delivery.Body, false)
 	default:
-		logs.Logger.Errorf(errors.InvalidMessageId.Error(), headers.MessageId)
+		err = fmt.Errorf("%w: %d", errors.InvalidMessageId, headers.MessageId)
+	}
+
+	if err != nil {
+		c.joiner.w.DeadLetter(delivery, err)
 	}
 
 	return sequenceIds, delivery.Body
@@ -60,42 +66,41 @@ func (c *counter) Process(delivery amqp.Delivery, headers amqp.Header) ([]sequen
 func (c *counter) processEof(headers amqp.Header) []sequence.Destination {
 	sequenceIds, err := c.joiner.w.HandleEofMessage(amqp.EmptyEof, headers)
 	if err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToPublish.Error(), err)
+		c.joiner.w.Log(headers).Errorf("%s: %s", errors.FailedToPublish.Error(), err)
 	}
 	return sequenceIds
 }
 
-func (c *counter) processReview(headers amqp.Header, msgBytes []byte, recovery bool) []sequence.Destination {
+func (c *counter) processReview(headers amqp.Header, msgBytes []byte, recovery bool) ([]sequence.Destination, error) {
 	var sequenceIds []sequence.Destination
 	msg, err := message.ScoredReviewFromBytes(msgBytes)
 	if err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
-		return sequenceIds
+		return nil, fmt.Errorf("%w: %w", errors.FailedToParse, err)
 	}
 
 	userInfo, ok := c.joiner.gameInfoByClient[headers.ClientId]
 	if !ok {
 		c.joiner.gameInfoByClient[headers.ClientId] = map[int64]gameInfo{msg.GameId: {gameName: msg.GameName}}
-		return sequenceIds
+		return sequenceIds, nil
 	}
 
 	info, ok := userInfo[msg.GameId]
 	if !ok {
 		c.joiner.gameInfoByClient[headers.ClientId][msg.GameId] = gameInfo{votes: msg.Votes}
-		return sequenceIds
+		return sequenceIds, nil
 	} else if info.sent {
-		return sequenceIds
+		return sequenceIds, nil
 	}
 
 	if info.gameName != "" && info.votes+msg.Votes >= c.target {
 		if !recovery {
 			b, err := message.GameName{GameId: msg.GameId, GameName: info.gameName}.ToBytes()
 			if err != nil {
-				logs.Logger.Errorf("%s: %s", errors.FailedToPublish.Error(), err.Error())
-				return sequenceIds
+				c.joiner.w.Log(headers).Errorf("%s: %s", errors.FailedToPublish.Error(), err.Error())
+				return sequenceIds, nil
 			}
 			if sequenceIds = c.publish(headers, b); sequenceIds == nil {
-				return sequenceIds
+				return sequenceIds, nil
 			}
 		}
 		c.joiner.gameInfoByClient[headers.ClientId][msg.GameId] = gameInfo{gameName: msg.GameName, votes: info.votes, sent: true}
@@ -103,33 +108,32 @@ func (c *counter) processReview(headers amqp.Header, msgBytes []byte, recovery b
 		c.joiner.gameInfoByClient[headers.ClientId][msg.GameId] = gameInfo{gameName: info.gameName, votes: info.votes + msg.Votes}
 	}
 
-	return sequenceIds
+	return sequenceIds, nil
 }
 
-func (c *counter) processGame(headers amqp.Header, msgBytes []byte, recovery bool) []sequence.Destination {
+func (c *counter) processGame(headers amqp.Header, msgBytes []byte, recovery bool) ([]sequence.Destination, error) {
 	var sequenceIds []sequence.Destination
 	msg, err := message.GameNameFromBytes(msgBytes)
 	if err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
-		return sequenceIds
+		return nil, fmt.Errorf("%w: %w", errors.FailedToParse, err)
 	}
 
 	userInfo, ok := c.joiner.gameInfoByClient[headers.ClientId]
 	if !ok {
 		c.joiner.gameInfoByClient[headers.ClientId] = map[int64]gameInfo{msg.GameId: {gameName: msg.GameName}}
-		return sequenceIds
+		return sequenceIds, nil
 	}
 
 	info, ok := userInfo[msg.GameId]
 	if !ok { // No reviews have been received for this game.
 		c.joiner.gameInfoByClient[headers.ClientId][msg.GameId] = gameInfo{gameName: msg.GameName}
-		return sequenceIds
+		return sequenceIds, nil
 	}
 
 	if info.votes >= c.target {
 		if !recovery {
 			if sequenceIds = c.publish(headers, msgBytes); sequenceIds == nil {
-				return sequenceIds
+				return sequenceIds, nil
 			}
 		}
 		c.joiner.gameInfoByClient[headers.ClientId][msg.GameId] = gameInfo{gameName: msg.GameName, votes: info.votes, sent: true}
@@ -137,7 +141,7 @@ func (c *counter) processGame(headers amqp.Header, msgBytes []byte, recovery boo
 		c.joiner.gameInfoByClient[headers.ClientId][msg.GameId] = gameInfo{gameName: msg.GameName, votes: info.votes}
 	}
 
-	return sequenceIds
+	return sequenceIds, nil
 }
 
 // publish publishes the game name when the target is reached.
@@ -150,7 +154,7 @@ func (c *counter) publish(headers amqp.Header, msgBytes []byte) []sequence.Desti
 	headers = headers.WithMessageId(message.GameNameId).WithSequenceId(sequence.SrcNew(c.joiner.w.Uuid, sequenceId))
 
 	if err := c.joiner.w.Broker.Publish(c.joiner.w.Outputs[0].Exchange, c.joiner.w.Outputs[0].Key, msgBytes, headers); err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToPublish.Error(), err.Error())
+		c.joiner.w.Log(headers).Errorf("%s: %s", errors.FailedToPublish.Error(), err.Error())
 		return nil
 	}
 
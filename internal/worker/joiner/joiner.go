@@ -4,7 +4,6 @@ import (
 	"tp1/internal/errors"
 	"tp1/internal/worker"
 	"tp1/pkg/amqp"
-	"tp1/pkg/logs"
 	"tp1/pkg/message"
 	"tp1/pkg/recovery"
 	"tp1/pkg/sequence"
@@ -12,8 +11,8 @@ import (
 
 // Every joiner must implement the processor interface because all of them join reviews with games.
 type processor interface {
-	processReview(headers amqp.Header, msgBytes []byte, recovery bool) []sequence.Destination
-	processGame(headers amqp.Header, msgBytes []byte, recovery bool) []sequence.Destination
+	processReview(headers amqp.Header, msgBytes []byte, recovery bool) ([]sequence.Destination, error)
+	processGame(headers amqp.Header, msgBytes []byte, recovery bool) ([]sequence.Destination, error)
 }
 
 type joiner struct {
@@ -33,6 +32,24 @@ type recvEofs struct {
 	game   bool
 }
 
+// joinerState is the state of a joiner, saved in snapshots. It mirrors the joiner's fields, since unexported
+// fields cannot be encoded.
+type joinerState struct {
+	Eofs  map[string]eofsState
+	Games map[string]map[int64]gameState
+}
+
+type eofsState struct {
+	Review bool
+	Game   bool
+}
+
+type gameState struct {
+	GameName string
+	Votes    uint64
+	Sent     bool
+}
+
 func newJoiner() (*joiner, error) {
 	w, err := worker.New()
 	if err != nil {
@@ -72,18 +89,73 @@ func (j *joiner) processEof(header amqp.Header, sendEof func(header amqp.Header)
 
 func (j *joiner) recover(instance processor) {
 	ch := make(chan recovery.Message, worker.ChanSize)
-	go j.w.Recover(ch)
+	go j.w.Recover(j, ch)
 
 	for recoveredMsg := range ch {
+		var err error
+
 		switch recoveredMsg.Header().MessageId {
 		case message.EofId:
 			j.processEof(recoveredMsg.Header(), nil)
+		case message.ClientAbortId:
+			j.Purge(recoveredMsg.Header().ClientId)
 		case message.ScoredReviewId:
-			instance.processReview(recoveredMsg.Header(), recoveredMsg.Message(), true)
+			_, err = instance.processReview(recoveredMsg.Header(), recoveredMsg.Message(), true)
 		case message.GameNameId:
-			instance.processGame(recoveredMsg.Header(), recoveredMsg.Message(), true)
+			_, err = instance.processGame(recoveredMsg.Header(), recoveredMsg.Message(), true)
 		default:
-			logs.Logger.Errorf(errors.InvalidMessageId.Error(), recoveredMsg.Header().MessageId)
+			j.w.Log(recoveredMsg.Header()).Errorf("%s: %d", errors.InvalidMessageId.Error(), recoveredMsg.Header().MessageId)
+		}
+
+		if err != nil {
+			j.w.Log(recoveredMsg.Header()).Errorf("%s", err)
 		}
 	}
 }
+
+func (j *joiner) Purge(clientId string) {
+	delete(j.gameInfoByClient, clientId)
+	delete(j.eofsByClient, clientId)
+}
+
+func (j *joiner) StateSize(clientId string) int {
+	return len(j.gameInfoByClient[clientId])
+}
+
+func (j *joiner) Snapshot() ([]byte, error) {
+	state := joinerState{
+		Eofs:  make(map[string]eofsState, len(j.eofsByClient)),
+		Games: make(map[string]map[int64]gameState, len(j.gameInfoByClient)),
+	}
+
+	for clientId, recv := range j.eofsByClient {
+		state.Eofs[clientId] = eofsState{Review: recv.review, Game: recv.game}
+	}
+	for clientId, games := range j.gameInfoByClient {
+		state.Games[clientId] = make(map[int64]gameState, len(games))
+		for gameId, info := range games {
+			state.Games[clientId][gameId] = gameState{GameName: info.gameName, Votes: info.votes, Sent: info.sent}
+		}
+	}
+
+	return worker.EncodeState(state)
+}
+
+func (j *joiner) Restore(b []byte) error {
+	var state joinerState
+	if err := worker.DecodeState(b, &state); err != nil {
+		return err
+	}
+
+	for clientId, recv := range state.Eofs {
+		j.eofsByClient[clientId] = recvEofs{review: recv.Review, game: recv.Game}
+	}
+	for clientId, games := range state.Games {
+		j.gameInfoByClient[clientId] = make(map[int64]gameInfo, len(games))
+		for gameId, info := range games {
+			j.gameInfoByClient[clientId][gameId] = gameInfo{gameName: info.GameName, votes: info.Votes, sent: info.Sent}
+		}
+	}
+
+	return nil
+}
@@ -1,10 +1,11 @@
 package joiner
 
 import (
+	"fmt"
+
 	"tp1/internal/errors"
 	"tp1/internal/worker"
 	"tp1/pkg/amqp"
-	"tp1/pkg/logs"
 	"tp1/pkg/message"
 	"tp1/pkg/sequence"
 )
@@ -42,16 +43,21 @@ func (p *percentile) Start() {
 
 func (p *percentile) Process(delivery amqp.Delivery, headers amqp.Header) ([]sequence.Destination, []byte) {
 	var sequenceIds []sequence.Destination
+	var err error
 
 	switch headers.MessageId {
 	case message.EofId:
 		sequenceIds = p.joiner.processEof(headers, p.processEof)
 	case message.ScoredReviewId:
-		p.processReview(headers, delivery.Body, false)
+		_, err = p.processReview(headers, delivery.Body, false)
 	case message.GameNameId:
-		p.processGame(headers, delivery.Body, false)
+		_, err = p.processGame(headers, delivery.Body, false)
 	default:
-		logs.Logger.Errorf(errors.InvalidMessageId.Error(), headers.MessageId)
+		err = fmt.Errorf("%w: %d", errors.InvalidMessageId, headers.MessageId)
+	}
+
+	if err != nil {
+		p.joiner.w.DeadLetter(delivery, err)
 	}
 
 	return sequenceIds, delivery.Body
@@ -67,7 +73,7 @@ func (p *percentile) processEof(headers amqp.Header) []sequence.Destination {
 
 	auxSequenceIds, err := p.joiner.w.HandleEofMessage(amqp.EmptyEof, headers)
 	if err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToPublish.Error(), err)
+		p.joiner.w.Log(headers).Errorf("%s: %s", errors.FailedToPublish.Error(), err)
 	}
 
 	sequenceIds = append(sequenceIds, auxSequenceIds...)
@@ -98,17 +104,16 @@ func (p *percentile) processBatch(headers amqp.Header, userInfo map[int64]gameIn
 	return sequenceIds
 }
 
-func (p *percentile) processReview(headers amqp.Header, msgBytes []byte, _ bool) []sequence.Destination {
+func (p *percentile) processReview(headers amqp.Header, msgBytes []byte, _ bool) ([]sequence.Destination, error) {
 	msg, err := message.ScoredReviewFromBytes(msgBytes)
 	if err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
-		return nil
+		return nil, fmt.Errorf("%w: %w", errors.FailedToParse, err)
 	}
 
 	userInfo, ok := p.joiner.gameInfoByClient[headers.ClientId]
 	if !ok { // First message for this clientId
 		p.joiner.gameInfoByClient[headers.ClientId] = map[int64]gameInfo{msg.GameId: {votes: msg.Votes}}
-		return nil
+		return nil, nil
 	}
 
 	info, ok := userInfo[msg.GameId]
@@ -118,20 +123,19 @@ func (p *percentile) processReview(headers amqp.Header, msgBytes []byte, _ bool)
 		p.joiner.gameInfoByClient[headers.ClientId][msg.GameId] = gameInfo{gameName: info.gameName, votes: info.votes + msg.Votes}
 	}
 
-	return nil
+	return nil, nil
 }
 
-func (p *percentile) processGame(headers amqp.Header, msgBytes []byte, _ bool) []sequence.Destination {
+func (p *percentile) processGame(headers amqp.Header, msgBytes []byte, _ bool) ([]sequence.Destination, error) {
 	msg, err := message.GameNameFromBytes(msgBytes)
 	if err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
-		return nil
+		return nil, fmt.Errorf("%w: %w", errors.FailedToParse, err)
 	}
 
 	userInfo, ok := p.joiner.gameInfoByClient[headers.ClientId]
 	if !ok { // First message for this clientId
 		p.joiner.gameInfoByClient[headers.ClientId] = map[int64]gameInfo{msg.GameId: {gameName: msg.GameName}}
-		return nil
+		return nil, nil
 	}
 
 	info, ok := userInfo[msg.GameId]
@@ -140,13 +144,13 @@ func (p *percentile) processGame(headers amqp.Header, msgBytes []byte, _ bool) [
 	} else {
 		p.joiner.gameInfoByClient[headers.ClientId][msg.GameId] = gameInfo{gameName: msg.GameName, votes: info.votes}
 	}
-	return nil
+	return nil, nil
 }
 
 func (p *percentile) publish(headers amqp.Header, reviews message.ScoredReviews) sequence.Destination {
 	b, err := reviews.ToBytes()
 	if err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
+		p.joiner.w.Log(headers).Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
 	}
 
 	key := p.joiner.w.Outputs[0].Key
@@ -155,7 +159,7 @@ func (p *percentile) publish(headers amqp.Header, reviews message.ScoredReviews)
 	headers = headers.WithMessageId(message.ScoredReviewId).WithSequenceId(sequence.SrcNew(p.joiner.w.Uuid, sequenceId))
 
 	if err = p.joiner.w.Broker.Publish(p.joiner.w.Outputs[0].Exchange, key, b, headers); err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToPublish.Error(), err.Error())
+		p.joiner.w.Log(headers).Errorf("%s: %s", errors.FailedToPublish.Error(), err.Error())
 	}
 
 	return sequence.DstNew(key, sequenceId)
@@ -5,7 +5,6 @@ import (
 	"tp1/internal/errors"
 	"tp1/internal/worker"
 	"tp1/pkg/amqp"
-	"tp1/pkg/logs"
 	"tp1/pkg/message"
 	"tp1/pkg/sequence"
 )
@@ -45,16 +44,21 @@ func (t *top) Start() {
 
 func (t *top) Process(delivery amqp.Delivery, headers amqp.Header) ([]sequence.Destination, []byte) {
 	var sequenceIds []sequence.Destination
+	var err error
 
 	switch headers.MessageId {
 	case message.EofId:
 		sequenceIds = t.joiner.processEof(headers, t.processEof)
 	case message.ScoredReviewId:
-		sequenceIds = t.processReview(headers, delivery.Body, false)
+		sequenceIds, err = t.processReview(headers, delivery.Body, false)
 	case message.GameNameId:
-		sequenceIds = t.processGame(headers, delivery.Body, false)
+		sequenceIds, err = t.processGame(headers, delivery.Body, false)
 	default:
-		logs.Logger.Errorf(errors.InvalidMessageId.Error(), headers.MessageId)
+		err = fmt.Errorf("%w: %d", errors.InvalidMessageId, headers.MessageId)
+	}
+
+	if err != nil {
+		t.joiner.w.DeadLetter(delivery, err)
 	}
 
 	return sequenceIds, delivery.Body
@@ -63,72 +67,70 @@ func (t *top) Process(delivery amqp.Delivery, headers amqp.Header) ([]sequence.D
 func (t *top) processEof(headers amqp.Header) []sequence.Destination {
 	sequenceIds, err := t.joiner.w.HandleEofMessage(amqp.EmptyEof, headers, amqp.DestinationEof(t.output))
 	if err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToPublish.Error(), err.Error())
+		t.joiner.w.Log(headers).Errorf("%s: %s", errors.FailedToPublish.Error(), err.Error())
 	}
 
 	return sequenceIds
 }
 
-func (t *top) processReview(headers amqp.Header, msgBytes []byte, recovery bool) []sequence.Destination {
+func (t *top) processReview(headers amqp.Header, msgBytes []byte, recovery bool) ([]sequence.Destination, error) {
 	var sequenceIds []sequence.Destination
 	msg, err := message.ScoredReviewFromBytes(msgBytes)
 	if err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
-		return sequenceIds
+		return nil, fmt.Errorf("%w: %w", errors.FailedToParse, err)
 	}
 
 	userInfo, ok := t.joiner.gameInfoByClient[headers.ClientId]
 	if !ok {
 		t.joiner.gameInfoByClient[headers.ClientId] = map[int64]gameInfo{msg.GameId: {votes: msg.Votes}}
-		return sequenceIds
+		return sequenceIds, nil
 	}
 
 	info, ok := userInfo[msg.GameId]
 	if !ok {
 		t.joiner.gameInfoByClient[headers.ClientId][msg.GameId] = gameInfo{votes: msg.Votes}
-		return sequenceIds
+		return sequenceIds, nil
 	}
 
 	t.joiner.gameInfoByClient[headers.ClientId][msg.GameId] = gameInfo{gameName: info.gameName, votes: info.votes + msg.Votes}
 
 	if info.gameName == "" {
-		return sequenceIds
+		return sequenceIds, nil
 	}
 
 	if !recovery {
 		b, err := message.ScoredReviews{{GameId: msg.GameId, GameName: info.gameName, Votes: info.votes + msg.Votes}}.ToBytes()
 		if err != nil {
-			logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
-			return sequenceIds
+			t.joiner.w.Log(headers).Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
+			return sequenceIds, nil
 		}
 		destSeqId := t.publish(headers, b)
 		if destSeqId == nil {
-			return sequenceIds
+			return sequenceIds, nil
 		}
 		sequenceIds = append(sequenceIds, destSeqId...)
 	}
 
-	return sequenceIds
+	return sequenceIds, nil
 }
 
-func (t *top) processGame(headers amqp.Header, msgBytes []byte, recovery bool) []sequence.Destination {
+func (t *top) processGame(headers amqp.Header, msgBytes []byte, recovery bool) ([]sequence.Destination, error) {
 	var sequenceIds []sequence.Destination
 	msg, err := message.GameNameFromBytes(msgBytes)
 	if err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
-		return sequenceIds
+		return nil, fmt.Errorf("%w: %w", errors.FailedToParse, err)
 	}
 
 	userInfo, ok := t.joiner.gameInfoByClient[headers.ClientId]
 	if !ok {
 		t.joiner.gameInfoByClient[headers.ClientId] = map[int64]gameInfo{msg.GameId: {gameName: msg.GameName}}
-		return sequenceIds
+		return sequenceIds, nil
 	}
 
 	info, ok := userInfo[msg.GameId]
 	if !ok { // No reviews have been received for this game.
 		t.joiner.gameInfoByClient[headers.ClientId][msg.GameId] = gameInfo{gameName: msg.GameName}
-		return sequenceIds
+		return sequenceIds, nil
 	}
 
 	t.joiner.gameInfoByClient[headers.ClientId][msg.GameId] = gameInfo{gameName: msg.GameName, votes: info.votes}
@@ -136,17 +138,17 @@ func (t *top) processGame(headers amqp.Header, msgBytes []byte, recovery bool) [
 	if !recovery {
 		b, err := message.ScoredReviews{{GameId: msg.GameId, Votes: info.votes, GameName: msg.GameName}}.ToBytes()
 		if err != nil {
-			logs.Logger.Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
-			return sequenceIds
+			t.joiner.w.Log(headers).Errorf("%s: %s", errors.FailedToParse.Error(), err.Error())
+			return sequenceIds, nil
 		}
 		destSeqId := t.publish(headers, b)
 		if destSeqId == nil {
-			return sequenceIds
+			return sequenceIds, nil
 		}
 		sequenceIds = append(sequenceIds, destSeqId...)
 	}
 
-	return sequenceIds
+	return sequenceIds, nil
 }
 
 func (t *top) publish(headers amqp.Header, b []byte) []sequence.Destination {
@@ -156,7 +158,7 @@ func (t *top) publish(headers amqp.Header, b []byte) []sequence.Destination {
 	headers = headers.WithMessageId(message.ScoredReviewId).WithSequenceId(sequence.SrcNew(t.joiner.w.Uuid, sequenceId))
 
 	if err := t.joiner.w.Broker.Publish(t.output.Exchange, key, b, headers); err != nil {
-		logs.Logger.Errorf("%s: %s", errors.FailedToPublish.Error(), err.Error())
+		t.joiner.w.Log(headers).Errorf("%s: %s", errors.FailedToPublish.Error(), err.Error())
 		return nil
 	}
 
@@ -0,0 +1,160 @@
+package worker
+
+import (
+	"sort"
+	"sync"
+
+	"tp1/pkg/membership"
+	"tp1/pkg/message"
+)
+
+// view is the membership a client gets processed with.
+type view struct {
+	peers        []uint8 // peers holds the sorted IDs of the workers the EOFs go around, including this one.
+	expectedEofs uint8
+}
+
+// members resolves the peers and the expected EOFs of a worker. They are either set by the `peers` and
+// `expected-eofs` keys, or discovered through a membership.Registry if the `membership` section is set.
+//
+// Discovered members are pinned by client the first time the client is seen, so that workers joining or leaving
+// only affect the clients that start afterwards. Since each worker pins them on its own, peers may pin different
+// members for a client: the EOF carries the peers it goes around, which every worker adds its own to. Pins are saved
+// in snapshots, so that a restarted worker keeps them.
+type members struct {
+	mu       sync.Mutex
+	registry *membership.Registry // registry is nil if members are static.
+	stage    string               // stage is the stage of the worker, whose members the EOFs go around.
+	upstream string               // upstream is the stage whose members send an EOF each, if any.
+	static   view
+	pinned   map[string]view
+}
+
+func newStaticMembers(peers, expectedEofs uint8) *members {
+	ids := make([]uint8, 0, peers)
+	for id := uint8(0); id < peers; id++ {
+		ids = append(ids, id)
+	}
+	return &members{static: view{peers: ids, expectedEofs: expectedEofs}}
+}
+
+func newDiscoveredMembers(registry *membership.Registry, stage, upstream string) *members {
+	return &members{
+		registry: registry,
+		stage:    stage,
+		upstream: upstream,
+		pinned:   make(map[string]view),
+	}
+}
+
+// pin returns the members a client gets processed with, pinning the current ones if the client is new.
+func (m *members) pin(clientId string) view {
+	if m.registry == nil {
+		return m.static
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if v, ok := m.pinned[clientId]; ok {
+		return v
+	}
+
+	v := view{peers: m.registry.Members(m.stage)}
+	if m.upstream != "" {
+		v.expectedEofs = uint8(len(m.registry.Members(m.upstream)))
+	}
+
+	m.pinned[clientId] = v
+	return v
+}
+
+// around returns the peers an EOF of a client goes around: the ones it carries along with the ones pinned.
+func (m *members) around(clientId string, carried []uint8) view {
+	v := m.pin(clientId)
+	if len(carried) == 0 {
+		return v
+	}
+
+	peers := append([]uint8{}, v.peers...)
+	for _, peer := range carried {
+		if !message.Eof(peers).Contains(peer) {
+			peers = append(peers, peer)
+		}
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i] < peers[j] })
+	return view{peers: peers, expectedEofs: v.expectedEofs}
+}
+
+// unpin forgets the members pinned for a client.
+func (m *members) unpin(clientId string) {
+	if m.registry == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.pinned, clientId)
+}
+
+// pinnedView is a view as saved in snapshots.
+type pinnedView struct {
+	Peers        []uint8
+	ExpectedEofs uint8
+}
+
+// snapshot encodes the members pinned by client. Static members are not saved, since they never change.
+func (m *members) snapshot() ([]byte, error) {
+	if m.registry == nil {
+		return nil, nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pinned := make(map[string]pinnedView, len(m.pinned))
+	for clientId, v := range m.pinned {
+		pinned[clientId] = pinnedView{Peers: v.peers, ExpectedEofs: v.expectedEofs}
+	}
+	return EncodeState(pinned)
+}
+
+// restore replaces the members pinned by client with the ones of a snapshot.
+func (m *members) restore(state []byte) error {
+	if m.registry == nil || state == nil {
+		return nil
+	}
+
+	pinned := make(map[string]pinnedView)
+	if err := DecodeState(state, &pinned); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pinned = make(map[string]view, len(pinned))
+	for clientId, v := range pinned {
+		m.pinned[clientId] = view{peers: v.Peers, expectedEofs: v.ExpectedEofs}
+	}
+	return nil
+}
+
+// aggregates returns whether the worker receives an EOF from each member of an upstream stage.
+func (m *members) aggregates() bool {
+	if m.registry == nil {
+		return m.static.expectedEofs > 0
+	}
+	return m.upstream != ""
+}
+
+// nextUnvisited returns the peer an EOF goes to after the given one, skipping the visited ones and wrapping around.
+// It returns false if every peer was visited.
+func (v view) nextUnvisited(id uint8, visited message.Eof) (uint8, bool) {
+	start := sort.Search(len(v.peers), func(i int) bool { return v.peers[i] > id })
+	for i := 0; i < len(v.peers); i++ {
+		peer := v.peers[(start+i)%len(v.peers)]
+		if !visited.Contains(peer) {
+			return peer, true
+		}
+	}
+	return 0, false
+}
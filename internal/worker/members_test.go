@@ -0,0 +1,77 @@
+package worker
+
+import (
+	"testing"
+
+	"tp1/pkg/membership"
+	"tp1/pkg/message"
+)
+
+func TestNextUnvisitedWrapsAround(t *testing.T) {
+	v := newStaticMembers(3, 0).pin("0-0")
+
+	next, ok := v.nextUnvisited(2, message.Eof{2})
+	if !ok || next != 0 {
+		t.Fatalf("expected the EOF to go to worker 0, got %d (%t)", next, ok)
+	}
+
+	next, ok = v.nextUnvisited(1, message.Eof{2, 0, 1})
+	if ok {
+		t.Fatalf("expected every worker to be visited, got %d", next)
+	}
+}
+
+func TestNextUnvisitedSkipsMissingPeers(t *testing.T) {
+	v := view{peers: []uint8{1, 4, 6}}
+
+	next, ok := v.nextUnvisited(4, message.Eof{4, 6})
+	if !ok || next != 1 {
+		t.Fatalf("expected the EOF to go to worker 1, got %d (%t)", next, ok)
+	}
+}
+
+func TestStaticMembersDoNotRing(t *testing.T) {
+	v := newStaticMembers(1, 2).pin("0-0")
+
+	if _, ok := v.nextUnvisited(0, message.Eof{0}); ok {
+		t.Fatal("expected a single worker not to forward EOFs to itself")
+	}
+	if v.expectedEofs != 2 {
+		t.Fatalf("expected 2 EOFs, got %d", v.expectedEofs)
+	}
+}
+
+func TestEofsGoAroundThePeersCarriedAlongWithThePinnedOnes(t *testing.T) {
+	m := newDiscoveredMembers(&membership.Registry{}, "filter", "")
+	m.pinned["0-0"] = view{peers: []uint8{0, 1}}
+
+	v := m.around("0-0", []uint8{0, 2})
+	if len(v.peers) != 3 || v.peers[0] != 0 || v.peers[1] != 1 || v.peers[2] != 2 {
+		t.Fatalf("expected the EOF to go around workers 0, 1 and 2, got %v", v.peers)
+	}
+
+	next, ok := v.nextUnvisited(1, message.Eof{0, 1})
+	if !ok || next != 2 {
+		t.Fatalf("expected the EOF to go to worker 2, got %d (%t)", next, ok)
+	}
+}
+
+func TestPinnedMembersAreRestoredFromSnapshots(t *testing.T) {
+	m := newDiscoveredMembers(&membership.Registry{}, "aggregator", "filter")
+	m.pinned["0-0"] = view{peers: []uint8{0, 2}, expectedEofs: 3}
+
+	state, err := m.snapshot()
+	if err != nil {
+		t.Fatalf("Unexpected error taking snapshot: %s", err)
+	}
+
+	restored := newDiscoveredMembers(&membership.Registry{}, "aggregator", "filter")
+	if err = restored.restore(state); err != nil {
+		t.Fatalf("Unexpected error restoring snapshot: %s", err)
+	}
+
+	v := restored.pin("0-0")
+	if len(v.peers) != 2 || v.peers[1] != 2 || v.expectedEofs != 3 {
+		t.Fatalf("expected the pinned members to be restored, got %v", v)
+	}
+}
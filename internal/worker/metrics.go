@@ -0,0 +1,77 @@
+package worker
+
+import (
+	"strconv"
+	"time"
+
+	"tp1/internal/errors"
+	"tp1/pkg/message"
+	"tp1/pkg/metrics"
+)
+
+const (
+	metricsAddressKey     = "metrics-address"
+	defaultMetricsAddress = ":9100"
+
+	processed = "processed"
+	duplicate = "duplicate"
+	failed    = "failed"
+	toPeer    = "peer"
+	toOutput  = "output"
+)
+
+// Sizer is implemented by nodes that keep state by client, so that its size can be exposed as a metric.
+type Sizer interface {
+	// StateSize returns the amount of entries the node keeps for the given client.
+	StateSize(clientId string) int
+}
+
+var (
+	deliveries = metrics.NewCounter("worker_deliveries_total",
+		"Deliveries handled by the worker, by message ID and result: processed, duplicate or failed.",
+		"message_id", "result")
+	publishLatency = metrics.NewHistogram("worker_publish_duration_seconds",
+		"Time taken to publish messages to an exchange, including publisher confirms if enabled.",
+		metrics.DefBuckets, "exchange")
+	clientStateSize = metrics.NewGauge("worker_client_state_entries",
+		"Entries the node keeps for each client.", "client_id")
+	activeClients = metrics.NewGauge("worker_active_clients",
+		"Clients seen by the worker that were neither aborted nor expired.")
+	eofsForwarded = metrics.NewCounter("worker_eofs_forwarded_total",
+		"EOFs and client aborts forwarded, either to the next peer or to the outputs.", "message_id", "to")
+)
+
+// serveMetrics exposes the worker metrics over HTTP at `metrics-address`, unless it is empty.
+func (f *Worker) serveMetrics() {
+	metrics.NewGaugeFunc("worker_recovery_log_bytes", "Size of the recovery log.", func() float64 {
+		size, err := f.recovery.Size()
+		if err != nil {
+			return 0
+		}
+		return float64(size)
+	})
+
+	if err := metrics.Serve(f.config.String(metricsAddressKey, defaultMetricsAddress)); err != nil {
+		f.log.Errorf("%s: %s", errors.FailedToServeMetrics.Error(), err)
+	}
+}
+
+// countDelivery counts a delivery handled with the given result.
+func countDelivery(messageId message.Id, result string) {
+	deliveries.Inc(strconv.Itoa(int(messageId)), result)
+}
+
+// observePublish samples the latency of a publishing to the given exchange which started at start.
+func observePublish(exchange string, start time.Time) {
+	publishLatency.Observe(time.Since(start).Seconds(), exchange)
+}
+
+// measureClient updates the size of the state kept for a client. The size of clients that are gone is dropped.
+func (f *Worker) measureClient(clientId string, gone bool) {
+	if gone {
+		clientStateSize.Delete(clientId)
+	} else if s, ok := f.state.(Sizer); ok {
+		clientStateSize.Set(float64(s.StateSize(clientId)), clientId)
+	}
+	activeClients.Set(float64(f.clients.active()))
+}
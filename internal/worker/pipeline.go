@@ -0,0 +1,102 @@
+package worker
+
+import (
+	"sync"
+
+	"tp1/pkg/amqp"
+	"tp1/pkg/sequence"
+	"tp1/pkg/tracing"
+)
+
+// ConcurrentNode is implemented by stateless nodes whose processing can be split in two stages:
+//   - Prepare, which must not touch any shared state, so that many deliveries can be prepared concurrently.
+//   - Complete, which generates sequence IDs and publishes. It runs one delivery at a time, in delivery order,
+//     so that sequence IDs are published in increasing order, as the duplicate handlers downstream expect.
+//
+// Process must be equivalent to calling Complete with the result of Prepare.
+type ConcurrentNode interface {
+	Node
+	Prepare(delivery amqp.Delivery, headers amqp.Header) any
+	Complete(prepared any, delivery amqp.Delivery, headers amqp.Header) ([]sequence.Destination, []byte)
+}
+
+type job struct {
+	delivery amqp.Delivery
+	header   amqp.Header
+	src      sequence.Source
+	span     *tracing.Span
+	prepared chan any
+}
+
+// pipeline prepares deliveries with a pool of goroutines and completes them in the order they were submitted.
+type pipeline struct {
+	node    ConcurrentNode
+	jobs    chan *job
+	ordered chan *job
+	wg      sync.WaitGroup
+	stopped chan struct{} // stopped is closed once the deliveries not completed yet must be left as they are.
+}
+
+func newPipeline(node ConcurrentNode, concurrency int, complete func(*job)) *pipeline {
+	p := &pipeline{
+		node:    node,
+		jobs:    make(chan *job, concurrency),
+		ordered: make(chan *job, concurrency),
+		stopped: make(chan struct{}),
+	}
+
+	p.wg.Add(concurrency + 1)
+	for i := 0; i < concurrency; i++ {
+		go p.prepare()
+	}
+	go p.complete(complete)
+
+	return p
+}
+
+// submit queues a delivery. It blocks while the pipeline is full.
+func (p *pipeline) submit(delivery amqp.Delivery, header amqp.Header, src sequence.Source, span *tracing.Span) {
+	j := &job{delivery: delivery, header: header, src: src, span: span, prepared: make(chan any, 1)}
+	p.ordered <- j
+	p.jobs <- j
+}
+
+// close waits for every submitted delivery to be completed, or skipped once the pipeline is stopped.
+func (p *pipeline) close() {
+	close(p.jobs)
+	close(p.ordered)
+	p.wg.Wait()
+}
+
+// stop skips the deliveries not being completed yet, which stay unacknowledged. The one being completed still
+// finishes. Deliveries are still prepared, since preparing them has no effects, and the one being completed may be
+// waiting for it.
+func (p *pipeline) stop() {
+	close(p.stopped)
+}
+
+func (p *pipeline) prepare() {
+	defer p.wg.Done()
+	for j := range p.jobs {
+		j.prepared <- p.node.Prepare(j.delivery, j.header)
+	}
+}
+
+func (p *pipeline) complete(complete func(*job)) {
+	defer p.wg.Done()
+	for j := range p.ordered {
+		if p.isStopped() {
+			continue
+		}
+		complete(j)
+	}
+}
+
+func (p *pipeline) isStopped() bool {
+	select {
+	case <-p.stopped:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,81 @@
+package worker
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"tp1/pkg/amqp"
+	"tp1/pkg/sequence"
+)
+
+// slowNode takes longer to prepare the first deliveries, so that they finish preparing out of order.
+type slowNode struct {
+	total int
+}
+
+func (n *slowNode) Init() error { return nil }
+func (n *slowNode) Start()      {}
+
+func (n *slowNode) Process(delivery amqp.Delivery, headers amqp.Header) ([]sequence.Destination, []byte) {
+	return n.Complete(n.Prepare(delivery, headers), delivery, headers)
+}
+
+func (n *slowNode) Prepare(delivery amqp.Delivery, _ amqp.Header) any {
+	i, _ := strconv.Atoi(string(delivery.Body))
+	time.Sleep(time.Duration(n.total-i) * time.Millisecond)
+	return i
+}
+
+func (n *slowNode) Complete(prepared any, _ amqp.Delivery, _ amqp.Header) ([]sequence.Destination, []byte) {
+	return nil, []byte(strconv.Itoa(prepared.(int)))
+}
+
+func TestPipelineCompletesInSubmissionOrder(t *testing.T) {
+	node := &slowNode{total: 20}
+	var completed []int
+
+	p := newPipeline(node, 4, func(j *job) {
+		_, msg := node.Complete(<-j.prepared, j.delivery, j.header)
+		i, _ := strconv.Atoi(string(msg))
+		completed = append(completed, i)
+	})
+
+	for i := 0; i < node.total; i++ {
+		p.submit(amqp.Delivery{Body: []byte(strconv.Itoa(i))}, amqp.Header{}, sequence.Source{}, nil)
+	}
+	p.close()
+
+	if len(completed) != node.total {
+		t.Fatalf("expected %d completed deliveries, got %d", node.total, len(completed))
+	}
+	for i, c := range completed {
+		if c != i {
+			t.Fatalf("expected delivery %d to be completed in position %d, got %d", i, i, c)
+		}
+	}
+}
+
+func TestStoppedPipelineSkipsDeliveriesNotCompletedYet(t *testing.T) {
+	node := &slowNode{total: 5}
+	release := make(chan struct{})
+	var completed []int
+
+	p := newPipeline(node, 4, func(j *job) {
+		_, msg := node.Complete(<-j.prepared, j.delivery, j.header)
+		i, _ := strconv.Atoi(string(msg))
+		<-release
+		completed = append(completed, i)
+	})
+
+	for i := 0; i < node.total; i++ {
+		p.submit(amqp.Delivery{Body: []byte(strconv.Itoa(i))}, amqp.Header{}, sequence.Source{}, nil)
+	}
+	p.stop()
+	close(release)
+	p.close()
+
+	if len(completed) != 1 || completed[0] != 0 {
+		t.Fatalf("expected only the delivery in process to be completed, got %v", completed)
+	}
+}
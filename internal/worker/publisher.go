@@ -0,0 +1,63 @@
+package worker
+
+import (
+	"time"
+
+	"tp1/pkg/amqp"
+)
+
+// trackingBroker wraps a MessageBroker and remembers the first publishing error since the last reset, along with
+// the messages that failed. It allows the worker to find out whether every output of a Process call was published,
+// and to publish the ones that were not again, without requiring nodes to report it. It also measures how long each
+// publishing takes.
+type trackingBroker struct {
+	amqp.MessageBroker
+	err    error
+	failed []amqp.Message
+}
+
+func newTrackingBroker(b amqp.MessageBroker) *trackingBroker {
+	return &trackingBroker{MessageBroker: b}
+}
+
+// Publish sends a message to an exchange, keeping track of its error, if any.
+func (b *trackingBroker) Publish(exchange, key string, msg []byte, headers amqp.Header) error {
+	defer observePublish(exchange, time.Now())
+	return b.track(b.MessageBroker.Publish(exchange, key, msg, headers), amqp.Message{Exchange: exchange, Key: key, Body: msg, Header: headers})
+}
+
+// PublishBatch sends many messages, keeping track of the error, if any. Its latency is measured under the exchange
+// of the first message.
+func (b *trackingBroker) PublishBatch(msgs ...amqp.Message) error {
+	if len(msgs) > 0 {
+		defer observePublish(msgs[0].Exchange, time.Now())
+	}
+	return b.track(b.MessageBroker.PublishBatch(msgs...), msgs...)
+}
+
+// reset returns the first error tracked since the last call, and clears it along with the messages that failed.
+func (b *trackingBroker) reset() error {
+	err := b.err
+	b.err, b.failed = nil, nil
+	return err
+}
+
+// republish publishes again the messages that failed since the last reset, as they were, so that the ones the broker
+// got anyway are discarded downstream as duplicates. It returns the error of the attempt, if any, keeping the
+// messages to be published again.
+func (b *trackingBroker) republish() error {
+	failed := b.failed
+	b.err, b.failed = nil, nil
+	return b.PublishBatch(failed...)
+}
+
+func (b *trackingBroker) track(err error, msgs ...amqp.Message) error {
+	if err == nil {
+		return nil
+	}
+	if b.err == nil {
+		b.err = err
+	}
+	b.failed = append(b.failed, msgs...)
+	return err
+}
@@ -0,0 +1,45 @@
+package worker
+
+import (
+	"errors"
+	"testing"
+
+	"tp1/pkg/amqp"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flakyBroker fails the given amount of publishings, and records the messages of the ones that succeed.
+type flakyBroker struct {
+	amqp.MessageBroker
+	failures  int
+	published []amqp.Message
+}
+
+func (b *flakyBroker) Publish(exchange, key string, msg []byte, headers amqp.Header) error {
+	return b.PublishBatch(amqp.Message{Exchange: exchange, Key: key, Body: msg, Header: headers})
+}
+
+func (b *flakyBroker) PublishBatch(msgs ...amqp.Message) error {
+	if b.failures > 0 {
+		b.failures--
+		return errors.New("channel closed")
+	}
+	b.published = append(b.published, msgs...)
+	return nil
+}
+
+func TestFailedPublishingsAreRepublishedAsTheyWere(t *testing.T) {
+	flaky := &flakyBroker{failures: 2}
+	b := newTrackingBroker(flaky)
+
+	header := amqp.Header{ClientId: "0-1", SequenceId: "node-7"}
+	assert.Error(t, b.Publish("games", "action", []byte("a"), header))
+	assert.Error(t, b.republish(), "the messages that fail again are kept")
+	assert.NoError(t, b.republish())
+	assert.NoError(t, b.reset())
+
+	assert.Equal(t, []amqp.Message{{Exchange: "games", Key: "action", Body: []byte("a"), Header: header}}, flaky.published)
+	assert.NoError(t, b.republish(), "nothing is left to republish")
+	assert.Len(t, flaky.published, 1)
+}
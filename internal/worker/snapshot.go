@@ -0,0 +1,107 @@
+package worker
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+
+	"tp1/internal/errors"
+	"tp1/pkg/recovery"
+)
+
+// Snapshotter is implemented by nodes that keep state between messages, so that it can be saved in snapshots
+// instead of being rebuilt from every message in the recovery log.
+type Snapshotter interface {
+	// Snapshot encodes the state of the node.
+	Snapshot() ([]byte, error)
+	// Restore replaces the state of the node with a previously encoded one.
+	Restore(state []byte) error
+}
+
+// EncodeState encodes a node's state, to be returned by Snapshot.
+func EncodeState(state any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(state); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeState decodes a state encoded by EncodeState into the value pointed to by state.
+// Maps already set in state are filled rather than replaced.
+func DecodeState(b []byte, state any) error {
+	return gob.NewDecoder(bytes.NewReader(b)).Decode(state)
+}
+
+// snapshot saves the sequence IDs of the logged messages and the state of the node, truncating the recovery log.
+func (f *Worker) snapshot() {
+	s := recovery.Snapshot{
+		Sequences:  f.sequenceIdGen.Snapshot(),
+		Duplicates: f.logged.Snapshot(),
+	}
+	s.Clients, s.Aborted, s.Expired = f.clients.snapshot()
+
+	members, err := f.members.snapshot()
+	if err != nil {
+		f.log.Errorf("%s: %s", errors.FailedToSnapshot.Error(), err)
+		return
+	}
+	s.Members = members
+
+	if f.state != nil {
+		state, err := f.state.Snapshot()
+		if err != nil {
+			f.log.Errorf("%s: %s", errors.FailedToSnapshot.Error(), err)
+			return
+		}
+		s.Node = state
+	}
+
+	if err := f.recovery.SaveSnapshot(s); err != nil {
+		f.log.Errorf("%s: %s", errors.FailedToSnapshot.Error(), err)
+		return
+	}
+
+	f.sinceSnapshot = 0
+	f.log.Debugf("Snapshot saved")
+}
+
+// loadSnapshot reads the last snapshot, if any, to be restored once the node recovers.
+// The recovery log gets truncated with every snapshot, so the node cannot be recovered without it.
+func (f *Worker) loadSnapshot() error {
+	s, err := f.recovery.LoadSnapshot()
+	if err != nil {
+		return fmt.Errorf("%w: %w", errors.FailedToRestore, err)
+	}
+
+	f.loaded = s
+	return nil
+}
+
+// restore restores the snapshot loaded on Init, if any, before the recovery log gets replayed.
+// If the state of the node cannot be restored, the worker refuses to start.
+func (f *Worker) restore() {
+	s := f.loaded
+	f.loaded = nil
+	if s == nil {
+		return
+	}
+
+	f.sequenceIdGen.Restore(s.Sequences)
+	f.dup.Restore(s.Duplicates)
+	f.logged.Restore(s.Duplicates)
+	f.clients.restore(s.Clients, s.Aborted, s.Expired)
+	if err := f.members.restore(s.Members); err != nil {
+		f.restoreErr = fmt.Errorf("%w: %w", errors.FailedToRestore, err)
+		return
+	}
+
+	if f.state != nil && s.Node != nil {
+		if err := f.state.Restore(s.Node); err != nil {
+			f.restoreErr = fmt.Errorf("%w: %w", errors.FailedToRestore, err)
+			return
+		}
+	}
+
+	f.log.Infof("Restored snapshot %d", s.Generation)
+}
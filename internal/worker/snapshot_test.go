@@ -0,0 +1,48 @@
+package worker
+
+import (
+	"errors"
+	"testing"
+
+	"tp1/pkg/dup"
+	"tp1/pkg/logs"
+	"tp1/pkg/recovery"
+	"tp1/pkg/sequence"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// brokenState fails to restore any state.
+type brokenState struct{}
+
+func (brokenState) Snapshot() ([]byte, error) { return nil, nil }
+
+func (brokenState) Restore([]byte) error { return errors.New("unexpected EOF") }
+
+func newSnapshotWorker(state Snapshotter, loaded *recovery.Snapshot) *Worker {
+	return &Worker{
+		state:         state,
+		loaded:        loaded,
+		sequenceIdGen: sequence.NewGenerator(),
+		dup:           dup.NewHandler(),
+		logged:        dup.NewHandler(),
+		clients:       newClients(0),
+		members:       newStaticMembers(1, 0),
+		log:           logs.With(logs.Node, "node"),
+	}
+}
+
+func TestRestoreFailureStopsTheWorkerFromStarting(t *testing.T) {
+	f := newSnapshotWorker(brokenState{}, &recovery.Snapshot{Generation: 2, Node: []byte("state")})
+
+	f.restore()
+	assert.Error(t, f.restoreErr)
+	assert.Nil(t, f.loaded)
+}
+
+func TestRestoreWithoutSnapshot(t *testing.T) {
+	f := newSnapshotWorker(brokenState{}, nil)
+
+	f.restore()
+	assert.NoError(t, f.restoreErr)
+}
@@ -8,6 +8,7 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"tp1/internal/errors"
 	"tp1/pkg/amqp"
@@ -16,9 +17,12 @@ import (
 	"tp1/pkg/config/provider"
 	"tp1/pkg/dup"
 	"tp1/pkg/logs"
+	"tp1/pkg/membership"
 	"tp1/pkg/message"
 	"tp1/pkg/recovery"
 	"tp1/pkg/sequence"
+	"tp1/pkg/tracing"
+	ioutils "tp1/pkg/utils/io"
 )
 
 const (
@@ -27,6 +31,7 @@ const (
 	configPath          = "config.json"
 	logLevelKey         = "log-level"
 	defaultLogLevel     = "INFO"
+	logFormatKey        = "log-format"
 	workerIdKey         = "worker-id"
 	workerUuidKey       = "worker-uuid"
 	queryKey            = "query"
@@ -36,6 +41,28 @@ const (
 	manyConsumersSubstr = "%d"
 	exchangesKey        = "exchanges"
 	outputQKey          = "output-queues"
+	prefetchKey         = "prefetch"
+	defaultPrefetch     = 256
+	concurrencyKey      = "concurrency"
+	defaultConcurrency  = 1
+	deadLetterKey       = "dead-letter"
+	snapshotEveryKey    = "snapshot-every"
+	fsyncKey            = "fsync"
+	defaultSnapshotFreq = 10000
+	clientTTLKey        = "client-ttl-ms"
+	defaultClientTTL    = 30 * 60 * 1000
+	stageKey            = "membership.stage"
+	upstreamKey         = "membership.upstream"
+	heartbeatKey        = "membership.heartbeat-ms"
+	defaultHeartbeat    = 1000
+	memberTimeoutKey    = "membership.timeout-ms"
+	defaultTimeout      = 30000
+	settleKey           = "membership.settle-ms"
+	defaultSettle       = 3000
+	tracingKey          = "tracing"
+	processSpan         = "process"
+	shutdownTimeoutKey  = "shutdown-timeout-ms"
+	defaultShutdown     = 5000
 )
 
 type Node interface {
@@ -49,18 +76,36 @@ type Node interface {
 type Worker struct {
 	config        config.Config
 	Broker        amqp.MessageBroker
+	publisher     *trackingBroker
 	inputEof      amqp.DestinationEof
 	outputsEof    []amqp.DestinationEof
 	Outputs       []amqp.Destination
 	recovery      *recovery.Handler
 	sequenceIdGen *sequence.Generator
 	dup           *dup.Handler
+	logged        *dup.Handler // logged holds the sequence IDs of the messages saved in the recovery log.
+	state         Snapshotter
+	loaded        *recovery.Snapshot // loaded is the snapshot read on Init, until it gets restored.
+	restoreErr    error              // restoreErr is why the state of the node could not be restored, if it could not.
+	snapshotEvery int                // snapshotEvery is the amount of logged messages between snapshots. 0 disables them.
+	sinceSnapshot int
+	clients       *clients
 	Uuid          string
+	log           *logs.Entry // log attaches the UUID of the node to its records.
 	Id            uint8
-	peers         uint8
-	ExpectedEofs  uint8
+	members       *members
+	registry      *membership.Registry // registry is nil unless the `membership` section is set.
 	Query         any
 	signalChan    chan os.Signal
+	prefetch      int
+	concurrency   int
+	deadLetter    *amqp.Destination
+	deadLettered  error           // deadLettered is why the delivery being processed was dead-lettered, if it was.
+	tracer        *tracing.Tracer // tracer is nil unless the `tracing` section is set.
+	consumers     []string        // consumers are the tags the input queues are consumed with.
+	shutdown      time.Duration   // shutdown is how long draining may take once a signal is received.
+	backoff       broker.Backoff  // backoff is the one of the broker, which publishing is retried with.
+	stopping      chan struct{}   // stopping is closed once draining times out, so that the worker stops working.
 }
 
 // New initializes and returns a new instance of Worker.
@@ -72,8 +117,12 @@ func New() (*Worker, error) {
 	if err != nil {
 		return nil, err
 	}
-	_ = logs.InitLogger(cfg.String(logLevelKey, defaultLogLevel))
-	b, err := broker.NewBroker()
+	_ = logs.Init(cfg.String(logLevelKey, defaultLogLevel), cfg.String(logFormatKey, logs.TextFormat))
+	b, err := broker.NewBroker(cfg)
+	if err != nil {
+		return nil, err
+	}
+	brokerCfg, err := broker.ConfigFrom(cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -96,44 +145,115 @@ func New() (*Worker, error) {
 		return nil, err
 	}
 
-	recoveryHandler, err := recovery.NewHandler()
+	syncPolicy, err := ioutils.SyncPolicyFromConfig(cfg, fsyncKey)
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryHandler, err := recovery.NewHandler(syncPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	uuid := os.Getenv(workerUuidKey)
+	tracer, err := tracing.NewTracer(cfg, tracingKey, cfg.String(stageKey, uuid), uuid)
 	if err != nil {
 		return nil, err
 	}
 
+	members := newStaticMembers(peers, expectedEofs)
+	var registry *membership.Registry
+	if stage := cfg.String(stageKey, ""); stage != "" {
+		heartbeat := time.Duration(cfg.Int64(heartbeatKey, defaultHeartbeat)) * time.Millisecond
+		timeout := time.Duration(cfg.Int64(memberTimeoutKey, defaultTimeout)) * time.Millisecond
+		// The registry publishes on its own, so it must not use the tracking broker.
+		registry = membership.NewRegistry(b, membership.Member{Stage: stage, Id: uint8(id)}, heartbeat, timeout)
+		members = newDiscoveredMembers(registry, stage, cfg.String(upstreamKey, ""))
+	}
+
+	publisher := newTrackingBroker(b)
+
 	return &Worker{
 		config:        cfg,
 		Query:         query,
-		Broker:        b,
+		Broker:        publisher,
+		publisher:     publisher,
 		signalChan:    signalChan,
-		Uuid:          os.Getenv(workerUuidKey),
+		Uuid:          uuid,
+		log:           logs.With(logs.Node, uuid),
 		Id:            uint8(id),
 		recovery:      recoveryHandler,
 		dup:           dup.NewHandler(),
+		logged:        dup.NewHandler(),
 		sequenceIdGen: sequence.NewGenerator(),
-		peers:         peers,
-		ExpectedEofs:  expectedEofs,
+		members:       members,
+		registry:      registry,
+		tracer:        tracer,
+		prefetch:      cfg.Int(prefetchKey, defaultPrefetch),
+		concurrency:   cfg.Int(concurrencyKey, defaultConcurrency),
+		snapshotEvery: cfg.Int(snapshotEveryKey, defaultSnapshotFreq),
+		clients:       newClients(time.Duration(cfg.Int64(clientTTLKey, defaultClientTTL)) * time.Millisecond),
+		shutdown:      time.Duration(cfg.Int64(shutdownTimeoutKey, defaultShutdown)) * time.Millisecond,
+		backoff:       brokerCfg.Reconnect,
+		stopping:      make(chan struct{}),
 	}, nil
 }
 
-// Init initializes the Worker instance by setting up exchanges and queues.
+// Init initializes the Worker instance by loading the last snapshot and setting up exchanges and queues.
 func (f *Worker) Init() error {
+	if err := f.loadSnapshot(); err != nil {
+		return err
+	}
 	if err := f.initExchanges(); err != nil {
 		return err
 	}
-	return f.initQueues()
+	if err := f.initDeadLetter(); err != nil {
+		return err
+	}
+	if err := f.initQueues(); err != nil {
+		return err
+	}
+	return f.initMembership()
+}
+
+// initMembership announces the worker to the rest of the workers and discovers the members of its stage and of
+// its upstream stage, if the `membership` section is set.
+func (f *Worker) initMembership() error {
+	if f.registry == nil {
+		return nil
+	}
+
+	settle := time.Duration(f.config.Int64(settleKey, defaultSettle)) * time.Millisecond
+	if err := f.registry.Join(settle, f.members.upstream); err != nil {
+		return err
+	}
+
+	f.log.Infof("Discovered peers %v", f.registry.Members(f.members.stage))
+	return nil
 }
 
 // Start begins the main processing logic for the Worker.
 // It listens for messages from input queues, applies the provided filter logic, and processes messages.
 func (f *Worker) Start(filter Node) {
 	defer close(f.signalChan)
+	defer f.tracer.Close()
 	defer f.Broker.Close()
+	defer f.recovery.Flush() // Pending acks must be sent before the broker gets closed.
+	if f.registry != nil {
+		defer f.registry.Leave()
+	}
+
+	if f.restoreErr != nil {
+		f.log.Errorf("Refusing to start: %s", f.restoreErr.Error())
+		return
+	}
+
+	f.serveMetrics()
 
 	var inputQ []amqp.Destination
 	err := f.config.Unmarshal(inputQKey, &inputQ)
 	if err != nil {
-		logs.Logger.Errorf("error unmarshalling input-queue: %s", err.Error())
+		f.log.Errorf("error unmarshalling input-queue: %s", err.Error())
 		return
 	}
 
@@ -144,37 +264,45 @@ func (f *Worker) Start(filter Node) {
 			queueName = fmt.Sprintf(queueName, f.Id)
 		}
 		if _, err = f.Broker.QueueDeclare(queueName); err != nil {
-			logs.Logger.Errorf("error declaring queue %s: %s", queueName, err.Error())
+			f.log.Errorf("error declaring queue %s: %s", queueName, err.Error())
 		}
-		ch, err := f.Broker.Consume(queueName, "", false, false)
+		tag := f.Uuid + "-" + queueName
+		ch, err := f.Broker.Consume(queueName, tag, false, false, f.prefetch)
 		if err != nil {
-			logs.Logger.Errorf("error consuming from input-queue: %s", err.Error())
+			f.log.Errorf("error consuming from input-queue: %s", err.Error())
 			return
 		}
+		f.consumers = append(f.consumers, tag)
 		channels = append(channels, ch)
 	}
 
 	f.consume(filter, f.signalChan, channels...)
 }
 
-// Recover reads the recovery log and processes the messages.
+// Recover restores the last snapshot and then reads the recovery log and processes the messages logged after it.
+// The state of the node is saved in future snapshots, unless it is nil.
 //
 // It performs the following steps:
+// - Restore the sequence ids and the node state from the snapshot.
 // - Recover the source sequence id.
 // - Recover the destination sequence id.
+// - Track the client of the message, purging it if the message is a client abort.
 // - Send the message to the filter for processing if needed.
-func (f *Worker) Recover(ch chan<- recovery.Message) {
+func (f *Worker) Recover(state Snapshotter, ch chan<- recovery.Message) {
 	if ch != nil {
 		defer close(ch)
 	}
 
+	f.state = state
+	f.restore()
+
 	recoveryCh := make(chan recovery.Record, ChanSize)
 	go f.recovery.Recover(recoveryCh)
 
 	for record := range recoveryCh {
 		src, err := sequence.SrcFromString(record.Header().SequenceId)
 		if err != nil {
-			logs.Logger.Errorf("error getting source from sequence: %s", err.Error())
+			f.Log(record.Header()).Errorf("error getting source from sequence: %s", err.Error())
 			continue
 		}
 
@@ -186,10 +314,29 @@ func (f *Worker) Recover(ch chan<- recovery.Message) {
 			f.sequenceIdGen.RecoverId(seq)
 		}
 
+		if record.Header().MessageId == message.ClientAbortId {
+			f.clients.abort(record.Header().ClientId, time.Now())
+			f.members.unpin(record.Header().ClientId)
+		} else {
+			f.clients.touch(record.Header().ClientId, time.Now())
+			f.members.pin(record.Header().ClientId)
+		}
+
 		f.dup.RecoverSequenceId(*src)
+		f.logged.RecoverSequenceId(*src)
 	}
 }
 
+// ExpectedEofs returns the amount of EOFs the worker expects for a client before propagating its information.
+func (f *Worker) ExpectedEofs(clientId string) uint8 {
+	return f.members.pin(clientId).expectedEofs
+}
+
+// Aggregates returns whether the worker expects many EOFs by client, one from each member of its upstream stage.
+func (f *Worker) Aggregates() bool {
+	return f.members.aggregates()
+}
+
 // NextSequenceId generates and returns the next sequence ID for a given key.
 func (f *Worker) NextSequenceId(key string) uint64 {
 	return f.sequenceIdGen.NextId(key)
@@ -199,24 +346,29 @@ func (f *Worker) NextSequenceId(key string) uint64 {
 //
 // This method processes EOF messages, tracks which workers have already handled the EOF, and decides whether
 // to forward the message to the next input queue or propagate it to the output queues. If all workers have been
-// visited, the EOF message is finalized and sent to the outputs.
+// visited, the EOF message is finalized and sent to the outputs. The workers are the peers pinned for the client,
+// along with the ones the EOF carries, and the EOF goes around them in order of ID, wrapping around. Client aborts
+// are forwarded the same way, keeping their message ID.
 //
 // Parameters:
 // - msg ([]byte): The raw message containing EOF information.
 // - headers (amqp.Header): The headers associated with the message.
 // - output (...amqp.DestinationEof): A variadic parameter of EOF destinations for output queues.
 func (f *Worker) HandleEofMessage(msg []byte, headers amqp.Header, output ...amqp.DestinationEof) ([]sequence.Destination, error) {
-	workersVisited, err := message.EofFromBytes(msg)
+	round, err := message.EofRoundFromBytes(msg)
 	if err != nil {
 		return nil, err
 	}
 
-	if !workersVisited.Contains(f.Id) {
-		workersVisited = append(workersVisited, f.Id)
+	if !round.Visited.Contains(f.Id) {
+		round.Visited = append(round.Visited, f.Id)
 	}
 
-	if uint8(len(workersVisited)) < f.peers {
-		return f.sendEofToNextInput(headers, workersVisited)
+	v := f.members.around(headers.ClientId, round.Peers)
+	round.Peers = v.peers
+	next, ok := v.nextUnvisited(f.Id, round.Visited)
+	if ok && f.inputEof.Exchange != "" {
+		return f.sendEofToNextInput(headers, next, round)
 	}
 
 	return f.sendEofToOutputs(headers, output...)
@@ -230,23 +382,29 @@ func (f *Worker) HandleEofMessage(msg []byte, headers amqp.Header, output ...amq
 //
 // Parameters:
 // - headers (amqp.Header): The headers of the incoming EOF message that will be included in the forwarded message.
-// - workersVisited (message.Eof): A list of worker IDs that have already processed the EOF message.
-func (f *Worker) sendEofToNextInput(headers amqp.Header, workersVisited message.Eof) ([]sequence.Destination, error) {
-	key := fmt.Sprintf(f.inputEof.Key, f.Id+1)
+// - next (uint8): The ID of the worker the EOF message is forwarded to.
+// - round (message.EofRound): The worker IDs that have already processed the EOF message, and the ones it goes around.
+func (f *Worker) sendEofToNextInput(headers amqp.Header, next uint8, round message.EofRound) ([]sequence.Destination, error) {
+	key := fmt.Sprintf(f.inputEof.Key, next)
 	sequenceId := f.NextSequenceId(key)
 	sequenceIds := []sequence.Destination{sequence.DstNew(key, sequenceId)}
 
-	bytes, err := workersVisited.ToBytes()
+	bytes, err := round.ToBytes()
 	if err != nil {
 		return nil, err
 	}
 
-	return sequenceIds, f.Broker.Publish(
+	if err = f.Broker.Publish(
 		f.inputEof.Exchange,
 		key,
 		bytes,
-		headers.WithMessageId(message.EofId).WithSequenceId(sequence.SrcNew(f.Uuid, sequenceId)),
-	)
+		headers.WithMessageId(eofMessageId(headers)).WithSequenceId(sequence.SrcNew(f.Uuid, sequenceId)),
+	); err != nil {
+		return sequenceIds, err
+	}
+
+	eofsForwarded.Inc(strconv.Itoa(int(eofMessageId(headers))), toPeer)
+	return sequenceIds, nil
 }
 
 // sendEofToOutputs forwards an EOF message to the output queues after all workers have been visited.
@@ -273,15 +431,24 @@ func (f *Worker) sendEofToOutputs(headers amqp.Header, output ...amqp.Destinatio
 			o.Exchange,
 			o.Key,
 			amqp.EmptyEof,
-			headers.WithMessageId(message.EofId).WithSequenceId(sequence.SrcNew(f.Uuid, sequenceId)),
+			headers.WithMessageId(eofMessageId(headers)).WithSequenceId(sequence.SrcNew(f.Uuid, sequenceId)),
 		); err != nil {
 			return nil, err
 		}
+		eofsForwarded.Inc(strconv.Itoa(int(eofMessageId(headers))), toOutput)
 	}
 
 	return sequenceIds, nil
 }
 
+// eofMessageId returns the message ID an EOF gets forwarded with. Client aborts keep their own.
+func eofMessageId(headers amqp.Header) message.Id {
+	if headers.MessageId == message.ClientAbortId {
+		return message.ClientAbortId
+	}
+	return message.EofId
+}
+
 // consume listens for incoming AMQP messages and processes them using the provided filter and sequence handling logic.
 // The function utilizes a `select` loop to wait for either signal interrupts or incoming messages. Once a message is
 // received, it is processed and acknowledged. Duplicate messages are filtered using a handler for sequence IDs.
@@ -295,8 +462,21 @@ func (f *Worker) sendEofToOutputs(headers amqp.Header, output ...amqp.Destinatio
 // 1. It sets up a `select` loop that listens on the signal channel and the provided delivery channels.
 // 2. Upon receiving a signal, the worker shuts down gracefully.
 // 3. If an incoming message is received, it checks for duplicates by inspecting the sequence ID.
-// 4. Non-duplicate messages are processed by the `filter` and logged using the recovery handler.
-// 5. After processing, the message is acknowledged, and the worker continues to wait for the next message or signal.
+// 4. Non-duplicate messages are processed by the `filter` and logged using the recovery handler. Messages with an
+// invalid sequence ID are sent to the dead-letter exchange. Client aborts are handled by the worker itself, and
+// messages of aborted clients are acknowledged without being processed.
+// 5. If any publishing made while processing failed (or was not confirmed by the broker), it is retried in place
+// before the message is logged and acknowledged: see retryPublish.
+// 6. After processing, the message is acknowledged once its record is durable, and the worker continues to wait for
+// the next message or signal.
+//
+// If the node implements ConcurrentNode and `concurrency` is greater than 1, messages are prepared concurrently
+// and completed, logged and acknowledged in the order they were received.
+//
+// If the `tracing` section is set, each traced message gets a span, which its outputs are published under. The span
+// is exported once the message finishes.
+//
+// On a signal, the worker drains before returning: see drain.
 //
 // It ensures that the worker can shut down cleanly when receiving a signal and that messages are processed in order,
 // with duplicate handling based on sequence IDs.
@@ -308,10 +488,30 @@ func (f *Worker) consume(filter Node, signalChan chan os.Signal, deliveryChan ..
 		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ch)})
 	}
 
+	handle := func(delivery amqp.Delivery, header amqp.Header, src sequence.Source, span *tracing.Span) {
+		sequenceIds, msg := f.dispatch(delivery, header, func() ([]sequence.Destination, []byte) {
+			return filter.Process(delivery, header)
+		})
+		f.finish(delivery, header, src, span, sequenceIds, msg)
+	}
+
+	var p *pipeline
+	if node, ok := filter.(ConcurrentNode); ok && f.concurrency > 1 {
+		f.log.Infof("Processing up to %d messages concurrently", f.concurrency)
+		p = newPipeline(node, f.concurrency, func(j *job) {
+			sequenceIds, msg := f.dispatch(j.delivery, j.header, func() ([]sequence.Destination, []byte) {
+				return node.Complete(<-j.prepared, j.delivery, j.header)
+			})
+			f.finish(j.delivery, j.header, j.src, j.span, sequenceIds, msg)
+		})
+		handle = p.submit
+	}
+
 	for {
 		chosen, recv, ok := reflect.Select(cases)
 		if !ok || chosen == 0 { // Signal channel chosen for consumption
-			logs.Logger.Criticalf("Signal received. Shutting down...")
+			f.log.Criticalf("Signal received. Shutting down...")
+			f.drain(p)
 			return
 		}
 
@@ -319,22 +519,152 @@ func (f *Worker) consume(filter Node, signalChan chan os.Signal, deliveryChan ..
 		header := amqp.HeadersFromDelivery(delivery)
 		srcSequenceId, err := sequence.SrcFromString(header.SequenceId)
 		if err != nil {
-			logs.Logger.Errorf("error getting source sequence id: %s", err.Error())
+			f.discard(delivery, fmt.Errorf("error getting source sequence id: %w", err))
 			continue
 		}
 
-		// Node and only process non-duplicate messages
+		// Only process messages that are not duplicates.
 		if !f.dup.IsDuplicate(*srcSequenceId) {
-			sequenceIds, msg := filter.Process(delivery, header)
-
-			if err = f.recovery.Log(recovery.NewRecord(header, sequenceIds, msg)); err != nil {
-				logs.Logger.Errorf("%s: %s", errors.FailedToLog.Error(), err)
+			if header.MessageId == message.ClientAbortId || !f.clients.discards(header.ClientId) {
+				f.members.pin(header.ClientId)
+				span := f.tracer.Start(processSpan, header)
+				handle(delivery, span.Header(header), *srcSequenceId, span)
+				continue
 			}
+			f.Log(header).Debugf("Discarding message of aborted client")
 		}
+		countDelivery(header.MessageId, duplicate)
 
-		// Acknowledge all duplicate and processed messages
+		// Acknowledge duplicate messages and messages of aborted clients
 		if err = delivery.Ack(false); err != nil {
-			logs.Logger.Errorf("Failed to acknowledge message: %s", err.Error())
+			f.Log(header).Errorf("Failed to acknowledge message: %s", err.Error())
 		}
 	}
 }
+
+// finish logs a processed message using the recovery handler and acknowledges it, as soon as its record is synced
+// according to the `fsync` policy. Every `snapshot-every` logged messages, a snapshot is saved. A snapshot is also
+// saved whenever a client gets aborted or expires, so that its records are dropped from the recovery log.
+func (f *Worker) finish(delivery amqp.Delivery, header amqp.Header, src sequence.Source, span *tracing.Span, sequenceIds []sequence.Destination, msg []byte) {
+	deadLettered := f.deadLettered
+	f.deadLettered = nil
+	if err := f.publisher.reset(); err != nil && !f.retryPublish(header, err) {
+		span.Fail(err)
+		return
+	}
+	if deadLettered != nil {
+		span.Fail(deadLettered)
+	} else {
+		countDelivery(header.MessageId, processed)
+		span.Finish(outputs(sequenceIds)...)
+	}
+
+	// The message gets acknowledged once its record is durable, which may happen after finishing.
+	if err := f.recovery.Log(recovery.NewRecord(header, sequenceIds, msg), recovery.Ack(delivery)); err != nil {
+		f.Log(header).Errorf("%s: %s", errors.FailedToLog.Error(), err)
+		recovery.Ack(delivery)(nil)
+	} else {
+		f.logged.RecoverSequenceId(src)
+		f.sinceSnapshot++
+	}
+
+	purged := f.track(header)
+	if f.snapshotEvery > 0 && (purged || f.sinceSnapshot >= f.snapshotEvery) {
+		f.snapshot()
+	}
+}
+
+// dispatch handles client aborts by itself, and hands any other delivery to process.
+func (f *Worker) dispatch(delivery amqp.Delivery, header amqp.Header, process func() ([]sequence.Destination, []byte)) ([]sequence.Destination, []byte) {
+	if header.MessageId == message.ClientAbortId {
+		return f.abort(delivery, header)
+	}
+	return process()
+}
+
+// abort purges the state of an aborted client and forwards the abort like an EOF. An abort which did not visit any
+// peer yet is not forwarded if the client was already aborted, since the first abort goes through every peer.
+func (f *Worker) abort(delivery amqp.Delivery, header amqp.Header) ([]sequence.Destination, []byte) {
+	visited, err := message.EofFromBytes(delivery.Body)
+	if err != nil {
+		f.DeadLetter(delivery, fmt.Errorf("%w: %w", errors.FailedToParse, err))
+		return nil, nil
+	}
+
+	f.purge(header.ClientId)
+	if len(visited) == 0 && f.clients.isAborted(header.ClientId) {
+		return nil, nil
+	}
+
+	f.Log(header).Infof("Client aborted")
+	sequenceIds, err := f.HandleEofMessage(delivery.Body, header)
+	if err != nil {
+		f.Log(header).Errorf("%s: %s", errors.FailedToPublish.Error(), err)
+	}
+	return sequenceIds, nil
+}
+
+// track updates the lifecycle of the client of a finished message and purges the clients that expired, as per
+// `client-ttl-ms`. It returns whether any client was aborted or expired.
+func (f *Worker) track(header amqp.Header) bool {
+	now := time.Now()
+	purged := header.MessageId == message.ClientAbortId
+	if purged {
+		f.clients.abort(header.ClientId, now)
+		f.members.unpin(header.ClientId)
+	} else {
+		f.clients.touch(header.ClientId, now)
+	}
+	f.measureClient(header.ClientId, purged)
+
+	for _, clientId := range f.clients.expire(now) {
+		f.log.With(logs.ClientId, clientId).Infof("Client expired")
+		f.purge(clientId)
+		f.members.unpin(clientId)
+		f.measureClient(clientId, true)
+		purged = true
+	}
+	return purged
+}
+
+// purge drops the state the node keeps for a client, if any.
+func (f *Worker) purge(clientId string) {
+	if p, ok := f.state.(Purger); ok {
+		p.Purge(clientId)
+	}
+}
+
+// retryPublish publishes the outputs of a message that could not be published again, until they all get published.
+// The message cannot be requeued instead: processing it already changed the state of the node, and the messages
+// after it from the same upstream were let through the duplicate handler, so its redelivery would be discarded.
+// Outputs keep their sequence IDs, so the ones the broker got anyway are discarded downstream as duplicates. Retries
+// wait as the broker does between reconnections, for as long as it takes, unless the worker stops draining. Returns
+// false if the worker gave up, in which case the message is left to be redelivered once the worker restarts.
+func (f *Worker) retryPublish(header amqp.Header, cause error) bool {
+	log := f.Log(header)
+	for attempt := uint(0); cause != nil; attempt++ {
+		log.Errorf("%s: %s. Retrying", errors.FailedToPublish.Error(), cause)
+		select {
+		case <-f.stopping:
+			log.Warningf("Gave up publishing, shutting down")
+			return false
+		case <-time.After(f.backoff.Delay(attempt)):
+		}
+		cause = f.publisher.republish()
+	}
+	return true
+}
+
+// Log returns the logger of the node with the client, sequence ID and message ID of the given header attached.
+func (f *Worker) Log(header amqp.Header) *logs.Entry {
+	return f.log.With(logs.Header(header.ClientId, header.SequenceId, header.MessageId)...)
+}
+
+// outputs returns the destinations a message was published to, as recorded in its span.
+func outputs(sequenceIds []sequence.Destination) []string {
+	dsts := make([]string, 0, len(sequenceIds))
+	for _, seq := range sequenceIds {
+		dsts = append(dsts, seq.ToString())
+	}
+	return dsts
+}
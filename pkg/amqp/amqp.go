@@ -1,6 +1,8 @@
 package amqp
 
 import (
+	"errors"
+
 	"tp1/pkg/message"
 
 	amqp "github.com/rabbitmq/amqp091-go"
@@ -11,6 +13,8 @@ const (
 	OriginIdHeader   = "x-origin-id"
 	ClientIdHeader   = "x-client-id"
 	SequenceIdHeader = "x-sequence-id"
+	TraceIdHeader    = "x-trace-id"
+	SpanIdHeader     = "x-span-id"
 )
 
 const (
@@ -25,6 +29,11 @@ const (
 
 var EmptyEof, _ = message.Eof{}.ToBytes() // EmptyEof represents a serialized EOF message with no content.
 
+var (
+	ErrUnroutable = errors.New("message returned by the broker as unroutable")
+	ErrNacked     = errors.New("message negatively acknowledged by the broker")
+)
+
 type Delivery = amqp.Delivery
 type Publishing = amqp.Publishing
 type Queue amqp.Queue
@@ -55,12 +64,35 @@ type Destination struct {
 	Single    bool   `json:"single"`
 }
 
+// Message represents a single publishing, used to publish many messages at once.
+type Message struct {
+	Exchange string
+	Key      string
+	Body     []byte
+	Header   Header
+	Headers  map[string]any // Headers, if set, are sent as is instead of Header. Used to forward deliveries untouched.
+}
+
+// Table returns the headers to be sent along with the message.
+func (m Message) Table() map[string]any {
+	if m.Headers != nil {
+		return m.Headers
+	}
+	return m.Header.ToMap()
+}
+
 type MessageBroker interface {
 	QueueDeclare(name ...string) ([]Queue, error)
 	ExchangeDeclare(exchange ...Exchange) error
 	QueueBind(binds ...QueueBind) error
 	ExchangeBind(dst, key, src string) error
 	Publish(exchange, key string, msg []byte, headers Header) error
-	Consume(queue, consumer string, autoAck, exclusive bool) (<-chan Delivery, error)
+	PublishBatch(msgs ...Message) error
+	// Consume starts consuming from a queue. Field prefetch limits the amount of unacknowledged deliveries
+	// the consumer may hold at once. A value of 0 means no limit.
+	Consume(queue, consumer string, autoAck, exclusive bool, prefetch int) (<-chan Delivery, error)
+	// Cancel stops a consumer started with a non-empty consumer tag, closing its delivery channel. Deliveries
+	// it already received may still be acknowledged.
+	Cancel(consumer string) error
 	Close()
 }
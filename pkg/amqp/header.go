@@ -25,6 +25,8 @@ type Header struct {
 	ClientId   string
 	OriginId   uint8
 	MessageId  message.Id
+	TraceId    string // TraceId identifies the client batch the message comes from. Empty if it is not traced.
+	SpanId     string // SpanId identifies the span of the node which published the message.
 }
 
 // HeadersFromDelivery creates a new Header from a Delivery.
@@ -39,11 +41,16 @@ func HeadersFromDelivery(delivery Delivery) Header {
 		sequenceId = "0-0"
 	}
 
+	traceId, _ := delivery.Headers[TraceIdHeader].(string)
+	spanId, _ := delivery.Headers[SpanIdHeader].(string)
+
 	return Header{
 		MessageId:  message.Id(delivery.Headers[MessageIdHeader].(uint8)),
 		OriginId:   originId.(uint8),
 		ClientId:   delivery.Headers[ClientIdHeader].(string),
 		SequenceId: sequenceId.(string),
+		TraceId:    traceId,
+		SpanId:     spanId,
 	}
 }
 
@@ -89,14 +96,26 @@ func (h Header) WithMessageId(messageId message.Id) Header {
 	return h
 }
 
-// ToMap turns the Header into a delivery ready map.
+// WithSpan sets the trace and the span a message is published under and returns the updated Header.
+func (h Header) WithSpan(traceId, spanId string) Header {
+	h.TraceId = traceId
+	h.SpanId = spanId
+	return h
+}
+
+// ToMap turns the Header into a delivery ready map. The trace headers are left out if the message is not traced.
 func (h Header) ToMap() map[string]any {
-	return map[string]any{
+	m := map[string]any{
 		SequenceIdHeader: h.SequenceId,
 		ClientIdHeader:   h.ClientId,
 		OriginIdHeader:   h.OriginId,
 		MessageIdHeader:  uint8(h.MessageId),
 	}
+	if h.TraceId != "" {
+		m[TraceIdHeader] = h.TraceId
+		m[SpanIdHeader] = h.SpanId
+	}
+	return m
 }
 
 // ToString turns the Header into human-readable slice of strings.
@@ -0,0 +1,398 @@
+package memory
+
+import (
+	"fmt"
+	"sync"
+
+	"tp1/pkg/amqp"
+)
+
+type messageBroker struct {
+	server    *Server
+	confirms  bool
+	consumers []*consumer
+	unacked   map[uint64]*unacked // <deliveryTag, message>
+	nextTag   uint64
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+type unacked struct {
+	tag      uint64
+	queue    *queue
+	msg      *envelope
+	consumer *consumer
+}
+
+type consumer struct {
+	tag         string
+	queue       *queue
+	autoAck     bool
+	prefetch    int
+	outstanding int // outstanding is the amount of deliveries pending acknowledgement.
+	deliveries  chan amqp.Delivery
+	done        chan struct{}
+	stopped     chan struct{} // stopped is closed once the consumer stops delivering.
+	closed      bool
+}
+
+// QueueDeclare declares new queues given their names. Declaring an existing queue is a no-op.
+func (b *messageBroker) QueueDeclare(names ...string) ([]amqp.Queue, error) {
+	b.server.mu.Lock()
+	defer b.server.mu.Unlock()
+
+	if b.closed {
+		return nil, errClosed
+	}
+
+	queues := make([]amqp.Queue, 0, len(names))
+	for _, n := range names {
+		q, ok := b.server.queues[n]
+		if !ok {
+			q = &queue{name: n}
+			q.cond = sync.NewCond(&b.server.mu)
+			b.server.queues[n] = q
+		}
+		queues = append(queues, q.toQueue())
+	}
+
+	return queues, nil
+}
+
+// ExchangeDeclare declares new exchanges. Only direct and fanout exchanges are supported.
+func (b *messageBroker) ExchangeDeclare(exchanges ...amqp.Exchange) error {
+	b.server.mu.Lock()
+	defer b.server.mu.Unlock()
+
+	if b.closed {
+		return errClosed
+	}
+
+	for _, ex := range exchanges {
+		if ex.Kind != directKind && ex.Kind != fanoutKind {
+			return errUnsupportedKind(ex.Kind)
+		}
+
+		if declared, ok := b.server.exchanges[ex.Name]; ok {
+			if declared.kind != ex.Kind {
+				return errKindMismatch(ex.Name, declared.kind, ex.Kind)
+			}
+			continue
+		}
+
+		b.server.exchanges[ex.Name] = &exchange{kind: ex.Kind}
+	}
+
+	return nil
+}
+
+// QueueBind binds queues to their respective exchanges.
+func (b *messageBroker) QueueBind(binds ...amqp.QueueBind) error {
+	b.server.mu.Lock()
+	defer b.server.mu.Unlock()
+
+	if b.closed {
+		return errClosed
+	}
+
+	for _, bind := range binds {
+		ex, ok := b.server.exchanges[bind.Exchange]
+		if !ok {
+			return errUnknownExchange(bind.Exchange)
+		}
+		if _, ok = b.server.queues[bind.Name]; !ok {
+			return errUnknownQueue(bind.Name)
+		}
+
+		ex.queues = appendBinding(ex.queues, binding{key: bind.Key, dst: bind.Name})
+	}
+
+	return nil
+}
+
+// ExchangeBind binds an exchange to another exchange
+func (b *messageBroker) ExchangeBind(dst, key, src string) error {
+	b.server.mu.Lock()
+	defer b.server.mu.Unlock()
+
+	if b.closed {
+		return errClosed
+	}
+
+	ex, ok := b.server.exchanges[src]
+	if !ok {
+		return errUnknownExchange(src)
+	}
+	if _, ok = b.server.exchanges[dst]; !ok {
+		return errUnknownExchange(dst)
+	}
+
+	ex.exchanges = appendBinding(ex.exchanges, binding{key: key, dst: dst})
+	return nil
+}
+
+// Publish sends a message to an exchange. Messages that cannot be routed to any queue are dropped,
+// unless the connection was opened in confirm mode.
+func (b *messageBroker) Publish(exchange, key string, msg []byte, headers amqp.Header) error {
+	return b.PublishBatch(amqp.Message{Exchange: exchange, Key: key, Body: msg, Header: headers})
+}
+
+// PublishBatch sends many messages, stopping at the first failure.
+func (b *messageBroker) PublishBatch(msgs ...amqp.Message) error {
+	b.server.mu.Lock()
+	defer b.server.mu.Unlock()
+
+	if b.closed {
+		return errClosed
+	}
+
+	for _, m := range msgs {
+		routed, err := b.server.route(m.Exchange, m.Key, &envelope{
+			exchange: m.Exchange,
+			key:      m.Key,
+			headers:  m.Table(),
+			body:     m.Body,
+		}, make(map[string]bool))
+		if err != nil {
+			return err
+		}
+
+		if routed == 0 && b.confirms {
+			return fmt.Errorf("%w (exchange: %s, key: %s)", amqp.ErrUnroutable, m.Exchange, m.Key)
+		}
+	}
+
+	return nil
+}
+
+// Consume starts delivering messages from a queue. The returned channel gets closed once the connection is closed.
+func (b *messageBroker) Consume(queue, consumerTag string, autoAck, exclusive bool, prefetch int) (<-chan amqp.Delivery, error) {
+	b.server.mu.Lock()
+	defer b.server.mu.Unlock()
+
+	if b.closed {
+		return nil, errClosed
+	}
+
+	q, ok := b.server.queues[queue]
+	if !ok {
+		return nil, errUnknownQueue(queue)
+	}
+	if q.exclusive || (exclusive && q.consumers > 0) {
+		return nil, errExclusiveQueue(queue)
+	}
+
+	q.consumers++
+	q.exclusive = exclusive
+
+	c := &consumer{
+		tag:        consumerTag,
+		queue:      q,
+		autoAck:    autoAck,
+		prefetch:   prefetch,
+		deliveries: make(chan amqp.Delivery),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+	b.consumers = append(b.consumers, c)
+
+	b.wg.Add(1)
+	go b.deliver(c)
+
+	return c.deliveries, nil
+}
+
+// Cancel stops delivering messages to the consumer with the given tag and closes its delivery channel. Its
+// unacknowledged deliveries stay pending until they get settled or the connection is closed.
+func (b *messageBroker) Cancel(consumerTag string) error {
+	b.server.mu.Lock()
+	var c *consumer
+	for _, candidate := range b.consumers {
+		if candidate.tag == consumerTag && !candidate.closed {
+			c = candidate
+			break
+		}
+	}
+	if c == nil {
+		b.server.mu.Unlock()
+		return errUnknownConsumer(consumerTag)
+	}
+	c.stop()
+	b.server.mu.Unlock()
+
+	<-c.stopped
+	close(c.deliveries)
+	return nil
+}
+
+// Close closes the connection. Every unacknowledged message gets requeued as redelivered.
+func (b *messageBroker) Close() {
+	b.server.mu.Lock()
+	if b.closed {
+		b.server.mu.Unlock()
+		return
+	}
+
+	b.closed = true
+	var open []*consumer // open are the consumers which were not cancelled.
+	for _, c := range b.consumers {
+		if !c.closed {
+			c.stop()
+			open = append(open, c)
+		}
+	}
+	b.server.mu.Unlock()
+
+	b.wg.Wait()
+
+	b.server.mu.Lock()
+	defer b.server.mu.Unlock()
+
+	pending := make([]*unacked, 0, len(b.unacked))
+	for _, u := range b.unacked {
+		pending = append(pending, u)
+	}
+	b.server.requeue(pending...)
+	b.unacked = make(map[uint64]*unacked)
+
+	for _, c := range open {
+		close(c.deliveries)
+	}
+}
+
+// Ack acknowledges a delivery. If multiple is true, every delivery up to tag gets acknowledged as well.
+func (b *messageBroker) Ack(tag uint64, multiple bool) error {
+	b.server.mu.Lock()
+	defer b.server.mu.Unlock()
+
+	_, err := b.settle(tag, multiple)
+	return err
+}
+
+// Nack negatively acknowledges a delivery. If requeue is true, the message is put back at the head of its queue.
+func (b *messageBroker) Nack(tag uint64, multiple bool, requeue bool) error {
+	b.server.mu.Lock()
+	defer b.server.mu.Unlock()
+
+	settled, err := b.settle(tag, multiple)
+	if err != nil {
+		return err
+	}
+
+	if requeue {
+		b.server.requeue(settled...)
+	}
+	return nil
+}
+
+// Reject negatively acknowledges a single delivery.
+func (b *messageBroker) Reject(tag uint64, requeue bool) error {
+	return b.Nack(tag, false, requeue)
+}
+
+// settle removes deliveries from the unacknowledged set. Must be called with the lock held.
+func (b *messageBroker) settle(tag uint64, multiple bool) ([]*unacked, error) {
+	if b.closed {
+		return nil, errClosed
+	}
+
+	u, ok := b.unacked[tag]
+	if !ok {
+		return nil, errUnknownDelivery
+	}
+
+	settled := []*unacked{u}
+	if multiple {
+		settled = settled[:0]
+		for t, u := range b.unacked {
+			if t <= tag {
+				settled = append(settled, u)
+			}
+		}
+	}
+
+	for _, u := range settled {
+		delete(b.unacked, u.tag)
+		u.consumer.outstanding--
+		u.queue.cond.Broadcast()
+	}
+	return settled, nil
+}
+
+// deliver pops messages from the consumer's queue and pushes them through its delivery channel.
+func (b *messageBroker) deliver(c *consumer) {
+	defer b.wg.Done()
+	defer close(c.stopped)
+
+	for {
+		b.server.mu.Lock()
+		for (len(c.queue.messages) == 0 || c.full()) && !c.closed {
+			c.queue.cond.Wait()
+		}
+		if c.closed {
+			b.server.mu.Unlock()
+			return
+		}
+
+		msg := c.queue.messages[0]
+		c.queue.messages = c.queue.messages[1:]
+		b.nextTag++
+		tag := b.nextTag
+		if !c.autoAck {
+			b.unacked[tag] = &unacked{tag: tag, queue: c.queue, msg: msg, consumer: c}
+			c.outstanding++
+		}
+		b.server.mu.Unlock()
+
+		select {
+		case c.deliveries <- b.toDelivery(c, tag, msg):
+		case <-c.done:
+			// The message never reached the consumer, so it goes back untouched.
+			b.server.mu.Lock()
+			if _, ok := b.unacked[tag]; ok {
+				delete(b.unacked, tag)
+				c.outstanding--
+			}
+			c.queue.messages = append([]*envelope{msg}, c.queue.messages...)
+			b.server.mu.Unlock()
+			return
+		}
+	}
+}
+
+func (b *messageBroker) toDelivery(c *consumer, tag uint64, msg *envelope) amqp.Delivery {
+	return amqp.Delivery{
+		Acknowledger: b,
+		Headers:      msg.headers,
+		ContentType:  contentType,
+		ConsumerTag:  c.tag,
+		DeliveryTag:  tag,
+		Redelivered:  msg.redelivered,
+		Exchange:     msg.exchange,
+		RoutingKey:   msg.key,
+		Body:         msg.body,
+	}
+}
+
+// stop makes the consumer stop delivering and leave its queue. Must be called with the lock held.
+func (c *consumer) stop() {
+	c.closed = true
+	close(c.done)
+	c.queue.consumers--
+	c.queue.exclusive = false
+	c.queue.cond.Broadcast()
+}
+
+// full returns whether the consumer reached its prefetch count. Must be called with the lock held.
+func (c *consumer) full() bool {
+	return c.prefetch > 0 && c.outstanding >= c.prefetch
+}
+
+func appendBinding(bindings []binding, b binding) []binding {
+	for _, existing := range bindings {
+		if existing == b {
+			return bindings
+		}
+	}
+	return append(bindings, b)
+}
@@ -0,0 +1,365 @@
+package memory
+
+import (
+	"testing"
+	"time"
+
+	"tp1/pkg/amqp"
+	"tp1/pkg/message"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const timeout = time.Second
+
+func receive(t *testing.T, ch <-chan amqp.Delivery) amqp.Delivery {
+	t.Helper()
+	select {
+	case d, ok := <-ch:
+		assert.True(t, ok, "delivery channel should be open")
+		return d
+	case <-time.After(timeout):
+		t.Fatal("timed out waiting for delivery")
+		return amqp.Delivery{}
+	}
+}
+
+func assertEmpty(t *testing.T, ch <-chan amqp.Delivery) {
+	t.Helper()
+	select {
+	case d := <-ch:
+		t.Fatalf("unexpected delivery: %s", string(d.Body))
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func newDirectSetup(t *testing.T) (*Server, amqp.MessageBroker) {
+	s := NewServer()
+	b := s.NewBroker()
+
+	assert.NoError(t, b.ExchangeDeclare(amqp.Exchange{Name: "action", Kind: "direct"}))
+	_, err := b.QueueDeclare("games_action_0", "games_action_1")
+	assert.NoError(t, err)
+	assert.NoError(t, b.QueueBind(
+		amqp.QueueBind{Exchange: "action", Name: "games_action_0", Key: "input-0"},
+		amqp.QueueBind{Exchange: "action", Name: "games_action_1", Key: "input-1"},
+	))
+
+	return s, b
+}
+
+func TestDirectExchangeRoutesByKey(t *testing.T) {
+	s, b := newDirectSetup(t)
+	defer b.Close()
+
+	assert.NoError(t, b.Publish("action", "input-1", []byte("game"), amqp.Header{ClientId: "0-0"}))
+
+	assert.Equal(t, 0, s.Messages("games_action_0"))
+	assert.Equal(t, 1, s.Messages("games_action_1"))
+}
+
+func TestFanoutExchangeRoutesToEveryQueue(t *testing.T) {
+	s := NewServer()
+	b := s.NewBroker()
+	defer b.Close()
+
+	assert.NoError(t, b.ExchangeDeclare(amqp.Exchange{Name: "reports", Kind: "fanout"}))
+	_, err := b.QueueDeclare("reports_0", "reports_1")
+	assert.NoError(t, err)
+	assert.NoError(t, b.QueueBind(
+		amqp.QueueBind{Exchange: "reports", Name: "reports_0", Key: "0"},
+		amqp.QueueBind{Exchange: "reports", Name: "reports_1", Key: "1"},
+	))
+
+	assert.NoError(t, b.Publish("reports", "", []byte("result"), amqp.Header{}))
+
+	assert.Equal(t, 1, s.Messages("reports_0"))
+	assert.Equal(t, 1, s.Messages("reports_1"))
+}
+
+func TestDefaultExchangeRoutesByQueueName(t *testing.T) {
+	s := NewServer()
+	b := s.NewBroker()
+	defer b.Close()
+
+	_, err := b.QueueDeclare("joined_counted")
+	assert.NoError(t, err)
+	assert.NoError(t, b.Publish("", "joined_counted", []byte("game"), amqp.Header{}))
+
+	assert.Equal(t, 1, s.Messages("joined_counted"))
+}
+
+func TestExchangeBindForwardsMessages(t *testing.T) {
+	s := NewServer()
+	b := s.NewBroker()
+	defer b.Close()
+
+	assert.NoError(t, b.ExchangeDeclare(
+		amqp.Exchange{Name: "src", Kind: "direct"},
+		amqp.Exchange{Name: "dst", Kind: "direct"},
+	))
+	_, err := b.QueueDeclare("q")
+	assert.NoError(t, err)
+	assert.NoError(t, b.QueueBind(amqp.QueueBind{Exchange: "dst", Name: "q", Key: "k"}))
+	assert.NoError(t, b.ExchangeBind("dst", "k", "src"))
+
+	assert.NoError(t, b.Publish("src", "k", []byte("msg"), amqp.Header{}))
+
+	assert.Equal(t, 1, s.Messages("q"))
+}
+
+func TestPublishToUnknownExchangeFails(t *testing.T) {
+	b := NewServer().NewBroker()
+	defer b.Close()
+
+	assert.Error(t, b.Publish("missing", "key", []byte("msg"), amqp.Header{}))
+}
+
+func TestRedeclaringExchangeWithAnotherKindFails(t *testing.T) {
+	b := NewServer().NewBroker()
+	defer b.Close()
+
+	assert.NoError(t, b.ExchangeDeclare(amqp.Exchange{Name: "action", Kind: "direct"}))
+	assert.Error(t, b.ExchangeDeclare(amqp.Exchange{Name: "action", Kind: "fanout"}))
+}
+
+func TestConsumePreservesHeaders(t *testing.T) {
+	_, b := newDirectSetup(t)
+	defer b.Close()
+
+	headers := amqp.Header{SequenceId: "uuid-3", ClientId: "0-1", OriginId: amqp.GameOriginId, MessageId: message.GameId}
+	assert.NoError(t, b.Publish("action", "input-0", []byte("game"), headers))
+
+	ch, err := b.Consume("games_action_0", "", false, false, 0)
+	assert.NoError(t, err)
+
+	d := receive(t, ch)
+	assert.Equal(t, headers, amqp.HeadersFromDelivery(d))
+	assert.Equal(t, []byte("game"), d.Body)
+	assert.Equal(t, "action", d.Exchange)
+	assert.Equal(t, "input-0", d.RoutingKey)
+	assert.False(t, d.Redelivered)
+	assert.NoError(t, d.Ack(false))
+}
+
+func TestNackWithRequeueRedeliversMessage(t *testing.T) {
+	_, b := newDirectSetup(t)
+	defer b.Close()
+
+	assert.NoError(t, b.Publish("action", "input-0", []byte("game"), amqp.Header{}))
+	ch, err := b.Consume("games_action_0", "", false, false, 0)
+	assert.NoError(t, err)
+
+	d := receive(t, ch)
+	assert.NoError(t, d.Nack(false, true))
+
+	d = receive(t, ch)
+	assert.True(t, d.Redelivered)
+	assert.Equal(t, []byte("game"), d.Body)
+	assert.NoError(t, d.Ack(false))
+}
+
+func TestNackWithoutRequeueDropsMessage(t *testing.T) {
+	s, b := newDirectSetup(t)
+	defer b.Close()
+
+	assert.NoError(t, b.Publish("action", "input-0", []byte("game"), amqp.Header{}))
+	ch, err := b.Consume("games_action_0", "", false, false, 0)
+	assert.NoError(t, err)
+
+	d := receive(t, ch)
+	assert.NoError(t, d.Reject(false))
+
+	assertEmpty(t, ch)
+	assert.Equal(t, 0, s.Messages("games_action_0"))
+}
+
+func TestAckUnknownTagFails(t *testing.T) {
+	_, b := newDirectSetup(t)
+	defer b.Close()
+
+	assert.NoError(t, b.Publish("action", "input-0", []byte("game"), amqp.Header{}))
+	ch, err := b.Consume("games_action_0", "", false, false, 0)
+	assert.NoError(t, err)
+
+	d := receive(t, ch)
+	assert.NoError(t, d.Ack(false))
+	assert.Error(t, d.Ack(false))
+}
+
+func TestAckMultiple(t *testing.T) {
+	s, b := newDirectSetup(t)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, b.Publish("action", "input-0", []byte{byte(i)}, amqp.Header{}))
+	}
+
+	ch, err := b.Consume("games_action_0", "", false, false, 0)
+	assert.NoError(t, err)
+
+	var last amqp.Delivery
+	for i := 0; i < 3; i++ {
+		last = receive(t, ch)
+	}
+	assert.NoError(t, last.Ack(true))
+
+	b.Close()
+	assert.Equal(t, 0, s.Messages("games_action_0"))
+}
+
+func TestCloseRequeuesUnackedMessagesInOrder(t *testing.T) {
+	s, b := newDirectSetup(t)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, b.Publish("action", "input-0", []byte{byte(i)}, amqp.Header{}))
+	}
+
+	ch, err := b.Consume("games_action_0", "", false, false, 0)
+	assert.NoError(t, err)
+
+	first := receive(t, ch)
+	second := receive(t, ch)
+	assert.NoError(t, first.Ack(false))
+	assert.Equal(t, []byte{1}, second.Body)
+
+	b.Close()
+	_, ok := <-ch
+	assert.False(t, ok, "delivery channel should be closed")
+	assert.Equal(t, 2, s.Messages("games_action_0"))
+
+	other := s.NewBroker()
+	defer other.Close()
+
+	ch, err = other.Consume("games_action_0", "", false, false, 0)
+	assert.NoError(t, err)
+
+	d := receive(t, ch)
+	assert.Equal(t, []byte{1}, d.Body)
+	assert.True(t, d.Redelivered)
+
+	d = receive(t, ch)
+	assert.Equal(t, []byte{2}, d.Body)
+}
+
+func TestCancelStopsDeliveringButKeepsUnackedMessages(t *testing.T) {
+	s, b := newDirectSetup(t)
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, b.Publish("action", "input-0", []byte{byte(i)}, amqp.Header{}))
+	}
+
+	ch, err := b.Consume("games_action_0", "worker-1", false, false, 0)
+	assert.NoError(t, err)
+	first := receive(t, ch)
+
+	assert.NoError(t, b.Cancel("worker-1"))
+	_, ok := <-ch
+	assert.False(t, ok, "delivery channel should be closed")
+	assert.Error(t, b.Cancel("worker-1"))
+	assert.Equal(t, 2, s.Messages("games_action_0"))
+
+	assert.NoError(t, first.Ack(false))
+	b.Close()
+	assert.Equal(t, 2, s.Messages("games_action_0"))
+}
+
+func TestAutoAckMessagesAreNotRequeued(t *testing.T) {
+	s, b := newDirectSetup(t)
+
+	assert.NoError(t, b.Publish("action", "input-0", []byte("game"), amqp.Header{}))
+	ch, err := b.Consume("games_action_0", "", true, false, 0)
+	assert.NoError(t, err)
+
+	receive(t, ch)
+	b.Close()
+
+	assert.Equal(t, 0, s.Messages("games_action_0"))
+}
+
+func TestExclusiveConsumer(t *testing.T) {
+	s, b := newDirectSetup(t)
+	defer b.Close()
+
+	_, err := b.Consume("games_action_0", "", false, true, 0)
+	assert.NoError(t, err)
+
+	other := s.NewBroker()
+	defer other.Close()
+
+	_, err = other.Consume("games_action_0", "", false, false, 0)
+	assert.Error(t, err)
+}
+
+func TestConsumersShareQueue(t *testing.T) {
+	s, b := newDirectSetup(t)
+	defer b.Close()
+	other := s.NewBroker()
+	defer other.Close()
+
+	ch1, err := b.Consume("games_action_0", "", false, false, 0)
+	assert.NoError(t, err)
+	ch2, err := other.Consume("games_action_0", "", false, false, 0)
+	assert.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		assert.NoError(t, b.Publish("action", "input-0", []byte{byte(i)}, amqp.Header{}))
+	}
+
+	received := 0
+	for received < 2 {
+		select {
+		case d := <-ch1:
+			assert.NoError(t, d.Ack(false))
+		case d := <-ch2:
+			assert.NoError(t, d.Ack(false))
+		case <-time.After(timeout):
+			t.Fatal("timed out waiting for delivery")
+		}
+		received++
+	}
+}
+
+func TestConfirmingBrokerReportsUnroutableMessages(t *testing.T) {
+	s, b := newDirectSetup(t)
+	defer b.Close()
+
+	confirming := s.NewConfirmingBroker()
+	defer confirming.Close()
+
+	assert.NoError(t, b.Publish("action", "missing", []byte("game"), amqp.Header{}))
+	assert.ErrorIs(t, confirming.Publish("action", "missing", []byte("game"), amqp.Header{}), amqp.ErrUnroutable)
+	assert.NoError(t, confirming.Publish("action", "input-0", []byte("game"), amqp.Header{}))
+}
+
+func TestPublishBatch(t *testing.T) {
+	s, b := newDirectSetup(t)
+	defer b.Close()
+
+	assert.NoError(t, b.PublishBatch(
+		amqp.Message{Exchange: "action", Key: "input-0", Body: []byte("a")},
+		amqp.Message{Exchange: "action", Key: "input-1", Body: []byte("b")},
+		amqp.Message{Exchange: "action", Key: "input-1", Body: []byte("c")},
+	))
+
+	assert.Equal(t, 1, s.Messages("games_action_0"))
+	assert.Equal(t, 2, s.Messages("games_action_1"))
+}
+
+func TestPrefetchLimitsUnackedDeliveries(t *testing.T) {
+	_, b := newDirectSetup(t)
+	defer b.Close()
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, b.Publish("action", "input-0", []byte{byte(i)}, amqp.Header{}))
+	}
+
+	ch, err := b.Consume("games_action_0", "", false, false, 2)
+	assert.NoError(t, err)
+
+	first := receive(t, ch)
+	receive(t, ch)
+	assertEmpty(t, ch)
+
+	assert.NoError(t, first.Ack(false))
+	assert.Equal(t, []byte{2}, receive(t, ch).Body)
+}
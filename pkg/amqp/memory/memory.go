@@ -0,0 +1,199 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"tp1/pkg/amqp"
+)
+
+const (
+	defaultExchange = ""
+	directKind      = "direct"
+	fanoutKind      = "fanout"
+	contentType     = "application/octet-stream"
+)
+
+var (
+	errClosed          = errors.New("broker connection is closed")
+	errUnknownDelivery = errors.New("unknown delivery tag")
+)
+
+func errUnknownExchange(name string) error {
+	return fmt.Errorf("exchange %s not found", name)
+}
+
+func errUnknownQueue(name string) error {
+	return fmt.Errorf("queue %s not found", name)
+}
+
+func errUnknownConsumer(tag string) error {
+	return fmt.Errorf("consumer %s not found", tag)
+}
+
+func errExclusiveQueue(name string) error {
+	return fmt.Errorf("queue %s is in exclusive use", name)
+}
+
+func errUnsupportedKind(kind string) error {
+	return fmt.Errorf("unsupported exchange kind: %s", kind)
+}
+
+func errKindMismatch(name, declared, requested string) error {
+	return fmt.Errorf("exchange %s already declared as %s, got %s", name, declared, requested)
+}
+
+// Server holds the exchanges, queues and bindings shared by every in-memory broker connection.
+// Queues and exchanges outlive the connections that declared them, the same way durable
+// entities outlive connections in RabbitMQ.
+type Server struct {
+	mu        sync.Mutex
+	exchanges map[string]*exchange
+	queues    map[string]*queue
+}
+
+type exchange struct {
+	kind      string
+	queues    []binding // queues bound to the exchange.
+	exchanges []binding // exchanges bound to the exchange.
+}
+
+type binding struct {
+	key string
+	dst string
+}
+
+type queue struct {
+	name      string
+	messages  []*envelope
+	cond      *sync.Cond
+	consumers int
+	exclusive bool
+}
+
+type envelope struct {
+	exchange    string
+	key         string
+	headers     map[string]any
+	body        []byte
+	redelivered bool
+}
+
+// NewServer creates an empty in-memory broker server.
+func NewServer() *Server {
+	return &Server{
+		exchanges: make(map[string]*exchange),
+		queues:    make(map[string]*queue),
+	}
+}
+
+// NewBroker opens a new connection to the server. Every connection keeps track of its own
+// delivery tags and unacknowledged messages, which get requeued once the connection is closed.
+func (s *Server) NewBroker() amqp.MessageBroker {
+	return s.newBroker(false)
+}
+
+// NewConfirmingBroker opens a new connection that behaves like a broker in confirm mode:
+// publishing a message that cannot be routed to any queue fails with amqp.ErrUnroutable.
+func (s *Server) NewConfirmingBroker() amqp.MessageBroker {
+	return s.newBroker(true)
+}
+
+func (s *Server) newBroker(confirms bool) *messageBroker {
+	return &messageBroker{
+		server:   s,
+		unacked:  make(map[uint64]*unacked),
+		confirms: confirms,
+	}
+}
+
+// Messages returns the amount of messages ready to be delivered from a queue.
+func (s *Server) Messages(name string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, ok := s.queues[name]
+	if !ok {
+		return 0
+	}
+	return len(q.messages)
+}
+
+// route delivers a message to every queue reachable from the exchange, returning the amount of queues
+// it got delivered to. Must be called with the lock held.
+func (s *Server) route(name, key string, msg *envelope, visited map[string]bool) (int, error) {
+	if name == defaultExchange {
+		if q, ok := s.queues[key]; ok {
+			s.enqueue(q, msg)
+			return 1, nil
+		}
+		return 0, nil
+	}
+
+	ex, ok := s.exchanges[name]
+	if !ok {
+		return 0, errUnknownExchange(name)
+	}
+
+	if visited[name] {
+		return 0, nil
+	}
+	visited[name] = true
+
+	routed := 0
+	for _, b := range ex.queues {
+		if ex.matches(b, key) {
+			s.enqueue(s.queues[b.dst], msg)
+			routed++
+		}
+	}
+
+	for _, b := range ex.exchanges {
+		if ex.matches(b, key) {
+			n, err := s.route(b.dst, key, msg, visited)
+			if err != nil {
+				return routed, err
+			}
+			routed += n
+		}
+	}
+
+	return routed, nil
+}
+
+// enqueue appends a copy of the message to the queue. Must be called with the lock held.
+func (s *Server) enqueue(q *queue, msg *envelope) {
+	headers := make(map[string]any, len(msg.headers))
+	for k, v := range msg.headers {
+		headers[k] = v
+	}
+
+	q.messages = append(q.messages, &envelope{
+		exchange: msg.exchange,
+		key:      msg.key,
+		headers:  headers,
+		body:     append([]byte(nil), msg.body...),
+	})
+	q.cond.Broadcast()
+}
+
+// requeue puts messages back at the head of their queues, flagged as redelivered. Must be called with the lock held.
+func (s *Server) requeue(msgs ...*unacked) {
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].tag > msgs[j].tag })
+
+	for _, u := range msgs {
+		u.msg.redelivered = true
+		u.queue.messages = append([]*envelope{u.msg}, u.queue.messages...)
+		u.queue.cond.Broadcast()
+	}
+}
+
+func (ex *exchange) matches(b binding, key string) bool {
+	return ex.kind == fanoutKind || b.key == key
+}
+
+func (q *queue) toQueue() amqp.Queue {
+	return amqp.Queue{Name: q.name, Messages: len(q.messages), Consumers: q.consumers}
+}
@@ -1,8 +1,8 @@
 package provider
 
 import (
-	"fmt"
 	"os"
+	"path/filepath"
 	"time"
 
 	"tp1/pkg/config"
@@ -14,16 +14,20 @@ type cfg struct {
 	v *viper.Viper
 }
 
-// LoadConfig loads a provider with the specified files and local configuration.
-func LoadConfig(filepath string) (config.Config, error) {
-	wd, err := os.Getwd()
-	if err != nil {
-		return nil, err
+// LoadConfig loads a provider with the specified files and local configuration. Relative paths are resolved from
+// the working directory.
+func LoadConfig(path string) (config.Config, error) {
+	if !filepath.IsAbs(path) {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(wd, path)
 	}
 
 	v := viper.New()
 
-	v.SetConfigFile(fmt.Sprintf("%s/%s", wd, filepath))
+	v.SetConfigFile(path)
 	if err := v.ReadInConfig(); err != nil {
 		return nil, err
 	}
@@ -0,0 +1,114 @@
+package dlq
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"tp1/pkg/amqp"
+	"tp1/pkg/sequence"
+)
+
+const (
+	ReasonHeader    = "x-dead-letter-reason"
+	NodeHeader      = "x-dead-letter-node"
+	TimestampHeader = "x-dead-letter-timestamp"
+	ExchangeHeader  = "x-original-exchange"
+	KeyHeader       = "x-original-routing-key"
+	ReplayedHeader  = "x-replayed"
+
+	replayPrefix = "replay~" // replayPrefix is followed by the time a replay run started.
+
+	Kind = "fanout"
+)
+
+var ErrNotDeadLettered = errors.New("delivery was not dead-lettered")
+
+// Entry represents a dead-lettered message.
+type Entry struct {
+	Reason    string
+	Node      string
+	Timestamp time.Time
+	Exchange  string // Exchange the message was originally published to.
+	Key       string // Key the message was originally published with.
+	Headers   map[string]any
+	Body      []byte
+}
+
+// Wrap builds the message that dead-letters a delivery. Its headers are preserved, and the failure reason,
+// the UUID of the node that failed to process it and the current time are added, along with the exchange
+// and key it was originally published to.
+func Wrap(delivery amqp.Delivery, dst amqp.Destination, node string, cause error) amqp.Message {
+	headers := make(map[string]any, len(delivery.Headers)+5)
+	for k, v := range delivery.Headers {
+		headers[k] = v
+	}
+
+	headers[ReasonHeader] = cause.Error()
+	headers[NodeHeader] = node
+	headers[TimestampHeader] = time.Now().UTC()
+	headers[ExchangeHeader] = delivery.Exchange
+	headers[KeyHeader] = delivery.RoutingKey
+	delete(headers, ReplayedHeader)
+
+	return amqp.Message{Exchange: dst.Exchange, Key: dst.Key, Body: delivery.Body, Headers: headers}
+}
+
+// EntryFromDelivery parses a delivery consumed from a dead-letter queue.
+func EntryFromDelivery(delivery amqp.Delivery) (Entry, error) {
+	exchange, ok := delivery.Headers[ExchangeHeader].(string)
+	if !ok {
+		return Entry{}, ErrNotDeadLettered
+	}
+
+	key, _ := delivery.Headers[KeyHeader].(string)
+	reason, _ := delivery.Headers[ReasonHeader].(string)
+	node, _ := delivery.Headers[NodeHeader].(string)
+	timestamp, _ := delivery.Headers[TimestampHeader].(time.Time)
+
+	headers := make(map[string]any, len(delivery.Headers))
+	for k, v := range delivery.Headers {
+		headers[k] = v
+	}
+	for _, k := range []string{ReasonHeader, NodeHeader, TimestampHeader, ExchangeHeader, KeyHeader} {
+		delete(headers, k)
+	}
+
+	return Entry{
+		Reason:    reason,
+		Node:      node,
+		Timestamp: timestamp,
+		Exchange:  exchange,
+		Key:       key,
+		Headers:   headers,
+		Body:      delivery.Body,
+	}, nil
+}
+
+// ReplaySource returns the UUID of the sequence source of a new replay run. The nodes already saw the sequence IDs
+// of the messages, so they are replayed from a source of their own.
+func ReplaySource() string {
+	return fmt.Sprintf("%s%d", replayPrefix, time.Now().UnixNano())
+}
+
+// Replay builds the message that sends the entry back to where it was originally published, flagged as replayed,
+// with the sequence ID given. A run replays its messages in order from a single source with increasing IDs, so nodes
+// keep one expected ID per run.
+func (e Entry) Replay(seq sequence.Source) amqp.Message {
+	headers := make(map[string]any, len(e.Headers)+1)
+	for k, v := range e.Headers {
+		headers[k] = v
+	}
+	headers[amqp.SequenceIdHeader] = seq.ToString()
+	headers[ReplayedHeader] = true
+
+	return amqp.Message{Exchange: e.Exchange, Key: e.Key, Body: e.Body, Headers: headers}
+}
+
+// String turns the entry into a human-readable summary.
+func (e Entry) String() string {
+	return fmt.Sprintf(
+		"[%s] node: %s, exchange: %q, key: %q, headers: %v, size: %d bytes, reason: %s",
+		e.Timestamp.Format(time.RFC3339), e.Node, e.Exchange, e.Key, e.Headers, len(e.Body), e.Reason,
+	)
+}
@@ -0,0 +1,65 @@
+package dlq
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"tp1/pkg/amqp"
+	"tp1/pkg/message"
+	"tp1/pkg/sequence"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrapPreservesHeaders(t *testing.T) {
+	headers := amqp.Header{SequenceId: "uuid-3", ClientId: "0-1", OriginId: amqp.GameOriginId, MessageId: message.GameId}
+	delivery := amqp.Delivery{Exchange: "action", RoutingKey: "input-0", Headers: headers.ToMap(), Body: []byte("game")}
+
+	msg := Wrap(delivery, amqp.Destination{Exchange: "action_dlx"}, "action-1", errors.New("failed to parse message"))
+
+	assert.Equal(t, "action_dlx", msg.Exchange)
+	assert.Equal(t, []byte("game"), msg.Body)
+	assert.Equal(t, "failed to parse message", msg.Headers[ReasonHeader])
+	assert.Equal(t, "action-1", msg.Headers[NodeHeader])
+	assert.WithinDuration(t, time.Now(), msg.Headers[TimestampHeader].(time.Time), time.Second)
+	for k, v := range headers.ToMap() {
+		assert.Equal(t, v, msg.Headers[k])
+	}
+}
+
+func TestReplaySendsMessageBackToOrigin(t *testing.T) {
+	headers := amqp.Header{SequenceId: "uuid-3", ClientId: "0-1", MessageId: message.GameId}
+	delivery := amqp.Delivery{Exchange: "action", RoutingKey: "input-0", Headers: headers.ToMap(), Body: []byte("game")}
+	msg := Wrap(delivery, amqp.Destination{Exchange: "action_dlx"}, "action-1", errors.New("unexpected message"))
+
+	entry, err := EntryFromDelivery(amqp.Delivery{Headers: msg.Headers, Body: msg.Body})
+	assert.NoError(t, err)
+	assert.Equal(t, "unexpected message", entry.Reason)
+	assert.Equal(t, "action-1", entry.Node)
+
+	replay := entry.Replay(sequence.SrcNew("replay~1", 0))
+	assert.Equal(t, "action", replay.Exchange)
+	assert.Equal(t, "input-0", replay.Key)
+	assert.Equal(t, []byte("game"), replay.Body)
+	assert.NotContains(t, replay.Headers, ReasonHeader)
+	assert.NotContains(t, replay.Headers, ExchangeHeader)
+	assert.Equal(t, true, replay.Headers[ReplayedHeader])
+
+	replayed := amqp.HeadersFromDelivery(amqp.Delivery{Headers: replay.Headers})
+	assert.Equal(t, headers.WithSequenceId(sequence.SrcNew("replay~1", 0)), replayed)
+}
+
+func TestReplayRunsHaveTheirOwnSource(t *testing.T) {
+	first := ReplaySource()
+	time.Sleep(time.Millisecond)
+	assert.NotEqual(t, first, ReplaySource())
+
+	_, err := sequence.SrcFromString(sequence.SrcNew(first, 3).ToString())
+	assert.NoError(t, err)
+}
+
+func TestEntryFromRegularDeliveryFails(t *testing.T) {
+	_, err := EntryFromDelivery(amqp.Delivery{Headers: amqp.Header{}.ToMap()})
+	assert.ErrorIs(t, err, ErrNotDeadLettered)
+}
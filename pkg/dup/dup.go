@@ -1,12 +1,15 @@
 package dup
 
 import (
+	"sync"
+
 	"tp1/pkg/sequence"
 )
 
 // Handler is an implementation of the Handler interface.
 // It tracks the next expected sequence ID for each worker using a map.
 type Handler struct {
+	mu           sync.Mutex
 	dupsByWorker map[string]uint64 // dupsByWorker saves the next expected sequence ID by worker UUID.
 }
 
@@ -18,11 +21,16 @@ func NewHandler() *Handler {
 
 // RecoverSequenceId updates the next expected sequence ID for a given worker based on the provided sequence.
 func (h *Handler) RecoverSequenceId(seq sequence.Source) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	h.dupsByWorker[seq.WorkerUuid()] = seq.Id() + 1
 }
 
 // IsDuplicate determines whether the given sequence ID from a worker is a duplicate.
 func (h *Handler) IsDuplicate(seq sequence.Source) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
 	nextSequenceId := h.dupsByWorker[seq.WorkerUuid()]
 	if seq.Id() < nextSequenceId {
 		return true
@@ -32,3 +40,26 @@ func (h *Handler) IsDuplicate(seq sequence.Source) bool {
 
 	return false
 }
+
+// Snapshot returns a copy of the next expected sequence ID by worker UUID.
+func (h *Handler) Snapshot() map[string]uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ids := make(map[string]uint64, len(h.dupsByWorker))
+	for k, v := range h.dupsByWorker {
+		ids[k] = v
+	}
+	return ids
+}
+
+// Restore replaces every expected sequence ID with the ones of a snapshot.
+func (h *Handler) Restore(ids map[string]uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.dupsByWorker = make(map[string]uint64, len(ids))
+	for k, v := range ids {
+		h.dupsByWorker[k] = v
+	}
+}
@@ -0,0 +1,111 @@
+package logs
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/op/go-logging"
+)
+
+// Keys of the fields attached to records about a client, a node or a message.
+const (
+	ClientId   = "client_id"
+	Node       = "node"
+	SequenceId = "sequence_id"
+	MessageId  = "message_id"
+)
+
+// Header returns the client, sequence ID and message ID of a message's header, as fields to attach to records.
+func Header(clientId, sequenceId string, messageId any) []any {
+	return []any{ClientId, clientId, SequenceId, sequenceId, MessageId, messageId}
+}
+
+// entryLogger is the logger entries log through. Entries add a frame between the caller and the logger, which is
+// skipped so that records show the caller's file and function.
+var entryLogger = func() *logging.Logger {
+	l, _ := GetLogger("")
+	l.ExtraCalldepth = 1
+	return l
+}()
+
+type field struct {
+	key   string
+	value any
+}
+
+// fields are appended to the arguments of the records logged by an entry. As text, they render as key=value pairs
+// after the message. The JSON backend takes them out of the message and writes them as keys of the object.
+type fields []field
+
+func (fs fields) String() string {
+	var b strings.Builder
+	for _, f := range fs {
+		value := fmt.Sprint(f.value)
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+		b.WriteString(" " + f.key + "=" + value)
+	}
+	return b.String()
+}
+
+// Entry logs records with a set of fields attached, so that the context of a record is given once instead of being
+// formatted into every message. A nil entry logs records without fields.
+type Entry struct {
+	fields fields
+}
+
+// With returns an entry with the given fields attached, as alternating keys and values.
+func With(keyvals ...any) *Entry {
+	return (&Entry{}).With(keyvals...)
+}
+
+// With returns a copy of the entry with the given fields attached, as alternating keys and values. A key already
+// attached to the entry gets its value replaced.
+func (e *Entry) With(keyvals ...any) *Entry {
+	var fs fields
+	if e != nil {
+		fs = append(make(fields, 0, len(e.fields)+len(keyvals)/2), e.fields...)
+	}
+
+next:
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		key := fmt.Sprint(keyvals[i])
+		for j := range fs {
+			if fs[j].key == key {
+				fs[j].value = keyvals[i+1]
+				continue next
+			}
+		}
+		fs = append(fs, field{key: key, value: keyvals[i+1]})
+	}
+	return &Entry{fields: fs}
+}
+
+func (e *Entry) args(args []any) []any {
+	var fs fields
+	if e != nil {
+		fs = e.fields
+	}
+	return append(args[:len(args):len(args)], fs)
+}
+
+func (e *Entry) Debugf(format string, args ...any) {
+	entryLogger.Debugf(format+"%v", e.args(args)...)
+}
+
+func (e *Entry) Infof(format string, args ...any) {
+	entryLogger.Infof(format+"%v", e.args(args)...)
+}
+
+func (e *Entry) Warningf(format string, args ...any) {
+	entryLogger.Warningf(format+"%v", e.args(args)...)
+}
+
+func (e *Entry) Errorf(format string, args ...any) {
+	entryLogger.Errorf(format+"%v", e.args(args)...)
+}
+
+func (e *Entry) Criticalf(format string, args ...any) {
+	entryLogger.Criticalf(format+"%v", e.args(args)...)
+}
@@ -0,0 +1,82 @@
+package logs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/op/go-logging"
+)
+
+const timeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+// jsonBackend writes records as JSON objects, one per line: the time, level, caller and message of the record,
+// followed by the fields of the entry it was logged through, if any.
+type jsonBackend struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func newJsonBackend(w io.Writer) *jsonBackend {
+	return &jsonBackend{w: w}
+}
+
+func (b *jsonBackend) Log(level logging.Level, calldepth int, rec *logging.Record) error {
+	var fs fields
+	if n := len(rec.Args); n > 0 {
+		if f, ok := rec.Args[n-1].(fields); ok {
+			fs = f
+			rec.Args[n-1] = ""
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(`{"time":`)
+	writeValue(&buf, rec.Time.Format(timeFormat))
+	buf.WriteString(`,"level":`)
+	writeValue(&buf, level.String())
+	if pc, file, line, ok := runtime.Caller(calldepth + 1); ok {
+		buf.WriteString(`,"caller":`)
+		writeValue(&buf, fmt.Sprintf("%s:%d", filepath.Base(file), line))
+		if fn := runtime.FuncForPC(pc); fn != nil {
+			name := fn.Name()
+			buf.WriteString(`,"func":`)
+			writeValue(&buf, name[strings.LastIndex(name, ".")+1:])
+		}
+	}
+	buf.WriteString(`,"msg":`)
+	writeValue(&buf, rec.Message())
+	for _, f := range fs {
+		buf.WriteByte(',')
+		writeValue(&buf, f.key)
+		buf.WriteByte(':')
+		writeValue(&buf, f.value)
+	}
+	buf.WriteString("}\n")
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	_, err := b.w.Write(buf.Bytes())
+	return err
+}
+
+// writeValue writes a value as JSON. Errors, stringers and values that cannot be encoded are written as strings.
+func writeValue(buf *bytes.Buffer, v any) {
+	switch value := v.(type) {
+	case error:
+		v = value.Error()
+	case fmt.Stringer:
+		v = value.String()
+	}
+
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprint(v))
+	}
+	buf.Write(encoded)
+}
@@ -1,25 +1,48 @@
 package logs
 
 import (
-	"github.com/op/go-logging"
+	"fmt"
 	"os"
+
+	"github.com/op/go-logging"
 )
 
 var Logger, _ = GetLogger("")
 
-const defLevel = "INFO"
+const (
+	defLevel = "INFO"
+
+	// TextFormat writes records as colored lines of text, with their fields appended as key=value pairs.
+	TextFormat = "text"
+	// JsonFormat writes records as JSON objects, one per line, with their fields as keys of the object.
+	JsonFormat = "json"
+)
 
 // InitLogger Receives the log level to be set in go-logging as a string. This method
 // parses the string and set the level to the logger. If the level string is not
 // valid an error is returned
 func InitLogger(logLevel string) error {
-	baseBackend := logging.NewLogBackend(os.Stdout, "", 0)
-	format := logging.MustStringFormatter(
-		"%{color}%{time:2006-01-02 15:04:05.000000-07:00} %{shortfile} %{shortfunc} ▶ %{level:.5s} %{color:reset} %{message}",
-	)
-	backendFormatter := logging.NewBackendFormatter(baseBackend, format)
+	return Init(logLevel, TextFormat)
+}
+
+// Init sets the level of the logger like InitLogger, and the format records are written in: either TextFormat or
+// JsonFormat. An empty format defaults to TextFormat.
+func Init(logLevel string, logFormat string) error {
+	var backend logging.Backend
+	switch logFormat {
+	case "", TextFormat:
+		baseBackend := logging.NewLogBackend(os.Stdout, "", 0)
+		format := logging.MustStringFormatter(
+			"%{color}%{time:2006-01-02 15:04:05.000000-07:00} %{shortfile} %{shortfunc} ▶ %{level:.5s} %{color:reset} %{message}",
+		)
+		backend = logging.NewBackendFormatter(baseBackend, format)
+	case JsonFormat:
+		backend = newJsonBackend(os.Stdout)
+	default:
+		return fmt.Errorf("unknown log format %q", logFormat)
+	}
 
-	backendLeveled := logging.AddModuleLevel(backendFormatter)
+	backendLeveled := logging.AddModuleLevel(backend)
 	if logLevel == "" {
 		logLevel = defLevel
 	}
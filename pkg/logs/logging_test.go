@@ -0,0 +1,89 @@
+package logs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/op/go-logging"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func captureJson(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	backend := logging.AddModuleLevel(newJsonBackend(&buf))
+	backend.SetLevel(logging.DEBUG, "")
+	logging.SetBackend(backend)
+	t.Cleanup(func() { _ = InitLogger(defLevel) })
+	return &buf
+}
+
+func decode(t *testing.T, buf *bytes.Buffer) map[string]any {
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	return record
+}
+
+func TestEntryFieldsAreWrittenAsJsonKeys(t *testing.T) {
+	buf := captureJson(t)
+
+	entry := With(Node, "d3b07384").With(ClientId, "0-1", SequenceId, "uuid-7")
+	entry.Errorf("Failed to publish %d messages: %s", 3, errors.New("channel closed"))
+
+	record := decode(t, buf)
+	assert.Equal(t, "ERROR", record["level"])
+	assert.Equal(t, "Failed to publish 3 messages: channel closed", record["msg"])
+	assert.Equal(t, "d3b07384", record[Node])
+	assert.Equal(t, "0-1", record[ClientId])
+	assert.Equal(t, "uuid-7", record[SequenceId])
+	assert.Regexp(t, `^logging_test\.go:\d+$`, record["caller"])
+	assert.Equal(t, "TestEntryFieldsAreWrittenAsJsonKeys", record["func"])
+}
+
+func TestLoggerRecordsAreWrittenAsJson(t *testing.T) {
+	buf := captureJson(t)
+
+	Logger.Infof("Restored snapshot %d", 4)
+
+	record := decode(t, buf)
+	assert.Equal(t, "INFO", record["level"])
+	assert.Equal(t, "Restored snapshot 4", record["msg"])
+	assert.Regexp(t, `^logging_test\.go:\d+$`, record["caller"])
+}
+
+func TestWithReplacesAttachedFields(t *testing.T) {
+	entry := With(ClientId, "0-1", MessageId, 2)
+	replaced := entry.With(ClientId, "0-2")
+
+	assert.Equal(t, " client_id=0-1 message_id=2", entry.fields.String())
+	assert.Equal(t, " client_id=0-2 message_id=2", replaced.fields.String())
+}
+
+func TestHeaderFieldsNameTheMessage(t *testing.T) {
+	entry := With(Header("0-1", "uuid-7", 2)...)
+	assert.Equal(t, " client_id=0-1 sequence_id=uuid-7 message_id=2", entry.fields.String())
+}
+
+func TestNilEntryLogsWithoutFields(t *testing.T) {
+	buf := captureJson(t)
+
+	var entry *Entry
+	entry.Warningf("No dead-letter queue configured")
+	assert.Equal(t, " client_id=0-1", entry.With(ClientId, "0-1").fields.String())
+
+	record := decode(t, buf)
+	assert.Equal(t, "No dead-letter queue configured", record["msg"])
+	assert.NotContains(t, record, ClientId)
+}
+
+func TestTextFieldsAreQuotedWhenNeeded(t *testing.T) {
+	entry := With("error", "channel closed", ClientId, "")
+	assert.Equal(t, ` error="channel closed" client_id=""`, entry.fields.String())
+}
+
+func TestUnknownFormatIsRejected(t *testing.T) {
+	assert.Error(t, Init(defLevel, "xml"))
+	assert.Error(t, Init("LOUD", JsonFormat))
+}
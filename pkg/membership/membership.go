@@ -0,0 +1,246 @@
+package membership
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"tp1/pkg/amqp"
+	"tp1/pkg/logs"
+	"tp1/pkg/utils/encoding"
+)
+
+const (
+	exchange     = "membership"
+	exchangeKind = "direct"
+	queueFormat  = "membership_%s_%d"
+)
+
+// Member identifies a worker within its stage. Every worker of a stage must have a different ID.
+type Member struct {
+	Stage string
+	Id    uint8
+}
+
+// Registry announces a worker to the rest of the workers through the broker and keeps track of the live members of
+// the stages it watches. Each member announces itself every heartbeat, and is considered gone once it announces it
+// is leaving or after not announcing itself for the timeout. The timeout should outlast a restart, so that a member
+// which crashes is not considered gone.
+//
+// Announcements are ordered by the clock of the member that sent them, but the timeout is measured with the local
+// clock since they were received, so that clocks of different hosts need not agree.
+type Registry struct {
+	broker    amqp.MessageBroker
+	self      Member
+	heartbeat time.Duration
+	timeout   time.Duration
+	mu        sync.Mutex
+	members   map[string]map[uint8]lastBeat // <stage, <member id, last heartbeat>>
+	done      chan struct{}
+	wg        sync.WaitGroup
+	log       *logs.Entry
+}
+
+// lastBeat is the last announcement of a member: when it was sent, as per the member, and when it was received.
+type lastBeat struct {
+	sentAt     time.Time
+	receivedAt time.Time
+}
+
+// announcement is the body of the membership messages.
+type announcement struct {
+	member  Member
+	sentAt  time.Time
+	leaving bool
+}
+
+// NewRegistry creates a Registry for the given worker, which announces itself every heartbeat.
+func NewRegistry(broker amqp.MessageBroker, self Member, heartbeat, timeout time.Duration) *Registry {
+	return &Registry{
+		broker:    broker,
+		self:      self,
+		heartbeat: heartbeat,
+		timeout:   timeout,
+		members:   make(map[string]map[uint8]lastBeat),
+		done:      make(chan struct{}),
+		log:       logs.With(logs.Node, fmt.Sprintf("%s-%d", self.Stage, self.Id)),
+	}
+}
+
+// Join starts announcing the worker and watching the members of its own stage along with the given ones. It waits
+// for settle before returning, so that the members already running get discovered.
+func (r *Registry) Join(settle time.Duration, stages ...string) error {
+	if err := r.broker.ExchangeDeclare(amqp.Exchange{Name: exchange, Kind: exchangeKind}); err != nil {
+		return err
+	}
+
+	queue := fmt.Sprintf(queueFormat, r.self.Stage, r.self.Id)
+	if _, err := r.broker.QueueDeclare(queue); err != nil {
+		return err
+	}
+
+	binds := []amqp.QueueBind{{Exchange: exchange, Name: queue, Key: r.self.Stage}}
+	for _, stage := range stages {
+		if stage != "" && stage != r.self.Stage {
+			binds = append(binds, amqp.QueueBind{Exchange: exchange, Name: queue, Key: stage})
+		}
+	}
+	if err := r.broker.QueueBind(binds...); err != nil {
+		return err
+	}
+
+	deliveries, err := r.broker.Consume(queue, "", true, false, 0)
+	if err != nil {
+		return err
+	}
+
+	r.seen(announcement{member: r.self, sentAt: time.Now()}, time.Now())
+	if err = r.announce(false); err != nil {
+		return err
+	}
+
+	r.wg.Add(2)
+	go r.listen(deliveries)
+	go r.beat()
+
+	time.Sleep(settle)
+	return nil
+}
+
+// Leave announces that the worker is leaving and stops announcing it.
+func (r *Registry) Leave() {
+	close(r.done)
+	r.wg.Wait()
+
+	if err := r.announce(true); err != nil {
+		r.log.Errorf("Failed to announce leaving: %s", err.Error())
+	}
+}
+
+// Members returns the sorted IDs of the live members of a stage.
+func (r *Registry) Members(stage string) []uint8 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	ids := make([]uint8, 0, len(r.members[stage]))
+	for id, last := range r.members[stage] {
+		if now.Sub(last.receivedAt) <= r.timeout {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func (r *Registry) beat() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			if err := r.announce(false); err != nil {
+				r.log.Errorf("Failed to announce membership: %s", err.Error())
+			}
+		}
+	}
+}
+
+func (r *Registry) listen(deliveries <-chan amqp.Delivery) {
+	defer r.wg.Done()
+
+	for {
+		select {
+		case <-r.done:
+			return
+		case d, ok := <-deliveries:
+			if !ok {
+				return
+			}
+			a, err := decode(d.Body)
+			if err != nil {
+				r.log.Errorf("Failed to parse membership announcement: %s", err.Error())
+				continue
+			}
+			r.seen(a, time.Now())
+		}
+	}
+}
+
+// seen updates the members with an announcement received at the given time. Announcements older than the last one
+// of the member are ignored, since they may be left over in the queue from a previous run.
+func (r *Registry) seen(a announcement, receivedAt time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	members, ok := r.members[a.member.Stage]
+	if !ok {
+		members = make(map[uint8]lastBeat)
+		r.members[a.member.Stage] = members
+	}
+
+	if last, ok := members[a.member.Id]; ok && a.sentAt.Before(last.sentAt) {
+		return
+	}
+
+	if a.leaving {
+		delete(members, a.member.Id)
+		return
+	}
+	members[a.member.Id] = lastBeat{sentAt: a.sentAt, receivedAt: receivedAt}
+}
+
+func (r *Registry) announce(leaving bool) error {
+	b, err := announcement{member: r.self, sentAt: time.Now(), leaving: leaving}.encode()
+	if err != nil {
+		return err
+	}
+	return r.broker.Publish(exchange, r.self.Stage, b, amqp.Header{})
+}
+
+func (a announcement) encode() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encoding.EncodeString(&buf, a.member.Stage); err != nil {
+		return nil, err
+	}
+	if err := encoding.EncodeNumber(&buf, a.member.Id); err != nil {
+		return nil, err
+	}
+	if err := encoding.EncodeNumber(&buf, a.sentAt.UnixMilli()); err != nil {
+		return nil, err
+	}
+	if err := encoding.EncodeBool(&buf, a.leaving); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decode(b []byte) (announcement, error) {
+	var a announcement
+	var err error
+	buf := bytes.NewBuffer(b)
+
+	if a.member.Stage, err = encoding.DecodeString(buf); err != nil {
+		return a, err
+	}
+	if a.member.Id, err = encoding.DecodeUint8(buf); err != nil {
+		return a, err
+	}
+	sentAt, err := encoding.DecodeInt64(buf)
+	if err != nil {
+		return a, err
+	}
+	a.sentAt = time.UnixMilli(sentAt)
+	if a.leaving, err = encoding.DecodeBool(buf); err != nil {
+		return a, err
+	}
+	return a, nil
+}
@@ -0,0 +1,83 @@
+package membership
+
+import (
+	"testing"
+	"time"
+
+	"tp1/pkg/amqp/memory"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	heartbeat = 10 * time.Millisecond
+	timeout   = time.Second
+	settle    = 50 * time.Millisecond
+)
+
+func TestRegistryDiscoversMembers(t *testing.T) {
+	s := memory.NewServer()
+
+	filter0 := NewRegistry(s.NewBroker(), Member{Stage: "filter", Id: 0}, heartbeat, timeout)
+	filter1 := NewRegistry(s.NewBroker(), Member{Stage: "filter", Id: 1}, heartbeat, timeout)
+	agg := NewRegistry(s.NewBroker(), Member{Stage: "aggregator", Id: 0}, heartbeat, timeout)
+
+	require.NoError(t, filter0.Join(0))
+	require.NoError(t, filter1.Join(0))
+	require.NoError(t, agg.Join(settle, "filter"))
+	defer agg.Leave()
+	defer filter0.Leave()
+
+	assert.Equal(t, []uint8{0, 1}, agg.Members("filter"))
+	assert.Equal(t, []uint8{0}, agg.Members("aggregator"))
+
+	filter1.Leave()
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]uint8{0}, agg.Members("filter"))
+	}, time.Second, heartbeat)
+}
+
+func TestRegistryForgetsSilentMembers(t *testing.T) {
+	r := NewRegistry(nil, Member{Stage: "filter", Id: 0}, heartbeat, timeout)
+	now := time.Now()
+
+	r.seen(announcement{member: Member{Stage: "filter", Id: 1}, sentAt: now}, now.Add(-2*timeout))
+	r.seen(announcement{member: Member{Stage: "filter", Id: 2}, sentAt: now}, now)
+
+	assert.Equal(t, []uint8{2}, r.Members("filter"))
+}
+
+func TestRegistryDoesNotCompareClocks(t *testing.T) {
+	r := NewRegistry(nil, Member{Stage: "filter", Id: 0}, heartbeat, timeout)
+	now := time.Now()
+
+	// A member whose clock is behind is still alive, as long as it keeps announcing itself.
+	r.seen(announcement{member: Member{Stage: "filter", Id: 1}, sentAt: now.Add(-2 * timeout)}, now)
+
+	assert.Equal(t, []uint8{1}, r.Members("filter"))
+}
+
+func TestRegistryIgnoresStaleAnnouncements(t *testing.T) {
+	r := NewRegistry(nil, Member{Stage: "filter", Id: 0}, heartbeat, timeout)
+	now := time.Now()
+
+	r.seen(announcement{member: Member{Stage: "filter", Id: 1}, sentAt: now, leaving: true}, now)
+	r.seen(announcement{member: Member{Stage: "filter", Id: 1}, sentAt: now.Add(time.Millisecond)}, now)
+	r.seen(announcement{member: Member{Stage: "filter", Id: 1}, sentAt: now, leaving: true}, now)
+
+	assert.Equal(t, []uint8{1}, r.Members("filter"))
+}
+
+func TestAnnouncementEncoding(t *testing.T) {
+	a := announcement{member: Member{Stage: "filter", Id: 3}, sentAt: time.UnixMilli(1234), leaving: true}
+
+	b, err := a.encode()
+	require.NoError(t, err)
+	decoded, err := decode(b)
+	require.NoError(t, err)
+
+	assert.Equal(t, a.member, decoded.member)
+	assert.True(t, a.sentAt.Equal(decoded.sentAt))
+	assert.True(t, decoded.leaving)
+}
@@ -10,9 +10,9 @@ import (
 type DateFilteredReleases []DateFilteredRelease
 
 type DateFilteredRelease struct {
-	GameId      int64
-	GameName    string
-	AvgPlaytime int64
+	GameId      int64  `json:"game-id"`
+	GameName    string `json:"game-name"`
+	AvgPlaytime int64  `json:"avg-playtime"`
 }
 
 func (r DateFilteredReleases) ToBytes() ([]byte, error) {
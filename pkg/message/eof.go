@@ -23,7 +23,10 @@ func (m Eof) ToBytes() ([]byte, error) {
 }
 
 func EofFromBytes(b []byte) (Eof, error) {
-	buf := bytes.NewBuffer(b)
+	return readEof(bytes.NewBuffer(b))
+}
+
+func readEof(buf *bytes.Buffer) (Eof, error) {
 	var size uint8
 	if err := binary.Read(buf, binary.BigEndian, &size); err != nil {
 		return nil, err
@@ -46,3 +49,43 @@ func (m Eof) Contains(v uint8) bool {
 	}
 	return false
 }
+
+// EofRound is an EOF going around the workers of a stage: the workers it visited, followed by the ones it goes
+// around. EOFs sent by other stages carry no peers.
+type EofRound struct {
+	Visited Eof
+	Peers   []uint8
+}
+
+func (r EofRound) ToBytes() ([]byte, error) {
+	visited, err := r.Visited.ToBytes()
+	if err != nil {
+		return nil, err
+	}
+	if len(r.Peers) == 0 {
+		return visited, nil
+	}
+
+	peers, err := Eof(r.Peers).ToBytes()
+	if err != nil {
+		return nil, err
+	}
+	return append(visited, peers...), nil
+}
+
+func EofRoundFromBytes(b []byte) (EofRound, error) {
+	buf := bytes.NewBuffer(b)
+	visited, err := readEof(buf)
+	if err != nil {
+		return EofRound{}, err
+	}
+	if buf.Len() == 0 {
+		return EofRound{Visited: visited}, nil
+	}
+
+	peers, err := readEof(buf)
+	if err != nil {
+		return EofRound{}, err
+	}
+	return EofRound{Visited: visited, Peers: peers}, nil
+}
@@ -10,8 +10,8 @@ import (
 type GameNames []GameName
 
 type GameName struct {
-	GameId   int64
-	GameName string
+	GameId   int64  `json:"game-id"`
+	GameName string `json:"game-name"`
 }
 
 func GameNameFromBytes(b []byte) (GameName, error) {
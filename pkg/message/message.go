@@ -15,6 +15,7 @@ const (
 	GameReleaseId
 	PlatformId
 	GameWithPlaytimeId
+	ClientAbortId // ClientAbortId is sent in place of an EOF when a client disconnects before finishing.
 )
 
 type Id uint8
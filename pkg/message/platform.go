@@ -3,9 +3,9 @@ package message
 import "fmt"
 
 type Platform struct {
-	Windows uint
-	Linux   uint
-	Mac     uint
+	Windows uint `json:"windows"`
+	Linux   uint `json:"linux"`
+	Mac     uint `json:"mac"`
 }
 
 func (p Platform) ToBytes() ([]byte, error) {
@@ -0,0 +1,125 @@
+package message
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// Queries whose results are sent to clients.
+const (
+	Query1 uint8 = iota + 1
+	Query2
+	Query3
+	Query4
+	Query5
+)
+
+// Result is the result of a query for a client, with its rows typed by query: the platforms of Q1, the releases of Q2,
+// the reviews of Q3 and Q5 and the games of Q4.
+type Result struct {
+	Query     uint8                `json:"query"`
+	Platforms *Platform            `json:"platforms,omitempty"`
+	Releases  DateFilteredReleases `json:"releases,omitempty"`
+	Reviews   ScoredReviews        `json:"reviews,omitempty"`
+	Games     GameNames            `json:"games,omitempty"`
+}
+
+func ResultFromJSON(b []byte) (Result, error) {
+	var r Result
+	if err := json.Unmarshal(b, &r); err != nil {
+		return Result{}, err
+	}
+	if r.Query < Query1 || r.Query > Query5 {
+		return Result{}, fmt.Errorf("unknown query %d", r.Query)
+	}
+	return r, nil
+}
+
+func (r Result) ToJSON() ([]byte, error) {
+	return json.Marshal(r)
+}
+
+// Name returns the name of the query of the result, which prefixes its text.
+func (r Result) Name() string {
+	return fmt.Sprintf("Q%d", r.Query)
+}
+
+// Append adds the rows of a partial result of Q4 or Q5, which arrive in several messages, to the result.
+func (r *Result) Append(other Result) {
+	r.Reviews = append(r.Reviews, other.Reviews...)
+	r.Games = append(r.Games, other.Games...)
+}
+
+// String returns the text of the result, as written to the results file.
+func (r Result) String() string {
+	switch r.Query {
+	case Query1:
+		var p Platform
+		if r.Platforms != nil {
+			p = *r.Platforms
+		}
+		return p.ToResultString()
+	case Query2:
+		return r.Releases.ToResultString()
+	case Query3:
+		return r.Reviews.ToQ3ResultString()
+	case Query4:
+		if len(r.Games) == 0 {
+			return ToQ4ResultString("")
+		}
+		return ToQ4ResultString(r.Games.ToStringAux())
+	case Query5:
+		if len(r.Reviews) == 0 {
+			return ToQ5ResultString("")
+		}
+		return ToQ5ResultString(r.Reviews.ToStringAux())
+	}
+	return ""
+}
+
+// Records returns the rows of the result as CSV records, after a header with the names of the columns.
+func (r Result) Records() [][]string {
+	switch r.Query {
+	case Query1:
+		var p Platform
+		if r.Platforms != nil {
+			p = *r.Platforms
+		}
+		return [][]string{
+			{"windows", "linux", "mac"},
+			{formatUint(uint64(p.Windows)), formatUint(uint64(p.Linux)), formatUint(uint64(p.Mac))},
+		}
+	case Query2:
+		records := [][]string{{"game-id", "game-name", "avg-playtime"}}
+		for _, release := range r.Releases {
+			records = append(records, []string{formatInt(release.GameId), release.GameName, formatInt(release.AvgPlaytime)})
+		}
+		return records
+	case Query3, Query5:
+		votes := "positive-reviews"
+		if r.Query == Query5 {
+			votes = "negative-reviews"
+		}
+		records := [][]string{{"game-id", "game-name", votes}}
+		for _, review := range r.Reviews {
+			records = append(records, []string{formatInt(review.GameId), review.GameName, formatUint(review.Votes)})
+		}
+		return records
+	case Query4:
+		records := [][]string{{"game-id", "game-name"}}
+		for _, game := range r.Games {
+			records = append(records, []string{formatInt(game.GameId), game.GameName})
+		}
+		return records
+	}
+	return nil
+}
+
+func formatInt(n int64) string {
+	return strconv.FormatInt(n, 10)
+}
+
+func formatUint(n uint64) string {
+	return strconv.FormatUint(n, 10)
+}
@@ -12,9 +12,9 @@ import (
 type ScoredReviews []ScoredReview
 
 type ScoredReview struct {
-	GameId   int64
-	Votes    uint64
-	GameName string
+	GameId   int64  `json:"game-id"`
+	Votes    uint64 `json:"votes"`
+	GameName string `json:"game-name"`
 }
 
 func ScoredReviewFromBytes(b []byte) (ScoredReview, error) {
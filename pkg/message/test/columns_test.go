@@ -0,0 +1,49 @@
+package test_test
+
+import (
+	"testing"
+
+	"tp1/pkg/message"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ClientGamesColumns(t *testing.T) {
+	original := []message.DataCSVGames{
+		{AppID: 10, Name: "Portal", Price: 9.99, Windows: true, Mac: true, PeakCCU: -1, Genres: "Puzzle"},
+		{AppID: 20, Name: "Half-Life", Linux: true, AveragePlaytimeForever: 1 << 40},
+	}
+
+	columns, err := message.ClientGamesToColumns(original)
+	require.NoError(t, err)
+	gob, err := original[0].ToBytes()
+	require.NoError(t, err)
+	assert.Less(t, len(columns), len(gob), "both games take less than one encoded with gob")
+
+	decoded, err := message.ClientGamesFromColumns(columns)
+	require.NoError(t, err)
+	assert.Equal(t, original, decoded)
+
+	_, err = message.ClientGamesFromColumns(columns[:len(columns)-1])
+	assert.Error(t, err)
+}
+
+func Test_ClientReviewsColumns(t *testing.T) {
+	original := []message.DataCSVReviews{
+		{AppID: 10, AppName: "Portal", ReviewText: "great", ReviewScore: 1, ReviewVotes: 3},
+		{AppID: 10, AppName: "Portal", ReviewText: "", ReviewScore: -1},
+	}
+
+	columns, err := message.ClientReviewsToColumns(original)
+	require.NoError(t, err)
+	decoded, err := message.ClientReviewsFromColumns(columns)
+	require.NoError(t, err)
+	assert.Equal(t, original, decoded)
+
+	empty, err := message.ClientReviewsToColumns(nil)
+	require.NoError(t, err)
+	decoded, err = message.ClientReviewsFromColumns(empty)
+	require.NoError(t, err)
+	assert.Empty(t, decoded)
+}
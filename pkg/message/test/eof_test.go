@@ -65,3 +65,27 @@ func TestEof_Contains_False(t *testing.T) {
 	eof := message.Eof{1, 2, 3}
 	assert.False(t, eof.Contains(4))
 }
+
+func TestEofRound_ToBytes_CarriesPeers(t *testing.T) {
+	round := message.EofRound{Visited: message.Eof{1}, Peers: []uint8{0, 1, 2}}
+
+	result, err := round.ToBytes()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, 1, 3, 0, 1, 2}, result)
+
+	visited, err := message.EofFromBytes(result)
+	assert.NoError(t, err)
+	assert.Equal(t, message.Eof{1}, visited)
+}
+
+func TestEofRoundFromBytes_ValidInput(t *testing.T) {
+	result, err := message.EofRoundFromBytes([]byte{1, 1, 3, 0, 1, 2})
+	assert.NoError(t, err)
+	assert.Equal(t, message.EofRound{Visited: message.Eof{1}, Peers: []uint8{0, 1, 2}}, result)
+}
+
+func TestEofRoundFromBytes_WithoutPeers(t *testing.T) {
+	result, err := message.EofRoundFromBytes([]byte{0})
+	assert.NoError(t, err)
+	assert.Equal(t, message.EofRound{Visited: message.Eof{}}, result)
+}
@@ -0,0 +1,48 @@
+package test_test
+
+import (
+	"testing"
+
+	"tp1/pkg/message"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_ResultJSON(t *testing.T) {
+	results := []message.Result{
+		{Query: message.Query1, Platforms: &message.Platform{Windows: 10, Linux: 3, Mac: 5}},
+		{Query: message.Query2, Releases: message.DateFilteredReleases{{GameId: 10, GameName: "Portal", AvgPlaytime: 120}}},
+		{Query: message.Query5, Reviews: message.ScoredReviews{{GameId: 20, GameName: "Dota 2", Votes: 7}}},
+	}
+
+	for _, result := range results {
+		b, err := result.ToJSON()
+		require.NoError(t, err)
+
+		res, err := message.ResultFromJSON(b)
+		require.NoError(t, err)
+		assert.Equal(t, result, res)
+	}
+
+	_, err := message.ResultFromJSON([]byte(`{"query": 9}`))
+	assert.Error(t, err)
+}
+
+func Test_ResultText(t *testing.T) {
+	games := message.Result{Query: message.Query4}
+	games.Append(message.Result{Games: message.GameNames{{GameId: 10, GameName: "Portal"}}})
+	games.Append(message.Result{Games: message.GameNames{{GameId: 20, GameName: "Dota 2"}}})
+
+	assert.Equal(t, "Q4:\nJuego: [Portal], Id: [10]\nJuego: [Dota 2], Id: [20]\n", games.String())
+	assert.Equal(t, "Q5:\n", message.Result{Query: message.Query5}.String())
+	assert.Equal(t, "Q1:\nWindows: [0], Linux: [0], Mac: [0]", message.Result{Query: message.Query1}.String())
+}
+
+func Test_ResultRecords(t *testing.T) {
+	reviews := message.Result{Query: message.Query3, Reviews: message.ScoredReviews{{GameId: 10, GameName: "Portal", Votes: 7}}}
+	assert.Equal(t, [][]string{{"game-id", "game-name", "positive-reviews"}, {"10", "Portal", "7"}}, reviews.Records())
+
+	platforms := message.Result{Query: message.Query1, Platforms: &message.Platform{Windows: 10, Linux: 3, Mac: 5}}
+	assert.Equal(t, [][]string{{"windows", "linux", "mac"}, {"10", "3", "5"}}, platforms.Records())
+}
@@ -0,0 +1,139 @@
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	counterKind   = "counter"
+	gaugeKind     = "gauge"
+	histogramKind = "histogram"
+	labelSep      = "\xff"
+)
+
+// DefBuckets are the default histogram buckets, in seconds, fit for latencies from a millisecond to ten seconds.
+var DefBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// family is a metric and all of its series, one for each combination of label values.
+type family struct {
+	mu      sync.Mutex
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+	series  map[string]*series
+	fn      func() float64 // fn, if set, gives the only value of the metric when it is scraped.
+}
+
+// series holds the value of a metric for some label values. Histograms use counts and sum instead of value.
+type series struct {
+	values []string
+	value  float64
+	counts []uint64 // counts holds the observations of each bucket, without accumulating them.
+	sum    float64
+	count  uint64
+}
+
+// Counter is a metric that only goes up, such as the amount of messages processed.
+type Counter struct {
+	f *family
+}
+
+// Gauge is a metric that goes up and down, such as the size of a queue.
+type Gauge struct {
+	f *family
+}
+
+// Histogram is a metric that samples observations, such as latencies, counting them in buckets.
+type Histogram struct {
+	f *family
+}
+
+// Inc adds one to the counter with the given label values.
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds v, which must not be negative, to the counter with the given label values.
+func (c *Counter) Add(v float64, values ...string) {
+	if v < 0 {
+		panic(fmt.Sprintf("metrics: counter %s cannot decrease", c.f.name))
+	}
+	c.f.with(values, func(s *series) { s.value += v })
+}
+
+// Set sets the gauge with the given label values to v.
+func (g *Gauge) Set(v float64, values ...string) {
+	g.f.with(values, func(s *series) { s.value = v })
+}
+
+// Add adds v, which may be negative, to the gauge with the given label values.
+func (g *Gauge) Add(v float64, values ...string) {
+	g.f.with(values, func(s *series) { s.value += v })
+}
+
+// Delete drops the gauge with the given label values, so that it is no longer exposed.
+func (g *Gauge) Delete(values ...string) {
+	g.f.mu.Lock()
+	defer g.f.mu.Unlock()
+	delete(g.f.series, g.f.key(values))
+}
+
+// Observe samples v in the histogram with the given label values.
+func (h *Histogram) Observe(v float64, values ...string) {
+	h.f.with(values, func(s *series) {
+		if s.counts == nil {
+			s.counts = make([]uint64, len(h.f.buckets))
+		}
+		for i, bound := range h.f.buckets {
+			if v <= bound {
+				s.counts[i]++
+				break
+			}
+		}
+		s.sum += v
+		s.count++
+	})
+}
+
+// with calls update with the series of the given label values, creating it if needed.
+func (f *family) with(values []string, update func(*series)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	key := f.key(values)
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		f.series[key] = s
+	}
+	update(s)
+}
+
+func (f *family) key(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s has labels %v, got %d values", f.name, f.labels, len(values)))
+	}
+	return strings.Join(values, labelSep)
+}
+
+// sorted returns a copy of the series of the family, sorted by label values.
+func (f *family) sorted() []series {
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	sorted := make([]series, 0, len(keys))
+	for _, k := range keys {
+		s := *f.series[k]
+		s.counts = append([]uint64(nil), s.counts...)
+		sorted = append(sorted, s)
+	}
+	return sorted
+}
@@ -0,0 +1,232 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"tp1/pkg/logs"
+)
+
+const (
+	contentType = "text/plain; version=0.0.4; charset=utf-8"
+	path        = "/metrics"
+)
+
+// Default is the registry the package level functions register metrics in, and the one Serve exposes.
+var Default = NewRegistry()
+
+// Registry holds metrics by name and writes them in the Prometheus text format.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// NewCounter registers a counter with the given label names in the default registry.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return Default.Counter(name, help, labels...)
+}
+
+// NewGauge registers a gauge with the given label names in the default registry.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return Default.Gauge(name, help, labels...)
+}
+
+// NewHistogram registers a histogram with the given buckets and label names in the default registry.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return Default.Histogram(name, help, buckets, labels...)
+}
+
+// NewGaugeFunc registers a gauge in the default registry whose value is given by fn whenever it is scraped.
+func NewGaugeFunc(name, help string, fn func() float64) {
+	Default.GaugeFunc(name, help, fn)
+}
+
+// Counter registers a counter with the given label names. Registering a metric twice returns the same one.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	return &Counter{f: r.register(name, help, counterKind, labels, nil)}
+}
+
+// Gauge registers a gauge with the given label names. Registering a metric twice returns the same one.
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{f: r.register(name, help, gaugeKind, labels, nil)}
+}
+
+// Histogram registers a histogram with the given buckets, in increasing order, and label names. Registering a
+// metric twice returns the same one.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if !sort.Float64sAreSorted(buckets) {
+		panic(fmt.Sprintf("metrics: buckets of %s are not sorted", name))
+	}
+	return &Histogram{f: r.register(name, help, histogramKind, labels, buckets)}
+}
+
+// GaugeFunc registers a gauge without labels whose value is given by fn whenever it is scraped. fn must be safe to
+// call concurrently. Registering it again replaces fn.
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	f := r.register(name, help, gaugeKind, nil, nil)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fn = fn
+}
+
+func (r *Registry) register(name, help, kind string, labels []string, buckets []float64) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if f, ok := r.families[name]; ok {
+		if f.kind != kind || strings.Join(f.labels, labelSep) != strings.Join(labels, labelSep) {
+			panic(fmt.Sprintf("metrics: %s already registered as a %s with labels %v", name, f.kind, f.labels))
+		}
+		return f
+	}
+
+	f := &family{
+		name:    name,
+		help:    help,
+		kind:    kind,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+	r.families[name] = f
+	return f
+}
+
+// Write writes every metric of the registry in the Prometheus text format, sorted by name.
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.Unlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP writes the metrics of the registry as the response to a scrape.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	if err := r.Write(w); err != nil {
+		logs.Logger.Errorf("Failed to write metrics: %s", err.Error())
+	}
+}
+
+// Serve exposes the metrics of the default registry at /metrics of the given address, in the background.
+// An empty address disables it.
+func Serve(addr string) error {
+	if addr == "" {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(path, Default)
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			logs.Logger.Errorf("Metrics server stopped: %s", err.Error())
+		}
+	}()
+
+	logs.Logger.Infof("Serving metrics at %s%s", listener.Addr(), path)
+	return nil
+}
+
+func (f *family) write(w *bufio.Writer) {
+	f.mu.Lock()
+	fn := f.fn
+	sorted := f.sorted()
+	f.mu.Unlock()
+
+	if fn == nil && len(sorted) == 0 {
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	_, _ = fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.kind)
+
+	if fn != nil {
+		writeSample(w, f.name, nil, nil, fn())
+		return
+	}
+
+	for _, s := range sorted {
+		if f.kind != histogramKind {
+			writeSample(w, f.name, f.labels, s.values, s.value)
+			continue
+		}
+
+		labels := append(append([]string(nil), f.labels...), "le")
+		var cumulative uint64
+		for i, bound := range f.buckets {
+			if s.counts != nil {
+				cumulative += s.counts[i]
+			}
+			writeSample(w, f.name+"_bucket", labels, append(append([]string(nil), s.values...), formatFloat(bound)), float64(cumulative))
+		}
+		writeSample(w, f.name+"_bucket", labels, append(append([]string(nil), s.values...), "+Inf"), float64(s.count))
+		writeSample(w, f.name+"_sum", f.labels, s.values, s.sum)
+		writeSample(w, f.name+"_count", f.labels, s.values, float64(s.count))
+	}
+}
+
+func writeSample(w *bufio.Writer, name string, labels, values []string, v float64) {
+	_, _ = w.WriteString(name)
+	if len(labels) > 0 {
+		_ = w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				_ = w.WriteByte(',')
+			}
+			_, _ = fmt.Fprintf(w, "%s=\"%s\"", label, escapeLabel(values[i]))
+		}
+		_ = w.WriteByte('}')
+	}
+	_, _ = fmt.Fprintf(w, " %s\n", formatFloat(v))
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
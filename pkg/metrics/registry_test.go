@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func write(t *testing.T, r *Registry) string {
+	var buf bytes.Buffer
+	require.NoError(t, r.Write(&buf))
+	return buf.String()
+}
+
+func TestCountersAndGaugesAreWrittenByLabelValues(t *testing.T) {
+	r := NewRegistry()
+	deliveries := r.Counter("deliveries_total", "Deliveries handled.", "message_id", "result")
+	clients := r.Gauge("client_state_entries", "Entries kept by client.", "client_id")
+
+	deliveries.Inc("3", "processed")
+	deliveries.Add(2, "3", "processed")
+	deliveries.Inc("1", "duplicate")
+	clients.Set(10, "0-1")
+	clients.Set(4, "0-2")
+	clients.Delete("0-2")
+
+	assert.Equal(t, `# HELP client_state_entries Entries kept by client.
+# TYPE client_state_entries gauge
+client_state_entries{client_id="0-1"} 10
+# HELP deliveries_total Deliveries handled.
+# TYPE deliveries_total counter
+deliveries_total{message_id="1",result="duplicate"} 1
+deliveries_total{message_id="3",result="processed"} 3
+`, write(t, r))
+}
+
+func TestHistogramBucketsAreCumulative(t *testing.T) {
+	r := NewRegistry()
+	latency := r.Histogram("publish_seconds", "Publish latency.", []float64{0.1, 1}, "exchange")
+
+	latency.Observe(0.05, "reports")
+	latency.Observe(0.5, "reports")
+	latency.Observe(3, "reports")
+
+	assert.Equal(t, `# HELP publish_seconds Publish latency.
+# TYPE publish_seconds histogram
+publish_seconds_bucket{exchange="reports",le="0.1"} 1
+publish_seconds_bucket{exchange="reports",le="1"} 2
+publish_seconds_bucket{exchange="reports",le="+Inf"} 3
+publish_seconds_sum{exchange="reports"} 3.55
+publish_seconds_count{exchange="reports"} 3
+`, write(t, r))
+}
+
+func TestGaugeFuncIsEvaluatedOnScrape(t *testing.T) {
+	r := NewRegistry()
+	size := 1.0
+	r.GaugeFunc("log_bytes", "Log size.", func() float64 { return size })
+	size = 42
+
+	assert.Equal(t, "# HELP log_bytes Log size.\n# TYPE log_bytes gauge\nlog_bytes 42\n", write(t, r))
+}
+
+func TestMetricsWithoutSeriesAreLeftOut(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("restarts_total", "Restarts.", "node")
+	assert.Empty(t, write(t, r))
+}
+
+func TestLabelValuesAreEscaped(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("errors_total", "Errors.", "cause").Inc("bad \"quote\"\n")
+	assert.Contains(t, write(t, r), `errors_total{cause="bad \"quote\"\n"} 1`)
+}
+
+func TestRegisteringTwiceReturnsTheSameMetric(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("acks_total", "Acks.", "client_id").Inc("0-1")
+	r.Counter("acks_total", "Acks.", "client_id").Inc("0-1")
+
+	assert.Contains(t, write(t, r), `acks_total{client_id="0-1"} 2`)
+	assert.Panics(t, func() { r.Gauge("acks_total", "Acks.", "client_id") })
+}
+
+func TestWrongLabelCountPanics(t *testing.T) {
+	c := NewRegistry().Counter("batches_total", "Batches.", "client_id", "source")
+	assert.Panics(t, func() { c.Inc("0-1") })
+}
+
+func TestHandlerServesTextFormat(t *testing.T) {
+	r := NewRegistry()
+	r.Counter("batches_total", "Batches.").Inc()
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+	assert.Equal(t, contentType, rec.Header().Get("Content-Type"))
+	body, err := io.ReadAll(rec.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), "batches_total 1\n")
+}
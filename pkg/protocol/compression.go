@@ -0,0 +1,90 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// Compression is how the records of batches are compressed, agreed in the handshake: the client lists the ones it
+// accepts, by preference, and the gateway picks the first it supports.
+type Compression uint8
+
+const (
+	NoCompression Compression = iota
+	Gzip
+)
+
+// compressions are the compressions supported, by name.
+var compressions = map[string]Compression{"none": NoCompression, "gzip": Gzip}
+
+func (c Compression) String() string {
+	for name, compression := range compressions {
+		if compression == c {
+			return name
+		}
+	}
+	return fmt.Sprintf("unknown(%d)", uint8(c))
+}
+
+// ParseCompression returns the compression with the given name.
+func ParseCompression(name string) (Compression, error) {
+	if c, ok := compressions[name]; ok {
+		return c, nil
+	}
+	return 0, fmt.Errorf("unknown compression %q", name)
+}
+
+// Choose returns the first of the compressions offered that is supported, or NoCompression if none is.
+func Choose(offered []Compression) Compression {
+	for _, c := range offered {
+		if c.supported() {
+			return c
+		}
+	}
+	return NoCompression
+}
+
+func (c Compression) supported() bool {
+	return c == NoCompression || c == Gzip
+}
+
+func (c Compression) compress(data []byte) ([]byte, error) {
+	if c == NoCompression {
+		return data, nil
+	}
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decompress decompresses data, which may not grow past the largest payload of a frame, so that a corrupt batch
+// does not allocate a huge buffer.
+func (c Compression) decompress(data []byte) ([]byte, error) {
+	if c == NoCompression {
+		return data, nil
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	decompressed, err := io.ReadAll(io.LimitReader(r, maxPayloadLen+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(decompressed) > maxPayloadLen {
+		return nil, ErrPayloadTooLarge
+	}
+	return decompressed, nil
+}
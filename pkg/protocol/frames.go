@@ -0,0 +1,241 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"tp1/pkg/utils/encoding"
+)
+
+// Stream is what an Ack acknowledges.
+type Stream uint8
+
+const (
+	GamesStream Stream = iota
+	ReviewsStream
+	ResultsStream // ResultsStream acks carry no number, since results are sent one at a time.
+)
+
+// DataStreams is the amount of streams clients send batches through.
+const DataStreams = int(ResultsStream)
+
+// ErrRefused is returned when the gateway answers a Hello with an Error, which it does if it will not serve the
+// client.
+var ErrRefused = errors.New("gateway refused the session")
+
+// Handshake is what a client starts a session with: the version of the protocol it speaks, its ID if it has one,
+// and the compressions it accepts for batches, by preference.
+type Handshake struct {
+	Version      uint8
+	ClientId     string
+	Compressions []Compression
+}
+
+// Resume is where a session starts: the ID the client has to use, the compression of its batches, and the number of
+// the next batch of each data stream the gateway expects. Those are the batches following the last ones the gateway
+// published, so the client can skip the batches before them, even if it did not get their acks.
+type Resume struct {
+	ClientId    string
+	Compression Compression
+	Next        [DataStreams]uint32
+}
+
+// Batch is the payload of Games and Reviews frames. Records are encoded by the message package, in columns, and
+// compressed as agreed in the handshake. The last batch of a stream has Eof set, and may have no records.
+type Batch struct {
+	Num     uint32
+	Eof     bool
+	Records []byte
+}
+
+// UnexpectedFrame returns the error of receiving a frame of an unexpected type.
+func UnexpectedFrame(f Frame) error {
+	return fmt.Errorf("unexpected %s frame", f.Type)
+}
+
+// NewHello returns the Hello of a client with the given ID, which is empty if the client needs one assigned, and
+// the compressions it accepts, by preference.
+func NewHello(clientId string, compressions []Compression) (Frame, error) {
+	var buf bytes.Buffer
+	if err := encoding.EncodeNumber(&buf, uint8(Version)); err != nil {
+		return Frame{}, err
+	}
+	if err := encoding.EncodeString(&buf, clientId); err != nil {
+		return Frame{}, err
+	}
+	if err := encoding.EncodeNumber(&buf, uint8(len(compressions))); err != nil {
+		return Frame{}, err
+	}
+	for _, c := range compressions {
+		if err := encoding.EncodeNumber(&buf, uint8(c)); err != nil {
+			return Frame{}, err
+		}
+	}
+	return Frame{Type: Hello, Payload: buf.Bytes()}, nil
+}
+
+// ParseHello returns the handshake a Hello starts.
+func ParseHello(f Frame) (Handshake, error) {
+	var h Handshake
+	if f.Type != Hello {
+		return h, UnexpectedFrame(f)
+	}
+
+	var err error
+	buf := bytes.NewBuffer(f.Payload)
+	if h.Version, err = encoding.DecodeUint8(buf); err != nil {
+		return h, err
+	}
+	if h.Version != Version { // The rest of the Hello may differ in other versions.
+		return h, nil
+	}
+	if h.ClientId, err = encoding.DecodeString(buf); err != nil {
+		return h, err
+	}
+	count, err := encoding.DecodeUint8(buf)
+	if err != nil {
+		return h, err
+	}
+	for i := uint8(0); i < count; i++ {
+		c, err := encoding.DecodeUint8(buf)
+		if err != nil {
+			return h, err
+		}
+		h.Compressions = append(h.Compressions, Compression(c))
+	}
+	return h, nil
+}
+
+// NewWelcome returns the Welcome that lets a client start or resume its session.
+func NewWelcome(r Resume) (Frame, error) {
+	var buf bytes.Buffer
+	if err := encoding.EncodeString(&buf, r.ClientId); err != nil {
+		return Frame{}, err
+	}
+	if err := encoding.EncodeNumber(&buf, uint8(r.Compression)); err != nil {
+		return Frame{}, err
+	}
+	for _, next := range r.Next {
+		if err := encoding.EncodeNumber(&buf, next); err != nil {
+			return Frame{}, err
+		}
+	}
+	return Frame{Type: Welcome, Payload: buf.Bytes()}, nil
+}
+
+// ParseWelcome returns the resume point of a Welcome. An Error frame is returned as an error wrapping ErrRefused.
+func ParseWelcome(f Frame) (Resume, error) {
+	var r Resume
+	if f.Type == Error {
+		return r, fmt.Errorf("%w: %s", ErrRefused, f.Payload)
+	}
+	if f.Type != Welcome {
+		return r, UnexpectedFrame(f)
+	}
+
+	var err error
+	buf := bytes.NewBuffer(f.Payload)
+	if r.ClientId, err = encoding.DecodeString(buf); err != nil {
+		return r, err
+	}
+	c, err := encoding.DecodeUint8(buf)
+	if err != nil {
+		return r, err
+	}
+	if r.Compression = Compression(c); !r.Compression.supported() {
+		return r, fmt.Errorf("unsupported compression %s", r.Compression)
+	}
+	for i := range r.Next {
+		if r.Next[i], err = encoding.DecodeUint32(buf); err != nil {
+			return r, err
+		}
+	}
+	return r, nil
+}
+
+// NewBatch returns a Games or Reviews frame with the given batch, compressing its records.
+func NewBatch(t Type, b Batch, c Compression) (Frame, error) {
+	records, err := c.compress(b.Records)
+	if err != nil {
+		return Frame{}, err
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(records) + 9)
+	if err = encoding.EncodeNumber(&buf, b.Num); err != nil {
+		return Frame{}, err
+	}
+	if err = encoding.EncodeBool(&buf, b.Eof); err != nil {
+		return Frame{}, err
+	}
+	if err = encoding.EncodeNumber(&buf, uint32(len(records))); err != nil {
+		return Frame{}, err
+	}
+	buf.Write(records)
+	return Frame{Type: t, Payload: buf.Bytes()}, nil
+}
+
+// ParseBatch returns the batch of a Games or Reviews frame, decompressing its records.
+func ParseBatch(f Frame, c Compression) (Batch, error) {
+	var b Batch
+	if f.Type != Games && f.Type != Reviews {
+		return b, UnexpectedFrame(f)
+	}
+
+	var err error
+	buf := bytes.NewBuffer(f.Payload)
+	if b.Num, err = encoding.DecodeUint32(buf); err != nil {
+		return b, err
+	}
+	if b.Eof, err = encoding.DecodeBool(buf); err != nil {
+		return b, err
+	}
+	size, err := encoding.DecodeUint32(buf)
+	if err != nil {
+		return b, err
+	}
+	if int(size) != buf.Len() {
+		return b, fmt.Errorf("batch of %d bytes in %d bytes", size, buf.Len())
+	}
+
+	b.Records, err = c.decompress(buf.Bytes())
+	return b, err
+}
+
+// NewAck returns the Ack of the given batch of a stream.
+func NewAck(s Stream, num uint32) (Frame, error) {
+	var buf bytes.Buffer
+	if err := encoding.EncodeNumber(&buf, uint8(s)); err != nil {
+		return Frame{}, err
+	}
+	if err := encoding.EncodeNumber(&buf, num); err != nil {
+		return Frame{}, err
+	}
+	return Frame{Type: Ack, Payload: buf.Bytes()}, nil
+}
+
+// ParseAck returns the stream and the batch number of an Ack.
+func ParseAck(f Frame) (Stream, uint32, error) {
+	if f.Type != Ack {
+		return 0, 0, UnexpectedFrame(f)
+	}
+
+	buf := bytes.NewBuffer(f.Payload)
+	s, err := encoding.DecodeUint8(buf)
+	if err != nil {
+		return 0, 0, err
+	}
+	num, err := encoding.DecodeUint32(buf)
+	return Stream(s), num, err
+}
+
+// NewResult returns a Result frame with the given result, encoded as JSON.
+func NewResult(result []byte) Frame {
+	return Frame{Type: Result, Payload: result}
+}
+
+// NewError returns an Error frame with the given reason.
+func NewError(reason string) Frame {
+	return Frame{Type: Error, Payload: []byte(reason)}
+}
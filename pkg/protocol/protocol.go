@@ -0,0 +1,100 @@
+// Package protocol implements the protocol clients talk to the gateway with, over a single connection.
+//
+// Every frame starts with its type (1 byte) and the length of its payload (4 bytes, big endian). A connection starts
+// with a handshake: the client sends a Hello with the version it speaks, its ID if it already has one and the
+// compressions it accepts, and the gateway answers with a Welcome carrying the ID the client has to use, the
+// compression of its batches and the batches to resume from, or with an Error. Then the client sends games and
+// reviews batches, each acknowledged by the gateway with an Ack, and the gateway sends results, each acknowledged by
+// the client with an Ack, all multiplexed over the connection.
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Version is the version of the protocol implemented by this package.
+const Version = 4
+
+// Type is the type of a frame.
+type Type uint8
+
+const (
+	Hello   Type = iota + 1 // Hello starts the handshake. Sent by the client.
+	Welcome                 // Welcome completes the handshake. Sent by the gateway.
+	Games                   // Games is a batch of games. Sent by the client.
+	Reviews                 // Reviews is a batch of reviews. Sent by the client.
+	Ack                     // Ack acknowledges a batch or a result. Sent by both sides.
+	Result                  // Result is the result of a query, as JSON. Sent by the gateway.
+	Error                   // Error tells the client why the gateway is closing the connection. Sent by the gateway.
+)
+
+func (t Type) String() string {
+	switch t {
+	case Hello:
+		return "hello"
+	case Welcome:
+		return "welcome"
+	case Games:
+		return "games"
+	case Reviews:
+		return "reviews"
+	case Ack:
+		return "ack"
+	case Result:
+		return "result"
+	case Error:
+		return "error"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(t))
+	}
+}
+
+const (
+	headerLen = 5
+	// maxPayloadLen bounds the payloads read, so that a corrupt length does not allocate a huge buffer.
+	maxPayloadLen = 64 << 20
+)
+
+var ErrPayloadTooLarge = errors.New("frame payload too large")
+
+// Frame is a typed message.
+type Frame struct {
+	Type    Type
+	Payload []byte
+}
+
+// WriteFrame writes a frame in a single write, so that frames written concurrently through a synchronized writer
+// do not interleave.
+func WriteFrame(w io.Writer, f Frame) error {
+	if len(f.Payload) > maxPayloadLen {
+		return ErrPayloadTooLarge
+	}
+
+	b := make([]byte, headerLen, headerLen+len(f.Payload))
+	b[0] = byte(f.Type)
+	binary.BigEndian.PutUint32(b[1:headerLen], uint32(len(f.Payload)))
+	_, err := w.Write(append(b, f.Payload...))
+	return err
+}
+
+// ReadFrame reads the next frame.
+func ReadFrame(r io.Reader) (Frame, error) {
+	var header [headerLen]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return Frame{}, err
+	}
+
+	length := binary.BigEndian.Uint32(header[1:])
+	if length > maxPayloadLen {
+		return Frame{}, ErrPayloadTooLarge
+	}
+
+	f := Frame{Type: Type(header[0]), Payload: make([]byte, length)}
+	if _, err := io.ReadFull(r, f.Payload); err != nil {
+		return Frame{}, err
+	}
+	return f, nil
+}
@@ -0,0 +1,88 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func roundTrip(t *testing.T, f Frame) Frame {
+	var buf bytes.Buffer
+	require.NoError(t, WriteFrame(&buf, f))
+	read, err := ReadFrame(&buf)
+	require.NoError(t, err)
+	assert.Zero(t, buf.Len())
+	return read
+}
+
+func TestHandshakeFrames(t *testing.T) {
+	hello, err := NewHello("0-4", []Compression{Gzip, NoCompression})
+	require.NoError(t, err)
+	h, err := ParseHello(roundTrip(t, hello))
+	require.NoError(t, err)
+	assert.Equal(t, Handshake{Version: Version, ClientId: "0-4", Compressions: []Compression{Gzip, NoCompression}}, h)
+	assert.Equal(t, Gzip, Choose(h.Compressions))
+	assert.Equal(t, NoCompression, Choose([]Compression{7}))
+
+	resume := Resume{ClientId: "1-7", Compression: Gzip, Next: [DataStreams]uint32{GamesStream: 3, ReviewsStream: 12}}
+	welcome, err := NewWelcome(resume)
+	require.NoError(t, err)
+	parsed, err := ParseWelcome(roundTrip(t, welcome))
+	require.NoError(t, err)
+	assert.Equal(t, resume, parsed)
+
+	_, err = ParseWelcome(roundTrip(t, NewError("unsupported version 4")))
+	assert.ErrorIs(t, err, ErrRefused)
+	assert.ErrorContains(t, err, "unsupported version 4")
+}
+
+func TestBatchFrames(t *testing.T) {
+	records := bytes.Repeat([]byte("10,Portal,great game;"), 100)
+	for _, c := range []Compression{NoCompression, Gzip} {
+		f, err := NewBatch(Reviews, Batch{Num: 3, Records: records}, c)
+		require.NoError(t, err)
+		if c == Gzip {
+			assert.Less(t, len(f.Payload), len(records)/4)
+		}
+
+		read := roundTrip(t, f)
+		assert.Equal(t, Reviews, read.Type)
+		parsed, err := ParseBatch(read, c)
+		require.NoError(t, err)
+		assert.Equal(t, Batch{Num: 3, Records: records}, parsed)
+	}
+
+	f, err := NewBatch(Games, Batch{Num: 4, Eof: true}, Gzip)
+	require.NoError(t, err)
+	parsed, err := ParseBatch(roundTrip(t, f), Gzip)
+	require.NoError(t, err)
+	assert.True(t, parsed.Eof)
+	assert.Empty(t, parsed.Records)
+}
+
+func TestAckFrames(t *testing.T) {
+	f, err := NewAck(GamesStream, 12)
+	require.NoError(t, err)
+	stream, num, err := ParseAck(roundTrip(t, f))
+	require.NoError(t, err)
+	assert.Equal(t, GamesStream, stream)
+	assert.Equal(t, uint32(12), num)
+
+	_, _, err = ParseAck(NewResult([]byte("Q1")))
+	assert.EqualError(t, err, "unexpected result frame")
+}
+
+func TestCorruptFramesAreRejected(t *testing.T) {
+	header := []byte{byte(Result), 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(header[1:], maxPayloadLen+1)
+	_, err := ReadFrame(bytes.NewReader(header))
+	assert.ErrorIs(t, err, ErrPayloadTooLarge)
+
+	_, err = ParseBatch(Frame{Type: Games, Payload: []byte{0, 0, 0, 1, 0, 0xff, 0xff, 0xff, 0xff}}, NoCompression)
+	assert.Error(t, err)
+	_, err = ParseBatch(Frame{Type: Games, Payload: []byte{0, 0, 0, 1, 0, 0, 0, 0, 2, 1, 2}}, Gzip)
+	assert.Error(t, err)
+}
@@ -0,0 +1,91 @@
+package recovery
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Dump writes every entry of the recovery log at the given path in a human-readable form, and returns the amount of
+// entries written. Logs in the legacy CSV format are supported. The log is not modified, so corrupted entries are
+// skipped but left in place. Message bodies are only written if body is true.
+func Dump(path string, w io.Writer, body bool) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	count := 0
+	var writeErr error
+	write := func(e entry) {
+		if writeErr == nil {
+			count++
+			_, writeErr = fmt.Fprintf(w, "%d. %s\n", count, e.format(body))
+		}
+	}
+
+	header := make([]byte, fileHeaderLen)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return 0, err
+	}
+
+	err = errLegacyFormat
+	if n == len(header) {
+		err = checkFileHeader(header)
+	}
+	if errors.Is(err, errLegacyFormat) {
+		if _, err = file.Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+		if err = scanLegacy(file, write); err != nil {
+			return count, err
+		}
+		return count, writeErr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	valid, err := scanFrames(bufio.NewReader(file), write)
+	if err != nil {
+		return count, err
+	}
+	if writeErr != nil {
+		return count, writeErr
+	}
+
+	if info, err := file.Stat(); err == nil && info.Size() > fileHeaderLen+valid {
+		_, writeErr = fmt.Fprintf(w, "%d bytes after the last valid record are corrupted\n", info.Size()-fileHeaderLen-valid)
+	}
+	return count, writeErr
+}
+
+// format turns the entry into a human-readable string.
+func (e entry) format(body bool) string {
+	if e.kind == generationKind {
+		return fmt.Sprintf("continues from snapshot %d", e.generation)
+	}
+
+	header := e.record.Header()
+	dsts := make([]string, 0, len(e.record.SequenceIds()))
+	for _, dst := range e.record.SequenceIds() {
+		dsts = append(dsts, dst.ToString())
+	}
+
+	s := fmt.Sprintf(
+		"sequence: %s, client: %s, origin: %d, message: %d, destinations: [%s], size: %d bytes",
+		header.SequenceId, header.ClientId, header.OriginId, header.MessageId, strings.Join(dsts, " "),
+		len(e.record.Message()),
+	)
+	if body {
+		s += fmt.Sprintf(", body: %q", e.record.Message())
+	}
+	return s
+}
@@ -0,0 +1,183 @@
+package recovery
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"tp1/pkg/amqp"
+	msg "tp1/pkg/message"
+	"tp1/pkg/sequence"
+	"tp1/pkg/utils/encoding"
+)
+
+// The recovery log starts with a file header made of magic and version, followed by frames. Each frame is made of
+// the length of its payload, the CRC32 of its payload and the payload itself, all of them big endian:
+//
+//	magic (4) | version (1) | length (4) | crc (4) | payload (length) | length (4) | crc (4) | ...
+//
+// A payload starts with its kind. A record payload follows with the header, the destination sequence IDs and the
+// message, with strings and the message prefixed by their length:
+//
+//	kind (1) | sequence id | client id | origin id (1) | message id (1) | count (4) | (key | id (8)) * count | msg
+//
+// A generation payload follows with the generation of the snapshot the log continues from (8).
+const (
+	magic         = "TP1R"
+	version uint8 = 1
+
+	fileHeaderLen  = int64(len(magic) + 1)
+	frameHeaderLen = 8
+)
+
+// entryKind identifies what a frame holds.
+type entryKind uint8
+
+const (
+	recordKind entryKind = iota
+	generationKind
+)
+
+var (
+	errUnknownKind    = errors.New("unknown entry kind")
+	errUnknownVersion = errors.New("unknown recovery log version")
+)
+
+// entry is a decoded frame. Only the field matching its kind is set.
+type entry struct {
+	kind       entryKind
+	record     Record
+	generation uint64
+}
+
+func fileHeader() []byte {
+	return append([]byte(magic), version)
+}
+
+// checkFileHeader verifies the file header of a log, which must be fileHeaderLen bytes long.
+func checkFileHeader(b []byte) error {
+	if string(b[:len(magic)]) != magic {
+		return errLegacyFormat
+	}
+	if b[len(magic)] != version {
+		return fmt.Errorf("%w: %d", errUnknownVersion, b[len(magic)])
+	}
+	return nil
+}
+
+func (r *record) encode() ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encoding.EncodeNumber(&buf, uint8(recordKind)); err != nil {
+		return nil, err
+	}
+	if err := encoding.EncodeString(&buf, r.header.SequenceId); err != nil {
+		return nil, err
+	}
+	if err := encoding.EncodeString(&buf, r.header.ClientId); err != nil {
+		return nil, err
+	}
+	if err := encoding.EncodeNumber(&buf, r.header.OriginId); err != nil {
+		return nil, err
+	}
+	if err := encoding.EncodeNumber(&buf, uint8(r.header.MessageId)); err != nil {
+		return nil, err
+	}
+
+	if err := encoding.EncodeNumber(&buf, uint32(len(r.dstSequenceId))); err != nil {
+		return nil, err
+	}
+	for _, dst := range r.dstSequenceId {
+		if err := encoding.EncodeString(&buf, dst.Key()); err != nil {
+			return nil, err
+		}
+		if err := encoding.EncodeNumber(&buf, dst.Id()); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := encoding.EncodeString(&buf, string(r.msg)); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func encodeGeneration(generation uint64) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := encoding.EncodeNumber(&buf, uint8(generationKind)); err != nil {
+		return nil, err
+	}
+	if err := encoding.EncodeNumber(&buf, generation); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeEntry decodes the payload of a frame.
+func decodeEntry(payload []byte) (entry, error) {
+	buf := bytes.NewBuffer(payload)
+
+	kind, err := encoding.DecodeUint8(buf)
+	if err != nil {
+		return entry{}, err
+	}
+
+	switch entryKind(kind) {
+	case recordKind:
+		r, err := decodeRecord(buf)
+		return entry{kind: recordKind, record: r}, err
+	case generationKind:
+		generation, err := encoding.DecodeUint64(buf)
+		return entry{kind: generationKind, generation: generation}, err
+	default:
+		return entry{}, fmt.Errorf("%w: %d", errUnknownKind, kind)
+	}
+}
+
+func decodeRecord(buf *bytes.Buffer) (Record, error) {
+	var header amqp.Header
+	var err error
+
+	if header.SequenceId, err = encoding.DecodeString(buf); err != nil {
+		return nil, err
+	}
+	if header.ClientId, err = encoding.DecodeString(buf); err != nil {
+		return nil, err
+	}
+	if header.OriginId, err = encoding.DecodeUint8(buf); err != nil {
+		return nil, err
+	}
+	messageId, err := encoding.DecodeUint8(buf)
+	if err != nil {
+		return nil, err
+	}
+	header.MessageId = msg.Id(messageId)
+
+	count, err := encoding.DecodeUint32(buf)
+	if err != nil {
+		return nil, err
+	}
+	if int(count) > buf.Len() {
+		return nil, errFieldsCount
+	}
+
+	sequenceIds := make([]sequence.Destination, 0, count)
+	for i := uint32(0); i < count; i++ {
+		key, err := encoding.DecodeString(buf)
+		if err != nil {
+			return nil, err
+		}
+		id, err := encoding.DecodeUint64(buf)
+		if err != nil {
+			return nil, err
+		}
+		sequenceIds = append(sequenceIds, sequence.DstNew(key, id))
+	}
+
+	body, err := encoding.DecodeString(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRecord(header, sequenceIds, []byte(body)), nil
+}
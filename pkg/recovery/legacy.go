@@ -0,0 +1,118 @@
+package recovery
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strconv"
+
+	"tp1/pkg/amqp"
+	"tp1/pkg/logs"
+	"tp1/pkg/sequence"
+)
+
+// Logs written before the binary format are CSV files. Each line is a record, made of the header fields, the amount
+// of destination sequence IDs, the sequence IDs, the message and, optionally, a checksum. A line made of the
+// generation marker, the generation and a checksum may precede them.
+const generationMarker = "generation"
+
+var (
+	errLegacyFormat = errors.New("legacy CSV recovery log")
+	errChecksum     = errors.New("checksum mismatch")
+	errFieldsCount  = errors.New("unexpected amount of fields")
+)
+
+// scanLegacy decodes every line of a CSV log, calling fn for each valid one. Invalid lines are skipped.
+func scanLegacy(r io.Reader, fn func(entry)) error {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	for {
+		line, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				logs.Logger.Errorf("Dropping legacy record: %s", err.Error())
+				continue
+			}
+			return err
+		}
+
+		e, err := parseLegacyEntry(line)
+		if err != nil {
+			logs.Logger.Errorf("Dropping legacy record: %s", err.Error())
+			continue
+		}
+		fn(e)
+	}
+}
+
+func parseLegacyEntry(line []string) (entry, error) {
+	if line[0] == generationMarker {
+		generation, err := parseGenerationMarker(line)
+		return entry{kind: generationKind, generation: generation}, err
+	}
+
+	r, err := parseRecord(line)
+	return entry{kind: recordKind, record: r}, err
+}
+
+// parseRecord parses a line of the log. Lines without a checksum are accepted.
+func parseRecord(line []string) (Record, error) {
+	if len(line) < amqp.HeaderLen+2 {
+		return nil, errFieldsCount
+	}
+
+	header, err := amqp.HeaderFromStrings(line)
+	if err != nil {
+		return nil, err
+	}
+
+	count, err := strconv.Atoi(line[amqp.HeaderLen])
+	if err != nil {
+		return nil, err
+	}
+
+	fields := amqp.HeaderLen + 1 + count + 1
+	switch len(line) {
+	case fields:
+	case fields + 1:
+		if checksum(line[:fields]) != line[fields] {
+			return nil, errChecksum
+		}
+	default:
+		return nil, errFieldsCount
+	}
+
+	sequenceIds, err := sequence.DstsFromStrings(line[amqp.HeaderLen : fields-1])
+	if err != nil {
+		return nil, err
+	}
+
+	return NewRecord(*header, sequenceIds, []byte(line[fields-1])), nil
+}
+
+func parseGenerationMarker(line []string) (uint64, error) {
+	if len(line) != 3 {
+		return 0, errFieldsCount
+	}
+	if checksum(line[:2]) != line[2] {
+		return 0, errChecksum
+	}
+	return strconv.ParseUint(line[1], 10, 64)
+}
+
+// checksum returns the CRC32 of the given fields, as a hexadecimal string.
+func checksum(fields []string) string {
+	h := crc32.NewIEEE()
+	for _, f := range fields {
+		_, _ = h.Write([]byte(f))
+		_, _ = h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%08x", h.Sum32())
+}
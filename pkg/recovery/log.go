@@ -0,0 +1,232 @@
+package recovery
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"tp1/pkg/logs"
+)
+
+const (
+	logMode   = 0666
+	legacyExt = ".legacy" // legacyExt is the extension of the copy of a CSV log kept while it gets migrated.
+)
+
+// logFile is an append-only file of frames, in the recovery log's binary format.
+type logFile struct {
+	file *os.File
+	path string
+}
+
+// openLog opens the log at the given path, creating it if it does not exist. CSV logs get migrated to the binary
+// format. A copy of the CSV log is kept until the migration finishes, so that it can be resumed after a crash.
+func openLog(path string) (*logFile, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, logMode)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &logFile{file: file, path: path}
+	if err = l.init(); err != nil {
+		l.close()
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *logFile) init() error {
+	if _, err := os.Stat(l.path + legacyExt); err == nil {
+		return l.migrate()
+	}
+
+	info, err := l.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, fileHeaderLen)
+	n, err := l.file.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	// An empty file, or one whose header was torn by a crash, is a new log.
+	if bytes.HasPrefix(fileHeader(), header[:n]) && info.Size() == int64(n) {
+		return l.reset(nil)
+	}
+
+	err = checkFileHeader(header)
+	if errors.Is(err, errLegacyFormat) {
+		if err = copySynced(l.path, l.path+legacyExt); err != nil {
+			return err
+		}
+		return l.migrate()
+	}
+	return err
+}
+
+// migrate rewrites the log in the binary format from the copy of the CSV log, and removes the copy afterward.
+func (l *logFile) migrate() error {
+	legacy, err := os.Open(l.path + legacyExt)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = legacy.Close()
+	}()
+
+	logs.Logger.Infof("Migrating recovery log %s to version %d", l.path, version)
+	if err = l.reset(nil); err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(l.file)
+	migrated := 0
+	err = scanLegacy(legacy, func(e entry) {
+		var payload []byte
+		if payload, err = e.encode(); err == nil {
+			_, err = w.Write(frame(payload))
+		}
+		if err != nil {
+			logs.Logger.Errorf("Failed to migrate record: %s", err.Error())
+			return
+		}
+		migrated++
+	})
+	if err != nil {
+		return err
+	}
+	if err = w.Flush(); err != nil {
+		return err
+	}
+	if err = l.file.Sync(); err != nil {
+		return err
+	}
+
+	logs.Logger.Infof("Migrated %d records", migrated)
+	return os.Remove(l.path + legacyExt)
+}
+
+// scan decodes every frame of the log, calling fn for each valid one. See scanFrames.
+func (l *logFile) scan(fn func(entry)) (int64, error) {
+	r := bufio.NewReader(io.NewSectionReader(l.file, fileHeaderLen, 1<<62))
+	valid, err := scanFrames(r, fn)
+	return fileHeaderLen + valid, err
+}
+
+// append writes a frame with the given payload at the end of the log.
+func (l *logFile) append(payload []byte) error {
+	_, err := l.file.Write(frame(payload))
+	return err
+}
+
+// sync commits the contents of the log to disk.
+func (l *logFile) sync() error {
+	return l.file.Sync()
+}
+
+// size returns the size of the log, in bytes.
+func (l *logFile) size() (int64, error) {
+	info, err := l.file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// truncate discards everything in the log after the given size, in bytes.
+func (l *logFile) truncate(size int64) error {
+	return l.file.Truncate(size)
+}
+
+// reset discards every frame of the log, and writes a frame with the given payload, unless it is nil.
+func (l *logFile) reset(payload []byte) error {
+	if err := l.file.Truncate(0); err != nil {
+		return err
+	}
+
+	b := fileHeader()
+	if payload != nil {
+		b = append(b, frame(payload)...)
+	}
+	if _, err := l.file.Write(b); err != nil {
+		return err
+	}
+	return l.file.Sync()
+}
+
+func (l *logFile) close() {
+	if err := l.file.Close(); err != nil {
+		logs.Logger.Errorf("error closing file: %v", err)
+	}
+}
+
+// frame prefixes a payload with its length and CRC.
+func frame(payload []byte) []byte {
+	b := make([]byte, frameHeaderLen, frameHeaderLen+len(payload))
+	binary.BigEndian.PutUint32(b, uint32(len(payload)))
+	binary.BigEndian.PutUint32(b[4:], crc32.ChecksumIEEE(payload))
+	return append(b, payload...)
+}
+
+// scanFrames decodes every frame read from r, calling fn for each valid one, and returns the amount of bytes up to
+// the end of the last valid frame. Frames failing their checksum are skipped. Reading stops at a frame torn by a
+// crash, which is left out of the returned amount.
+func scanFrames(r io.Reader, fn func(entry)) (int64, error) {
+	var read, valid int64
+	header := make([]byte, frameHeaderLen)
+
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return valid, nil
+			}
+			return valid, err
+		}
+
+		// The payload is not allocated upfront, since a torn length may be way larger than the log.
+		length := int64(binary.BigEndian.Uint32(header))
+		payload, err := io.ReadAll(io.LimitReader(r, length))
+		if err != nil {
+			return valid, err
+		}
+		if int64(len(payload)) < length {
+			return valid, nil
+		}
+		read += int64(frameHeaderLen + len(payload))
+
+		if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+			logs.Logger.Errorf("Dropping record: %s", errChecksum.Error())
+			continue
+		}
+
+		e, err := decodeEntry(payload)
+		if err != nil {
+			logs.Logger.Errorf("Dropping record: %s", err.Error())
+			continue
+		}
+
+		valid = read
+		fn(e)
+	}
+}
+
+func (e entry) encode() ([]byte, error) {
+	if e.kind == generationKind {
+		return encodeGeneration(e.generation)
+	}
+	return e.record.encode()
+}
+
+func copySynced(src, dst string) error {
+	b, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return writeSynced(dst, b)
+}
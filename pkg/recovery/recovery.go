@@ -1,73 +1,139 @@
 package recovery
 
 import (
-	"io"
-
 	"tp1/pkg/amqp"
 	"tp1/pkg/logs"
-	"tp1/pkg/sequence"
 	ioutils "tp1/pkg/utils/io"
 )
 
-const filePath = "recovery.csv"
+const (
+	// filePath keeps its extension, so that logs written before the binary format get migrated.
+	filePath     = "recovery.csv"
+	snapshotPath = "snapshots/snapshot.bin" // Kept in a directory, since the snapshot gets replaced by renaming it.
+)
 
 type Handler struct {
-	file *ioutils.File
+	file         *logFile
+	syncer       *ioutils.Syncer
+	snapshotPath string
+	generation   uint64 // generation is the generation of the last snapshot taken or loaded.
+}
+
+// NewHandler creates a new recovery handler, which syncs the log according to policy.
+func NewHandler(policy ioutils.SyncPolicy) (*Handler, error) {
+	return newHandler(filePath, snapshotPath, policy)
 }
 
-// NewHandler creates a new recovery handler.
-func NewHandler() (*Handler, error) {
-	file, err := ioutils.NewFile(filePath)
+func newHandler(logPath, snapshotPath string, policy ioutils.SyncPolicy) (*Handler, error) {
+	file, err := openLog(logPath)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Handler{
-		file: file,
+		file:         file,
+		syncer:       ioutils.NewSyncer(policy, file.sync),
+		snapshotPath: snapshotPath,
 	}, nil
 }
 
-// Recover reads each line of the underlying file, parses it, and sends it through a Record channel.
-// Upon failure when reading or parsing, the line gets skipped.
+// Recover reads each record of the underlying file and sends it through a Record channel.
+// Upon failure when decoding a record or verifying its checksum, the record gets skipped. A record torn by a crash
+// at the end of the file gets truncated.
+//
+// If a snapshot was loaded and the log predates it, no record is sent: every one of them is already part of
+// the snapshot.
 func (h *Handler) Recover(ch chan<- Record) {
 	defer close(ch)
 
-	for {
-		line, err := h.file.Read()
-		if err != nil {
-			if err == io.EOF {
-				break
+	var logGeneration uint64
+	valid, err := h.file.scan(func(e entry) {
+		switch e.kind {
+		case generationKind:
+			logGeneration = e.generation
+		case recordKind:
+			if logGeneration >= h.generation {
+				ch <- e.record
 			}
-			logs.Logger.Errorf("Failed to read line: %v", err)
-			continue
 		}
+	})
+	if err != nil {
+		logs.Logger.Errorf("Failed to read recovery log: %v", err)
+		return
+	}
 
-		header, err := amqp.HeaderFromStrings(line)
-		if err != nil {
-			logs.Logger.Errorf("failed to recover header: %s", err.Error())
-			continue
+	if logGeneration < h.generation {
+		logs.Logger.Infof("Recovery log predates snapshot %d. Discarding it", h.generation)
+		if err = h.resetLog(); err != nil {
+			logs.Logger.Errorf("failed to truncate recovery log: %s", err.Error())
 		}
+		return
+	}
+
+	if err = h.file.truncate(valid); err != nil {
+		logs.Logger.Errorf("failed to truncate corrupted records: %s", err.Error())
+	}
+}
 
-		sequenceIds, err := sequence.DstsFromStrings(line[amqp.HeaderLen : len(line)-1])
+// Log saves a record into the underlying file. done, unless nil, is called once the record is durable according to
+// the sync policy, which may happen after Log returns. It is not called if saving the record fails.
+func (h *Handler) Log(record Record, done func(error)) error {
+	payload, err := record.encode()
+	if err != nil {
+		return err
+	}
+	if err = h.file.append(payload); err != nil {
+		return err
+	}
+
+	h.syncer.Written(done)
+	return nil
+}
+
+// Ack returns a callback for Log, which acknowledges a delivery once its record is durable. If the record could not
+// be made durable, the delivery is requeued instead, so that it gets redelivered.
+func Ack(delivery amqp.Delivery) func(error) {
+	return func(err error) {
 		if err != nil {
-			logs.Logger.Errorf("failed to recover sequence: %s", err.Error())
-			continue
+			logs.Logger.Errorf("Failed to log record, requeueing message: %s", err.Error())
+			if err = delivery.Nack(false, true); err != nil {
+				logs.Logger.Errorf("Failed to requeue message: %s", err.Error())
+			}
+			return
+		}
+		if err = delivery.Ack(false); err != nil {
+			logs.Logger.Errorf("Failed to acknowledge message: %s", err.Error())
 		}
-
-		ch <- NewRecord(
-			*header,
-			sequenceIds,
-			[]byte(line[len(line)-1]),
-		)
 	}
 }
 
-// Log saves a record into the underlying file.
-func (h *Handler) Log(record Record) error {
-	return h.file.Write(record.toString())
+// Flush syncs every record logged so far, calling their callbacks.
+func (h *Handler) Flush() {
+	h.syncer.Flush()
+}
+
+// Sync syncs every record logged so far to disk, whatever the sync policy, calling the callbacks of those pending.
+func (h *Handler) Sync() error {
+	h.syncer.Flush()
+	return h.file.sync()
 }
 
-// Close closes the file descriptor linked to the underlying file.
+// Close syncs every record logged so far and closes the file descriptor linked to the underlying file.
 func (h *Handler) Close() {
-	h.file.Close()
+	h.syncer.Flush()
+	h.file.close()
+}
+
+// Size returns the size of the recovery log, in bytes.
+func (h *Handler) Size() (int64, error) {
+	return h.file.size()
+}
+
+// resetLog discards every record in the log, which continues from the current snapshot.
+func (h *Handler) resetLog() error {
+	payload, err := encodeGeneration(h.generation)
+	if err != nil {
+		return err
+	}
+	return h.file.reset(payload)
 }
@@ -0,0 +1,295 @@
+package recovery
+
+import (
+	"encoding/csv"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tp1/pkg/amqp"
+	"tp1/pkg/amqp/memory"
+	msg "tp1/pkg/message"
+	"tp1/pkg/sequence"
+	ioutils "tp1/pkg/utils/io"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var syncAlways = ioutils.SyncPolicy{Mode: ioutils.SyncAlways}
+
+func newTestHandler(t *testing.T) (*Handler, string) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, filePath)
+
+	h, err := newHandler(logPath, filepath.Join(dir, snapshotPath), syncAlways)
+	require.NoError(t, err)
+	t.Cleanup(h.Close)
+
+	return h, logPath
+}
+
+func reopen(t *testing.T, h *Handler, logPath string) *Handler {
+	h.Close()
+	reopened, err := newHandler(logPath, h.snapshotPath, syncAlways)
+	require.NoError(t, err)
+	t.Cleanup(reopened.Close)
+
+	return reopened
+}
+
+func testRecord(seq string, body string) Record {
+	header := amqp.Header{SequenceId: seq, ClientId: "0-0", OriginId: amqp.GameOriginId, MessageId: msg.GameId}
+	return NewRecord(header, []sequence.Destination{sequence.DstNew("key", 1)}, []byte(body))
+}
+
+func writeLegacy(t *testing.T, path string, lines ...[]string) {
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	require.NoError(t, w.WriteAll(lines))
+}
+
+func recoverAll(h *Handler) []Record {
+	ch := make(chan Record, 16)
+	go h.Recover(ch)
+
+	var records []Record
+	for r := range ch {
+		records = append(records, r)
+	}
+	return records
+}
+
+func TestRecoverReturnsLoggedRecords(t *testing.T) {
+	h, logPath := newTestHandler(t)
+	require.NoError(t, h.Log(testRecord("uuid-1", "first"), nil))
+	require.NoError(t, h.Log(testRecord("uuid-2", "second, with \"quotes\""), nil))
+
+	records := recoverAll(reopen(t, h, logPath))
+
+	require.Len(t, records, 2)
+	assert.Equal(t, "uuid-2", records[1].Header().SequenceId)
+	assert.Equal(t, []byte("second, with \"quotes\""), records[1].Message())
+	assert.Equal(t, []sequence.Destination{sequence.DstNew("key", 1)}, records[1].SequenceIds())
+}
+
+func TestRecoverDropsTornRecord(t *testing.T) {
+	h, logPath := newTestHandler(t)
+	require.NoError(t, h.Log(testRecord("uuid-1", "first"), nil))
+	require.NoError(t, h.Log(testRecord("uuid-2", "second"), nil))
+
+	info, err := os.Stat(logPath)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(logPath, info.Size()-3))
+
+	h = reopen(t, h, logPath)
+	records := recoverAll(h)
+	require.Len(t, records, 1)
+	assert.Equal(t, "uuid-1", records[0].Header().SequenceId)
+
+	// The torn record is truncated, so new records are not appended to it.
+	require.NoError(t, h.Log(testRecord("uuid-3", "third"), nil))
+	records = recoverAll(reopen(t, h, logPath))
+	require.Len(t, records, 2)
+	assert.Equal(t, "uuid-3", records[1].Header().SequenceId)
+}
+
+func TestRecoverDropsRecordWithInvalidChecksum(t *testing.T) {
+	h, logPath := newTestHandler(t)
+	require.NoError(t, h.Log(testRecord("uuid-1", "first"), nil))
+	require.NoError(t, h.Log(testRecord("uuid-2", "second"), nil))
+
+	// Corrupts the last byte of the first record's message.
+	payload, err := testRecord("uuid-1", "first").encode()
+	require.NoError(t, err)
+	b, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	b[fileHeaderLen+frameHeaderLen+int64(len(payload))-1] ^= 0xff
+	require.NoError(t, os.WriteFile(logPath, b, 0666))
+
+	records := recoverAll(reopen(t, h, logPath))
+
+	require.Len(t, records, 1)
+	assert.Equal(t, "uuid-2", records[0].Header().SequenceId)
+}
+
+func TestRecoverMigratesLegacyLog(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, filePath)
+	record := testRecord("uuid-1", "with, \"quotes\"\nand newlines")
+	legacy := append(record.Header().ToString(), "1", "key-1", string(record.Message()))
+	writeLegacy(t, logPath,
+		[]string{generationMarker, "0", checksum([]string{generationMarker, "0"})},
+		legacy,
+		append(legacy[:len(legacy):len(legacy)], checksum(legacy)),
+		append(legacy[:len(legacy):len(legacy)], "00000000"),
+	)
+
+	h, err := newHandler(logPath, filepath.Join(dir, snapshotPath), syncAlways)
+	require.NoError(t, err)
+	t.Cleanup(h.Close)
+
+	b, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	assert.Equal(t, fileHeader(), b[:fileHeaderLen])
+	assert.NoFileExists(t, logPath+legacyExt)
+
+	records := recoverAll(h)
+	require.Len(t, records, 2)
+	assert.Equal(t, record, records[1])
+}
+
+func TestRecoverResumesInterruptedMigration(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, filePath)
+	record := testRecord("uuid-1", "legacy")
+	writeLegacy(t, logPath+legacyExt, append(record.Header().ToString(), "1", "key-1", "legacy"))
+	require.NoError(t, os.WriteFile(logPath, fileHeader(), 0666))
+
+	h, err := newHandler(logPath, filepath.Join(dir, snapshotPath), syncAlways)
+	require.NoError(t, err)
+	t.Cleanup(h.Close)
+
+	records := recoverAll(h)
+	require.Len(t, records, 1)
+	assert.Equal(t, record, records[0])
+	assert.NoFileExists(t, logPath+legacyExt)
+}
+
+func TestSyncCallsPendingCallbacks(t *testing.T) {
+	dir := t.TempDir()
+	group := ioutils.SyncPolicy{Mode: ioutils.SyncGroup, Records: 64, Interval: time.Hour}
+	h, err := newHandler(filepath.Join(dir, filePath), filepath.Join(dir, snapshotPath), group)
+	require.NoError(t, err)
+	defer h.Close()
+
+	synced := 0
+	for _, seq := range []string{"uuid-1", "uuid-2"} {
+		require.NoError(t, h.Log(testRecord(seq, "body"), func(err error) {
+			assert.NoError(t, err)
+			synced++
+		}))
+	}
+	assert.Zero(t, synced)
+
+	require.NoError(t, h.Sync())
+	assert.Equal(t, 2, synced)
+}
+
+func TestAckRequeuesDeliveryWhoseRecordFailed(t *testing.T) {
+	b := memory.NewServer().NewBroker()
+	defer b.Close()
+	_, err := b.QueueDeclare("results")
+	require.NoError(t, err)
+	require.NoError(t, b.Publish("", "results", []byte("body"), amqp.Header{}))
+
+	deliveries, err := b.Consume("results", "", false, false, 0)
+	require.NoError(t, err)
+	Ack(<-deliveries)(errors.New("disk full"))
+
+	redelivered := <-deliveries
+	assert.True(t, redelivered.Redelivered)
+	Ack(redelivered)(nil)
+}
+
+func TestDump(t *testing.T) {
+	h, logPath := newTestHandler(t)
+	require.NoError(t, h.Log(testRecord("uuid-1", "first"), nil))
+	require.NoError(t, h.Log(testRecord("uuid-2", "second"), nil))
+	h.Close()
+
+	var out strings.Builder
+	count, err := Dump(logPath, &out, true)
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.Contains(t, out.String(), "2. sequence: uuid-2, client: 0-0")
+	assert.Contains(t, out.String(), `body: "second"`)
+}
+
+func TestSnapshotTruncatesLog(t *testing.T) {
+	h, logPath := newTestHandler(t)
+	require.NoError(t, h.Log(testRecord("uuid-1", "first"), nil))
+	require.NoError(t, h.SaveSnapshot(Snapshot{Sequences: map[string]uint64{"key": 2}, Node: []byte("state")}))
+	require.NoError(t, h.Log(testRecord("uuid-2", "second"), nil))
+
+	h = reopen(t, h, logPath)
+	s, err := h.LoadSnapshot()
+	require.NoError(t, err)
+	require.NotNil(t, s)
+	assert.Equal(t, uint64(1), s.Generation)
+	assert.Equal(t, map[string]uint64{"key": 2}, s.Sequences)
+	assert.Equal(t, []byte("state"), s.Node)
+
+	records := recoverAll(h)
+	require.Len(t, records, 1)
+	assert.Equal(t, "uuid-2", records[0].Header().SequenceId)
+}
+
+func TestSizeFollowsLogAndSnapshots(t *testing.T) {
+	h, _ := newTestHandler(t)
+	empty, err := h.Size()
+	require.NoError(t, err)
+
+	require.NoError(t, h.Log(testRecord("uuid-1", "first"), nil))
+	logged, err := h.Size()
+	require.NoError(t, err)
+	assert.Greater(t, logged, empty)
+
+	require.NoError(t, h.SaveSnapshot(Snapshot{}))
+	truncated, err := h.Size()
+	require.NoError(t, err)
+	assert.Less(t, truncated, logged)
+}
+
+func TestRecoverSkipsLogOlderThanSnapshot(t *testing.T) {
+	h, logPath := newTestHandler(t)
+	require.NoError(t, h.Log(testRecord("uuid-1", "first"), nil))
+
+	// Simulates a crash right after the snapshot was persisted, but before the log was truncated.
+	old, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	require.NoError(t, h.SaveSnapshot(Snapshot{}))
+	require.NoError(t, os.WriteFile(logPath, old, 0666))
+
+	h = reopen(t, h, logPath)
+	_, err = h.LoadSnapshot()
+	require.NoError(t, err)
+	assert.Empty(t, recoverAll(h))
+
+	require.NoError(t, h.Log(testRecord("uuid-2", "second"), nil))
+	h = reopen(t, h, logPath)
+	_, err = h.LoadSnapshot()
+	require.NoError(t, err)
+	records := recoverAll(h)
+	require.Len(t, records, 1)
+	assert.Equal(t, "uuid-2", records[0].Header().SequenceId)
+}
+
+func TestLoadSnapshotWithoutSnapshot(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	s, err := h.LoadSnapshot()
+
+	assert.NoError(t, err)
+	assert.Nil(t, s)
+}
+
+func TestLoadCorruptedSnapshot(t *testing.T) {
+	h, _ := newTestHandler(t)
+	require.NoError(t, h.SaveSnapshot(Snapshot{Node: []byte("state")}))
+
+	b, err := os.ReadFile(h.snapshotPath)
+	require.NoError(t, err)
+	b[len(b)-1] ^= 0xff
+	require.NoError(t, os.WriteFile(h.snapshotPath, b, 0666))
+
+	_, err = h.LoadSnapshot()
+	assert.ErrorIs(t, err, errCorruptedSnapshot)
+}
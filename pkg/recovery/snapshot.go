@@ -0,0 +1,107 @@
+package recovery
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	snapshotMode    = 0666
+	snapshotDirMode = 0777
+	checksumLen     = 4
+	tmpSnapshotExt  = ".tmp"
+)
+
+var errCorruptedSnapshot = errors.New("corrupted snapshot")
+
+// Snapshot holds the state of a node at a given point of the recovery log.
+type Snapshot struct {
+	Generation uint64
+	Sequences  map[string]uint64    // Sequences holds the next sequence ID by output key.
+	Duplicates map[string]uint64    // Duplicates holds the next expected sequence ID by worker UUID.
+	Node       []byte               // Node holds the state of the node, encoded by the node itself.
+	Members    []byte               // Members holds the members pinned by client, encoded by the worker.
+	Clients    map[string]time.Time // Clients holds the last time each active client was seen.
+	Aborted    map[string]time.Time // Aborted holds the time each aborted client was aborted at.
+	Expired    map[string]time.Time // Expired holds the time each expired client expired at.
+}
+
+// SaveSnapshot persists a snapshot and truncates the recovery log, since every record in it is part of the
+// snapshot from then on.
+//
+// The snapshot is written to a temporary file which replaces the previous snapshot once synced, so that a
+// crash never leaves a partially written snapshot behind. If the node crashes before the log is truncated,
+// the log is discarded on recovery since it predates the snapshot.
+func (h *Handler) SaveSnapshot(s Snapshot) error {
+	// Pending records get synced first, so that their callbacks are not lost when the log is truncated.
+	h.syncer.Flush()
+	s.Generation = h.generation + 1
+
+	var buf bytes.Buffer
+	buf.Write(make([]byte, checksumLen))
+	if err := gob.NewEncoder(&buf).Encode(s); err != nil {
+		return err
+	}
+	data := buf.Bytes()
+	binary.BigEndian.PutUint32(data, crc32.ChecksumIEEE(data[checksumLen:]))
+
+	if err := os.MkdirAll(filepath.Dir(h.snapshotPath), snapshotDirMode); err != nil {
+		return err
+	}
+	if err := writeSynced(h.snapshotPath+tmpSnapshotExt, data); err != nil {
+		return err
+	}
+	if err := os.Rename(h.snapshotPath+tmpSnapshotExt, h.snapshotPath); err != nil {
+		return err
+	}
+
+	h.generation = s.Generation
+	return h.resetLog()
+}
+
+// LoadSnapshot reads the last persisted snapshot. It returns nil if no snapshot was ever taken.
+// It must be called before Recover, so that records already part of the snapshot are not recovered.
+func (h *Handler) LoadSnapshot() (*Snapshot, error) {
+	data, err := os.ReadFile(h.snapshotPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if len(data) < checksumLen || binary.BigEndian.Uint32(data) != crc32.ChecksumIEEE(data[checksumLen:]) {
+		return nil, errCorruptedSnapshot
+	}
+
+	var s Snapshot
+	if err = gob.NewDecoder(bytes.NewReader(data[checksumLen:])).Decode(&s); err != nil {
+		return nil, err
+	}
+
+	h.generation = s.Generation
+	return &s, nil
+}
+
+func writeSynced(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, snapshotMode)
+	if err != nil {
+		return err
+	}
+
+	if _, err = file.Write(data); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -24,3 +24,20 @@ func (g *Generator) NextId(key string) uint64 {
 	}
 	return sequenceId
 }
+
+// Snapshot returns a copy of the next sequence ID by key.
+func (g *Generator) Snapshot() map[string]uint64 {
+	ids := make(map[string]uint64, len(g.sequenceIds))
+	for k, v := range g.sequenceIds {
+		ids[k] = v
+	}
+	return ids
+}
+
+// Restore replaces every sequence ID with the ones of a snapshot.
+func (g *Generator) Restore(ids map[string]uint64) {
+	g.sequenceIds = make(map[string]uint64, len(ids))
+	for k, v := range ids {
+		g.sequenceIds[k] = v
+	}
+}
@@ -0,0 +1,189 @@
+package tracing
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	fileMode      = 0o644
+	otlpTimeout   = 5 * time.Second
+	otlpScope     = "tp1"
+	consumerKind  = 5 // consumerKind is SPAN_KIND_CONSUMER, for spans handling a message from a broker.
+	statusError   = 2 // statusError is STATUS_CODE_ERROR.
+	jsonMediaType = "application/json"
+)
+
+// jsonFileExporter appends spans to a file, one JSON object per line.
+type jsonFileExporter struct {
+	file *os.File
+}
+
+func newFileExporter(path string) (*jsonFileExporter, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, fileMode)
+	if err != nil {
+		return nil, err
+	}
+	return &jsonFileExporter{file: file}, nil
+}
+
+func (e *jsonFileExporter) Export(_ string, spans []Span) error {
+	w := bufio.NewWriter(e.file)
+	encoder := json.NewEncoder(w)
+	for _, s := range spans {
+		if err := encoder.Encode(s); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+func (e *jsonFileExporter) Close() error {
+	return e.file.Close()
+}
+
+// otlpHttpExporter posts spans to a collector, as OTLP/HTTP with JSON encoding.
+type otlpHttpExporter struct {
+	endpoint string
+	client   *http.Client
+}
+
+func newOtlpExporter(endpoint string) *otlpHttpExporter {
+	return &otlpHttpExporter{endpoint: endpoint, client: &http.Client{Timeout: otlpTimeout}}
+}
+
+func (e *otlpHttpExporter) Export(service string, spans []Span) error {
+	body, err := json.Marshal(otlpRequest(service, spans))
+	if err != nil {
+		return err
+	}
+
+	resp, err := e.client.Post(e.endpoint, jsonMediaType, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector answered %s", resp.Status)
+	}
+	return nil
+}
+
+func (e *otlpHttpExporter) Close() error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// The types below are the subset of the OTLP JSON encoding the exporter needs.
+
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []attribute `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope      `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceId           string      `json:"traceId"`
+	SpanId            string      `json:"spanId"`
+	ParentSpanId      string      `json:"parentSpanId,omitempty"`
+	Name              string      `json:"name"`
+	Kind              int         `json:"kind"`
+	StartTimeUnixNano string      `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string      `json:"endTimeUnixNano"`
+	Attributes        []attribute `json:"attributes"`
+	Status            *status     `json:"status,omitempty"`
+}
+
+type status struct {
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+type attribute struct {
+	Key   string `json:"key"`
+	Value value  `json:"value"`
+}
+
+type value struct {
+	StringValue *string     `json:"stringValue,omitempty"`
+	IntValue    *string     `json:"intValue,omitempty"`
+	ArrayValue  *arrayValue `json:"arrayValue,omitempty"`
+}
+
+type arrayValue struct {
+	Values []value `json:"values"`
+}
+
+func otlpRequest(service string, spans []Span) exportRequest {
+	converted := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		converted = append(converted, toOtlp(s))
+	}
+
+	return exportRequest{ResourceSpans: []resourceSpans{{
+		Resource:   resource{Attributes: []attribute{stringAttribute("service.name", service)}},
+		ScopeSpans: []scopeSpans{{Scope: scope{Name: otlpScope}, Spans: converted}},
+	}}}
+}
+
+func toOtlp(s Span) otlpSpan {
+	outputs := make([]value, 0, len(s.Outputs))
+	for _, o := range s.Outputs {
+		outputs = append(outputs, stringValue(o))
+	}
+	messageId := strconv.Itoa(int(s.MessageId))
+
+	span := otlpSpan{
+		TraceId:           s.TraceId,
+		SpanId:            s.SpanId,
+		ParentSpanId:      s.ParentSpanId,
+		Name:              s.Name,
+		Kind:              consumerKind,
+		StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+		Attributes: []attribute{
+			stringAttribute("node.uuid", s.Node),
+			stringAttribute("client.id", s.ClientId),
+			stringAttribute("sequence.id", s.SequenceId),
+			{Key: "message.id", Value: value{IntValue: &messageId}},
+			{Key: "outputs", Value: value{ArrayValue: &arrayValue{Values: outputs}}},
+		},
+	}
+	if s.Error != "" {
+		span.Status = &status{Message: s.Error, Code: statusError}
+	}
+	return span
+}
+
+func stringAttribute(key, v string) attribute {
+	return attribute{Key: key, Value: stringValue(v)}
+}
+
+func stringValue(v string) value {
+	return value{StringValue: &v}
+}
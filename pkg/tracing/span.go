@@ -0,0 +1,73 @@
+package tracing
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math/rand/v2"
+	"time"
+
+	"tp1/pkg/amqp"
+)
+
+// Span is the work a node did on a single message: which message it took, and where it published its outputs.
+type Span struct {
+	TraceId      string    `json:"trace-id"`
+	SpanId       string    `json:"span-id"`
+	ParentSpanId string    `json:"parent-span-id,omitempty"`
+	Name         string    `json:"name"`
+	Node         string    `json:"node"`
+	ClientId     string    `json:"client-id"`
+	SequenceId   string    `json:"sequence-id"`
+	MessageId    uint8     `json:"message-id"`
+	Outputs      []string  `json:"outputs,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+
+	tracer *Tracer
+}
+
+// Header returns the header of the message the span was started for, with the span set as the one the outputs of
+// the message are published under. A nil span returns the header as is.
+func (s *Span) Header(header amqp.Header) amqp.Header {
+	if s == nil {
+		return header
+	}
+	return header.WithSpan(s.TraceId, s.SpanId)
+}
+
+// Finish ends the span, recording the destinations the outputs were published to, and queues it to be exported.
+// Finishing a nil span does nothing.
+func (s *Span) Finish(outputs ...string) {
+	if s == nil {
+		return
+	}
+	s.Outputs = outputs
+	s.End = time.Now()
+	s.tracer.export(*s)
+}
+
+// Fail ends the span, recording the reason the message could not be processed, and queues it to be exported.
+// Failing a nil span does nothing.
+func (s *Span) Fail(err error) {
+	if s == nil {
+		return
+	}
+	s.Error = err.Error()
+	s.Finish()
+}
+
+// NewTraceId returns a random trace ID, as 32 hex digits.
+func NewTraceId() string {
+	b := make([]byte, 16)
+	binary.BigEndian.PutUint64(b, rand.Uint64())
+	binary.BigEndian.PutUint64(b[8:], rand.Uint64())
+	return hex.EncodeToString(b)
+}
+
+// newSpanId returns a random span ID, as 16 hex digits.
+func newSpanId() string {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, rand.Uint64())
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,200 @@
+package tracing
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"tp1/pkg/amqp"
+	"tp1/pkg/config"
+	"tp1/pkg/logs"
+	"tp1/pkg/metrics"
+)
+
+const (
+	exporterKey        = "exporter"
+	fileExporter       = "file"
+	otlpExporter       = "otlp"
+	pathKey            = "path"
+	defaultPath        = "traces.json"
+	endpointKey        = "endpoint"
+	defaultEndpoint    = "http://otel-collector:4318/v1/traces"
+	sampleRatioKey     = "sample-ratio"
+	defaultSampleRatio = 1.0
+	batchSizeKey       = "batch-size"
+	defaultBatchSize   = 256
+	intervalKey        = "interval-ms"
+	defaultInterval    = 1000
+	bufferKey          = "buffer"
+	defaultBuffer      = 4096
+)
+
+var droppedSpans = metrics.NewCounter("tracing_dropped_spans_total",
+	"Spans dropped because the exporter could not keep up, or failed.")
+
+// Exporter sends finished spans to wherever they are stored.
+type Exporter interface {
+	// Export sends a batch of spans of the given service.
+	Export(service string, spans []Span) error
+	// Close releases the resources of the exporter.
+	Close() error
+}
+
+// Tracer starts spans for the messages a node handles and exports them in batches, in the background. Spans are
+// dropped rather than slowing the node down if the exporter cannot keep up.
+type Tracer struct {
+	service     string
+	node        string
+	exporter    Exporter
+	sampleRatio float64
+	batchSize   int
+	interval    time.Duration
+	mu          sync.RWMutex
+	closed      bool // closed is set once the tracer is closed, after which spans are dropped.
+	spans       chan Span
+	done        chan struct{}
+}
+
+// NewTracer creates a tracer for the given service and node, as configured by the given section. Without the
+// section, tracing is disabled and a nil tracer is returned, whose methods do nothing.
+//
+// The section holds the `exporter`, either `file` (spans are appended to `path` as JSON lines) or `otlp` (spans are
+// posted to `endpoint`, an OTLP/HTTP collector), and optionally the `sample-ratio` of traces started by the node,
+// the `batch-size` and `interval-ms` spans are exported every, and the `buffer` of spans waiting to be exported.
+func NewTracer(cfg config.Config, section, service, node string) (*Tracer, error) {
+	if !cfg.Contains(section) {
+		return nil, nil
+	}
+
+	var exporter Exporter
+	var err error
+	switch kind := cfg.String(section+"."+exporterKey, fileExporter); kind {
+	case fileExporter:
+		exporter, err = newFileExporter(cfg.String(section+"."+pathKey, defaultPath))
+	case otlpExporter:
+		exporter = newOtlpExporter(cfg.String(section+"."+endpointKey, defaultEndpoint))
+	default:
+		err = fmt.Errorf("%s: unknown exporter %q", section, kind)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	t := newTracer(exporter, service, node, cfg.Int(section+"."+batchSizeKey, defaultBatchSize),
+		time.Duration(cfg.Int64(section+"."+intervalKey, defaultInterval))*time.Millisecond,
+		cfg.Int(section+"."+bufferKey, defaultBuffer))
+	t.sampleRatio = cfg.Float64(section+"."+sampleRatioKey, defaultSampleRatio)
+	return t, nil
+}
+
+func newTracer(exporter Exporter, service, node string, batchSize int, interval time.Duration, buffer int) *Tracer {
+	t := &Tracer{
+		service:     service,
+		node:        node,
+		exporter:    exporter,
+		sampleRatio: defaultSampleRatio,
+		batchSize:   batchSize,
+		interval:    interval,
+		spans:       make(chan Span, buffer),
+		done:        make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// NewTrace returns the ID of a new trace, or an empty string if the tracer is nil or the trace is not sampled.
+func (t *Tracer) NewTrace() string {
+	if t == nil || rand.Float64() >= t.sampleRatio {
+		return ""
+	}
+	return NewTraceId()
+}
+
+// Start starts a span for a message with the given header, as a child of the span that published it. It returns
+// nil if the tracer is nil or the message is not traced.
+func (t *Tracer) Start(name string, header amqp.Header) *Span {
+	if t == nil || header.TraceId == "" {
+		return nil
+	}
+
+	return &Span{
+		TraceId:      header.TraceId,
+		SpanId:       newSpanId(),
+		ParentSpanId: header.SpanId,
+		Name:         name,
+		Node:         t.node,
+		ClientId:     header.ClientId,
+		SequenceId:   header.SequenceId,
+		MessageId:    uint8(header.MessageId),
+		Start:        time.Now(),
+		tracer:       t,
+	}
+}
+
+// Close exports the spans finished so far and closes the exporter. Spans finished afterward are dropped.
+func (t *Tracer) Close() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	t.closed = true
+	close(t.spans)
+	t.mu.Unlock()
+
+	<-t.done
+	if err := t.exporter.Close(); err != nil {
+		logs.With(logs.Node, t.node).Errorf("Failed to close span exporter: %s", err.Error())
+	}
+}
+
+func (t *Tracer) export(s Span) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		droppedSpans.Inc()
+		return
+	}
+
+	select {
+	case t.spans <- s:
+	default:
+		droppedSpans.Inc()
+	}
+}
+
+// run exports spans whenever a batch is full, and every interval.
+func (t *Tracer) run() {
+	defer close(t.done)
+
+	batch := make([]Span, 0, t.batchSize)
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.exporter.Export(t.service, batch); err != nil {
+			logs.With(logs.Node, t.node).Errorf("Failed to export %d spans: %s", len(batch), err.Error())
+			droppedSpans.Add(float64(len(batch)))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case s, ok := <-t.spans:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, s)
+			if len(batch) >= t.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package tracing
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tp1/pkg/amqp"
+	"tp1/pkg/message"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testHeader(traceId, spanId string) amqp.Header {
+	return amqp.Header{SequenceId: "uuid-7", ClientId: "0-1", MessageId: message.GameId, TraceId: traceId, SpanId: spanId}
+}
+
+func readSpans(t *testing.T, path string) []Span {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var spans []Span
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var s Span
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &s))
+		spans = append(spans, s)
+	}
+	return spans
+}
+
+func TestNilTracerDoesNothing(t *testing.T) {
+	var tracer *Tracer
+	assert.Empty(t, tracer.NewTrace())
+
+	span := tracer.Start("process", testHeader(NewTraceId(), ""))
+	assert.Nil(t, span)
+	header := testHeader("", "")
+	assert.Equal(t, header, span.Header(header))
+	span.Finish("key-1")
+	span.Fail(errors.New("failed"))
+	tracer.Close()
+}
+
+func TestUntracedMessagesGetNoSpan(t *testing.T) {
+	exporter, err := newFileExporter(filepath.Join(t.TempDir(), "traces.json"))
+	require.NoError(t, err)
+	tracer := newTracer(exporter, "action-filter", "action-filter-1", 16, time.Hour, 16)
+	defer tracer.Close()
+
+	assert.Nil(t, tracer.Start("process", testHeader("", "")))
+}
+
+func TestSpansAreChainedAndExportedToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.json")
+	exporter, err := newFileExporter(path)
+	require.NoError(t, err)
+	tracer := newTracer(exporter, "action-filter", "action-filter-1", 16, time.Hour, 16)
+
+	traceId := tracer.NewTrace()
+	root := tracer.Start("batch", testHeader(traceId, ""))
+	header := root.Header(testHeader(traceId, ""))
+	root.Finish("games-action-0")
+
+	child := tracer.Start("process", header)
+	child.Fail(errors.New("failed to publish message"))
+	tracer.Close()
+
+	spans := readSpans(t, path)
+	require.Len(t, spans, 2)
+	assert.Equal(t, traceId, spans[0].TraceId)
+	assert.Empty(t, spans[0].ParentSpanId)
+	assert.Equal(t, []string{"games-action-0"}, spans[0].Outputs)
+	assert.Equal(t, traceId, spans[1].TraceId)
+	assert.Equal(t, spans[0].SpanId, spans[1].ParentSpanId)
+	assert.Equal(t, "action-filter-1", spans[1].Node)
+	assert.Equal(t, "uuid-7", spans[1].SequenceId)
+	assert.Equal(t, "failed to publish message", spans[1].Error)
+}
+
+func TestSpansArePostedToCollector(t *testing.T) {
+	requests := make(chan exportRequest, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req exportRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, jsonMediaType, r.Header.Get("Content-Type"))
+		requests <- req
+	}))
+	defer collector.Close()
+
+	tracer := newTracer(newOtlpExporter(collector.URL), "counter-joiner", "counter-joiner-1", 1, time.Hour, 16)
+	tracer.Start("process", testHeader(NewTraceId(), "00f067aa0ba902b7")).Finish("joined_reviews_0-3")
+	tracer.Close()
+
+	req := <-requests
+	require.Len(t, req.ResourceSpans, 1)
+	assert.Equal(t, "counter-joiner", *req.ResourceSpans[0].Resource.Attributes[0].Value.StringValue)
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	require.Len(t, spans, 1)
+	assert.Equal(t, "00f067aa0ba902b7", spans[0].ParentSpanId)
+	assert.Len(t, spans[0].TraceId, 32)
+	assert.Len(t, spans[0].SpanId, 16)
+	assert.Nil(t, spans[0].Status)
+}
+
+func TestSpansAreDroppedWhenBufferIsFull(t *testing.T) {
+	tracer := &Tracer{spans: make(chan Span, 1)}
+	tracer.export(Span{})
+	tracer.export(Span{})
+	assert.Len(t, tracer.spans, 1)
+}
+
+func TestSpansFinishedAfterCloseAreDropped(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.json")
+	exporter, err := newFileExporter(path)
+	require.NoError(t, err)
+	tracer := newTracer(exporter, "gateway", "gateway-1", 16, time.Hour, 16)
+
+	span := tracer.Start("batch", testHeader(NewTraceId(), ""))
+	tracer.Close()
+	span.Finish()
+
+	assert.Empty(t, readSpans(t, path))
+}
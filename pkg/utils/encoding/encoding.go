@@ -3,6 +3,7 @@ package encoding
 import (
 	"bytes"
 	"encoding/binary"
+	"io"
 )
 
 func EncodeBool(buf *bytes.Buffer, data bool) error {
@@ -72,6 +73,9 @@ func DecodeString(buf *bytes.Buffer) (string, error) {
 	if err := binary.Read(buf, binary.BigEndian, &size); err != nil {
 		return "", err
 	}
+	if int(size) > buf.Len() {
+		return "", io.ErrUnexpectedEOF
+	}
 
 	aux := make([]byte, size)
 	i := uint32(0)
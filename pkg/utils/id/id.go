@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"sync"
 
 	"tp1/pkg/logs"
 	ioutils "tp1/pkg/utils/io"
@@ -21,13 +22,17 @@ const (
 	idParts     = 2
 )
 
+// Generator hands out ids, persisting the next one. It is safe for concurrent use.
 type Generator struct {
+	mu     sync.Mutex
 	file   *ioutils.File
+	syncer *ioutils.Syncer
 	prefix uint8
 	nextId uint16
 }
 
-func NewGenerator(prefix uint8, fileName string) *Generator {
+// NewGenerator creates a new id generator, which persists the next id in fileName and syncs it according to policy.
+func NewGenerator(prefix uint8, fileName string, policy ioutils.SyncPolicy) *Generator {
 	if fileName == "" {
 		fileName = defaultFile
 	}
@@ -40,29 +45,37 @@ func NewGenerator(prefix uint8, fileName string) *Generator {
 
 	return &Generator{
 		file:   file,
+		syncer: ioutils.NewSyncer(policy, file.Sync),
 		prefix: prefix,
 		nextId: loadFromDisk(file),
 	}
 }
 
 // GetId returns a new id. The format of the id is prefix-nextId
-func (g *Generator) GetId() string {
+// It blocks until the next id is synced to disk, so that an id handed out is never handed out again after a crash.
+// With SyncGroup, ids requested concurrently get synced together.
+func (g *Generator) GetId() (string, error) {
+	g.mu.Lock()
 	id := strconv.Itoa(int(g.prefix)) + Separator + strconv.Itoa(int(g.nextId))
 	g.nextId++
-
-	err := g.writeToDisk()
+	err := g.file.Overwrite([]string{strconv.Itoa(int(g.nextId))})
+	g.mu.Unlock()
 	if err != nil {
-		logs.Logger.Errorf("Error writing id to file: %v", err)
+		return "", fmt.Errorf("error writing id to file: %w", err)
 	}
 
-	return id
-}
+	// Any sync from now on persists this id or a later one.
+	synced := make(chan error, 1)
+	g.syncer.Written(func(err error) { synced <- err })
+	if err = <-synced; err != nil {
+		return "", fmt.Errorf("error syncing id file: %w", err)
+	}
 
-func (g *Generator) writeToDisk() error {
-	return g.file.Overwrite([]string{strconv.Itoa(int(g.nextId))})
+	return id, nil
 }
 
 func (g *Generator) Close() {
+	g.syncer.Flush()
 	g.file.Close()
 }
 
@@ -2,13 +2,17 @@ package id
 
 import (
 	"os"
+	"sync"
 	"testing"
+	"time"
+
+	ioutils "tp1/pkg/utils/io"
 )
 
 func TestIdGeneratorReturnsCorrectIdFormat(t *testing.T) {
-	g := NewGenerator(1, "test-%d.csv")
+	g := NewGenerator(1, "test-%d.csv", ioutils.SyncPolicy{Mode: ioutils.SyncAlways})
 	expected := "1-0"
-	if id := g.GetId(); id != expected {
+	if id, _ := g.GetId(); id != expected {
 		t.Errorf("Expected id %s, got %s", expected, id)
 	}
 	g.Close()
@@ -16,10 +20,10 @@ func TestIdGeneratorReturnsCorrectIdFormat(t *testing.T) {
 }
 
 func TestIdGeneratorIncrementsId(t *testing.T) {
-	g := NewGenerator(0, "test-%d.csv")
-	g.GetId() // 0-0
+	g := NewGenerator(0, "test-%d.csv", ioutils.SyncPolicy{Mode: ioutils.SyncAlways})
+	_, _ = g.GetId() // 0-0
 	expected := "0-1"
-	if id := g.GetId(); id != expected {
+	if id, _ := g.GetId(); id != expected {
 		t.Errorf("Expected id %s, got %s", expected, id)
 	}
 	g.Close()
@@ -27,21 +31,46 @@ func TestIdGeneratorIncrementsId(t *testing.T) {
 }
 
 func TestPersistentIdGeneratorIncrementsId(t *testing.T) {
-	g := NewGenerator(0, "test-%d.csv")
-	g.GetId() // 0-0
+	g := NewGenerator(0, "test-%d.csv", ioutils.SyncPolicy{Mode: ioutils.SyncAlways})
+	_, _ = g.GetId() // 0-0
 	expected := "0-1"
-	if id := g.GetId(); id != expected {
+	if id, _ := g.GetId(); id != expected {
 		t.Errorf("Expected id %s, got %s", expected, id)
 	}
 	g.Close()
 
-	g2 := NewGenerator(0, "test-%d.csv")
-	g2.GetId() // 0-0
+	g2 := NewGenerator(0, "test-%d.csv", ioutils.SyncPolicy{Mode: ioutils.SyncAlways})
 	expected2 := "0-2"
-	if id := g.GetId(); id != expected2 {
+	if id, _ := g2.GetId(); id != expected2 {
 		t.Errorf("Expected id %s, got %s", expected2, id)
 	}
+	g2.Close()
+	resetFiles()
+}
+
+func TestGroupSyncedIdsArePersistedOnceHandedOut(t *testing.T) {
+	policy := ioutils.SyncPolicy{Mode: ioutils.SyncGroup, Records: 4, Interval: 10 * time.Millisecond}
+	g := NewGenerator(0, "test-%d.csv", policy)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := g.GetId(); err != nil {
+				t.Errorf("Unexpected error getting id: %s", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	g2 := NewGenerator(0, "test-%d.csv", policy)
+	expected := "0-2"
+	if id, _ := g2.GetId(); id != expected {
+		t.Errorf("Expected id %s, got %s", expected, id)
+	}
 	g.Close()
+	g2.Close()
 	resetFiles()
 }
 
@@ -46,6 +46,11 @@ func (r *File) Write(record []string) error {
 	return r.w.Write(record)
 }
 
+// Sync commits the contents of the file to disk.
+func (r *File) Sync() error {
+	return r.file.Sync()
+}
+
 // Close closes the underlying file associated with the File and logs an error if the file cannot be closed.
 func (r *File) Close() {
 	if err := r.file.Close(); err != nil {
@@ -55,6 +60,11 @@ func (r *File) Close() {
 
 // Overwrite overwrites the file with the given strings.
 func (r *File) Overwrite(strings []string) error {
+	return r.OverwriteAll([][]string{strings})
+}
+
+// OverwriteAll overwrites the file with the given records.
+func (r *File) OverwriteAll(records [][]string) error {
 	if err := r.file.Truncate(0); err != nil {
 		return err
 	}
@@ -62,5 +72,5 @@ func (r *File) Overwrite(strings []string) error {
 		return err
 	}
 
-	return r.Write(strings)
+	return r.w.WriteAll(records)
 }
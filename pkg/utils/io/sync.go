@@ -0,0 +1,122 @@
+package io
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"tp1/pkg/config"
+)
+
+// SyncMode defines when writes to a file get synced to disk.
+type SyncMode string
+
+const (
+	SyncNone   SyncMode = "none"   // SyncNone leaves syncing to the OS. Writes may be lost if the host crashes.
+	SyncAlways SyncMode = "always" // SyncAlways syncs after every write.
+	SyncGroup  SyncMode = "group"  // SyncGroup syncs many writes at once, every N writes or T milliseconds.
+
+	syncModeKey     = "policy"
+	syncRecordsKey  = "records"
+	syncIntervalKey = "interval-ms"
+
+	defaultSyncRecords  = 64
+	defaultSyncInterval = 50
+)
+
+// SyncPolicy defines when writes to a file get synced to disk.
+type SyncPolicy struct {
+	Mode     SyncMode
+	Records  int           // Records is the amount of writes synced at once with SyncGroup.
+	Interval time.Duration // Interval is the longest a write waits to be synced with SyncGroup.
+}
+
+// SyncPolicyFromConfig reads a policy from the `policy`, `records` and `interval-ms` keys of the given section.
+// SyncNone is used if the section is missing.
+func SyncPolicyFromConfig(cfg config.Config, section string) (SyncPolicy, error) {
+	policy := SyncPolicy{
+		Mode:     SyncMode(cfg.String(section+"."+syncModeKey, string(SyncNone))),
+		Records:  cfg.Int(section+"."+syncRecordsKey, defaultSyncRecords),
+		Interval: time.Duration(cfg.Int64(section+"."+syncIntervalKey, defaultSyncInterval)) * time.Millisecond,
+	}
+
+	switch policy.Mode {
+	case SyncNone, SyncAlways:
+	case SyncGroup:
+		if policy.Records <= 0 || policy.Interval <= 0 {
+			return policy, fmt.Errorf("%s: records and interval must be positive", section)
+		}
+	default:
+		return policy, fmt.Errorf("%s: unknown sync policy %q", section, policy.Mode)
+	}
+
+	return policy, nil
+}
+
+// Syncer syncs a file according to a SyncPolicy. Each write is registered along with a callback, which gets called
+// once the write is durable.
+type Syncer struct {
+	mu      sync.Mutex
+	policy  SyncPolicy
+	sync    func() error
+	pending []func(error)
+	timer   *time.Timer
+}
+
+// NewSyncer creates a Syncer which syncs by calling sync.
+func NewSyncer(policy SyncPolicy, sync func() error) *Syncer {
+	return &Syncer{policy: policy, sync: sync}
+}
+
+// Written registers a finished write. done, unless nil, is called with the syncing error once the write is durable.
+// With SyncGroup it may be called from another goroutine, once the group gets synced. Otherwise, it gets called
+// before Written returns.
+func (s *Syncer) Written(done func(error)) {
+	switch s.policy.Mode {
+	case SyncAlways:
+		err := s.sync()
+		if done != nil {
+			done(err)
+		}
+	case SyncGroup:
+		s.mu.Lock()
+		s.pending = append(s.pending, done)
+		if len(s.pending) < s.policy.Records {
+			if s.timer == nil {
+				s.timer = time.AfterFunc(s.policy.Interval, s.Flush)
+			}
+			s.mu.Unlock()
+			return
+		}
+		s.mu.Unlock()
+		s.Flush()
+	default:
+		if done != nil {
+			done(nil)
+		}
+	}
+}
+
+// Flush syncs every pending write right away, calling their callbacks.
+func (s *Syncer) Flush() {
+	s.mu.Lock()
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if len(s.pending) == 0 {
+		s.mu.Unlock()
+		return
+	}
+
+	err := s.sync()
+	pending := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	for _, done := range pending {
+		if done != nil {
+			done(err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package io
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncerAlwaysSyncsEveryWrite(t *testing.T) {
+	var syncs atomic.Int32
+	s := NewSyncer(SyncPolicy{Mode: SyncAlways}, func() error {
+		syncs.Add(1)
+		return nil
+	})
+
+	done := false
+	s.Written(func(error) { done = true })
+
+	assert.True(t, done)
+	assert.Equal(t, int32(1), syncs.Load())
+}
+
+func TestSyncerGroupSyncsOnceEveryRecords(t *testing.T) {
+	var syncs atomic.Int32
+	s := NewSyncer(SyncPolicy{Mode: SyncGroup, Records: 3, Interval: time.Hour}, func() error {
+		syncs.Add(1)
+		return nil
+	})
+
+	var done atomic.Int32
+	for i := 0; i < 2; i++ {
+		s.Written(func(error) { done.Add(1) })
+	}
+	assert.Equal(t, int32(0), done.Load())
+	assert.Equal(t, int32(0), syncs.Load())
+
+	s.Written(func(error) { done.Add(1) })
+	assert.Equal(t, int32(3), done.Load())
+	assert.Equal(t, int32(1), syncs.Load())
+}
+
+func TestSyncerGroupSyncsAfterInterval(t *testing.T) {
+	s := NewSyncer(SyncPolicy{Mode: SyncGroup, Records: 100, Interval: 10 * time.Millisecond}, func() error {
+		return nil
+	})
+
+	done := make(chan struct{})
+	s.Written(func(error) { close(done) })
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected write to be synced after the interval")
+	}
+}
+
+func TestSyncerFlushSyncsPendingWrites(t *testing.T) {
+	var syncs atomic.Int32
+	s := NewSyncer(SyncPolicy{Mode: SyncGroup, Records: 100, Interval: time.Hour}, func() error {
+		syncs.Add(1)
+		return nil
+	})
+
+	var done atomic.Int32
+	s.Written(func(error) { done.Add(1) })
+	s.Flush()
+	s.Flush()
+
+	assert.Equal(t, int32(1), done.Load())
+	assert.Equal(t, int32(1), syncs.Load())
+}
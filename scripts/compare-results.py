@@ -1,8 +1,12 @@
+import json
 import sys
 import re
 
 
 def parse_file(filename):
+    if filename.endswith(".json"):
+        return parse_json_file(filename)
+
     with open(filename, "r") as file:
         content = file.read()
 
@@ -26,6 +30,23 @@ def parse_file(filename):
     return parsed_data
 
 
+def parse_json_file(filename):
+    with open(filename, "r") as file:
+        results = json.load(file)
+
+    parsed_data = {}
+    for q_key, result in results.items():
+        if "platforms" in result:
+            rows = [result["platforms"]]
+        else:
+            rows = result.get("releases") or result.get("reviews") or result.get("games") or []
+        parsed_data[q_key] = sorted(
+            json.dumps(row, sort_keys=True, ensure_ascii=False) for row in rows
+        )
+
+    return parsed_data
+
+
 def compare_files(file_list):
     parsed_files = {filename: parse_file(filename) for filename in file_list}
     reference_filename = file_list[0]
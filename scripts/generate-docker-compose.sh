@@ -1,3 +1,3 @@
 #!/bin/bash
 
-python3 generate_docker_compose.py 
\ No newline at end of file
+go run ../cmd/topology generate -out .. ../configs/topology.json
@@ -1,5 +1,6 @@
 import re
 import os
+import shutil
 
 with open('../docker-compose.yaml', 'r') as file:
     docker_compose_content = file.read()
@@ -10,5 +11,9 @@ volumes = volume_pattern.findall(docker_compose_content)
 
 for volume in volumes:
     host_path = volume.split(':')[0].strip('- ')
+    if host_path.endswith('/'): # snapshot directories are emptied, just like recovery files
+        shutil.rmtree('.' + host_path, ignore_errors=True)
+        os.makedirs('.' + host_path)
+        continue
     with open( '.' + host_path, 'w') as f:
         pass
\ No newline at end of file